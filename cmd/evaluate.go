@@ -0,0 +1,64 @@
+// Copyright © 2018 Radomirs Cirskis <nad2000@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"extract-blocks/model"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// evaluateCmd represents the evaluate command
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate",
+	Short: "Evaluate the answer cells against the model answers",
+	Long: `Compares the cells of all processed student answers with the matching model answer
+cells (the same question, worksheet index and cell range) and populates AutoEvaluation:
+
+  - IsValueCorrect   - the cell value matches the model answer cell value;
+  - IsFormulaCorrect - the cell formula in R1C1 notation matches the model answer cell formula;
+  - IsHardcoded      - a constant was entered where the model answer has a formula;
+  - is_carried_forward_correct - the cell value matches the model answer formula recomputed
+    with the answer precedent cell values (error carried forward).
+
+Existing evaluation entries get updated, so the command can be re-run safely.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		model.DebugLevel, model.VerboseLevel = debugLevel, verboseLevel
+		getConfig()
+		debugCmd(cmd)
+
+		var err error
+		Db, err = model.OpenDb(url)
+		if err != nil {
+			log.Error(err)
+			log.Fatalf("Failed to connect database %q", url)
+		}
+		defer Db.Close()
+		if debugLevel > 1 {
+			Db.LogMode(true)
+		}
+
+		if err := model.EvaluateAnswers(assignmentID, modelAnswerUserID); err != nil {
+			log.WithError(err).Fatalln("Failed to evaluate the answers.")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(evaluateCmd)
+	flags := evaluateCmd.Flags()
+	flags.IntVarP(&assignmentID, "assignment", "a", -1, "The assignment ID to process (-1 - process all assignments)")
+}
@@ -0,0 +1,98 @@
+// Copyright © 2018 Radomirs Cirskis <nad2000@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"extract-blocks/model"
+	"io"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	graphAnswerID int
+	graphFormat   string
+	graphOutput   string
+	graphCells    bool
+)
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Export the formula dependency graph of an answer",
+	Long: `Exports the precedent/dependent graph of the blocks (or the cells) of the processed
+answer workbook extracted with the "run" command as Graphviz DOT or JSON, eg:
+
+  extract-blocks graph -A 42 | dot -Tsvg > answer.svg
+
+The edges are directed from the precedents to the dependents, the block graph edges are
+labeled with the number of the cell references.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		model.DebugLevel, model.VerboseLevel = debugLevel, verboseLevel
+		getConfig()
+		debugCmd(cmd)
+
+		if graphFormat != "dot" && graphFormat != "json" {
+			log.Fatalf("Unknown graph format %q, expected \"dot\" or \"json\".", graphFormat)
+		}
+		var err error
+		Db, err = model.OpenDb(url)
+		if err != nil {
+			log.Error(err)
+			log.Fatalf("Failed to connect database %q", url)
+		}
+		defer Db.Close()
+		if debugLevel > 1 {
+			Db.LogMode(true)
+		}
+
+		g, err := model.AnswerDependencyGraph(graphAnswerID, graphCells)
+		if err != nil {
+			log.WithError(err).Fatalln("Failed to retrieve the dependency graph.")
+		}
+		var w io.Writer = os.Stdout
+		if graphOutput != "" && graphOutput != "-" {
+			f, err := os.Create(graphOutput)
+			if err != nil {
+				log.WithError(err).Fatalf("Failed to create the file %q", graphOutput)
+			}
+			defer f.Close()
+			w = f
+		}
+		if graphFormat == "json" {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(g)
+		} else {
+			err = g.WriteDOT(w)
+		}
+		if err != nil {
+			log.WithError(err).Fatalln("Failed to write the dependency graph.")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(graphCmd)
+	flags := graphCmd.Flags()
+	flags.IntVarP(&graphAnswerID, "answer", "A", 0, "The answer ID (StudentAnswerID)")
+	flags.StringVarP(&graphFormat, "format", "F", "dot", "The output format: dot or json")
+	flags.StringVarP(&graphOutput, "output", "o", "", "The output file (default: the standard output)")
+	flags.BoolVar(&graphCells, "cells", false, "Export the cell graph instead of the block graph")
+	graphCmd.MarkFlagRequired("answer")
+}
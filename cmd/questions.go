@@ -73,7 +73,7 @@ func HandleQuestions(manager s3.FileManager) error {
 		}
 		log.Infof("Processing %q", fileName)
 
-		if err := q.ImportFile(fileName, color, verbose, skipHidden); err != nil {
+		if err := q.ImportFile(fileName, blockColors(), verbose, skipHidden); err != nil {
 			log.WithError(err).Errorf("Failed to import %q for the question %#v", fileName, q)
 			continue
 		}
@@ -97,6 +97,6 @@ func HandleQuestions(manager s3.FileManager) error {
 func init() {
 	RootCmd.AddCommand(questionsCmd)
 	flags := questionsCmd.Flags()
-	flags.StringVarP(&color, "color", "c", defaultColor, "The block filling color")
+	flags.StringVarP(&color, "color", "c", defaultColor, "The block filling color or the color palette, e.g., FFFFFF00=calculation,FF00FF00=input,FF0000FF=formatting")
 	viper.BindPFlag("color", flags.Lookup("color"))
 }
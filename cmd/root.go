@@ -81,6 +81,7 @@ func getConfig() {
 	awsSecretAccessKey = viper.GetString("aws-secret-access-key")
 	url = viper.GetString("url")
 	// color = viper.GetString("color")
+	model.ColorTolerance = viper.GetFloat64("color-tolerance")
 	force = viper.GetBool("force")
 	dest = viper.GetString("dest")
 	skipHidden = viper.GetBool("skip-hidden")
@@ -91,6 +92,15 @@ func getConfig() {
 	}
 }
 
+// blockColors returns the block color palette, eg, "FFFFFF00=calculation,FF00FF00=input,FF0000FF=formatting",
+// if it's set and the block color is not given, otherwise the block color (or the palette given with it).
+func blockColors() string {
+	if palette := viper.GetString("palette"); palette != "" && color == defaultColor {
+		return palette
+	}
+	return color
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -118,12 +128,16 @@ func init() {
 	flags.String("aws-access-key-id", "", "AWS Access Key ID.")
 	flags.String("aws-secret-access-key", "", "AWS Secret Access Key.")
 	flags.String("dest", os.TempDir(), "The destionation directory for download files from AWS S3.")
+	flags.String("palette", "", "The block color palette used unless the block color is given, e.g., FFFFFF00=calculation,FF00FF00=input,FF0000FF=formatting.")
+	flags.Float64("color-tolerance", 0, "The maximum RGB distance (0..441) between the block filling colors considered the same (0 - exact match).")
 
 	viper.BindPFlag("url", flags.Lookup("url"))
 	viper.BindPFlag("aws-profile", flags.Lookup("aws-profile"))
 	viper.BindPFlag("aws-region", flags.Lookup("aws-region"))
 	viper.BindPFlag("aws-access-key-id", flags.Lookup("aws-access-key-id"))
 	viper.BindPFlag("aws-secret-access-key", flags.Lookup("aws-secret-access-key"))
+	viper.BindPFlag("palette", flags.Lookup("palette"))
+	viper.BindPFlag("color-tolerance", flags.Lookup("color-tolerance"))
 	viper.BindEnv("aws-region", "AWS_REGION")
 	viper.BindEnv("aws-access-key-id", "AWS_ACCESS_KEY_ID")
 	viper.BindEnv("aws-secret-access-key", "AWS_SECRET_ACCESS_KEY")
@@ -48,8 +48,9 @@ func init() {
 	flags := runCmd.Flags()
 
 	flags.BoolP("force", "f", false, "Repeat extraction if files were already handle.")
-	flags.StringP("color", "c", defaultColor, "The block filling color.")
+	flags.StringP("color", "c", defaultColor, "The block filling color or the color palette, e.g., FFFFFF00=calculation,FF00FF00=input,FF0000FF=formatting.")
 	flags.IntVarP(&assignmentID, "assignment", "a", -1, "The assignment ID to process (-1 - process all assignments)")
+	flags.BoolVar(&model.DiscoverBlocks, "discover", false, "Discover the blocks ignoring the filling colors (by default used only if no color-coded block was found in the workbook).")
 
 	viper.BindPFlag("color", flags.Lookup("color"))
 	viper.BindPFlag("force", flags.Lookup("force"))
@@ -93,7 +94,7 @@ func extractBlocks(cmd *cobra.Command, args []string) {
 			if !model.DryRun {
 				Db.FirstOrCreate(&a, &a)
 			}
-			model.ExtractBlocksFromFile(excelFileName, color, force, verbose, skipHidden, a.ID)
+			model.ExtractBlocksFromFile(excelFileName, blockColors(), force, verbose, skipHidden, a.ID)
 		}
 	} else {
 		manager := createManager()
@@ -132,7 +133,7 @@ func HandleAnswers(manager s3.FileManager) error {
 			continue
 		}
 		log.Infof("Processing %q", fileName)
-		if _, err := model.ExtractBlocksFromFile(fileName, color, force, verbose, skipHidden, r.StudentAnswerID); err != nil {
+		if _, err := model.ExtractBlocksFromFile(fileName, blockColors(), force, verbose, skipHidden, r.StudentAnswerID); err != nil {
 			log.WithError(err).Errorln("Failed to process file: ", fileName)
 		} else {
 			fileCount++
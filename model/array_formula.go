@@ -0,0 +1,227 @@
+package model
+
+import (
+	x "extract-blocks/model/xlsx"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/xlsx"
+)
+
+// formulaDetails - the formula attributes of the cell the xlsx library leaves out
+type formulaDetails struct {
+	Type     string // shared, array, dataTable or "" (normal formula)
+	Ref      string // the range of the shared or array formula or the data table
+	Original string // the formula as entered if it got rewritten, eg, with the structured references resolved
+}
+
+// workbookFormulas - the formula details of the workbook cells (see openWorkbook)
+type workbookFormulas map[*xlsx.Cell]formulaDetails
+
+// sheetCell returns the cell (zero based indexes) of the sheet or nil if it's missing.
+// NB! sheet.Cell would extend the sheet if the cell is missing
+func sheetCell(sheet *xlsx.Sheet, rowIndex, colIndex int) *xlsx.Cell {
+	if rowIndex < 0 || rowIndex >= len(sheet.Rows) || sheet.Rows[rowIndex] == nil ||
+		colIndex < 0 || colIndex >= len(sheet.Rows[rowIndex].Cells) {
+		return nil
+	}
+	return sheet.Rows[rowIndex].Cells[colIndex]
+}
+
+// setFormula replaces the formula of the cell keeping the cell type and the value
+// (the xlsx library formula setters reset the type).
+func setFormula(cell *xlsx.Cell, formula string) {
+	switch cell.Type() {
+	case xlsx.CellTypeNumeric:
+		cell.SetFormula(formula)
+	case xlsx.CellTypeBool:
+		b := cell.Bool()
+		cell.SetFormula(formula)
+		cell.SetBool(b)
+	default:
+		cell.SetStringFormula(formula)
+	}
+}
+
+// shift returns the cell reference shifted by the rows and the columns
+// unless the row or the column is absolute.
+func (c CellReference) shift(rows, cols int) CellReference {
+	if c.Row >= 0 && !c.AbsRow {
+		c.Row += rows
+	}
+	if c.Col >= 0 && !c.AbsCol {
+		c.Col += cols
+	}
+	return c
+}
+
+// shiftFormula shifts the relative references of the formula by the rows and the columns,
+// eg, the shared formula of the master cell for the other cells of the shared formula range.
+func shiftFormula(formula string, rows, cols int) string {
+	tokens, err := Tokenize(formula)
+	if err != nil {
+		if DebugLevel > 1 {
+			log.WithError(err).Debugf("Failed to tokenize formula %q", formula)
+		}
+		return formula
+	}
+	var sb strings.Builder
+	for _, t := range tokens {
+		if t.Type != TokenReference {
+			sb.WriteString(t.Value)
+			continue
+		}
+		ref, err := ParseReference(t.Value)
+		if err != nil || ref.IsError {
+			sb.WriteString(t.Value)
+			continue
+		}
+		ref.From, ref.To = ref.From.shift(rows, cols), ref.To.shift(rows, cols)
+		sb.WriteString(ref.String())
+	}
+	return sb.String()
+}
+
+// resolveFormulas records the formula types and ranges of the sheet cells and expands
+// the shared formulas (only the master cell of the shared formula carries the text).
+func resolveFormulas(sheet *xlsx.Sheet, ws *x.Worksheet, formulas workbookFormulas) {
+	type sharedFormula struct {
+		rowIndex, colIndex int
+		formula            string
+	}
+	masters := make(map[string]sharedFormula)
+	var shared []sharedFormula // the cells with the shared index instead of the formula
+	for _, row := range ws.SheetData.Row {
+		for _, c := range row.C {
+			if c.F == nil {
+				continue
+			}
+			colIndex, rowIndex, err := xlsx.GetCoordsFromCellIDString(c.R)
+			if err != nil {
+				continue
+			}
+			cell := sheetCell(sheet, rowIndex, colIndex)
+			if cell == nil {
+				continue
+			}
+			formulas[cell] = formulaDetails{Type: c.F.T, Ref: c.F.Ref}
+			if c.F.T == "dataTable" {
+				// the data table range shares the formula, eg, {=TABLE(,B3)}
+				formula, _, _ := dataTableFormula(c.F.Dt2D == "1" || c.F.Dt2D == "true",
+					c.F.Dtr == "1" || c.F.Dtr == "true", c.F.R1, c.F.R2)
+				setFormula(cell, formula)
+				continue
+			}
+			if c.F.T != "shared" {
+				continue
+			}
+			if formula := strings.TrimSpace(c.F.Text); formula != "" {
+				masters[c.F.Si] = sharedFormula{rowIndex, colIndex, formula}
+			} else {
+				shared = append(shared, sharedFormula{rowIndex, colIndex, c.F.Si})
+			}
+		}
+	}
+	for _, sf := range shared {
+		master, ok := masters[sf.formula]
+		if !ok {
+			log.Warnf("The master cell of the shared formula %q is missing in %q", sf.formula, sheet.Name)
+			continue
+		}
+		setFormula(sheet.Rows[sf.rowIndex].Cells[sf.colIndex],
+			shiftFormula(master.formula, sf.rowIndex-master.rowIndex, sf.colIndex-master.colIndex))
+	}
+}
+
+// originalFormula returns the formula of the cell as entered if it got rewritten
+// at the import, eg, with the structured references resolved.
+func originalFormula(cell *xlsx.Cell, formulas workbookFormulas) string {
+	return formulas[cell].Original
+}
+
+// arrayRange returns the range (zero based indexes) of the array formula (CSE or
+// dynamic array spill) or the data table if the cell is the top-left cell of it.
+func arrayRange(cell *xlsx.Cell, formulas workbookFormulas) (tRow, lCol, bRow, rCol int, ok bool) {
+	f := formulas[cell]
+	if f.Type != "array" && f.Type != "dataTable" || f.Ref == "" {
+		return
+	}
+	ref, err := ParseReference(f.Ref)
+	if err != nil || ref.IsError || ref.From.Row < 0 || ref.From.Col < 0 {
+		return
+	}
+	tRow, lCol, bRow, rCol = ref.From.Row, ref.From.Col, ref.From.Row, ref.From.Col
+	if ref.IsRange {
+		bRow, rCol = ref.To.Row, ref.To.Col
+	}
+	return tRow, lCol, bRow, rCol, true
+}
+
+// arrayFormulas maps all the cells of the array formula ranges of the sheet
+// to the array formulas (only the top-left cell of the range carries the formula).
+func arrayFormulas(sheet *xlsx.Sheet, formulas workbookFormulas) map[[2]int]string {
+	arrays := make(map[[2]int]string)
+	for _, row := range sheet.Rows {
+		for _, cell := range row.Cells {
+			if tRow, lCol, bRow, rCol, ok := arrayRange(cell, formulas); ok {
+				for r := tRow; r <= bRow; r++ {
+					for c := lCol; c <= rCol; c++ {
+						arrays[[2]int{r, c}] = cell.Formula()
+					}
+				}
+			}
+		}
+	}
+	return arrays
+}
+
+// expandArray extends the block to the whole range of the array formula
+// if the block top-left cell contains one. The range gets limited to
+// the reference block (if it's given).
+func (b *Block) expandArray(sheet *xlsx.Sheet, formulas workbookFormulas, rb *Block) bool {
+	// NB! sheet.Cell would extend the sheet if the cell is missing
+	if b.TRow >= len(sheet.Rows) || b.LCol >= len(sheet.Rows[b.TRow].Cells) {
+		return false
+	}
+	tRow, lCol, bRow, rCol, ok := arrayRange(sheet.Rows[b.TRow].Cells[b.LCol], formulas)
+	if !ok || tRow != b.TRow || lCol != b.LCol {
+		return false
+	}
+	if rb != nil {
+		bRow, rCol = minInt(bRow, rb.BRow), minInt(rCol, rb.RCol)
+	}
+	b.BRow, b.RCol, b.IsArray = bRow, rCol, true
+	return true
+}
+
+// cellFormula returns the formula of the block cell, all the cells of
+// the array formula block share the same formula.
+func (b *Block) cellFormula(cell *xlsx.Cell) string {
+	if b.IsArray {
+		return b.Formula
+	}
+	return cell.Formula()
+}
+
+// storeCells stores all the block cells.
+func (b *Block) storeCells(sheet *xlsx.Sheet, formulas workbookFormulas) {
+	if DryRun {
+		return
+	}
+	for r := b.TRow; r <= b.BRow; r++ {
+		for c := b.LCol; c <= b.RCol; c++ {
+			cell := sheet.Cell(r, c)
+			bc := Cell{
+				BlockID:         NewNullInt64(b.ID),
+				WorksheetID:     b.WorksheetID,
+				Formula:         b.cellFormula(cell),
+				OriginalFormula: originalFormula(cell, formulas),
+				Value:           cellValue(cell),
+				Range:           CellAddress(r, c),
+			}
+			if err := Db.FirstOrCreate(&bc, bc).Error; err != nil {
+				log.WithError(err).Error("Failed to create a cell: ", bc)
+			}
+		}
+	}
+}
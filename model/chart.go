@@ -0,0 +1,298 @@
+package model
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/excelize"
+)
+
+// ChartSeries - a chart data series
+type ChartSeries struct {
+	ID               int
+	ChartID          int `gorm:"index"`
+	Idx              int
+	Order            int
+	Type             string // the chart type of the series, it might differ in the combo charts
+	Name             string // the series name or the cached value of the name reference
+	NameRef          string
+	CategoryRange    string
+	ValueRange       string
+	XRange           string
+	YRange           string
+	AxisGroup        string `gorm:"type:varchar(10)"` // primary or secondary
+	TrendlineType    string `gorm:"type:varchar(20)"` // linear, exp, log, movingAvg, poly, power
+	TrendlineOptions string // eg, order=2,forward=1,intercept=0,R²,equation
+	DataLabels       string // the shown data label content, eg, value,category
+}
+
+// TableName overrides default table name for the model
+func (ChartSeries) TableName() string {
+	return "ChartSeries"
+}
+
+// chartTypeName maps the chart element name to the chart type, eg, c:barChart -> Bar (or Column)
+func chartTypeName(elementName, barDir string) string {
+	name := strings.Title(strings.TrimSuffix(elementName, "Chart"))
+	if name == "Bar" && barDir == "col" {
+		return "Column"
+	}
+	return name
+}
+
+// legendPositions - the legend position names
+var legendPositions = map[string]string{
+	"b":  "bottom",
+	"l":  "left",
+	"r":  "right",
+	"t":  "top",
+	"tr": "top right",
+}
+
+// legendPosition returns the legend position of the chart or "" if there is no legend.
+func (cs *xlsxChartSpace) legendPosition() string {
+	if cs.Legend == nil {
+		return ""
+	}
+	if cs.Legend.Position == nil || cs.Legend.Position.Value == "" {
+		return "right"
+	}
+	if pos, ok := legendPositions[cs.Legend.Position.Value]; ok {
+		return pos
+	}
+	return cs.Legend.Position.Value
+}
+
+// isOn tests the boolean chart element value (the default is true).
+func isOn(v *xlsxAnyWithStringValAttribute) bool {
+	return v != nil && (v.Value == "" || v.Value == "1" || v.Value == "true")
+}
+
+// Value returns the comma separated list of the content shown in the data labels.
+func (dl *xlsxDataLabels) Value() string {
+	if dl == nil || isOn(dl.Delete) {
+		return ""
+	}
+	var labels []string
+	for _, l := range []struct {
+		name string
+		val  *xlsxAnyWithStringValAttribute
+	}{
+		{"series", dl.ShowSerName},
+		{"category", dl.ShowCatName},
+		{"value", dl.ShowVal},
+		{"percent", dl.ShowPercent},
+		{"bubble size", dl.ShowBubbleSize},
+		{"legend key", dl.ShowLegendKey},
+	} {
+		if isOn(l.val) {
+			labels = append(labels, l.name)
+		}
+	}
+	return strings.Join(labels, ",")
+}
+
+// Options returns the trendline options, eg, order=2,forward=1,R²,equation
+func (t *xlsxTrendline) Options() string {
+	var options []string
+	for _, o := range []struct {
+		name string
+		val  *xlsxAnyWithStringValAttribute
+	}{
+		{"order", t.Order},
+		{"period", t.Period},
+		{"forward", t.Forward},
+		{"backward", t.Backward},
+		{"intercept", t.Intercept},
+	} {
+		if o.val != nil {
+			options = append(options, o.name+"="+o.val.Value)
+		}
+	}
+	if isOn(t.DispRSqr) {
+		options = append(options, "R²")
+	}
+	if isOn(t.DispEq) {
+		options = append(options, "equation")
+	}
+	if t.Name != "" {
+		options = append(options, "name="+t.Name)
+	}
+	return strings.Join(options, ",")
+}
+
+// chartSeries returns all the series of the chart groups (the combo charts
+// have a group per the chart type). The chart groups that use other axes than
+// the first group are plotted on the secondary axes.
+func (cs *xlsxChartSpace) chartSeries() (series []ChartSeries, dataLabels string) {
+	var primaryAxes string
+	for _, g := range cs.PlotArea.Groups {
+		if !strings.HasSuffix(g.XMLName.Local, "Chart") {
+			continue // the axes, the layout...
+		}
+		var axes []string
+		for _, a := range g.AxisIDs {
+			axes = append(axes, a.Value)
+		}
+		axisGroup := "primary"
+		if primaryAxes == "" {
+			primaryAxes = strings.Join(axes, ",")
+		} else if strings.Join(axes, ",") != primaryAxes {
+			axisGroup = "secondary"
+		}
+		groupLabels := g.DataLabels.Value()
+		if dataLabels == "" {
+			dataLabels = groupLabels
+		}
+		for _, s := range g.Series {
+			rec := ChartSeries{
+				Idx:           s.Idx.Value,
+				Order:         s.Order.Value,
+				Type:          chartTypeName(g.XMLName.Local, g.BarDir.Value),
+				Name:          s.Name,
+				NameRef:       s.NameRef,
+				CategoryRange: joinStr(",", s.CategoryStrRef, s.CategoryNumRef, s.CategoryMultiRef),
+				ValueRange:    s.ValueRef,
+				XRange:        joinStr(",", s.XStrRef, s.XNumRef),
+				YRange:        s.YRef,
+				AxisGroup:     axisGroup,
+				DataLabels:    groupLabels,
+			}
+			if rec.Name == "" {
+				rec.Name = s.NameCache
+			}
+			if s.DataLabels != nil {
+				rec.DataLabels = s.DataLabels.Value()
+			}
+			if len(s.Trendlines) > 0 {
+				rec.TrendlineType = s.Trendlines[0].Type.Value
+				rec.TrendlineOptions = s.Trendlines[0].Options()
+			}
+			series = append(series, rec)
+		}
+	}
+	return
+}
+
+// importChartSeries stores the series of the chart and adds the auxiliary blocks for them
+// next to the chart properties (starting with the row propCount rows bellow the top of the chart).
+func (ws *Worksheet) importChartSeries(chart *Chart, series []ChartSeries, propCount int) {
+	chartID := NewNullInt64(chart.ID)
+	addBlock := func(name, value string) {
+		ws.AddAuxBlock(&Block{
+			Range:           name,
+			Formula:         value,
+			RelativeFormula: CellAddress(chart.FromRow+propCount, chart.ToCol+2),
+			ChartID:         chartID,
+		}, "Chart")
+		propCount++
+	}
+	for i, s := range series {
+		s.ChartID = chart.ID
+		if err := Db.Create(&s).Error; err != nil {
+			log.WithError(err).Errorf("Failed to create the chart series entry %#v", s)
+			continue
+		}
+		name := "Series " + strconv.Itoa(i+1)
+		addBlock(name, joinStr(",",
+			s.NameRef, s.Type, s.AxisGroup, s.CategoryRange, s.ValueRange, s.XRange, s.YRange))
+		if s.TrendlineType != "" {
+			addBlock("Trendline", joinStr(",", name, s.TrendlineType, s.TrendlineOptions))
+		}
+		if s.DataLabels != "" {
+			addBlock("DataLabels", joinStr(",", name, s.DataLabels))
+		}
+	}
+}
+
+// ImportChartsheets imports the chart sheets (eg, xl/chartsheets/sheet1.xml) as the worksheets
+// marked with IsChartsheet together with their charts.
+func (wb *Workbook) ImportChartsheets(file *excelize.File, fileName string) {
+	for i, sheet := range workbookSheets(file) {
+		if sheet.Type != "chartsheet" {
+			continue
+		}
+		var ws Worksheet
+		result := Db.First(&ws, Worksheet{
+			Name:       sheet.Name,
+			AnswerID:   wb.AnswerID,
+			WorkbookID: wb.ID,
+		})
+		if result.RecordNotFound() && !DryRun {
+			ws = Worksheet{
+				Name:             sheet.Name,
+				WorkbookFileName: filepath.Base(fileName),
+				AnswerID:         wb.AnswerID,
+				WorkbookID:       wb.ID,
+			}
+			if err := Db.Create(&ws).Error; err != nil {
+				log.WithError(err).Errorf("Failed to create the chart sheet %q entry", sheet.Name)
+				continue
+			}
+		}
+		ws.IsChartsheet = true
+		ws.Idx = i + 1
+		ws.partName = sheet.PartName
+		Db.Save(&ws)
+		if VerboseLevel > 0 {
+			log.Infof("Found the chart sheet %q", ws.Name)
+		}
+		ws.importCharts(file, sheet.PartName)
+	}
+}
+
+// pivotTableName splits the pivot chart source into the sheet name and the pivot table name,
+// eg, [Book1.xlsx]'Sales Pivot'!PivotTable1 -> Sales Pivot, PivotTable1.
+func pivotTableName(source string) (sheet, name string) {
+	i := strings.LastIndex(source, "!")
+	if i < 0 {
+		return "", source
+	}
+	sheet, name = source[:i], source[i+1:]
+	quoted := strings.HasPrefix(sheet, "'") && strings.HasSuffix(sheet, "'") && len(sheet) > 1
+	if quoted {
+		sheet = sheet[1 : len(sheet)-1]
+	}
+	if j := strings.Index(sheet, "]"); strings.HasPrefix(sheet, "[") && j > 0 {
+		sheet = sheet[j+1:]
+	}
+	// the workbook name might be outside of the quotes
+	if !quoted && strings.HasPrefix(sheet, "'") && strings.HasSuffix(sheet, "'") && len(sheet) > 1 {
+		sheet, quoted = sheet[1:len(sheet)-1], true
+	}
+	if quoted {
+		sheet = strings.Replace(sheet, "''", "'", -1)
+	}
+	return
+}
+
+// linkPivotCharts links the pivot charts of the workbook to the data sources of their pivot tables.
+func (wb *Workbook) linkPivotCharts() {
+	if DryRun {
+		return
+	}
+	var charts []Chart
+	if err := Db.
+		Joins("JOIN WorkSheets AS ws ON ws.id = charts.worksheet_id").
+		Where("ws.workbook_id = ? AND charts.pivot_name IS NOT NULL AND charts.pivot_name != ''", wb.ID).
+		Find(&charts).Error; err != nil {
+		log.WithError(err).Errorln("Failed to retrieve the pivot charts of the workbook: ", wb.FileName)
+		return
+	}
+	for _, c := range charts {
+		sheet, name := pivotTableName(c.PivotName)
+		var ds DataSource
+		if Db.
+			Joins("JOIN WorkSheets AS ws ON ws.id = DataSources.worksheet_id").
+			Where("ws.workbook_id = ? AND ws.name = ? AND DataSources.name = ?", wb.ID, sheet, name).
+			First(&ds).RecordNotFound() {
+			log.Warnf("The pivot table %q of the pivot chart %q was not found", c.PivotName, c.Title)
+			continue
+		}
+		if err := Db.Model(&c).UpdateColumn("pivot_source_id", ds.ID).Error; err != nil {
+			log.WithError(err).Errorln("Failed to link the pivot chart: ", c.PivotName)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package model
+
+import "testing"
+
+func TestPivotTableName(t *testing.T) {
+	for source, expected := range map[string][2]string{
+		"[Book1.xlsx]Sheet2!PivotTable1":         {"Sheet2", "PivotTable1"},
+		"[Book1.xlsx]'Sales Pivot'!PivotTable3":  {"Sales Pivot", "PivotTable3"},
+		"'[Book 1.xlsx]Tom''s Pivot'!PivotTable": {"Tom's Pivot", "PivotTable"},
+		"PivotTable1":                            {"", "PivotTable1"},
+	} {
+		if sheet, name := pivotTableName(source); sheet != expected[0] || name != expected[1] {
+			t.Errorf("Expected %q to be split into %q, got: %q, %q", source, expected, sheet, name)
+		}
+	}
+}
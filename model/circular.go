@@ -0,0 +1,199 @@
+package model
+
+import (
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/excelize"
+	"github.com/nad2000/xlsx"
+)
+
+// cellNode - a formula cell of the workbook dependency graph
+type cellNode struct{ worksheetID, row, col int }
+
+// stronglyConnected returns the strongly connected components (Tarjan's algorithm)
+// of the graph, ie, the cells of the components are mutually dependent.
+func stronglyConnected(nodes []cellNode, edges map[cellNode][]cellNode) (components [][]cellNode) {
+	var (
+		index   int
+		indexes = make(map[cellNode]int)
+		lowLink = make(map[cellNode]int)
+		onStack = make(map[cellNode]bool)
+		stack   []cellNode
+		connect func(n cellNode)
+	)
+	connect = func(n cellNode) {
+		indexes[n], lowLink[n] = index, index
+		index++
+		stack = append(stack, n)
+		onStack[n] = true
+		for _, m := range edges[n] {
+			if _, ok := indexes[m]; !ok {
+				connect(m)
+				if lowLink[m] < lowLink[n] {
+					lowLink[n] = lowLink[m]
+				}
+			} else if onStack[m] && indexes[m] < lowLink[n] {
+				lowLink[n] = indexes[m]
+			}
+		}
+		if lowLink[n] == indexes[n] {
+			var component []cellNode
+			for {
+				m := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[m] = false
+				component = append(component, m)
+				if m == n {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+	for _, n := range nodes {
+		if _, ok := indexes[n]; !ok {
+			connect(n)
+		}
+	}
+	return
+}
+
+// circularCells returns the formula cells involved in the circular references
+// including the cells referencing themselves.
+func circularCells(nodes []cellNode, edges map[cellNode][]cellNode) map[cellNode]bool {
+	circular := make(map[cellNode]bool)
+	for _, component := range stronglyConnected(nodes, edges) {
+		if len(component) == 1 {
+			n := component[0]
+			for _, m := range edges[n] {
+				if m == n {
+					circular[n] = true
+				}
+			}
+			continue
+		}
+		for _, n := range component {
+			circular[n] = true
+		}
+	}
+	return circular
+}
+
+// markCircularReferences detects the cycles in the graph of the formula cells and
+// marks the worksheets, the workbook and the stored cells involved in them.
+func (wb *Workbook) markCircularReferences(sheetIDs []int, formulaCells map[int][]cellNode, dependencies []CellDependency, areas []area) {
+	var nodes []cellNode
+	for _, id := range sheetIDs {
+		nodes = append(nodes, formulaCells[id]...)
+	}
+	sheetRows := rowIndex(nodes)
+	edges := make(map[cellNode][]cellNode)
+	for i, d := range dependencies {
+		rows, ok := sheetRows[d.PrecedentWorksheetID]
+		if !ok {
+			continue
+		}
+		col, row, err := xlsx.GetCoordsFromCellIDString(d.CellRange)
+		if err != nil {
+			continue
+		}
+		n := cellNode{d.WorksheetID, row, col}
+		edges[n] = append(edges[n], areaCells(rows, areas[i])...)
+	}
+
+	circular := circularCells(nodes, edges)
+	sheetCells := make(map[int][]string)
+	for n := range circular {
+		sheetCells[n.worksheetID] = append(sheetCells[n.worksheetID], CellAddress(n.row, n.col))
+	}
+	for _, id := range sheetIDs {
+		if id == 0 {
+			continue
+		}
+		cells := sheetCells[id]
+		sort.Strings(cells)
+		if err := Db.Model(&Worksheet{ID: id}).UpdateColumns(map[string]interface{}{
+			"has_circular_references": len(cells) > 0,
+			"circular_cells":          strings.Join(cells, ","),
+		}).Error; err != nil {
+			log.WithError(err).Errorln("Failed to update the worksheet entry, ID: ", id)
+		}
+		if len(cells) > 0 {
+			log.Warnf("Detected circular references in the worksheet (ID: %d) of the workbook %q: %s",
+				id, wb.FileName, strings.Join(cells, ", "))
+			if err := Db.Model(&Cell{}).
+				Where("worksheet_id = ? AND cell_range IN (?)", id, cells).
+				UpdateColumn("is_circular", true).Error; err != nil {
+				log.WithError(err).Errorln("Failed to mark the circular reference cells of the worksheet, ID: ", id)
+			}
+		}
+	}
+	wb.HasCircularReferences = len(circular) > 0
+	if err := Db.Model(wb).UpdateColumn("has_circular_references", wb.HasCircularReferences).Error; err != nil {
+		log.WithError(err).Errorln("Failed to update the workbook entry: ", wb.FileName)
+	}
+}
+
+// rowIndex indexes the cells by the worksheets and the rows.
+func rowIndex(nodes []cellNode) map[int]map[int][]cellNode {
+	sheetRows := make(map[int]map[int][]cellNode)
+	for _, n := range nodes {
+		rows, ok := sheetRows[n.worksheetID]
+		if !ok {
+			rows = make(map[int][]cellNode)
+			sheetRows[n.worksheetID] = rows
+		}
+		rows[n.row] = append(rows[n.row], n)
+	}
+	return sheetRows
+}
+
+// areaCells returns the cells (indexed by the rows) within the area.
+func areaCells(rows map[int][]cellNode, a area) (cells []cellNode) {
+	within := func(row []cellNode) {
+		for _, m := range row {
+			if a.lCol <= m.col && m.col <= a.rCol {
+				cells = append(cells, m)
+			}
+		}
+	}
+	if a.bRow-a.tRow >= len(rows) {
+		// the whole column or a large range, eg, A:A
+		for r, row := range rows {
+			if a.tRow <= r && r <= a.bRow {
+				within(row)
+			}
+		}
+		return
+	}
+	for r := a.tRow; r <= a.bRow; r++ {
+		within(rows[r])
+	}
+	return
+}
+
+// ImportCalcProperties imports the calculation properties (calcPr) of the workbook:
+// the calculation mode and whether the iterative calculation is turned on.
+func (wb *Workbook) ImportCalcProperties(file *excelize.File) {
+	calcPr := UnmarshalWorkbook(file.XLSX["xl/workbook.xml"]).CalcPr
+	wb.CalcMode = calcPr.CalcMode
+	if wb.CalcMode == "" {
+		wb.CalcMode = "auto"
+	}
+	wb.IsIterative = calcPr.Iterate == "1" || strings.ToLower(calcPr.Iterate) == "true"
+	if wb.IsIterative {
+		log.Warnf("The iterative calculation is turned on in the workbook %q (iterations: %q, maximum change: %q)",
+			wb.FileName, calcPr.IterateCount, calcPr.IterateDelta)
+	}
+	if DryRun {
+		return
+	}
+	if err := Db.Model(wb).UpdateColumns(map[string]interface{}{
+		"calc_mode":    wb.CalcMode,
+		"is_iterative": wb.IsIterative,
+	}).Error; err != nil {
+		log.WithError(err).Errorln("Failed to update the workbook entry: ", wb.FileName)
+	}
+}
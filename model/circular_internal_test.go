@@ -0,0 +1,30 @@
+package model
+
+import "testing"
+
+func TestCircularCells(t *testing.T) {
+	var (
+		a1 = cellNode{1, 0, 0}
+		b1 = cellNode{1, 0, 1}
+		c1 = cellNode{1, 0, 2}
+		d1 = cellNode{1, 0, 3}
+		a2 = cellNode{2, 1, 0} // another sheet
+	)
+	nodes := []cellNode{a1, b1, c1, d1, a2}
+	edges := map[cellNode][]cellNode{
+		a1: {b1},
+		b1: {a2},
+		a2: {a1}, // the cross-sheet cycle A1 -> B1 -> A2 -> A1
+		c1: {c1}, // the self-reference
+		d1: {a1, b1},
+	}
+	circular := circularCells(nodes, edges)
+	for _, n := range []cellNode{a1, b1, a2, c1} {
+		if !circular[n] {
+			t.Errorf("Expected %v to be circular", n)
+		}
+	}
+	if circular[d1] || len(circular) != 4 {
+		t.Errorf("Expected only 4 circular cells, got: %v", circular)
+	}
+}
@@ -0,0 +1,516 @@
+package model
+
+import (
+	"database/sql"
+	x "extract-blocks/model/xlsx"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// defaultIconSet - the icon set of the rules without the iconSet attribute
+const defaultIconSet = "3TrafficLights1"
+
+// applyDxf sets the format applied by the conditional formatting rule
+func (cf *ConditionalFormatting) applyDxf(dxf x.Dxf) {
+	if f := dxf.Font; f != nil {
+		cf.FontColor = f.Color.String()
+		cf.FontBold = f.B.IsOn()
+		cf.FontItalic = f.I.IsOn()
+		cf.FontUnderline = f.Underline != nil && f.Underline.Val != "none"
+		cf.FontStrike = f.Strike.IsOn()
+	}
+	if f := dxf.Fill; f != nil {
+		// the solid fill color of the differential formatting is the background color
+		if cf.FillColor = f.PatternFill.BgColor.String(); cf.FillColor == "" {
+			cf.FillColor = f.PatternFill.FgColor.String()
+		}
+	}
+	if b := dxf.Border; b != nil {
+		for _, side := range []*x.BorderPr{b.Left, b.Right, b.Top, b.Bottom} {
+			if side != nil && (side.Style != "" || side.Color != nil) {
+				cf.BorderStyle, cf.BorderColor = side.Style, side.Color.String()
+				break
+			}
+		}
+	}
+	if dxf.NumFmt != nil {
+		cf.NumberFormat = dxf.NumFmt.FormatCode
+	}
+}
+
+// Format returns the description of the applied format, eg, fill=FFFFC7CE,font=FF9C0006,bold
+func (cf *ConditionalFormatting) Format() string {
+	var format []string
+	add := func(name, value string) {
+		if value != "" {
+			format = append(format, name+"="+value)
+		}
+	}
+	add("fill", cf.FillColor)
+	add("font", cf.FontColor)
+	for _, f := range []struct {
+		name string
+		on   bool
+	}{
+		{"bold", cf.FontBold},
+		{"italic", cf.FontItalic},
+		{"underline", cf.FontUnderline},
+		{"strike", cf.FontStrike},
+	} {
+		if f.on {
+			format = append(format, f.name)
+		}
+	}
+	add("border", joinStr(":", cf.BorderStyle, cf.BorderColor))
+	add("format", cf.NumberFormat)
+	return strings.Join(format, ",")
+}
+
+// scaleRuleTypes - the rules formatting all the numeric cells of the range
+var scaleRuleTypes = map[string]bool{
+	"colorScale": true,
+	"dataBar":    true,
+	"iconSet":    true,
+}
+
+// offsetReferences moves the relative references of the parsed formula by the given number of rows and columns.
+func offsetReferences(e Expr, rows, cols int) {
+	move := func(c *CellReference) {
+		if c.Row >= 0 && !c.AbsRow {
+			c.Row += rows
+		}
+		if c.Col >= 0 && !c.AbsCol {
+			c.Col += cols
+		}
+	}
+	walkExpr(e, func(e Expr) bool {
+		if r, ok := e.(*RefExpr); ok {
+			move(&r.From)
+			move(&r.To)
+		}
+		return true
+	})
+}
+
+// sqrefCells returns the cells (zero based row and column indexes sorted by rows) of the space separated
+// list of the ranges and the top left cell of the first range. The whole columns and rows are limited
+// to the used area (maxRow, maxCol).
+func sqrefCells(sqref string, maxRow, maxCol int) (cells [][2]int, top, left int, err error) {
+	seen := make(map[[2]int]bool)
+	for i, part := range strings.Fields(sqref) {
+		ref, err := ParseReference(part)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		a := referenceArea(ref)
+		if a.bRow == math.MaxInt32 {
+			a.bRow = maxRow
+		}
+		if a.rCol == math.MaxInt32 {
+			a.rCol = maxCol
+		}
+		if i == 0 {
+			top, left = a.tRow, a.lCol
+		}
+		for r := a.tRow; r <= a.bRow; r++ {
+			for c := a.lCol; c <= a.rCol; c++ {
+				if cell := [2]int{r, c}; !seen[cell] {
+					seen[cell] = true
+					cells = append(cells, cell)
+				}
+			}
+		}
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		return cells[i][0] < cells[j][0] || cells[i][0] == cells[j][0] && cells[i][1] < cells[j][1]
+	})
+	return
+}
+
+// highlight evaluates the rule with the cell values (cell address -> value) and returns the cells
+// of the range (sqref) the rule applies to. The rule formulas are relative to the top left cell
+// of the range. The text of the text rules (containsText, beginsWith, etc.) is given with text.
+func (cf *ConditionalFormatting) highlight(sqref, text string, values map[string]string) (highlighted []string, err error) {
+	cv := newPerturbedCells(values)
+	cells, top, left, err := sqrefCells(sqref, cv.maxRow, cv.maxCol)
+	if err != nil {
+		return
+	}
+	value := func(cell [2]int) Value {
+		return cv.CellValue("", cell[0], cell[1])
+	}
+	formula := func(formula string, cell [2]int) (Value, error) {
+		e, err := ParseFormula(formula)
+		if err != nil {
+			return Value{}, err
+		}
+		// only the cell values of the worksheet are available
+		walkExpr(e, func(e Expr) bool {
+			if r, ok := e.(*RefExpr); ok && (r.Sheet != "" || r.Workbook != "") && err == nil {
+				err = fmt.Errorf("the reference %q to another worksheet cannot be evaluated", r.Reference.String())
+			}
+			return err == nil
+		})
+		if err != nil {
+			return Value{}, err
+		}
+		offsetReferences(e, cell[0]-top, cell[1]-left)
+		ev := Evaluator{Cells: cv, Row: cell[0], Col: cell[1]}
+		v, err := ev.Eval(e)
+		return firstValue(v), err
+	}
+	var numbers []float64
+	for _, cell := range cells {
+		if v := value(cell); v.Type == ValueNumber {
+			numbers = append(numbers, v.Number)
+		}
+	}
+
+	var test func(cell [2]int) (bool, error)
+	switch cf.Type {
+	case "cellIs":
+		test = func(cell [2]int) (bool, error) {
+			v := value(cell)
+			if v.IsError() {
+				return false, nil
+			}
+			v1, err := formula(cf.Formula1, cell)
+			if err != nil {
+				return false, err
+			}
+			c1 := compareValues(v, v1)
+			switch cf.Operator {
+			case "between", "notBetween":
+				v2, err := formula(cf.Formula2, cell)
+				if err != nil {
+					return false, err
+				}
+				// the bounds can be given in any order
+				c2 := compareValues(v, v2)
+				isBetween := c1 >= 0 && c2 <= 0 || c1 <= 0 && c2 >= 0
+				return isBetween == (cf.Operator == "between"), nil
+			case "equal":
+				return c1 == 0, nil
+			case "notEqual":
+				return c1 != 0, nil
+			case "greaterThan":
+				return c1 > 0, nil
+			case "greaterThanOrEqual":
+				return c1 >= 0, nil
+			case "lessThan":
+				return c1 < 0, nil
+			case "lessThanOrEqual":
+				return c1 <= 0, nil
+			}
+			return false, fmt.Errorf("unsupported operator %q", cf.Operator)
+		}
+	case "expression":
+		test = func(cell [2]int) (bool, error) {
+			v, err := formula(cf.Formula1, cell)
+			if err != nil || v.IsError() {
+				return false, err
+			}
+			isTrue, _ := toBool(v)
+			return isTrue, nil
+		}
+	case "containsText", "notContainsText", "beginsWith", "endsWith":
+		text = strings.ToLower(text)
+		test = func(cell [2]int) (bool, error) {
+			v := value(cell)
+			if v.IsError() {
+				return cf.Type == "notContainsText", nil
+			}
+			s := strings.ToLower(v.String())
+			switch cf.Type {
+			case "containsText":
+				return strings.Contains(s, text), nil
+			case "notContainsText":
+				return !strings.Contains(s, text), nil
+			case "beginsWith":
+				return strings.HasPrefix(s, text), nil
+			}
+			return strings.HasSuffix(s, text), nil
+		}
+	case "containsBlanks", "notContainsBlanks":
+		test = func(cell [2]int) (bool, error) {
+			isBlank := strings.TrimSpace(value(cell).String()) == ""
+			return isBlank == (cf.Type == "containsBlanks"), nil
+		}
+	case "containsErrors", "notContainsErrors":
+		test = func(cell [2]int) (bool, error) {
+			return value(cell).IsError() == (cf.Type == "containsErrors"), nil
+		}
+	case "duplicateValues", "uniqueValues":
+		counts := make(map[string]int)
+		for _, cell := range cells {
+			if v := value(cell); v.Type != ValueEmpty {
+				counts[strings.ToLower(v.String())]++
+			}
+		}
+		test = func(cell [2]int) (bool, error) {
+			v := value(cell)
+			if v.Type == ValueEmpty {
+				return false, nil
+			}
+			return (counts[strings.ToLower(v.String())] > 1) == (cf.Type == "duplicateValues"), nil
+		}
+	case "top10":
+		isTop := cf.Operator == "top"
+		sort.Slice(numbers, func(i, j int) bool {
+			return isTop && numbers[i] > numbers[j] || !isTop && numbers[i] < numbers[j]
+		})
+		rank := atoi(cf.Formula1)
+		if cf.Formula2 == "percent" {
+			rank = len(numbers) * rank / 100
+		}
+		if rank < 1 {
+			rank = 1
+		}
+		if rank > len(numbers) {
+			rank = len(numbers)
+		}
+		test = func(cell [2]int) (bool, error) {
+			v := value(cell)
+			if v.Type != ValueNumber {
+				return false, nil
+			}
+			// the ties of the last ranked value are included
+			threshold := numbers[rank-1]
+			return isTop && v.Number >= threshold || !isTop && v.Number <= threshold, nil
+		}
+	case "aboveAverage":
+		// NB! the standard deviation and the equal to average options are not evaluated
+		if cf.Operator != "above average" && cf.Operator != "bellow average" {
+			return nil, fmt.Errorf("the rule %q %q cannot be evaluated", cf.Type, cf.Operator)
+		}
+		avg, _ := average(numbers)
+		test = func(cell [2]int) (bool, error) {
+			v := value(cell)
+			if v.Type != ValueNumber {
+				return false, nil
+			}
+			if cf.Operator == "above average" {
+				return v.Number > avg, nil
+			}
+			return v.Number < avg, nil
+		}
+	default:
+		if !scaleRuleTypes[cf.Type] {
+			return nil, fmt.Errorf("the rule %q cannot be evaluated", cf.Type)
+		}
+		test = func(cell [2]int) (bool, error) {
+			return value(cell).Type == ValueNumber, nil
+		}
+	}
+
+	highlighted = []string{}
+	for _, cell := range cells {
+		isHighlighted, err := test(cell)
+		if err != nil {
+			return nil, err
+		}
+		if isHighlighted {
+			highlighted = append(highlighted, CellAddress(cell[0], cell[1]))
+		}
+	}
+	return
+}
+
+// joinCfvo returns the comma separated list of the thresholds
+func joinCfvo(cfvo []x.Cfvo) string {
+	thresholds := make([]string, len(cfvo))
+	for i, c := range cfvo {
+		thresholds[i] = c.String()
+	}
+	return strings.Join(thresholds, ",")
+}
+
+// importConditionalFormatting imports the conditional formatting rules of the worksheet
+// together with the applied formats (dxfs - the differential formats of the workbook)
+// and the cells the rules get applied to (values - the cell values of the worksheet).
+func (ws *Worksheet) importConditionalFormatting(sheet *x.Worksheet, dxfs []x.Dxf, values map[string]string) {
+	for _, cf := range sheet.ConditionalFormatting {
+		ds := DataSource{
+			WorksheetID: ws.ID,
+			Range:       cf.Sqref,
+		}
+		Db.Create(&ds)
+		ws.AddAuxBlock(&Block{
+			Range:        "CFSource",
+			Formula:      ds.Range,
+			DataSourceID: NewNullInt64(ds.ID),
+		}, "CF")
+		for _, cfr := range cf.CfRule {
+			var operator, formula1, formula2, formula3 string
+			switch cfr.Type {
+			case "iconSet":
+				operator = cfr.IconSet.IconSet
+				if operator == "" {
+					operator = defaultIconSet
+				}
+			case "aboveAverage":
+				// eg, "above average", "equal or bellow average", "2 std dev above average"
+				if cfr.AboveAverage == "0" {
+					operator = "bellow average"
+				} else {
+					operator = "above average"
+				}
+				if cfr.StdDev != "" {
+					operator = cfr.StdDev + " std dev " + operator
+				} else if cfr.EqualAverage == "1" || cfr.EqualAverage == "true" {
+					operator = "equal or " + operator
+				}
+			case "top10":
+				if cfr.Bottom == "1" {
+					operator = "bottom"
+				} else {
+					operator = "top"
+				}
+			default:
+				operator = cfr.Operator
+			}
+			switch cfr.Type {
+			case "containsText":
+				formula1 = cfr.AttrText
+			case "timePeriod":
+				formula1 = cfr.TimePeriod
+			case "top10":
+				formula1 = cfr.Rank
+			default:
+				if len(cfr.Formula) > 0 {
+					formula1 = cfr.Formula[0].Text
+				}
+			}
+			if cfr.Type == "top10" {
+				if cfr.Percent != "" {
+					formula2 = "percent"
+				}
+			} else if len(cfr.Formula) > 1 {
+				formula2 = cfr.Formula[1].Text
+			}
+			if len(cfr.Formula) > 2 {
+				formula3 = cfr.Formula[2].Text
+			}
+
+			rec := ConditionalFormatting{
+				DataSourceID: ds.ID,
+				Type:         cfr.Type,
+				Operator:     operator,
+				Formula1:     formula1,
+				Formula2:     formula2,
+				Formula3:     formula3,
+				Priority:     atoi(cfr.Priority),
+				StopIfTrue:   cfr.StopIfTrue == "1" || cfr.StopIfTrue == "true",
+			}
+			if cfr.DxfId != "" {
+				if i := atoi(cfr.DxfId); i >= 0 && i < len(dxfs) {
+					rec.applyDxf(dxfs[i])
+				} else {
+					log.Warnf("The format (dxfId=%q) of the conditional formatting rule %q of %q is missing",
+						cfr.DxfId, cfr.Type, cf.Sqref)
+				}
+			}
+			switch cfr.Type {
+			case "colorScale":
+				rec.Thresholds = joinCfvo(cfr.ColorScale.Cfvo)
+				colors := make([]string, len(cfr.ColorScale.Color))
+				for i, c := range cfr.ColorScale.Color {
+					colors[i] = c.String()
+				}
+				rec.Colors = strings.Join(colors, ",")
+			case "dataBar":
+				rec.Thresholds = joinCfvo(cfr.DataBar.Cfvo)
+				rec.Colors = cfr.DataBar.Color.String()
+			case "iconSet":
+				rec.Thresholds = joinCfvo(cfr.IconSet.Cfvo)
+			}
+			if highlighted, err := rec.highlight(cf.Sqref, cfr.AttrText, values); err == nil {
+				rec.Highlighted = sql.NullString{String: strings.Join(highlighted, ","), Valid: true}
+			} else {
+				log.WithError(err).Warnf("Failed to evaluate the conditional formatting rule %q of %q", cfr.Type, cf.Sqref)
+			}
+			if err := Db.Create(&rec).Error; err != nil {
+				log.WithError(err).Errorf("Failed to create the conditional formatting entry %#v", rec)
+				continue
+			}
+			ws.AddAuxBlock(&Block{
+				Range:        rec.Type,
+				Formula:      joinStr(",", operator, formula1, formula2, formula3),
+				DataSourceID: NewNullInt64(ds.ID),
+			}, "CF")
+			if format := rec.Format(); format != "" {
+				ws.AddAuxBlock(&Block{
+					Range:        "CFFormat",
+					Formula:      format,
+					DataSourceID: NewNullInt64(ds.ID),
+				}, "CF")
+			}
+			if rec.Thresholds != "" {
+				ws.AddAuxBlock(&Block{
+					Range:        "CFScale",
+					Formula:      joinStr(",", rec.Thresholds, rec.Colors),
+					DataSourceID: NewNullInt64(ds.ID),
+				}, "CF")
+			}
+		}
+	}
+}
+
+// cfEvaluationRow - the conditional formatting rule with the index of its worksheet
+type cfEvaluationRow struct {
+	ID          int
+	Idx         int
+	Type        string
+	Highlighted sql.NullString
+}
+
+const cfEvaluationQuery = `
+SELECT cf.id, ws.idx, cf.Type AS type, cf.Highlighted AS highlighted
+FROM ConditionalFormattings AS cf
+	JOIN DataSources AS ds ON ds.id = cf.DataSourceId
+	JOIN WorkSheets AS ws ON ws.id = ds.worksheet_id
+`
+
+// EvaluateConditionalFormatting compares the cells highlighted by the conditional formatting rules
+// of the answer with the ones of the model answer. The rule is correct if a rule of the model answer
+// on the same worksheet (by the sheet index) highlights the same cells, eg, "greater than 100" and
+// the formula rule "=B2>100" applied to B2:B10.
+func EvaluateConditionalFormatting(answerID, modelAnswerUserID int) (count int, err error) {
+	var rules, modelRules []cfEvaluationRow
+	if err = Db.Raw(cfEvaluationQuery+"WHERE ws.StudentAnswerID = ?", answerID).Scan(&rules).Error; err != nil || len(rules) == 0 {
+		return
+	}
+	if err = Db.Raw(cfEvaluationQuery+`
+	JOIN StudentAnswers AS ma ON ma.StudentAnswerID = ws.StudentAnswerID
+	JOIN StudentAssignments AS sa ON sa.StudentAssignmentID = ma.StudentAssignmentID
+	JOIN StudentAnswers AS a ON a.QuestionID = ma.QuestionID
+WHERE sa.UserID = ? AND a.StudentAnswerID = ?`, modelAnswerUserID, answerID).Scan(&modelRules).Error; err != nil {
+		return
+	}
+	for _, r := range rules {
+		var isCorrect bool
+		for _, m := range modelRules {
+			if r.Highlighted.Valid && m.Highlighted.Valid && m.Idx == r.Idx &&
+				m.Highlighted.String == r.Highlighted.String && scaleRuleTypes[m.Type] == scaleRuleTypes[r.Type] {
+				isCorrect = true
+				break
+			}
+		}
+		if DebugLevel > 1 {
+			log.Debugf("Evaluated the conditional formatting %#v: %t", r, isCorrect)
+		}
+		if DryRun {
+			continue
+		}
+		if err := Db.Model(&ConditionalFormatting{}).Where("id = ?", r.ID).Update("IsCorrect", isCorrect).Error; err != nil {
+			log.WithError(err).Errorf("failed to store the evaluation of the conditional formatting (ID: %d)", r.ID)
+			continue
+		}
+		count++
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	values := map[string]string{
+		"A1": "5", "A2": "15", "A3": "25", "A4": "15", "A5": "abc",
+		"B1": "10", "B2": "10", "B3": "30", "B4": "20",
+	}
+	for _, c := range []struct {
+		sqref, text string
+		cf          ConditionalFormatting
+		expected    string
+	}{
+		{"A1:A5", "", ConditionalFormatting{Type: "cellIs", Operator: "between", Formula1: "20", Formula2: "10"}, "A2,A4"},
+		{"A1:A5", "", ConditionalFormatting{Type: "cellIs", Operator: "greaterThan", Formula1: "B1"}, "A2,A5"},
+		{"A1:A5", "", ConditionalFormatting{Type: "cellIs", Operator: "lessThan", Formula1: "$B$1"}, "A1"},
+		{"A1:A4", "", ConditionalFormatting{Type: "expression", Formula1: "A1>B1"}, "A2"},
+		{"A2:A4 A1", "", ConditionalFormatting{Type: "expression", Formula1: "MOD(A2,2)=1"}, "A1,A2,A3,A4"},
+		{"A1:A5", "", ConditionalFormatting{Type: "duplicateValues"}, "A2,A4"},
+		{"A1:A5", "", ConditionalFormatting{Type: "uniqueValues"}, "A1,A3,A5"},
+		{"A1:A5", "B", ConditionalFormatting{Type: "containsText", Operator: "containsText"}, "A5"},
+		{"A1:A6", "", ConditionalFormatting{Type: "containsBlanks"}, "A6"},
+		{"B1:B4", "", ConditionalFormatting{Type: "top10", Operator: "top", Formula1: "2"}, "B3,B4"},
+		{"B1:B4", "", ConditionalFormatting{Type: "top10", Operator: "bottom", Formula1: "1"}, "B1,B2"},
+		{"B1:B4", "", ConditionalFormatting{Type: "top10", Operator: "top", Formula1: "50", Formula2: "percent"}, "B3,B4"},
+		{"B1:B4", "", ConditionalFormatting{Type: "aboveAverage", Operator: "above average"}, "B3,B4"},
+		{"A1:A6", "", ConditionalFormatting{Type: "colorScale"}, "A1,A2,A3,A4"},
+	} {
+		highlighted, err := c.cf.highlight(c.sqref, c.text, values)
+		if err != nil {
+			t.Errorf("Failed to evaluate %#v: %v", c.cf, err)
+			continue
+		}
+		if got := strings.Join(highlighted, ","); got != c.expected {
+			t.Errorf("Expected %#v applied to %q to highlight %q, got: %q", c.cf, c.sqref, c.expected, got)
+		}
+	}
+	for _, cf := range []ConditionalFormatting{
+		{Type: "timePeriod"},
+		{Type: "aboveAverage", Operator: "equal or above average"},
+		{Type: "aboveAverage", Operator: "1 std dev bellow average"},
+		{Type: "cellIs", Operator: "greaterThan", Formula1: "Sheet2!B1"},
+		{Type: "expression", Formula1: "A1>'Sheet 2'!$B$1"},
+	} {
+		if _, err := cf.highlight("A1:A5", "", values); err == nil {
+			t.Errorf("Expected the evaluation of %#v to fail", cf)
+		}
+	}
+}
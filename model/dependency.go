@@ -0,0 +1,540 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/xlsx"
+)
+
+// CellDependency - the reference of the dependent (formula) cell to its precedent cell or range
+type CellDependency struct {
+	ID                   int
+	WorkbookID           int    `gorm:"index"`
+	WorksheetID          int    `gorm:"index"` // the worksheet of the dependent cell
+	CellRange            string // the dependent cell, eg, "C3"
+	PrecedentWorksheetID int    `gorm:"index"`
+	PrecedentRange       string // the precedent cell or range, eg, "A1:A5" or "A:A"
+	Reference            string // the reference as it appears in the formula, eg, "Sheet1!$A$1:$A$5" or a defined name
+}
+
+// TableName overrides default table name for the model
+func (CellDependency) TableName() string {
+	return "CellDependencies"
+}
+
+// BlockDependency - the dependency of the block on its precedent block
+type BlockDependency struct {
+	ID               int
+	WorkbookID       int `gorm:"index"`
+	BlockID          int `gorm:"index"` // the dependent block
+	PrecedentBlockID int `gorm:"index"`
+	ReferenceCount   int // the number of the cell references to the precedent block
+}
+
+// TableName overrides default table name for the model
+func (BlockDependency) TableName() string {
+	return "BlockDependencies"
+}
+
+// PrecedentValue - the (cached) value of a precedent cell referenced by the worksheet formulas,
+// eg, an input cell outside the answer blocks
+type PrecedentValue struct {
+	ID          int
+	WorkbookID  int    `gorm:"index"`
+	WorksheetID int    `gorm:"index"` // the worksheet of the dependent cells
+	CellRange   string // the precedent cell, eg, "A1" or "Sheet2!A1" (on another worksheet)
+	Value       string `gorm:"size:2000"`
+}
+
+// TableName overrides default table name for the model
+func (PrecedentValue) TableName() string {
+	return "PrecedentValues"
+}
+
+// area - the zero based bounds of the referenced cell range
+type area struct{ tRow, lCol, bRow, rCol int }
+
+func referenceArea(ref Reference) area {
+	a := area{ref.From.Row, ref.From.Col, ref.To.Row, ref.To.Col}
+	if a.tRow > a.bRow {
+		a.tRow, a.bRow = a.bRow, a.tRow
+	}
+	if a.lCol > a.rCol {
+		a.lCol, a.rCol = a.rCol, a.lCol
+	}
+	// the whole column or row references
+	if a.tRow < 0 {
+		a.tRow, a.bRow = 0, math.MaxInt32
+	}
+	if a.lCol < 0 {
+		a.lCol, a.rCol = 0, math.MaxInt32
+	}
+	return a
+}
+
+func (a area) includes(r, c int) bool {
+	return a.tRow <= r && r <= a.bRow && a.lCol <= c && c <= a.rCol
+}
+
+func (a area) overlaps(b *Block) bool {
+	return a.tRow <= b.BRow && b.TRow <= a.bRow && a.lCol <= b.RCol && b.LCol <= a.rCol
+}
+
+// formulaReferences returns the references of the formula including
+// the references given with the defined names.
+func formulaReferences(formula string, names map[string]Reference) (refs []Reference, texts []string, err error) {
+	expr, err := ParseFormula(formula)
+	if err != nil {
+		return
+	}
+	walkExpr(expr, func(e Expr) bool {
+		switch e := e.(type) {
+		case *RefExpr:
+			refs, texts = append(refs, e.Reference), append(texts, e.Reference.String())
+		case *NameExpr:
+			if ref, ok := names[strings.ToUpper(e.Name)]; ok {
+				refs, texts = append(refs, ref), append(texts, e.Name)
+			}
+		case *BinaryExpr:
+			// the range between two cell references, eg, Sheet1!A1:Sheet1!B2
+			if l, ok := e.Left.(*RefExpr); ok && e.Op == ":" && !l.IsRange {
+				if r, ok := e.Right.(*RefExpr); ok && !r.IsRange {
+					ref := l.Reference
+					ref.To, ref.IsRange = r.From, true
+					refs, texts = append(refs, ref), append(texts, e.String())
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return
+}
+
+// definedNameReferences maps the defined names of the workbook (upper case)
+// to the references, the names of constants and formulas are skipped.
+func definedNameReferences(file *xlsx.File) map[string]Reference {
+	names := make(map[string]Reference)
+	for _, dn := range file.DefinedNames {
+		if strings.HasPrefix(dn.Name, "_xlnm.") || strings.HasPrefix(dn.Name, "solver_") {
+			continue
+		}
+		ref, err := ParseReference(strings.TrimSpace(dn.Data))
+		if err != nil || ref.IsError || ref.Workbook != "" {
+			continue
+		}
+		names[strings.ToUpper(dn.Name)] = ref
+	}
+	return names
+}
+
+// ExtractDependencies extracts the precedent/dependent graph of the formula cells
+// and the blocks of the workbook including the cross-sheet references, and
+// marks the cells involved in the circular references.
+// sheetIDs are the IDs of the worksheet entries in the order of the file sheets
+// (0 - the sheet was skipped). The references to the external workbooks are ignored.
+func (wb *Workbook) ExtractDependencies(file *xlsx.File, formulas workbookFormulas, sheetIDs []int) {
+	if DryRun {
+		return
+	}
+	Db.Where("workbook_id = ?", wb.ID).Delete(BlockDependency{})
+	Db.Where("workbook_id = ?", wb.ID).Delete(CellDependency{})
+	Db.Where("workbook_id = ?", wb.ID).Delete(PrecedentValue{})
+
+	sheetNames := make(map[string]int)
+	for i, sheet := range file.Sheets {
+		if i < len(sheetIDs) && sheetIDs[i] != 0 {
+			sheetNames[strings.ToUpper(sheet.Name)] = sheetIDs[i]
+		}
+	}
+	names := definedNameReferences(file)
+
+	var (
+		dependencies []CellDependency
+		areas        []area // the precedent ranges of the dependencies
+		formulaCells = make(map[int][]cellNode)
+	)
+	tx := Db.Begin()
+	for i, sheet := range file.Sheets {
+		if i >= len(sheetIDs) || sheetIDs[i] == 0 {
+			continue
+		}
+		worksheetID := sheetIDs[i]
+		arrays := arrayFormulas(sheet, formulas)
+		for r, row := range sheet.Rows {
+			for c, cell := range row.Cells {
+				formula := cell.Formula()
+				if formula == "" {
+					formula = arrays[[2]int{r, c}]
+				}
+				if formula == "" {
+					continue
+				}
+				formulaCells[worksheetID] = append(formulaCells[worksheetID], cellNode{worksheetID, r, c})
+				refs, texts, err := formulaReferences(formula, names)
+				if err != nil {
+					log.WithError(err).Warnf("Failed to parse the formula %q of the cell %s!%s", formula, sheet.Name, CellAddress(r, c))
+					continue
+				}
+				seen := make(map[string]bool)
+				for k, ref := range refs {
+					if ref.IsError || ref.Workbook != "" {
+						continue
+					}
+					precedentID := worksheetID
+					if ref.Sheet != "" {
+						var ok bool
+						if precedentID, ok = sheetNames[strings.ToUpper(ref.Sheet)]; !ok {
+							continue
+						}
+					}
+					precedent := Reference{From: ref.From, To: ref.To, IsRange: ref.IsRange}
+					precedent.From.AbsCol, precedent.From.AbsRow = false, false
+					precedent.To.AbsCol, precedent.To.AbsRow = false, false
+					key := fmt.Sprintf("%d!%s", precedentID, precedent)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+					d := CellDependency{
+						WorkbookID:           wb.ID,
+						WorksheetID:          worksheetID,
+						CellRange:            CellAddress(r, c),
+						PrecedentWorksheetID: precedentID,
+						PrecedentRange:       precedent.String(),
+						Reference:            texts[k],
+					}
+					if err := tx.Create(&d).Error; err != nil {
+						log.WithError(err).Errorln("Failed to create a cell dependency: ", d)
+						continue
+					}
+					dependencies = append(dependencies, d)
+					areas = append(areas, referenceArea(precedent))
+				}
+			}
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.WithError(err).Errorln("Failed to store the cell dependencies of the workbook: ", wb.FileName)
+	}
+	if DebugLevel > 1 {
+		log.Debugf("Extracted %d cell dependencies of the workbook %q", len(dependencies), wb.FileName)
+	}
+	wb.storePrecedentValues(file, sheetIDs, dependencies, areas)
+	wb.markCircularReferences(sheetIDs, formulaCells, dependencies, areas)
+	wb.extractBlockDependencies(sheetIDs, dependencies, areas)
+}
+
+// storePrecedentValues stores the values of the precedent cells of the formulas,
+// the values are used evaluating the formulas, eg, carrying forward the errors
+// of the input cells outside the answer blocks.
+func (wb *Workbook) storePrecedentValues(file *xlsx.File, sheetIDs []int, dependencies []CellDependency, areas []area) {
+	sheets := make(map[int]*xlsx.Sheet)
+	for i, sheet := range file.Sheets {
+		if i < len(sheetIDs) && sheetIDs[i] != 0 {
+			sheets[sheetIDs[i]] = sheet
+		}
+	}
+	seen := make(map[string]bool)
+	tx := Db.Begin()
+	for i, d := range dependencies {
+		sheet, ok := sheets[d.PrecedentWorksheetID]
+		if !ok {
+			continue
+		}
+		a := areas[i]
+		for r := a.tRow; r <= a.bRow && r < len(sheet.Rows); r++ {
+			row := sheet.Rows[r]
+			if row == nil {
+				continue
+			}
+			for c := a.lCol; c <= a.rCol && c < len(row.Cells); c++ {
+				cell := row.Cells[c]
+				if cell == nil {
+					continue
+				}
+				value := cellValue(cell)
+				if value == "" {
+					continue
+				}
+				address := CellAddress(r, c)
+				if d.PrecedentWorksheetID != d.WorksheetID {
+					address = sheet.Name + "!" + address
+				}
+				key := fmt.Sprintf("%d!%s", d.WorksheetID, address)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				pv := PrecedentValue{WorkbookID: wb.ID, WorksheetID: d.WorksheetID, CellRange: address, Value: value}
+				if err := tx.Create(&pv).Error; err != nil {
+					log.WithError(err).Errorln("Failed to store a precedent cell value: ", pv)
+				}
+			}
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.WithError(err).Errorln("Failed to store the precedent cell values of the workbook: ", wb.FileName)
+	}
+}
+
+// extractBlockDependencies aggregates the cell dependencies into the dependencies between the blocks.
+func (wb *Workbook) extractBlockDependencies(sheetIDs []int, dependencies []CellDependency, areas []area) {
+	var blocks []Block
+	if err := Db.
+		Where("worksheet_id IN (?) AND BlockCellRange IS NOT NULL AND BlockCellRange != ''", sheetIDs).
+		Find(&blocks).Error; err != nil {
+		log.WithError(err).Errorln("Failed to fetch the blocks of the workbook: ", wb.FileName)
+		return
+	}
+	sheetBlocks := make(map[int]*blockIndex)
+	for i := range blocks {
+		b := &blocks[i]
+		bi, ok := sheetBlocks[b.WorksheetID]
+		if !ok {
+			bi = &blockIndex{rows: make(map[int][]*Block), minRow: b.TRow, maxRow: b.BRow}
+			sheetBlocks[b.WorksheetID] = bi
+		}
+		bi.add(b)
+	}
+
+	type precedentArea struct {
+		worksheetID int
+		area
+	}
+	precedentBlocks := make(map[precedentArea][]*Block)
+	counts := make(map[[2]int]int)
+	for i, d := range dependencies {
+		bi, ok := sheetBlocks[d.WorksheetID]
+		if !ok {
+			continue
+		}
+		col, row, err := xlsx.GetCoordsFromCellIDString(d.CellRange)
+		if err != nil {
+			continue
+		}
+		dependentBlocks := bi.at(row, col)
+		if len(dependentBlocks) == 0 {
+			continue
+		}
+		pa := precedentArea{d.PrecedentWorksheetID, areas[i]}
+		pbs, ok := precedentBlocks[pa]
+		if !ok {
+			if pbi, ok := sheetBlocks[d.PrecedentWorksheetID]; ok {
+				pbs = pbi.overlapping(pa.area)
+			}
+			precedentBlocks[pa] = pbs
+		}
+		for _, b := range dependentBlocks {
+			for _, pb := range pbs {
+				if pb.ID != b.ID {
+					counts[[2]int{b.ID, pb.ID}]++
+				}
+			}
+		}
+	}
+
+	keys := make([][2]int, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+	tx := Db.Begin()
+	for _, k := range keys {
+		bd := BlockDependency{WorkbookID: wb.ID, BlockID: k[0], PrecedentBlockID: k[1], ReferenceCount: counts[k]}
+		if err := tx.Create(&bd).Error; err != nil {
+			log.WithError(err).Errorln("Failed to create a block dependency: ", bd)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.WithError(err).Errorln("Failed to store the block dependencies of the workbook: ", wb.FileName)
+	}
+}
+
+// blockIndex - the blocks of a worksheet indexed by the rows they span
+type blockIndex struct {
+	rows           map[int][]*Block
+	minRow, maxRow int
+}
+
+func (bi *blockIndex) add(b *Block) {
+	for r := b.TRow; r <= b.BRow; r++ {
+		bi.rows[r] = append(bi.rows[r], b)
+	}
+	bi.minRow, bi.maxRow = minInt(bi.minRow, b.TRow), maxInt(bi.maxRow, b.BRow)
+}
+
+// at returns the blocks including the cell.
+func (bi *blockIndex) at(r, c int) (blocks []*Block) {
+	for _, b := range bi.rows[r] {
+		if b.LCol <= c && c <= b.RCol {
+			blocks = append(blocks, b)
+		}
+	}
+	return
+}
+
+// overlapping returns the blocks overlapping the area.
+func (bi *blockIndex) overlapping(a area) (blocks []*Block) {
+	seen := make(map[int]bool)
+	for r := maxInt(a.tRow, bi.minRow); r <= minInt(a.bRow, bi.maxRow); r++ {
+		for _, b := range bi.rows[r] {
+			if !seen[b.ID] && a.overlaps(b) {
+				seen[b.ID] = true
+				blocks = append(blocks, b)
+			}
+		}
+	}
+	return
+}
+
+// DependencyNode - a node of the dependency graph: a block, a cell or a precedent range
+type DependencyNode struct {
+	ID       string `json:"id"`
+	Sheet    string `json:"sheet"`
+	Range    string `json:"range"`
+	Category string `json:"category,omitempty"`
+	Color    string `json:"color,omitempty"`
+	Formula  string `json:"formula,omitempty"`
+}
+
+// DependencyEdge - an edge of the dependency graph directed from the precedent to the dependent
+type DependencyEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count,omitempty"` // the number of the cell references (the block graph)
+}
+
+// DependencyGraph - the precedent/dependent graph of the blocks or the cells of an answer
+type DependencyGraph struct {
+	Name  string           `json:"name"`
+	Nodes []DependencyNode `json:"nodes"`
+	Edges []DependencyEdge `json:"edges"`
+}
+
+// AnswerDependencyGraph returns the dependency graph of the blocks (or the cells
+// if cells is true) of the answer workbook.
+func AnswerDependencyGraph(answerID int, cells bool) (g DependencyGraph, err error) {
+	var wb Workbook
+	if err = Db.Where("StudentAnswerID = ?", answerID).Order("id DESC").First(&wb).Error; err != nil {
+		err = fmt.Errorf("failed to find the workbook of the answer (ID: %d): %s", answerID, err.Error())
+		return
+	}
+	g.Name = wb.FileName
+
+	var worksheets []Worksheet
+	if err = Db.Where("workbook_id = ?", wb.ID).Find(&worksheets).Error; err != nil {
+		return
+	}
+	sheetNames := make(map[int]string)
+	for _, ws := range worksheets {
+		sheetNames[ws.ID] = ws.Name
+	}
+	nodes := make(map[string]DependencyNode)
+	addNode := func(n DependencyNode) {
+		if _, ok := nodes[n.ID]; !ok {
+			nodes[n.ID] = n
+		}
+	}
+
+	if cells {
+		var dependencies []CellDependency
+		if err = Db.Where("workbook_id = ?", wb.ID).Order("id").Find(&dependencies).Error; err != nil {
+			return
+		}
+		for _, d := range dependencies {
+			from := DependencyNode{Sheet: sheetNames[d.PrecedentWorksheetID], Range: d.PrecedentRange}
+			from.ID = from.Sheet + "!" + from.Range
+			to := DependencyNode{Sheet: sheetNames[d.WorksheetID], Range: d.CellRange}
+			to.ID = to.Sheet + "!" + to.Range
+			addNode(from)
+			addNode(to)
+			g.Edges = append(g.Edges, DependencyEdge{From: from.ID, To: to.ID})
+		}
+	} else {
+		var dependencies []BlockDependency
+		if err = Db.Where("workbook_id = ?", wb.ID).Order("id").Find(&dependencies).Error; err != nil {
+			return
+		}
+		ids := make([]int, 0, 2*len(dependencies))
+		for _, d := range dependencies {
+			ids = append(ids, d.BlockID, d.PrecedentBlockID)
+		}
+		var blocks []Block
+		if err = Db.Where("ExcelBlockID IN (?)", ids).Find(&blocks).Error; err != nil {
+			return
+		}
+		blockNodes := make(map[int]DependencyNode)
+		for _, b := range blocks {
+			blockNodes[b.ID] = DependencyNode{
+				ID:       fmt.Sprintf("B%d", b.ID),
+				Sheet:    sheetNames[b.WorksheetID],
+				Range:    b.Range,
+				Category: string(b.Category),
+				Color:    b.Color,
+				Formula:  b.Formula,
+			}
+		}
+		for _, d := range dependencies {
+			from, to := blockNodes[d.PrecedentBlockID], blockNodes[d.BlockID]
+			addNode(from)
+			addNode(to)
+			g.Edges = append(g.Edges, DependencyEdge{From: from.ID, To: to.ID, Count: d.ReferenceCount})
+		}
+	}
+
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		if g.Nodes[i].Sheet != g.Nodes[j].Sheet {
+			return g.Nodes[i].Sheet < g.Nodes[j].Sheet
+		}
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	return
+}
+
+var dotReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotReplacer.Replace(s) + `"`
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. The blocks are filled
+// with the block colors and the edges are labeled with the reference counts.
+func (g DependencyGraph) WriteDOT(w io.Writer) (err error) {
+	write := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	write("digraph %s {\n\trankdir=LR;\n\tnode [shape=box];\n", dotQuote(g.Name))
+	for _, n := range g.Nodes {
+		label := n.Sheet + "!" + n.Range
+		if n.Formula != "" {
+			label += "\n=" + n.Formula
+		}
+		attrs := "label=" + dotQuote(label)
+		if len(n.Color) == 8 {
+			attrs += `, style=filled, fillcolor="#` + n.Color[2:] + `"`
+		}
+		write("\t%s [%s];\n", dotQuote(n.ID), attrs)
+	}
+	for _, e := range g.Edges {
+		if e.Count > 0 {
+			write("\t%s -> %s [label=\"%d\"];\n", dotQuote(e.From), dotQuote(e.To), e.Count)
+		} else {
+			write("\t%s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+		}
+	}
+	write("}\n")
+	return
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/xlsx"
+)
+
+// DiscoverBlocks - discover the blocks of the answers ignoring the filling colors
+// (otherwise the discovery is used only if no color-coded block was found in the workbook)
+var DiscoverBlocks bool
+
+// discoverBlocks finds the maximal rectangular ranges of the formula cells with
+// the same relative formula ignoring the filling colors and stores them as
+// the auto-discovered blocks of the worksheet.
+func (ws *Worksheet) discoverBlocks(sheet *xlsx.Sheet, formulas workbookFormulas, verbose bool) (blocks blockList) {
+	// the whole ranges of the found blocks (the stored blocks get narrowed
+	// down to the cells containing values)
+	found := blockList{}
+	// the normalized formulas of the cells (see NormalizeFormula)
+	normalized := make(map[[2]int]string)
+	for i, row := range sheet.Rows {
+		for j, cell := range row.Cells {
+			if formula := cell.Formula(); formula != "" {
+				normalized[[2]int{i, j}] = NormalizeFormula(i, j, formula)
+			}
+		}
+	}
+	sameFormula := func(r, c int, formula string) bool {
+		f, ok := normalized[[2]int{r, c}]
+		return ok && f == formula && !found.includes(r, c)
+	}
+
+	for i, row := range sheet.Rows {
+		for j, cell := range row.Cells {
+			formula, ok := normalized[[2]int{i, j}]
+			if !ok || found.includes(i, j) {
+				continue
+			}
+			b := Block{
+				WorksheetID:      ws.ID,
+				Color:            cell.GetStyle().Fill.FgColor,
+				Category:         CalculationBlock,
+				Formula:          cell.Formula(),
+				RelativeFormula:  RelativeFormula(i, j, cell.Formula()),
+				IsAutoDiscovered: true,
+				TRow:             i,
+				LCol:             j,
+				BRow:             i,
+				RCol:             j,
+			}
+			if !b.expandArray(sheet, formulas, nil) {
+				for sameFormula(i, b.RCol+1, formula) {
+					b.RCol++
+				}
+			ROWS:
+				for r := i + 1; ; r++ {
+					for c := b.LCol; c <= b.RCol; c++ {
+						if !sameFormula(r, c, formula) {
+							break ROWS
+						}
+					}
+					b.BRow = r
+				}
+			}
+			found = append(found, b)
+
+			if !DryRun {
+				Db.Create(&b)
+			}
+			b.storeCells(sheet, formulas)
+			if DebugLevel > 1 {
+				log.Debugf("Discovered %#v", b)
+			}
+			b.findInner(sheet)
+			b.save()
+			blocks = append(blocks, b)
+			if verbose && b.Range != "" {
+				log.Infof("Discovered: %s", b)
+			}
+		}
+	}
+	return
+}
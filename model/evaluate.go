@@ -0,0 +1,328 @@
+package model
+
+import (
+	"database/sql"
+	"math"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
+	"github.com/nad2000/xlsx"
+)
+
+// valueTolerance - the relative tolerance used comparing numeric cell values
+const valueTolerance = 1e-6
+
+// EvaluationRow - a student answer cell paired with the matching model answer cell
+type EvaluationRow struct {
+	ID                          int
+	Range                       string
+	Formula, Value              string
+	ModelFormula, ModelValue    string
+	ModelCellID                 int
+	WorksheetID, ModelSheetID   int
+	StudentAnswerID, QuestionID int
+	// the values of the answer and the model answer worksheet cells
+	// (cell address -> value) used testing the formula equivalence
+	// and detecting the hard-coded constants
+	Precedents, ModelPrecedents map[string]string `gorm:"-"`
+}
+
+// AnswersToEvaluate returns the processed student answers (excluding the model answers)
+// that can be evaluated against the model answers.
+func AnswersToEvaluate(assignmentID, modelAnswerUserID int) ([]Answer, error) {
+	var answers []Answer
+	q := Db.
+		Joins("JOIN StudentAssignments ON StudentAssignments.StudentAssignmentID = StudentAnswers.StudentAssignmentID").
+		Where("StudentAnswers.was_xl_processed = ?", 1).
+		Where("StudentAssignments.UserID <> ?", modelAnswerUserID)
+	if assignmentID > -1 {
+		q = q.Where("StudentAssignments.AssignmentID = ?", assignmentID)
+	}
+	err := q.Find(&answers).Error
+	return answers, err
+}
+
+// EvaluationRows retrieves all the answer cells matched with the model answer cells
+// of the same question, worksheet (by the sheet index) and the cell range.
+func EvaluationRows(answerID, modelAnswerUserID int) (results []EvaluationRow, err error) {
+	rows, err := Db.Raw(`
+SELECT
+	c.id,
+	c.cell_range AS "range",
+	c.Formula AS formula,
+	c.Value AS value,
+	ma.Formula AS model_formula,
+	ma.Value AS model_value,
+	ma.id AS model_cell_id,
+	ws.id AS worksheet_id,
+	ma.worksheet_id AS model_sheet_id,
+	a.StudentAnswerID AS student_answer_id,
+	a.QuestionID AS question_id
+FROM StudentAnswers AS a
+	JOIN WorkSheets AS ws ON ws.StudentAnswerID = a.StudentAnswerID
+	JOIN ExcelBlocks AS b ON b.worksheet_id = ws.id
+	JOIN Cells AS c ON c.block_id = b.ExcelBlockID
+	-- Model answers
+	JOIN (
+		SELECT
+			c.id,
+			c.cell_range,
+			c.Formula,
+			c.Value,
+			c.worksheet_id,
+			a.QuestionID,
+			ws.idx
+		FROM StudentAssignments AS sa
+			JOIN StudentAnswers AS a ON a.StudentAssignmentID = sa.StudentAssignmentID
+			JOIN WorkSheets AS ws ON ws.StudentAnswerID = a.StudentAnswerID
+			JOIN ExcelBlocks AS b ON b.worksheet_id = ws.id
+			JOIN Cells AS c ON c.block_id = b.ExcelBlockID
+		WHERE sa.UserID = ?) AS ma
+	ON ma.QuestionID = a.QuestionID AND ma.idx = ws.idx AND ma.cell_range = c.cell_range
+WHERE a.StudentAnswerID = ?
+ORDER BY c.id`, modelAnswerUserID, answerID).Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	results = []EvaluationRow{}
+	for rows.Next() {
+		var r EvaluationRow
+		Db.ScanRows(rows, &r)
+		results = append(results, r)
+	}
+	return
+}
+
+// isValueCorrect compares the answer value with the expected value,
+// the numeric values are compared with the relative tolerance.
+func isValueCorrect(value, expected string) bool {
+	value, expected = strings.TrimSpace(value), strings.TrimSpace(expected)
+	if value == expected {
+		return true
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	e, err := strconv.ParseFloat(expected, 64)
+	if err != nil {
+		return false
+	}
+	return math.Abs(v-e) <= valueTolerance*math.Max(1.0, math.Max(math.Abs(v), math.Abs(e)))
+}
+
+// WorksheetValues returns the values of the worksheet cells (cell address -> value):
+// the block cells and the precedent cells of the worksheet formulas including
+// the cells outside the blocks and on the other worksheets (eg, "Sheet2!A1").
+func WorksheetValues(worksheetID int) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, q := range []*gorm.DB{
+		Db.Model(&PrecedentValue{}).Where("worksheet_id = ?", worksheetID).Select("cell_range, value"),
+		Db.Model(&Cell{}).Where("worksheet_id = ?", worksheetID).Select("cell_range, Value"),
+	} {
+		rows, err := q.Rows()
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var address string
+			var value sql.NullString
+			if err := rows.Scan(&address, &value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			values[address] = value.String
+		}
+		rows.Close()
+	}
+	return values, nil
+}
+
+// isFormulaCorrect compares the answer cell formula with the model answer cell formula.
+// The formulas are correct if they are the same or compute the same results
+// with the same precedent cell values, eg, "B2*C2" and "C2*B2".
+func isFormulaCorrect(cellRange, formula, expected string, precedents map[string]string) bool {
+	if expected == "" {
+		return formula == ""
+	}
+	col, row, err := xlsx.GetCoordsFromCellIDString(cellRange)
+	if err != nil {
+		return formula == expected
+	}
+	return SameFormula(row, col, formula, expected) ||
+		formula != "" && EquivalentFormulas(row, col, formula, expected, precedents)
+}
+
+// isCarriedForwardCorrect recomputes the model answer formula with the answer precedent
+// cell values and compares the result with the answer value, ie, the answer value is
+// correct if the errors in the precedent cells get carried forward.
+func isCarriedForwardCorrect(cellRange, value, modelFormula string, precedents map[string]string) bool {
+	if modelFormula == "" || strings.TrimSpace(value) == "" {
+		return false
+	}
+	col, row, err := xlsx.GetCoordsFromCellIDString(cellRange)
+	if err != nil {
+		return false
+	}
+	v, err := EvaluateFormula(row, col, modelFormula, precedents)
+	if err != nil || v.IsError() {
+		return false
+	}
+	return isValueCorrect(value, v.String())
+}
+
+// Evaluate compares the answer cell with the model answer cell.
+func (r EvaluationRow) Evaluate() AutoEvaluation {
+	ae := AutoEvaluation{
+		CellID:           r.ID,
+		ValueResult:      truncate(r.ModelValue, 255),
+		IsValueCorrect:   isValueCorrect(r.Value, r.ModelValue),
+		IsFormulaCorrect: isFormulaCorrect(r.Range, r.Formula, r.ModelFormula, r.Precedents),
+	}
+	if r.ModelFormula != "" && r.Formula == "" && r.Value != "" {
+		// a constant entered where the model answer has a formula
+		ae.IsHardcoded, ae.HardcodedValues = true, truncate(r.Value, 255)
+		return ae
+	}
+	if r.Formula != "" {
+		ae.IsCarriedForwardCorrect = isCarriedForwardCorrect(r.Range, r.Value, r.ModelFormula, r.Precedents)
+	}
+	// the model answer cell values take precedence over the answer ones
+	values := make(map[string]string, len(r.Precedents)+len(r.ModelPrecedents))
+	for _, m := range []map[string]string{r.Precedents, r.ModelPrecedents} {
+		for k, v := range m {
+			values[k] = v
+		}
+	}
+	if constants := DetectHardcodedConstants(r.Formula, r.ModelFormula, values); len(constants) > 0 {
+		literals := make([]string, len(constants))
+		for i, c := range constants {
+			literals[i] = c.Literal
+		}
+		ae.IsHardcoded, ae.HardcodedValues = true, truncate(strings.Join(literals, ", "), 255)
+	}
+	return ae
+}
+
+func truncate(s string, size int) string {
+	if len(s) > size {
+		return s[:size]
+	}
+	return s
+}
+
+// Save creates or updates the auto-evaluation entry of the cell.
+func (ae *AutoEvaluation) Save() error {
+	var count int
+	if err := Db.Model(&AutoEvaluation{}).Where("cell_id = ?", ae.CellID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return Db.Create(ae).Error
+	}
+	return Db.Model(&AutoEvaluation{}).Where("cell_id = ?", ae.CellID).Updates(map[string]interface{}{
+		"ValueResult":                ae.ValueResult,
+		"IsValueCorrect":             ae.IsValueCorrect,
+		"IsFormulaCorrect":           ae.IsFormulaCorrect,
+		"is_hardcoded":               ae.IsHardcoded,
+		"hardcoded_values":           ae.HardcodedValues,
+		"is_carried_forward_correct": ae.IsCarriedForwardCorrect,
+		"is_formatting_correct":      ae.IsFormattingCorrect,
+		"formatting_result":          ae.FormattingResult,
+	}).Error
+}
+
+// EvaluateAnswer compares all the answer cells with the model answer cells
+// and creates or updates the auto-evaluation entries.
+func EvaluateAnswer(answerID, modelAnswerUserID int) (count int, err error) {
+	rows, err := EvaluationRows(answerID, modelAnswerUserID)
+	if err != nil {
+		return
+	}
+	precedents := make(map[int]map[string]string)
+	worksheetValues := func(worksheetID int) map[string]string {
+		if _, ok := precedents[worksheetID]; !ok {
+			values, err := WorksheetValues(worksheetID)
+			if err != nil {
+				log.WithError(err).Errorf("failed to retrieve the cell values of the worksheet (ID: %d)", worksheetID)
+			}
+			precedents[worksheetID] = values
+		}
+		return precedents[worksheetID]
+	}
+	formatting, ferr := formattingCells(answerID, rows)
+	if ferr != nil {
+		log.WithError(ferr).Errorf("failed to retrieve the cell formatting of the answer (ID: %d)", answerID)
+	}
+	blocks := make(map[int][]cellDifferences)
+	for _, r := range rows {
+		r.Precedents = worksheetValues(r.WorksheetID)
+		r.ModelPrecedents = worksheetValues(r.ModelSheetID)
+		ae := r.Evaluate()
+		if cell, ok := formatting[r.ID]; ok {
+			if model, ok := formatting[r.ModelCellID]; ok {
+				differences := ae.evaluateFormatting(cell, model)
+				if cell.BlockID.Valid {
+					id := int(cell.BlockID.Int64)
+					blocks[id] = append(blocks[id], cellDifferences{r.Range, differences})
+				}
+			}
+		}
+		if DebugLevel > 1 {
+			log.Debugf("Evaluated %#v: %#v", r, ae)
+		}
+		if DryRun {
+			continue
+		}
+		if err := ae.Save(); err != nil {
+			log.WithError(err).Errorf("failed to store the auto-evaluation of the cell (ID: %d)", r.ID)
+			continue
+		}
+		count++
+	}
+	commentBlockFormatting(blocks)
+	if n, err := EvaluateConditionalFormatting(answerID, modelAnswerUserID); err != nil {
+		log.WithError(err).Errorf("failed to evaluate the conditional formatting of the answer (ID: %d)", answerID)
+	} else if n > 0 && VerboseLevel > 0 {
+		log.Infof("Evaluated %d conditional formatting rule(s) of the answer (ID: %d)", n, answerID)
+	}
+	if n, err := EvaluateFilters(answerID, modelAnswerUserID); err != nil {
+		log.WithError(err).Errorf("failed to evaluate the filters of the answer (ID: %d)", answerID)
+	} else if n > 0 && VerboseLevel > 0 {
+		log.Infof("Evaluated %d filter(s) of the answer (ID: %d)", n, answerID)
+	}
+	if n, err := EvaluateSolverModels(answerID, modelAnswerUserID); err != nil {
+		log.WithError(err).Errorf("failed to evaluate the Solver models of the answer (ID: %d)", answerID)
+	} else if n > 0 && VerboseLevel > 0 {
+		log.Infof("Evaluated %d Solver model(s) of the answer (ID: %d)", n, answerID)
+	}
+	return
+}
+
+// EvaluateAnswers evaluates all the processed answers of the assignment
+// (-1 - all the assignments) against the model answers.
+func EvaluateAnswers(assignmentID, modelAnswerUserID int) error {
+	answers, err := AnswersToEvaluate(assignmentID, modelAnswerUserID)
+	if err != nil {
+		return err
+	}
+	var answerCount, cellCount int
+	for _, a := range answers {
+		count, err := EvaluateAnswer(a.ID, modelAnswerUserID)
+		if err != nil {
+			log.WithError(err).Errorf("failed to evaluate the answer (ID: %d)", a.ID)
+			continue
+		}
+		if VerboseLevel > 0 {
+			log.Infof("Evaluated %d cell(s) of the answer (ID: %d)", count, a.ID)
+		}
+		answerCount++
+		cellCount += count
+	}
+	log.Infof("Evaluated %d cell(s) of %d answer(s).", cellCount, answerCount)
+	return nil
+}
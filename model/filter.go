@@ -0,0 +1,411 @@
+package model
+
+import (
+	"database/sql"
+	x "extract-blocks/model/xlsx"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// excelTime converts the date serial number (the 1900 date system) into the time.
+func excelTime(serial float64) time.Time {
+	days := math.Floor(serial)
+	if days < 61 { // the non-existent 29th of February 1900
+		days++
+	}
+	t := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(days))
+	return t.Add(time.Duration(math.Round((serial-math.Floor(serial))*86400)) * time.Second)
+}
+
+// valueFilterMatcher returns the matcher of the values (and the dates of the date group items) of the filter.
+func valueFilterMatcher(fc x.FilterColumn, column []Value) (func(Value) bool, error) {
+	blank := fc.Filters.Blank == "1" || fc.Filters.Blank == "true"
+	vals := make(map[string]bool, len(fc.Filters.Filter))
+	for _, f := range fc.Filters.Filter {
+		vals[strings.ToLower(f.Val)] = true
+	}
+	// the filter values are the formatted (displayed) values that might differ from the cell values
+	found := make(map[string]bool, len(vals))
+	for _, v := range column {
+		if s := strings.ToLower(v.String()); vals[s] {
+			found[s] = true
+		}
+	}
+	for val := range vals {
+		if !found[val] {
+			return nil, fmt.Errorf("the filter value %q matches none of the cell values", val)
+		}
+	}
+	return func(v Value) bool {
+		if v.Type == ValueEmpty {
+			return blank
+		}
+		if vals[strings.ToLower(v.String())] {
+			return true
+		}
+		if v.Type != ValueNumber {
+			return false
+		}
+		t := excelTime(v.Number)
+		for _, dgi := range fc.Filters.DateGroupItem {
+			matches := true
+			for _, f := range []struct {
+				value, grouping string
+				actual          int
+			}{
+				{dgi.Year, "year", t.Year()},
+				{dgi.Month, "month", int(t.Month())},
+				{dgi.Day, "day", t.Day()},
+				{dgi.Hour, "hour", t.Hour()},
+				{dgi.Minute, "minute", t.Minute()},
+				{dgi.Second, "second", t.Second()},
+			} {
+				if f.value != "" && atoi(f.value) != f.actual {
+					matches = false
+					break
+				}
+				if f.grouping == dgi.DateTimeGrouping {
+					break
+				}
+			}
+			if matches {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// filterOperators maps the custom filter operators to the criteria operators
+var filterOperators = map[string]string{
+	"equal":              "=",
+	"notEqual":           "<>",
+	"greaterThan":        ">",
+	"greaterThanOrEqual": ">=",
+	"lessThan":           "<",
+	"lessThanOrEqual":    "<=",
+}
+
+// filterMatcher returns the matcher of the values kept by the criteria of the filter column
+// (column - the values of the filtered column). It fails if the criteria cannot be evaluated,
+// eg, the filtering by the cell color or the icon.
+func filterMatcher(fc x.FilterColumn, column []Value) (func(Value) bool, error) {
+	var numbers []float64
+	for _, v := range column {
+		if v.Type == ValueNumber {
+			numbers = append(numbers, v.Number)
+		}
+	}
+	switch {
+	case len(fc.Filters.Filter) > 0 || len(fc.Filters.DateGroupItem) > 0 || fc.Filters.Blank != "":
+		return valueFilterMatcher(fc, column)
+
+	case len(fc.CustomFilters.CustomFilter) > 0:
+		isAnd := fc.CustomFilters.And == "1" || fc.CustomFilters.And == "true"
+		var matchers []func(Value) bool
+		for _, cf := range fc.CustomFilters.CustomFilter {
+			op, ok := filterOperators[cf.Operator]
+			if cf.Operator == "" {
+				op, ok = "=", true
+			}
+			if !ok {
+				return nil, fmt.Errorf("unsupported custom filter operator %q", cf.Operator)
+			}
+			matchers = append(matchers, criteria(TextValue(op+cf.Val)))
+		}
+		return func(v Value) bool {
+			for _, m := range matchers {
+				if m(v) != isAnd {
+					return !isAnd
+				}
+			}
+			return isAnd
+		}, nil
+
+	case fc.Top10.Val != "" || fc.Top10.FilterVal != "":
+		isTop := fc.Top10.Top != "0" && fc.Top10.Top != "false"
+		cutOff, err := strconv.ParseFloat(fc.Top10.FilterVal, 64)
+		if err != nil {
+			n, err := strconv.ParseFloat(fc.Top10.Val, 64)
+			if err != nil || len(numbers) == 0 {
+				return nil, fmt.Errorf("invalid top 10 filter %#v", fc.Top10)
+			}
+			if fc.Top10.Percent == "1" || fc.Top10.Percent == "true" {
+				n = math.Ceil(float64(len(numbers)) * n / 100)
+			}
+			k := int(math.Max(1, math.Min(n, float64(len(numbers)))))
+			sort.Float64s(numbers)
+			if isTop {
+				cutOff = numbers[len(numbers)-k]
+			} else {
+				cutOff = numbers[k-1]
+			}
+		}
+		return func(v Value) bool {
+			return v.Type == ValueNumber && (isTop && v.Number >= cutOff || !isTop && v.Number <= cutOff)
+		}, nil
+
+	case fc.DynamicFilter.Type == "aboveAverage" || fc.DynamicFilter.Type == "belowAverage":
+		avg, err := strconv.ParseFloat(fc.DynamicFilter.Val, 64)
+		if err != nil {
+			if avg, err = average(numbers); err != nil {
+				return nil, err
+			}
+		}
+		isAbove := fc.DynamicFilter.Type == "aboveAverage"
+		return func(v Value) bool {
+			return v.Type == ValueNumber && (isAbove && v.Number > avg || !isAbove && v.Number < avg)
+		}, nil
+	}
+	return nil, fmt.Errorf("the filter of the column %s cannot be evaluated", fc.ColId)
+}
+
+// filteredRows returns the data rows (the row numbers, eg, 2 - the second row) of the range kept by the criteria
+// of the filter columns (cols - the offsets in the range of the columns the criteria are applied to).
+func filteredRows(a area, columns []x.FilterColumn, cols []int, values map[string]string) (map[int]bool, error) {
+	kept := make(map[int]bool)
+	for r := a.tRow + 1; r <= a.bRow; r++ {
+		kept[r+1] = true
+	}
+	for i, fc := range columns {
+		column := make([]Value, 0, a.bRow-a.tRow)
+		for r := a.tRow + 1; r <= a.bRow; r++ {
+			column = append(column, ParseValue(values[CellAddress(r, a.lCol+cols[i])]))
+		}
+		match, err := filterMatcher(fc, column)
+		if err != nil {
+			return nil, err
+		}
+		for j, v := range column {
+			if !match(v) {
+				delete(kept, a.tRow+2+j)
+			}
+		}
+	}
+	return kept, nil
+}
+
+// visibleRows returns the data rows of the range (without the header row) that are not hidden.
+func visibleRows(a area, hidden map[int]bool) map[int]bool {
+	visible := make(map[int]bool)
+	for r := a.tRow + 2; r <= a.bRow+1; r++ {
+		if !hidden[r] {
+			visible[r] = true
+		}
+	}
+	return visible
+}
+
+// sameRows tests if both sets contain the same rows.
+func sameRows(a, b map[int]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for r := range a {
+		if !b[r] {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubset tests if all the rows of a are in b.
+func isSubset(a, b map[int]bool) bool {
+	for r := range a {
+		if !b[r] {
+			return false
+		}
+	}
+	return true
+}
+
+// rowRanges formats the set of rows as the list of the row ranges, eg, 2:5,8,10:11.
+func rowRanges(rows map[int]bool) string {
+	sorted := make([]int, 0, len(rows))
+	for r := range rows {
+		sorted = append(sorted, r)
+	}
+	sort.Ints(sorted)
+	var ranges []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if j > i {
+			ranges = append(ranges, strconv.Itoa(sorted[i])+":"+strconv.Itoa(sorted[j]))
+		} else {
+			ranges = append(ranges, strconv.Itoa(sorted[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// verifyFilter sets the visible data rows of the filtered range and compares them with the rows
+// the criteria of the filter columns keep. The mismatch is either the stale filter (the rows
+// the criteria hide are visible, eg, the data were changed after filtering), the rows hidden
+// by hand (the rows the criteria keep are hidden) or the filter on the wrong column
+// (the criteria applied to another column of the range keep the visible rows).
+func (ds *DataSource) verifyFilter(columns []x.FilterColumn, values map[string]string, hidden map[int]bool) {
+	r, err := ParseReference(ds.Range)
+	if err != nil {
+		log.WithError(err).Errorf("Failed to parse the filtered range %q", ds.Range)
+		return
+	}
+	a := referenceArea(r)
+	if a.bRow == math.MaxInt32 || a.rCol == math.MaxInt32 {
+		return
+	}
+	visible := visibleRows(a, hidden)
+	ds.VisibleRows = sql.NullString{String: rowRanges(visible), Valid: true}
+
+	cols := make([]int, len(columns))
+	for i, fc := range columns {
+		cols[i] = atoi(fc.ColId)
+	}
+	kept, err := filteredRows(a, columns, cols, values)
+	if err == nil && sameRows(visible, kept) {
+		ds.IsFilterConsistent = sql.NullBool{Bool: true, Valid: true}
+		return
+	}
+	// the criteria might fail on the column they were recorded on, eg, the value is missing in the column
+	for i := range columns {
+		alt := append([]int(nil), cols...)
+		for c := 0; c <= a.rCol-a.lCol; c++ {
+			if c == cols[i] {
+				continue
+			}
+			alt[i] = c
+			if rows, err := filteredRows(a, columns, alt, values); err == nil && sameRows(visible, rows) {
+				ds.IsFilterConsistent = sql.NullBool{Bool: false, Valid: true}
+				ds.FilterMismatch = "wrong column"
+				return
+			}
+		}
+	}
+	if err != nil {
+		if DebugLevel > 1 {
+			log.WithError(err).Debugf("Failed to verify the filter of %q", ds.Range)
+		}
+		return
+	}
+	ds.IsFilterConsistent = sql.NullBool{Bool: false, Valid: true}
+	if isSubset(visible, kept) {
+		ds.FilterMismatch = "hidden by hand"
+	} else {
+		ds.FilterMismatch = "stale filter"
+	}
+}
+
+// inferFilter captures the rows hidden by hand in the worksheet without the autofilter within
+// the filtered ranges of the model answer worksheet (by the sheet index). The answers often get
+// "filtered" hiding the rows or saved in the way that drops the autofilter.
+func (ws *Worksheet) inferFilter(hidden map[int]bool) {
+	if len(hidden) == 0 || !ws.AnswerID.Valid || ws.Idx == 0 {
+		return
+	}
+	var sources []DataSource
+	if err := Db.
+		Select("DataSources.*").
+		Joins("JOIN WorkSheets AS mws ON mws.id = DataSources.worksheet_id").
+		Joins("JOIN StudentAnswers AS ma ON ma.StudentAnswerID = mws.StudentAnswerID").
+		Joins("JOIN StudentAssignments AS msa ON msa.StudentAssignmentID = ma.StudentAssignmentID").
+		Joins("JOIN StudentAnswers AS a ON a.QuestionID = ma.QuestionID").
+		Where("msa.UserID = ? AND a.StudentAnswerID = ? AND ma.StudentAnswerID <> a.StudentAnswerID",
+			ModelAnswerUserID, ws.AnswerID.Int64).
+		Where("mws.idx = ? AND DataSources.VisibleRows IS NOT NULL AND DataSources.IsFilterInferred = ?", ws.Idx, false).
+		Find(&sources).Error; err != nil {
+		log.WithError(err).Errorf("Failed to retrieve the model answer filters of the worksheet %q", ws.Name)
+		return
+	}
+	for _, s := range sources {
+		r, err := ParseReference(s.Range)
+		if err != nil {
+			continue
+		}
+		a := referenceArea(r)
+		visible := visibleRows(a, hidden)
+		if len(visible) == a.bRow-a.tRow {
+			continue
+		}
+		ds := DataSource{
+			WorksheetID:        ws.ID,
+			Range:              s.Range,
+			VisibleRows:        sql.NullString{String: rowRanges(visible), Valid: true},
+			IsFilterInferred:   true,
+			IsFilterConsistent: sql.NullBool{Bool: false, Valid: true},
+			FilterMismatch:     "hidden by hand",
+		}
+		if err := Db.Create(&ds).Error; err != nil {
+			log.WithError(err).Errorf("Failed to create the inferred filter of %q", s.Range)
+			continue
+		}
+		ws.AddAuxBlock(&Block{
+			Range:   "FilterSource",
+			Formula: s.Range,
+		}, "Filter")
+		if VerboseLevel > 0 {
+			log.Infof("The rows of %q of the worksheet %q are hidden without the filter", s.Range, ws.Name)
+		}
+	}
+}
+
+// filterEvaluationRow - the filtered range with the index of its worksheet
+type filterEvaluationRow struct {
+	ID          int
+	Idx         int
+	VisibleRows sql.NullString
+}
+
+const filterEvaluationQuery = `
+SELECT ds.id, ws.idx, ds.VisibleRows AS visible_rows
+FROM DataSources AS ds
+	JOIN WorkSheets AS ws ON ws.id = ds.worksheet_id
+`
+
+// EvaluateFilters compares the visible rows of the filtered ranges of the answer with the ones
+// of the model answer. The filter is correct if a filtered range of the model answer on the same
+// worksheet (by the sheet index) leaves the same rows visible even if the criteria differ,
+// eg, "Region = North" and "Country = USA".
+func EvaluateFilters(answerID, modelAnswerUserID int) (count int, err error) {
+	var filters, modelFilters []filterEvaluationRow
+	if err = Db.Raw(filterEvaluationQuery+"WHERE ws.StudentAnswerID = ? AND ds.VisibleRows IS NOT NULL",
+		answerID).Scan(&filters).Error; err != nil || len(filters) == 0 {
+		return
+	}
+	if err = Db.Raw(filterEvaluationQuery+`
+	JOIN StudentAnswers AS ma ON ma.StudentAnswerID = ws.StudentAnswerID
+	JOIN StudentAssignments AS sa ON sa.StudentAssignmentID = ma.StudentAssignmentID
+	JOIN StudentAnswers AS a ON a.QuestionID = ma.QuestionID
+WHERE sa.UserID = ? AND a.StudentAnswerID = ? AND ds.VisibleRows IS NOT NULL`, modelAnswerUserID, answerID).Scan(&modelFilters).Error; err != nil {
+		return
+	}
+	for _, f := range filters {
+		var isCorrect bool
+		for _, m := range modelFilters {
+			if m.Idx == f.Idx && m.VisibleRows.String == f.VisibleRows.String {
+				isCorrect = true
+				break
+			}
+		}
+		if DebugLevel > 1 {
+			log.Debugf("Evaluated the filter %#v: %t", f, isCorrect)
+		}
+		if DryRun {
+			continue
+		}
+		if err := Db.Model(&DataSource{}).Where("id = ?", f.ID).Update("IsFilterCorrect", isCorrect).Error; err != nil {
+			log.WithError(err).Errorf("failed to store the evaluation of the filter (ID: %d)", f.ID)
+			continue
+		}
+		count++
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	x "extract-blocks/model/xlsx"
+	"testing"
+)
+
+func TestRowRanges(t *testing.T) {
+	rows := map[int]bool{2: true, 3: true, 4: true, 5: true, 8: true, 10: true, 11: true}
+	if got := rowRanges(rows); got != "2:5,8,10:11" {
+		t.Errorf("Expected 2:5,8,10:11, got: %q", got)
+	}
+	if got := rowRanges(nil); got != "" {
+		t.Errorf("Expected no rows, got: %q", got)
+	}
+}
+
+func TestExcelTime(t *testing.T) {
+	for serial, expected := range map[float64]string{
+		1:         "1900-01-01 00:00",
+		61:        "1900-03-01 00:00",
+		40391:     "2010-08-01 00:00",
+		40391.875: "2010-08-01 21:00",
+	} {
+		if got := excelTime(serial).Format("2006-01-02 15:04"); got != expected {
+			t.Errorf("Expected %v to be %q, got: %q", serial, expected, got)
+		}
+	}
+}
+
+func TestFilterMatcher(t *testing.T) {
+	var column []Value
+	for _, s := range []string{"5", "15", "25", "35", "abc", ""} {
+		column = append(column, ParseValue(s))
+	}
+	var fc x.FilterColumn
+	fc.Top10.Val, fc.Top10.Percent = "50", "1"
+	match, err := filterMatcher(fc, column)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, v := range column {
+		if match(v) {
+			kept = append(kept, v.String())
+		}
+	}
+	if len(kept) != 2 || kept[0] != "25" || kept[1] != "35" {
+		t.Errorf("Expected the top 50%% to keep 25 and 35, got: %v", kept)
+	}
+	fc = x.FilterColumn{}
+	fc.ColorFilter.DxfId = "0"
+	if _, err := filterMatcher(fc, column); err == nil {
+		t.Error("Expected the color filter evaluation to fail")
+	}
+}
@@ -0,0 +1,363 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// horizontalAlignments - the names of the horizontal alignments used in the comments
+var horizontalAlignments = map[string]string{
+	"":                 "general",
+	"center":           "centre",
+	"centerContinuous": "centre across selection",
+}
+
+// numberFormatSections splits the format code into the sections (positive;negative;zero;text)
+// and strips the quoted text, the escaped characters and the bracketed parts, eg, [Red] or [$-409].
+func numberFormatSections(code string) (sections []string) {
+	var (
+		b        strings.Builder
+		quoted   bool
+		brackets bool
+		escaped  bool
+	)
+	for _, r := range code {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted:
+			quoted = r != '"'
+		case brackets:
+			brackets = r != ']'
+		case r == '"':
+			quoted = true
+		case r == '[':
+			brackets = true
+		case r == '\\' || r == '_' || r == '*':
+			escaped = true // the next character is displayed as is (or is the padding)
+		case r == ';':
+			sections = append(sections, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return append(sections, b.String())
+}
+
+// localeTagRe - the locale tag of the number format, eg, [$-409] (unlike the currency, eg, [$€-407])
+var localeTagRe = regexp.MustCompile(`\[\$-[0-9A-Fa-f]+\]`)
+
+// numberFormatKind returns the kind of the number format: general, number, currency,
+// percentage, scientific, fraction, date, time or text.
+func numberFormatKind(code string) string {
+	if code == "" || strings.EqualFold(code, "General") {
+		return "general"
+	}
+	if strings.ContainsAny(localeTagRe.ReplaceAllString(code, ""), "$€£¥") {
+		return "currency"
+	}
+	s := strings.ToLower(numberFormatSections(code)[0])
+	switch {
+	case strings.Contains(s, "%"):
+		return "percentage"
+	case strings.Contains(s, "e+") || strings.Contains(s, "e-"):
+		return "scientific"
+	case strings.Contains(s, "/") && strings.Contains(s, "?"):
+		return "fraction"
+	case strings.ContainsAny(s, "dy") || strings.Contains(s, "mmm"):
+		return "date"
+	case strings.ContainsAny(s, "hs"):
+		return "time"
+	case strings.Contains(s, "@") && !strings.ContainsAny(s, "0#?"):
+		return "text"
+	}
+	return "number"
+}
+
+// decimalPlaces returns the number of the decimal places of the format code (-1 for General).
+func decimalPlaces(code string) int {
+	if numberFormatKind(code) == "general" {
+		return -1
+	}
+	s := numberFormatSections(code)[0]
+	i := strings.Index(s, ".")
+	if i < 0 {
+		return 0
+	}
+	count := 0
+	for _, r := range s[i+1:] {
+		if r != '0' && r != '#' && r != '?' {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+// numberFormatDifference describes the difference of the number format, eg,
+// "number format shows 0 decimals instead of 2".
+func numberFormatDifference(code, expected string) string {
+	if code == expected || strings.EqualFold(code, "General") && expected == "" || code == "" && strings.EqualFold(expected, "General") {
+		return ""
+	}
+	kind, expectedKind := numberFormatKind(code), numberFormatKind(expected)
+	if kind != expectedKind {
+		return fmt.Sprintf("number format should be %s instead of %s", expectedKind, kind)
+	}
+	if d, e := decimalPlaces(code), decimalPlaces(expected); d != e {
+		return fmt.Sprintf("number format shows %d decimals instead of %d", d, e)
+	}
+	return fmt.Sprintf("number format should be %q instead of %q", expected, code)
+}
+
+// formattingDifferences compares the formatting of the answer cell with the formatting
+// of the model answer cell and returns the differences, eg, "border missing bottom".
+func formattingDifferences(cell, model Cell) (differences []string) {
+	add := func(format string, args ...interface{}) {
+		differences = append(differences, fmt.Sprintf(format, args...))
+	}
+
+	// Borders:
+	var b, mb Border
+	if cell.Border != nil {
+		b = *cell.Border
+	}
+	if model.Border != nil {
+		mb = *model.Border
+	}
+	for _, side := range []struct{ name, style, expected string }{
+		{"left", b.Left, mb.Left},
+		{"right", b.Right, mb.Right},
+		{"top", b.Top, mb.Top},
+		{"bottom", b.Bottom, mb.Bottom},
+		{"diagonal", b.Diagonal, mb.Diagonal},
+	} {
+		switch {
+		case side.style == side.expected:
+		case side.style == "":
+			add("border missing %s", side.name)
+		case side.expected == "":
+			add("border unexpected %s", side.name)
+		default:
+			add("border %s should be %s instead of %s", side.name, side.expected, side.style)
+		}
+	}
+
+	// Alignment:
+	var a, ma Alignment
+	if cell.Alignment != nil {
+		a = *cell.Alignment
+	}
+	if model.Alignment != nil {
+		ma = *model.Alignment
+	}
+	if a.Horizontal != ma.Horizontal && !(a.Horizontal == "general" && ma.Horizontal == "" || a.Horizontal == "" && ma.Horizontal == "general") {
+		name, ok := horizontalAlignments[ma.Horizontal]
+		if !ok {
+			name = ma.Horizontal
+		}
+		add("alignment should be %s", name)
+	}
+	if a.Vertical != ma.Vertical && !(a.Vertical == "bottom" && ma.Vertical == "" || a.Vertical == "" && ma.Vertical == "bottom") {
+		name := ma.Vertical
+		if name == "" {
+			name = "bottom"
+		}
+		add("vertical alignment should be %s", strings.Replace(name, "center", "centre", 1))
+	}
+	if a.WrapText != ma.WrapText {
+		if ma.WrapText {
+			add("text should be wrapped")
+		} else {
+			add("text should not be wrapped")
+		}
+	}
+
+	// Number format:
+	if d := numberFormatDifference(cell.CellFormat, model.CellFormat); d != "" {
+		differences = append(differences, d)
+	}
+
+	// Font:
+	if f, mf := cell.FontStyle, model.FontStyle; f != nil && mf != nil {
+		if !strings.EqualFold(f.Name, mf.Name) {
+			add("font should be %s instead of %s", mf.Name, f.Name)
+		}
+		if f.Size != mf.Size {
+			add("font size should be %s instead of %s", formatGeneral(mf.Size), formatGeneral(f.Size))
+		}
+		for _, s := range []struct {
+			name         string
+			on, expected bool
+		}{
+			{"bold", f.Bold, mf.Bold},
+			{"italic", f.Italic, mf.Italic},
+			{"struck through", f.Strike, mf.Strike},
+		} {
+			if s.on != s.expected {
+				if s.expected {
+					add("font should be %s", s.name)
+				} else {
+					add("font should not be %s", s.name)
+				}
+			}
+		}
+		switch {
+		case f.Underline == mf.Underline:
+		case mf.Underline == "":
+			add("font should not be underlined")
+		case f.Underline == "":
+			add("font should be underlined")
+		default:
+			add("font underline should be %s instead of %s", mf.Underline, f.Underline)
+		}
+		if !SameColor(f.Color, mf.Color) {
+			add("font colour should be %s instead of %s", mf.Color, f.Color)
+		}
+	}
+
+	// Fill:
+	if f, mf := cell.FillStyle, model.FillStyle; f != nil && mf != nil {
+		pattern, expected := f.Pattern, mf.Pattern
+		if pattern == "" {
+			pattern = "none"
+		}
+		if expected == "" {
+			expected = "none"
+		}
+		if pattern != expected {
+			add("fill pattern should be %s instead of %s", expected, pattern)
+		} else if expected != "none" && !SameColor(f.FgColor, mf.FgColor) {
+			add("fill colour should be %s instead of %s", mf.FgColor, f.FgColor)
+		}
+	}
+
+	// Merged cells:
+	switch {
+	case cell.MergedRef == model.MergedRef:
+	case model.MergedRef == "":
+		add("cells should not be merged")
+	case cell.MergedRef == "":
+		add("cells should be merged as %s", model.MergedRef)
+	default:
+		add("cells should be merged as %s instead of %s", model.MergedRef, cell.MergedRef)
+	}
+	return
+}
+
+// evaluateFormatting compares the formatting of the answer cell with the model answer cell.
+func (ae *AutoEvaluation) evaluateFormatting(cell, model Cell) []string {
+	differences := formattingDifferences(cell, model)
+	ae.IsFormattingCorrect = sql.NullBool{Bool: len(differences) == 0, Valid: true}
+	ae.FormattingResult = truncate(strings.Join(differences, ", "), 1000)
+	return differences
+}
+
+// formattingCells retrieves the answer and the model answer cells of the evaluation rows with their
+// formatting (cell ID -> cell). The formatting is evaluated only for the formatting questions.
+func formattingCells(answerID int, rows []EvaluationRow) (map[int]Cell, error) {
+	var q Question
+	if err := Db.
+		Joins("JOIN StudentAnswers AS a ON a.QuestionID = Questions.QuestionID").
+		Where("a.StudentAnswerID = ?", answerID).
+		First(&q).Error; err != nil || !q.IsFormatting {
+		return nil, err
+	}
+	worksheets := make(map[int]bool)
+	for _, r := range rows {
+		worksheets[r.WorksheetID], worksheets[r.ModelSheetID] = true, true
+	}
+	ids := make([]int, 0, len(worksheets))
+	for id := range worksheets {
+		ids = append(ids, id)
+	}
+	var cells []Cell
+	if err := Db.
+		Preload("Border").Preload("Alignment").Preload("FontStyle").Preload("FillStyle").
+		Where("worksheet_id IN (?)", ids).
+		Find(&cells).Error; err != nil {
+		return nil, err
+	}
+	formatting := make(map[int]Cell, len(cells))
+	for _, c := range cells {
+		formatting[c.ID] = c
+	}
+	return formatting, nil
+}
+
+// cellDifferences - the formatting differences of a block cell
+type cellDifferences struct {
+	address     string
+	differences []string
+}
+
+// blockFormattingComment summarises the formatting differences of the block cells, eg,
+// "Formatting of B2:D4: border missing bottom (B4, C4, D4); font should be bold".
+// The cells are listed only if not all the evaluated block cells have the difference.
+func blockFormattingComment(blockRange string, cells []cellDifferences) string {
+	var (
+		order     []string
+		addresses = make(map[string][]string)
+	)
+	for _, c := range cells {
+		for _, d := range c.differences {
+			if _, ok := addresses[d]; !ok {
+				order = append(order, d)
+			}
+			addresses[d] = append(addresses[d], c.address)
+		}
+	}
+	if len(order) == 0 {
+		return ""
+	}
+	parts := make([]string, len(order))
+	for i, d := range order {
+		parts[i] = d
+		if len(addresses[d]) < len(cells) {
+			parts[i] += " (" + strings.Join(addresses[d], ", ") + ")"
+		}
+	}
+	return "Formatting of " + blockRange + ": " + strings.Join(parts, "; ")
+}
+
+// commentBlockFormatting adds the summary of the formatting differences
+// to the answer blocks (block ID -> the evaluated block cells).
+func commentBlockFormatting(blocks map[int][]cellDifferences) {
+	ids := make([]int, 0, len(blocks))
+	for id := range blocks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		var b Block
+		if err := Db.First(&b, id).Error; err != nil {
+			log.WithError(err).Errorf("failed to retrieve the block (ID: %d)", id)
+			continue
+		}
+		text := blockFormattingComment(b.Range, blocks[id])
+		if text == "" {
+			continue
+		}
+		if DebugLevel > 1 {
+			log.Debugf("Block %q (ID: %d): %s", b.Range, b.ID, text)
+		}
+		if DryRun {
+			continue
+		}
+		comment := Comment{Text: text}
+		if err := Db.FirstOrCreate(&comment, comment).Error; err != nil {
+			log.WithError(err).Errorf("failed to create the comment %q", text)
+			continue
+		}
+		var bc BlockCommentMapping
+		if err := Db.FirstOrCreate(&bc, BlockCommentMapping{BlockID: b.ID, CommentID: comment.ID}).Error; err != nil {
+			log.WithError(err).Errorf("failed to map the comment %q to the block (ID: %d)", text, b.ID)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNumberFormatDifference(t *testing.T) {
+	for _, c := range []struct {
+		code, expected, difference string
+	}{
+		{"#,##0.00", "#,##0.00", ""},
+		{"", "General", ""},
+		{"0", "0.00", "number format shows 0 decimals instead of 2"},
+		{`"$"#,##0_);("$"#,##0)`, `"$"#,##0.00_);("$"#,##0.00)`, "number format shows 0 decimals instead of 2"},
+		{"0.00", `_("$"* #,##0.00_);_("$"* \(#,##0.00\);_("$"* "-"??_);_(@_)`, "number format should be currency instead of number"},
+		{"", "0.0%", "number format should be percentage instead of general"},
+		{"[$-409]d-mmm-yy", "0.00", "number format should be number instead of date"},
+		{"#,##0", "0", `number format should be "0" instead of "#,##0"`},
+	} {
+		if got := numberFormatDifference(c.code, c.expected); got != c.difference {
+			t.Errorf("Expected the difference of %q and %q to be %q, got: %q", c.code, c.expected, c.difference, got)
+		}
+	}
+}
+
+func TestFormattingDifferences(t *testing.T) {
+	cell := Cell{
+		Border:    &Border{Left: "thin", Bottom: "thin"},
+		Alignment: &Alignment{Horizontal: "general"},
+		FontStyle: &Font{Name: "Calibri", Size: 11, Underline: "single", Color: "FF000000"},
+		FillStyle: &Fill{Pattern: "solid", FgColor: "FFFFFF00"},
+	}
+	model := Cell{
+		Border:     &Border{Bottom: "double"},
+		Alignment:  &Alignment{Vertical: "center", WrapText: true},
+		FontStyle:  &Font{Name: "calibri", Size: 11, Italic: true, Color: "FF000001"},
+		FillStyle:  &Fill{Pattern: "solid", FgColor: "FFFFC000"},
+		MergedRef:  "B2:D2",
+		CellFormat: "General",
+	}
+	expected := []string{
+		"border unexpected left",
+		"border bottom should be double instead of thin",
+		"vertical alignment should be centre",
+		"text should be wrapped",
+		"font should be italic",
+		"font should not be underlined",
+		"fill colour should be FFFFC000 instead of FFFFFF00",
+		"cells should be merged as B2:D2",
+	}
+	if got := formattingDifferences(cell, model); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the differences %q, got: %q", expected, got)
+	}
+	if got := formattingDifferences(model, model); len(got) != 0 {
+		t.Errorf("Expected no differences, got: %q", got)
+	}
+}
+
+func TestBlockFormattingComment(t *testing.T) {
+	comment := blockFormattingComment("B2:B3", []cellDifferences{
+		{"B2", []string{"border missing bottom", "font should be bold"}},
+		{"B3", []string{"font should be bold"}},
+	})
+	if expected := "Formatting of B2:B3: border missing bottom (B2); font should be bold"; comment != expected {
+		t.Errorf("Expected %q, got: %q", expected, comment)
+	}
+	if comment := blockFormattingComment("B2:B3", []cellDifferences{{"B2", nil}, {"B3", nil}}); comment != "" {
+		t.Errorf("Expected no comment, got: %q", comment)
+	}
+}
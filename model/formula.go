@@ -0,0 +1,1000 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// TokenType - the type of a formula token
+type TokenType int
+
+// Formula token types
+const (
+	TokenUnknown             TokenType = iota
+	TokenNumber                        // 123, 1.5E+10
+	TokenText                          // "text"
+	TokenBool                          // TRUE, FALSE
+	TokenError                         // #N/A, #REF!, ...
+	TokenReference                     // A1, $A$1:B2, A:A, 3:3, 'Sheet 1'!B2
+	TokenName                          // defined name
+	TokenStructuredReference           // Table1[Column], [@Column]
+	TokenFunction                      // function name (followed by the opening parenthesis)
+	TokenOperator                      // +, -, *, /, ^, &, %, =, <>, <, >, <=, >=, :
+	TokenOpen                          // (
+	TokenClose                         // )
+	TokenArrayOpen                     // {
+	TokenArrayClose                    // }
+	TokenSeparator                     // , (argument separator or the union operator)
+	TokenRowSeparator                  // ; (array row separator)
+	TokenSpace                         // white space (or the intersection operator)
+)
+
+var tokenTypeNames = map[TokenType]string{
+	TokenUnknown:             "Unknown",
+	TokenNumber:              "Number",
+	TokenText:                "Text",
+	TokenBool:                "Bool",
+	TokenError:               "Error",
+	TokenReference:           "Reference",
+	TokenName:                "Name",
+	TokenStructuredReference: "StructuredReference",
+	TokenFunction:            "Function",
+	TokenOperator:            "Operator",
+	TokenOpen:                "Open",
+	TokenClose:               "Close",
+	TokenArrayOpen:           "ArrayOpen",
+	TokenArrayClose:          "ArrayClose",
+	TokenSeparator:           "Separator",
+	TokenRowSeparator:        "RowSeparator",
+	TokenSpace:               "Space",
+}
+
+func (tt TokenType) String() string {
+	if name, ok := tokenTypeNames[tt]; ok {
+		return name
+	}
+	return strconv.Itoa(int(tt))
+}
+
+// Token - a lexical unit of a formula. Concatenated token values
+// reproduce the original formula.
+type Token struct {
+	Type  TokenType
+	Value string
+	Pos   int // the position (in runes) of the token within the formula
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%s(%q)", t.Type, t.Value)
+}
+
+// formulaErrors - the error literals recognised in formulas
+var formulaErrors = []string{
+	"#NULL!", "#DIV/0!", "#VALUE!", "#REF!", "#NAME?", "#NUM!", "#N/A",
+	"#GETTING_DATA", "#SPILL!", "#CALC!", "#FIELD!", "#BLOCKED!", "#UNKNOWN!",
+}
+
+// MaxColumns and MaxRows - the sheet dimensions of the current Excel versions
+const (
+	MaxColumns = 16384
+	MaxRows    = 1048576
+)
+
+var (
+	cellRefRe   = regexp.MustCompile(`^(\$?)([A-Za-z]{1,3})(\$?)([0-9]{1,7})$`)
+	columnRefRe = regexp.MustCompile(`^(\$?)([A-Za-z]{1,3})$`)
+	rowRefRe    = regexp.MustCompile(`^(\$?)([0-9]{1,7})$`)
+)
+
+type lexer struct {
+	input  []rune
+	pos    int
+	tokens []Token
+}
+
+func (l *lexer) peek(offset int) rune {
+	if i := l.pos + offset; i < len(l.input) {
+		return l.input[i]
+	}
+	return 0
+}
+
+func (l *lexer) emit(tt TokenType, start int) {
+	l.tokens = append(l.tokens, Token{Type: tt, Value: string(l.input[start:l.pos]), Pos: start})
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '.' || r == '\\' || r == '?' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+// readWord consumes a run of the name (or cell reference) characters.
+func (l *lexer) readWord() string {
+	start := l.pos
+	for l.pos < len(l.input) && isWordRune(l.input[l.pos]) {
+		l.pos++
+	}
+	return string(l.input[start:l.pos])
+}
+
+// readBrackets consumes a (possibly nested) bracketed part, eg, [[#This Row],[Col]].
+func (l *lexer) readBrackets() error {
+	start, depth := l.pos, 0
+	for ; l.pos < len(l.input); l.pos++ {
+		switch l.input[l.pos] {
+		case '\'':
+			// escaped special character within a column name
+			l.pos++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				l.pos++
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unterminated bracket at %d", start)
+}
+
+// readQuoted consumes a quoted string with the quote character escaped by doubling it.
+func (l *lexer) readQuoted(quote rune) error {
+	start := l.pos
+	for l.pos++; l.pos < len(l.input); l.pos++ {
+		if l.input[l.pos] == quote {
+			if l.peek(1) == quote {
+				l.pos++
+				continue
+			}
+			l.pos++
+			return nil
+		}
+	}
+	return fmt.Errorf("unterminated %c at %d", quote, start)
+}
+
+// readError consumes an error literal.
+func (l *lexer) readError() bool {
+	rest := strings.ToUpper(string(l.input[l.pos:]))
+	for _, e := range formulaErrors {
+		if strings.HasPrefix(rest, e) {
+			l.pos += len([]rune(e))
+			return true
+		}
+	}
+	return false
+}
+
+// refKind classifies a reference part: 'c' - cell, 'C' - whole column, 'R' - whole row, 0 - not a reference.
+func refKind(s string) byte {
+	if m := cellRefRe.FindStringSubmatch(s); m != nil {
+		if col, row := columnIndex(m[2]), atoi(m[4]); col < MaxColumns && row > 0 && row <= MaxRows {
+			return 'c'
+		}
+		return 0
+	}
+	if m := columnRefRe.FindStringSubmatch(s); m != nil && columnIndex(m[2]) < MaxColumns {
+		return 'C'
+	}
+	if m := rowRefRe.FindStringSubmatch(s); m != nil {
+		if row := atoi(m[2]); row > 0 && row <= MaxRows {
+			return 'R'
+		}
+	}
+	return 0
+}
+
+// readRangeEnd tries to extend the reference of the given kind into a range (eg, A1:B2, A:C, 1:3).
+func (l *lexer) readRangeEnd(kind byte) bool {
+	if kind == 0 || l.peek(0) != ':' {
+		return false
+	}
+	start := l.pos
+	l.pos++
+	if word := l.readWord(); word != "" && refKind(word) == kind && l.peek(0) != '(' && l.peek(0) != '!' {
+		return true
+	}
+	l.pos = start
+	return false
+}
+
+// readReferenceBody consumes the part of the reference following the sheet name and '!'.
+func (l *lexer) readReferenceBody(start int) error {
+	if l.peek(0) == '#' {
+		if !l.readError() {
+			return fmt.Errorf("invalid reference at %d", start)
+		}
+		l.emit(TokenReference, start)
+		return nil
+	}
+	word := l.readWord()
+	if word == "" {
+		return fmt.Errorf("invalid reference at %d", start)
+	}
+	kind := refKind(word)
+	switch {
+	case kind == 'c':
+		l.readRangeEnd(kind)
+		l.emit(TokenReference, start)
+	case kind != 0 && l.readRangeEnd(kind):
+		l.emit(TokenReference, start)
+	default:
+		// sheet level defined name
+		l.emit(TokenName, start)
+	}
+	return nil
+}
+
+// Tokenize splits the formula into tokens.
+func Tokenize(formula string) (tokens []Token, err error) {
+	l := lexer{input: []rune(formula)}
+	for l.pos < len(l.input) {
+		start, r := l.pos, l.input[l.pos]
+		switch {
+		case isSpace(r):
+			for l.pos < len(l.input) && isSpace(l.input[l.pos]) {
+				l.pos++
+			}
+			l.emit(TokenSpace, start)
+		case r == '"':
+			if err = l.readQuoted('"'); err != nil {
+				return
+			}
+			l.emit(TokenText, start)
+		case r == '#':
+			if !l.readError() {
+				return nil, fmt.Errorf("unknown error literal at %d in %q", start, formula)
+			}
+			l.emit(TokenError, start)
+		case r == '\'':
+			// quoted sheet name
+			if err = l.readQuoted('\''); err != nil {
+				return
+			}
+			if l.peek(0) != '!' {
+				return nil, fmt.Errorf("expected '!' at %d in %q", l.pos, formula)
+			}
+			l.pos++
+			if err = l.readReferenceBody(start); err != nil {
+				return
+			}
+		case r == '[':
+			if err = l.readBrackets(); err != nil {
+				return
+			}
+			// external workbook reference, eg, [1]Sheet1!A1
+			if p := l.pos; isWordRune(l.peek(0)) {
+				l.readWord()
+				if l.peek(0) == '!' {
+					l.pos++
+					if err = l.readReferenceBody(start); err != nil {
+						return
+					}
+					continue
+				}
+				l.pos = p
+			}
+			l.emit(TokenStructuredReference, start)
+		case r == '(':
+			l.pos++
+			l.emit(TokenOpen, start)
+		case r == ')':
+			l.pos++
+			l.emit(TokenClose, start)
+		case r == '{':
+			l.pos++
+			l.emit(TokenArrayOpen, start)
+		case r == '}':
+			l.pos++
+			l.emit(TokenArrayClose, start)
+		case r == ',':
+			l.pos++
+			l.emit(TokenSeparator, start)
+		case r == ';':
+			l.pos++
+			l.emit(TokenRowSeparator, start)
+		case r == '<':
+			l.pos++
+			if n := l.peek(0); n == '=' || n == '>' {
+				l.pos++
+			}
+			l.emit(TokenOperator, start)
+		case r == '>':
+			l.pos++
+			if l.peek(0) == '=' {
+				l.pos++
+			}
+			l.emit(TokenOperator, start)
+		case strings.ContainsRune("+-*/^&%=:", r):
+			l.pos++
+			l.emit(TokenOperator, start)
+		case unicode.IsDigit(r) || r == '.' && unicode.IsDigit(l.peek(1)):
+			// whole row range, eg, 1:3
+			if word := l.readWord(); refKind(word) == 'R' && l.readRangeEnd('R') {
+				l.emit(TokenReference, start)
+				continue
+			}
+			l.pos = start
+			for unicode.IsDigit(l.peek(0)) {
+				l.pos++
+			}
+			if l.peek(0) == '.' {
+				for l.pos++; unicode.IsDigit(l.peek(0)); l.pos++ {
+				}
+			}
+			if e := l.peek(0); e == 'e' || e == 'E' {
+				p := l.pos
+				l.pos++
+				if s := l.peek(0); s == '+' || s == '-' {
+					l.pos++
+				}
+				if !unicode.IsDigit(l.peek(0)) {
+					l.pos = p
+				}
+				for unicode.IsDigit(l.peek(0)) {
+					l.pos++
+				}
+			}
+			l.emit(TokenNumber, start)
+		case isWordRune(r):
+			word := l.readWord()
+			switch l.peek(0) {
+			case '(':
+				l.emit(TokenFunction, start)
+				continue
+			case '!':
+				l.pos++
+				if err = l.readReferenceBody(start); err != nil {
+					return
+				}
+				continue
+			case '[':
+				if err = l.readBrackets(); err != nil {
+					return
+				}
+				l.emit(TokenStructuredReference, start)
+				continue
+			case ':':
+				// 3D reference, eg, Sheet1:Sheet3!A1
+				p := l.pos
+				l.pos++
+				if l.readWord() != "" && l.peek(0) == '!' {
+					l.pos++
+					if err = l.readReferenceBody(start); err != nil {
+						return
+					}
+					continue
+				}
+				l.pos = p
+			}
+			if u := strings.ToUpper(word); u == "TRUE" || u == "FALSE" {
+				l.emit(TokenBool, start)
+				continue
+			}
+			kind := refKind(word)
+			switch {
+			case kind == 'c':
+				l.readRangeEnd(kind)
+				l.emit(TokenReference, start)
+			case kind != 0 && l.readRangeEnd(kind):
+				l.emit(TokenReference, start)
+			default:
+				l.emit(TokenName, start)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d in %q", r, start, formula)
+		}
+	}
+	return l.tokens, nil
+}
+
+// columnIndex maps the column letters to the zero based column index.
+func columnIndex(letters string) (col int) {
+	for _, r := range strings.ToUpper(letters) {
+		col = col*26 + int(r-'A') + 1
+	}
+	return col - 1
+}
+
+// columnLetters maps the zero based column index to the column letters.
+func columnLetters(col int) string {
+	var letters []byte
+	for col++; col > 0; col = (col - 1) / 26 {
+		letters = append([]byte{byte('A' + (col-1)%26)}, letters...)
+	}
+	return string(letters)
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
+
+// CellReference - a single cell reference with zero based coordinates.
+// Col is -1 for a whole row and Row is -1 for a whole column reference.
+type CellReference struct {
+	Col, Row       int
+	AbsCol, AbsRow bool
+}
+
+func parseCellReference(s string) (c CellReference, err error) {
+	if m := cellRefRe.FindStringSubmatch(s); m != nil {
+		return CellReference{
+			Col: columnIndex(m[2]), AbsCol: m[1] == "$",
+			Row: atoi(m[4]) - 1, AbsRow: m[3] == "$",
+		}, nil
+	}
+	if m := columnRefRe.FindStringSubmatch(s); m != nil {
+		return CellReference{Col: columnIndex(m[2]), AbsCol: m[1] == "$", Row: -1}, nil
+	}
+	if m := rowRefRe.FindStringSubmatch(s); m != nil {
+		return CellReference{Col: -1, Row: atoi(m[2]) - 1, AbsRow: m[1] == "$"}, nil
+	}
+	return c, fmt.Errorf("invalid cell reference %q", s)
+}
+
+func (c CellReference) String() (s string) {
+	if c.Col >= 0 {
+		if c.AbsCol {
+			s += "$"
+		}
+		s += columnLetters(c.Col)
+	}
+	if c.Row >= 0 {
+		if c.AbsRow {
+			s += "$"
+		}
+		s += strconv.Itoa(c.Row + 1)
+	}
+	return
+}
+
+// R1C1 returns the reference in the R1C1 notation relative to the given cell.
+// The absolute parts are represented by the zero based index.
+func (c CellReference) R1C1(rowIndex, colIndex int) (r1c1 string) {
+	if c.Row >= 0 {
+		if c.AbsRow {
+			r1c1 = fmt.Sprintf("R[%d]", c.Row)
+		} else {
+			r1c1 = fmt.Sprintf("R[%+d]", c.Row-rowIndex)
+		}
+	}
+	if c.Col >= 0 {
+		if c.AbsCol {
+			r1c1 += fmt.Sprintf("C[%d]", c.Col)
+		} else {
+			r1c1 += fmt.Sprintf("C[%+d]", c.Col-colIndex)
+		}
+	}
+	return
+}
+
+// Reference - a cell, range, whole column or whole row reference
+// optionally qualified with the sheet (and the external workbook) name.
+type Reference struct {
+	Workbook string // external workbook, eg, "1" for [1]Sheet1!A1
+	Sheet    string // unquoted sheet name, eg, "Sheet 1" for 'Sheet 1'!A1
+	From, To CellReference
+	IsRange  bool
+	IsError  bool // #REF!
+}
+
+// ParseReference parses a reference, eg, A1, $A$1:B2, A:A, 3:3, 'Sheet 1'!B2.
+func ParseReference(s string) (ref Reference, err error) {
+	body := s
+	// the body part never contains '!' except "#REF!"
+	core := s
+	if strings.HasSuffix(strings.ToUpper(s), "#REF!") {
+		core = s[:len(s)-len("#REF!")] + "#REF"
+	}
+	if i := strings.LastIndex(core, "!"); i >= 0 {
+		prefix := s[:i]
+		body = s[i+1:]
+		if strings.HasPrefix(prefix, "'") && strings.HasSuffix(prefix, "'") && len(prefix) > 1 {
+			prefix = strings.Replace(prefix[1:len(prefix)-1], "''", "'", -1)
+		}
+		if strings.HasPrefix(prefix, "[") {
+			if j := strings.Index(prefix, "]"); j > 0 {
+				ref.Workbook, prefix = prefix[1:j], prefix[j+1:]
+			}
+		}
+		ref.Sheet = prefix
+	}
+	if strings.ToUpper(body) == "#REF!" {
+		ref.IsError = true
+		return
+	}
+	parts := strings.Split(body, ":")
+	if len(parts) > 2 {
+		return ref, fmt.Errorf("invalid reference %q", s)
+	}
+	if ref.From, err = parseCellReference(parts[0]); err != nil {
+		return
+	}
+	ref.To = ref.From
+	if len(parts) == 2 {
+		ref.IsRange = true
+		if ref.To, err = parseCellReference(parts[1]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+var plainSheetNameRe = regexp.MustCompile(`^[\pL_][\pL\pN_.]*$`)
+
+// SheetPrefix returns the sheet name qualifier (quoted if necessary) including '!'.
+func (r Reference) SheetPrefix() string {
+	if r.Sheet == "" && r.Workbook == "" {
+		return ""
+	}
+	name := r.Sheet
+	if r.Workbook != "" {
+		name = "[" + r.Workbook + "]" + name
+	}
+	if !plainSheetNameRe.MatchString(r.Sheet) || refKind(r.Sheet) != 0 {
+		name = "'" + strings.Replace(name, "'", "''", -1) + "'"
+	}
+	return name + "!"
+}
+
+func (r Reference) String() string {
+	if r.IsError {
+		return r.SheetPrefix() + "#REF!"
+	}
+	if r.IsRange {
+		return r.SheetPrefix() + r.From.String() + ":" + r.To.String()
+	}
+	return r.SheetPrefix() + r.From.String()
+}
+
+// R1C1 returns the reference in the R1C1 notation relative to the given cell.
+func (r Reference) R1C1(rowIndex, colIndex int) string {
+	if r.IsError {
+		return r.SheetPrefix() + "#REF!"
+	}
+	if r.IsRange {
+		return r.SheetPrefix() + r.From.R1C1(rowIndex, colIndex) + ":" + r.To.R1C1(rowIndex, colIndex)
+	}
+	return r.SheetPrefix() + r.From.R1C1(rowIndex, colIndex)
+}
+
+// Expr - a node of the parsed formula
+type Expr interface {
+	String() string
+}
+
+type (
+	// NumberExpr - a numeric constant
+	NumberExpr struct{ Value float64 }
+	// TextExpr - a string constant
+	TextExpr struct{ Value string }
+	// BoolExpr - a logical constant
+	BoolExpr struct{ Value bool }
+	// ErrorExpr - an error constant, eg, #N/A
+	ErrorExpr struct{ Value string }
+	// MissingExpr - an omitted function argument, eg, the second argument of IF(A1,,1)
+	MissingExpr struct{}
+	// RefExpr - a cell, range, whole column or row reference
+	RefExpr struct{ Reference }
+	// NameExpr - a defined name
+	NameExpr struct{ Name string }
+	// StructuredRefExpr - a table (structured) reference
+	StructuredRefExpr struct{ Text string }
+	// FuncExpr - a function call
+	FuncExpr struct {
+		Name string
+		Args []Expr
+	}
+	// UnaryExpr - the prefix (+, -) or postfix (%) operation
+	UnaryExpr struct {
+		Op      string
+		Operand Expr
+	}
+	// BinaryExpr - the binary operation. Besides the arithmetic, comparison and
+	// concatenation operators it includes the reference operators: range (:),
+	// intersection (" ") and union (,)
+	BinaryExpr struct {
+		Op          string
+		Left, Right Expr
+	}
+	// ArrayExpr - an array constant, eg, {1,2;3,4}
+	ArrayExpr struct{ Rows [][]Expr }
+)
+
+// binary operator binding powers
+var binaryPrecedence = map[string]int{
+	"=": 1, "<>": 1, "<": 1, ">": 1, "<=": 1, ">=": 1,
+	"&": 2,
+	"+": 3, "-": 3,
+	"*": 4, "/": 4,
+	"^": 5,
+	",": 8,
+	" ": 9,
+	":": 10,
+}
+
+const (
+	postfixPrecedence = 6
+	prefixPrecedence  = 7
+)
+
+func precedence(e Expr) int {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		return binaryPrecedence[e.Op]
+	case *UnaryExpr:
+		if e.Op == "%" {
+			return postfixPrecedence
+		}
+		return prefixPrecedence
+	}
+	return 100
+}
+
+// functionAliases - the newer function names mapped to their compatible versions CWA-295
+var functionAliases = map[string]string{
+	"STDEV.S":   "STDEV",
+	"VAR.S":     "VAR",
+	"VAR.P":     "VARP",
+	"MODE.SNGL": "MODE",
+}
+
+// canonicalFunctionName strips the future function prefixes (_xlfn., _xlws.)
+// and maps the function name to the compatible one.
+func canonicalFunctionName(name string) string {
+	for _, prefix := range []string{"_xlfn.", "_xlws."} {
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			name = name[len(prefix):]
+		}
+	}
+	if alias, ok := functionAliases[strings.ToUpper(name)]; ok {
+		return alias
+	}
+	return name
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'G', -1, 64)
+}
+
+func (e *NumberExpr) String() string { return formatNumber(e.Value) }
+func (e *TextExpr) String() string {
+	return `"` + strings.Replace(e.Value, `"`, `""`, -1) + `"`
+}
+func (e *BoolExpr) String() string {
+	if e.Value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+func (e *ErrorExpr) String() string         { return e.Value }
+func (e *MissingExpr) String() string       { return "" }
+func (e *RefExpr) String() string           { return e.Reference.String() }
+func (e *NameExpr) String() string          { return strings.ToUpper(e.Name) }
+func (e *StructuredRefExpr) String() string { return strings.ToUpper(e.Text) }
+func (e *FuncExpr) String() string          { return formatExpr(e, nil) }
+func (e *UnaryExpr) String() string         { return formatExpr(e, nil) }
+func (e *BinaryExpr) String() string        { return formatExpr(e, nil) }
+func (e *ArrayExpr) String() string         { return formatExpr(e, nil) }
+
+// formatExpr prints out the expression in the canonical form: no white spaces,
+// upper case names, minimal parentheses and, if the cell (row and column) is given,
+// the references in the relative R1C1 notation.
+func formatExpr(e Expr, cell *[2]int) string {
+	switch e := e.(type) {
+	case *RefExpr:
+		if cell != nil {
+			return e.R1C1(cell[0], cell[1])
+		}
+		return e.Reference.String()
+	case *FuncExpr:
+		args := make([]string, len(e.Args))
+		for i, a := range e.Args {
+			args[i] = formatExpr(a, cell)
+			if b, ok := a.(*BinaryExpr); ok && b.Op == "," {
+				args[i] = "(" + args[i] + ")"
+			}
+		}
+		return strings.ToUpper(e.Name) + "(" + strings.Join(args, ",") + ")"
+	case *UnaryExpr:
+		operand := formatExpr(e.Operand, cell)
+		if precedence(e.Operand) < precedence(e) {
+			operand = "(" + operand + ")"
+		}
+		if e.Op == "%" {
+			return operand + e.Op
+		}
+		return e.Op + operand
+	case *BinaryExpr:
+		p := precedence(e)
+		left, right := formatExpr(e.Left, cell), formatExpr(e.Right, cell)
+		if precedence(e.Left) < p {
+			left = "(" + left + ")"
+		}
+		if precedence(e.Right) <= p {
+			right = "(" + right + ")"
+		}
+		return left + e.Op + right
+	case *ArrayExpr:
+		rows := make([]string, len(e.Rows))
+		for i, row := range e.Rows {
+			values := make([]string, len(row))
+			for j, v := range row {
+				values[j] = formatExpr(v, cell)
+			}
+			rows[i] = strings.Join(values, ",")
+		}
+		return "{" + strings.Join(rows, ";") + "}"
+	}
+	return e.String()
+}
+
+type parser struct {
+	tokens []Token
+	pos    int
+}
+
+func (p *parser) peek() *Token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) next() *Token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(tt TokenType) error {
+	if t := p.next(); t == nil || t.Type != tt {
+		return p.errorf("expected %s", tt)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if t := p.peek(); t != nil {
+		return fmt.Errorf("%s at %d (%q)", msg, t.Pos, t.Value)
+	}
+	return fmt.Errorf("%s at the end of the formula", msg)
+}
+
+// significantTokens removes the white spaces replacing the ones
+// between two reference operands with the intersection operator.
+func significantTokens(tokens []Token) (result []Token) {
+	isOperandEnd := func(t Token) bool {
+		return t.Type == TokenReference || t.Type == TokenName ||
+			t.Type == TokenStructuredReference || t.Type == TokenClose
+	}
+	isOperandStart := func(t Token) bool {
+		return t.Type == TokenReference || t.Type == TokenName ||
+			t.Type == TokenStructuredReference || t.Type == TokenFunction || t.Type == TokenOpen
+	}
+	for i, t := range tokens {
+		if t.Type != TokenSpace {
+			result = append(result, t)
+			continue
+		}
+		if len(result) > 0 && i+1 < len(tokens) &&
+			isOperandEnd(result[len(result)-1]) && isOperandStart(tokens[i+1]) {
+			result = append(result, Token{Type: TokenOperator, Value: " ", Pos: t.Pos})
+		}
+	}
+	return
+}
+
+// ParseFormula parses the formula (with or without the leading '=') into the expression tree.
+func ParseFormula(formula string) (Expr, error) {
+	tokens, err := Tokenize(formula)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: significantTokens(tokens)}
+	if t := p.peek(); t != nil && t.Type == TokenOperator && t.Value == "=" {
+		p.next()
+	}
+	if p.peek() == nil {
+		return nil, fmt.Errorf("empty formula %q", formula)
+	}
+	e, err := p.parseExpr(0, false)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != nil {
+		return nil, p.errorf("unexpected token")
+	}
+	return e, nil
+}
+
+// parseExpr parses the expression with the operators binding tighter than minPrecedence.
+// If union is set, the comma is treated as the union operator (within parentheses).
+func (p *parser) parseExpr(minPrecedence int, union bool) (Expr, error) {
+	left, err := p.parseOperand(union)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t == nil {
+			return left, nil
+		}
+		var op string
+		switch {
+		case t.Type == TokenOperator:
+			op = t.Value
+		case t.Type == TokenSeparator && union:
+			op = ","
+		default:
+			return left, nil
+		}
+		if op == "%" {
+			if postfixPrecedence <= minPrecedence {
+				return left, nil
+			}
+			p.next()
+			left = &UnaryExpr{Op: op, Operand: left}
+			continue
+		}
+		prec, ok := binaryPrecedence[op]
+		if !ok {
+			return nil, p.errorf("unknown operator")
+		}
+		if prec <= minPrecedence {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseExpr(prec, union)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseOperand(union bool) (Expr, error) {
+	t := p.next()
+	if t == nil {
+		return nil, p.errorf("expected an operand")
+	}
+	switch t.Type {
+	case TokenNumber:
+		v, err := strconv.ParseFloat(t.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.Value, t.Pos)
+		}
+		return &NumberExpr{Value: v}, nil
+	case TokenText:
+		return &TextExpr{Value: strings.Replace(t.Value[1:len(t.Value)-1], `""`, `"`, -1)}, nil
+	case TokenBool:
+		return &BoolExpr{Value: strings.ToUpper(t.Value) == "TRUE"}, nil
+	case TokenError:
+		return &ErrorExpr{Value: strings.ToUpper(t.Value)}, nil
+	case TokenReference:
+		ref, err := ParseReference(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &RefExpr{ref}, nil
+	case TokenName:
+		return &NameExpr{Name: t.Value}, nil
+	case TokenStructuredReference:
+		return &StructuredRefExpr{Text: t.Value}, nil
+	case TokenFunction:
+		return p.parseFunction(t)
+	case TokenOpen:
+		e, err := p.parseExpr(0, true)
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(TokenClose)
+	case TokenArrayOpen:
+		return p.parseArray()
+	case TokenOperator:
+		if t.Value == "+" || t.Value == "-" {
+			operand, err := p.parseExpr(prefixPrecedence, union)
+			if err != nil {
+				return nil, err
+			}
+			return &UnaryExpr{Op: t.Value, Operand: operand}, nil
+		}
+	}
+	p.pos--
+	return nil, p.errorf("unexpected token")
+}
+
+func (p *parser) parseFunction(t *Token) (Expr, error) {
+	f := &FuncExpr{Name: canonicalFunctionName(t.Value)}
+	if err := p.expect(TokenOpen); err != nil {
+		return nil, err
+	}
+	if n := p.peek(); n != nil && n.Type == TokenClose {
+		p.next()
+		return f, nil
+	}
+	for {
+		var arg Expr = &MissingExpr{}
+		if n := p.peek(); n == nil || n.Type != TokenSeparator && n.Type != TokenClose {
+			var err error
+			if arg, err = p.parseExpr(0, false); err != nil {
+				return nil, err
+			}
+		}
+		f.Args = append(f.Args, arg)
+		n := p.next()
+		if n == nil {
+			return nil, p.errorf("expected ')'")
+		}
+		if n.Type == TokenClose {
+			return f, nil
+		}
+		if n.Type != TokenSeparator {
+			p.pos--
+			return nil, p.errorf("expected ',' or ')'")
+		}
+	}
+}
+
+func (p *parser) parseArray() (Expr, error) {
+	a := &ArrayExpr{Rows: [][]Expr{{}}}
+	for {
+		e, err := p.parseExpr(0, false)
+		if err != nil {
+			return nil, err
+		}
+		a.Rows[len(a.Rows)-1] = append(a.Rows[len(a.Rows)-1], e)
+		t := p.next()
+		if t == nil {
+			return nil, p.errorf("expected '}'")
+		}
+		switch t.Type {
+		case TokenArrayClose:
+			return a, nil
+		case TokenSeparator:
+		case TokenRowSeparator:
+			a.Rows = append(a.Rows, []Expr{})
+		default:
+			p.pos--
+			return nil, p.errorf("expected ',', ';' or '}'")
+		}
+	}
+}
+
+// NormalizeFormula returns the canonical form of the formula of the cell
+// (zero based row and column indexes) with the references in the relative R1C1 notation.
+// Two formulas with the same canonical form are treated as the same formula,
+// eg, "a1 + _xlfn.STDEV.S(B:B)" in C1 and "A2+STDEV(B:B)" in C2.
+// If the formula cannot be parsed, the formula with the references replaced
+// in the relative R1C1 notation (and without white spaces) is returned.
+func NormalizeFormula(rowIndex, colIndex int, formula string) string {
+	if formula == "" {
+		return ""
+	}
+	e, err := ParseFormula(formula)
+	if err != nil {
+		if DebugLevel > 1 {
+			log.WithError(err).Debugf("Failed to parse formula %q", formula)
+		}
+		return strings.Join(strings.Fields(RelativeFormula(rowIndex, colIndex, formula)), "")
+	}
+	return formatExpr(e, &[2]int{rowIndex, colIndex})
+}
+
+// SameFormula tests if two formulas of the cell (zero based row and column indexes) are the same.
+func SameFormula(rowIndex, colIndex int, formula, other string) bool {
+	return NormalizeFormula(rowIndex, colIndex, formula) == NormalizeFormula(rowIndex, colIndex, other)
+}
@@ -0,0 +1,763 @@
+package model
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueType - the type of the formula evaluation result
+type ValueType int
+
+// Formula value types
+const (
+	ValueEmpty ValueType = iota
+	ValueNumber
+	ValueText
+	ValueBool
+	ValueError
+	ValueArray
+)
+
+// Value - a cell value or the result of a formula (sub)expression evaluation
+type Value struct {
+	Type   ValueType
+	Number float64
+	Text   string // the text or the error code, eg, #DIV/0!
+	Bool   bool
+	Array  [][]Value // the values of a range or an array (rows of values)
+}
+
+// EmptyValue - the value of an empty cell
+var EmptyValue = Value{}
+
+// NumberValue creates a numeric value.
+func NumberValue(n float64) Value { return Value{Type: ValueNumber, Number: n} }
+
+// TextValue creates a text value.
+func TextValue(s string) Value { return Value{Type: ValueText, Text: s} }
+
+// BoolValue creates a logical value.
+func BoolValue(b bool) Value { return Value{Type: ValueBool, Bool: b} }
+
+// ErrorValue creates an error value, eg, #N/A.
+func ErrorValue(code string) Value { return Value{Type: ValueError, Text: code} }
+
+func arrayValue(rows [][]Value) Value { return Value{Type: ValueArray, Array: rows} }
+
+// formulaError - an Excel error (#DIV/0!, #N/A, ...) raised during the evaluation
+type formulaError string
+
+func (e formulaError) Error() string { return string(e) }
+
+// Excel errors
+const (
+	errDiv0  formulaError = "#DIV/0!"
+	errValue formulaError = "#VALUE!"
+	errNA    formulaError = "#N/A"
+	errNum   formulaError = "#NUM!"
+	errRef   formulaError = "#REF!"
+)
+
+// IsError tests if the value is an Excel error.
+func (v Value) IsError() bool { return v.Type == ValueError }
+
+func (v Value) String() string {
+	switch v.Type {
+	case ValueNumber:
+		return formatGeneral(v.Number)
+	case ValueText, ValueError:
+		return v.Text
+	case ValueBool:
+		if v.Bool {
+			return "TRUE"
+		}
+		return "FALSE"
+	case ValueArray:
+		return firstValue(v).String()
+	}
+	return ""
+}
+
+// formatGeneral formats the number as Excel General format does (up to 15 significant digits).
+func formatGeneral(n float64) string {
+	if n == 0 {
+		return "0"
+	}
+	n, _ = strconv.ParseFloat(strconv.FormatFloat(n, 'g', 15, 64), 64)
+	if a := math.Abs(n); a >= 1e-9 && a < 1e15 {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return formatNumber(n)
+}
+
+// ParseValue converts the cell value (as stored in Cells) into the Value.
+// The formatted numbers, eg, "1,000.50", "$5" or "10%", are converted into numbers.
+func ParseValue(s string) Value {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return EmptyValue
+	}
+	switch u := strings.ToUpper(t); u {
+	case "TRUE":
+		return BoolValue(true)
+	case "FALSE":
+		return BoolValue(false)
+	default:
+		for _, e := range formulaErrors {
+			if u == e {
+				return ErrorValue(e)
+			}
+		}
+	}
+	if n, ok := parseNumber(t); ok {
+		return NumberValue(n)
+	}
+	return TextValue(s)
+}
+
+// parseNumber parses the (possibly formatted) number.
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n, true
+	}
+	negative, scale := false, 1.0
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative, s = true, s[1:len(s)-1]
+	}
+	if strings.HasPrefix(s, "-") {
+		negative, s = !negative, s[1:]
+	}
+	if strings.HasSuffix(s, "%") {
+		scale, s = 0.01, strings.TrimSuffix(s, "%")
+	}
+	s = strings.TrimLeft(s, "$€£¥ ")
+	s = strings.Replace(s, ",", "", -1)
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || s == "" || strings.ContainsAny(s[:1], "+-") {
+		return 0, false
+	}
+	if negative {
+		n = -n
+	}
+	return n * scale, true
+}
+
+// CellValues - provides the cell values for the formula evaluation
+type CellValues interface {
+	// CellValue returns the value of the cell (zero based indexes) of the sheet,
+	// the sheet name is empty for the current sheet.
+	CellValue(sheet string, row, col int) Value
+	// Dimension returns the last used row and column of the sheet
+	// (used resolving the whole row and column references).
+	Dimension(sheet string) (maxRow, maxCol int)
+}
+
+// maxRangeSize - the maximum number of cells of a range the evaluator handles
+const maxRangeSize = 100000
+
+// Evaluator - the formula evaluator
+type Evaluator struct {
+	Cells    CellValues
+	Row, Col int // the cell (zero based indexes) containing the formula
+}
+
+// Evaluate parses and evaluates the formula.
+func (ev *Evaluator) Evaluate(formula string) (Value, error) {
+	e, err := ParseFormula(formula)
+	if err != nil {
+		return Value{}, err
+	}
+	return ev.Eval(e)
+}
+
+// Eval evaluates the parsed formula. The Excel errors, eg, #DIV/0!, are returned as values,
+// the error is returned only if the formula cannot be evaluated, eg, it contains
+// an unsupported or volatile function.
+func (ev *Evaluator) Eval(e Expr) (Value, error) {
+	v, err := ev.eval(e)
+	if fe, ok := err.(formulaError); ok {
+		return ErrorValue(string(fe)), nil
+	}
+	return v, err
+}
+
+func isReferenceExpr(e Expr) bool {
+	switch e := e.(type) {
+	case *RefExpr:
+		return true
+	case *BinaryExpr:
+		return e.Op == ":"
+	}
+	return false
+}
+
+func (ev *Evaluator) eval(e Expr) (Value, error) {
+	switch e := e.(type) {
+	case *NumberExpr:
+		return NumberValue(e.Value), nil
+	case *TextExpr:
+		return TextValue(e.Value), nil
+	case *BoolExpr:
+		return BoolValue(e.Value), nil
+	case *ErrorExpr:
+		return ErrorValue(e.Value), nil
+	case *MissingExpr:
+		return EmptyValue, nil
+	case *RefExpr:
+		return ev.referenceValue(e.Reference)
+	case *UnaryExpr:
+		v, err := ev.eval(e.Operand)
+		if err != nil {
+			return v, err
+		}
+		return mapValue(v, func(v Value) Value {
+			if e.Op == "+" {
+				return v
+			}
+			n, err := toNumber(v)
+			if err != nil {
+				return ErrorValue(err.Error())
+			}
+			if e.Op == "%" {
+				return NumberValue(n / 100)
+			}
+			return NumberValue(-n)
+		}), nil
+	case *BinaryExpr:
+		if e.Op == ":" {
+			ref, err := rangeReference(e)
+			if err != nil {
+				return Value{}, err
+			}
+			return ev.referenceValue(ref)
+		}
+		if e.Op == " " || e.Op == "," {
+			return Value{}, fmt.Errorf("unsupported reference operator %q", e.Op)
+		}
+		l, err := ev.eval(e.Left)
+		if err != nil {
+			return l, err
+		}
+		r, err := ev.eval(e.Right)
+		if err != nil {
+			return r, err
+		}
+		return binaryOperation(e.Op, l, r), nil
+	case *FuncExpr:
+		f, ok := formulaFunctions[strings.ToUpper(e.Name)]
+		if !ok {
+			return Value{}, fmt.Errorf("unsupported function %q", e.Name)
+		}
+		return f(ev, e.Args)
+	case *ArrayExpr:
+		rows := make([][]Value, len(e.Rows))
+		for i, row := range e.Rows {
+			rows[i] = make([]Value, len(row))
+			for j, x := range row {
+				v, err := ev.Eval(x)
+				if err != nil {
+					return v, err
+				}
+				rows[i][j] = v
+			}
+		}
+		return arrayValue(rows), nil
+	}
+	return Value{}, fmt.Errorf("unsupported expression %s", e)
+}
+
+// rangeReference combines the operands of the range operator, eg, A1:INDEX(...) is not supported.
+func rangeReference(e *BinaryExpr) (ref Reference, err error) {
+	var refs [2]Reference
+	for i, x := range []Expr{e.Left, e.Right} {
+		switch x := x.(type) {
+		case *RefExpr:
+			refs[i] = x.Reference
+		case *BinaryExpr:
+			if x.Op != ":" {
+				return ref, fmt.Errorf("unsupported range %s", e)
+			}
+			if refs[i], err = rangeReference(x); err != nil {
+				return
+			}
+		default:
+			return ref, fmt.Errorf("unsupported range %s", e)
+		}
+		if refs[i].IsError {
+			return ref, errRef
+		}
+	}
+	l, r := refs[0], refs[1]
+	if r.Sheet != "" && !strings.EqualFold(l.Sheet, r.Sheet) {
+		return ref, errValue
+	}
+	ref = Reference{Workbook: l.Workbook, Sheet: l.Sheet, IsRange: true}
+	ref.From = CellReference{
+		Row: minInt(l.From.Row, l.To.Row, r.From.Row, r.To.Row),
+		Col: minInt(l.From.Col, l.To.Col, r.From.Col, r.To.Col),
+	}
+	ref.To = CellReference{
+		Row: maxInt(l.From.Row, l.To.Row, r.From.Row, r.To.Row),
+		Col: maxInt(l.From.Col, l.To.Col, r.From.Col, r.To.Col),
+	}
+	if ref.From.Row < 0 {
+		ref.To.Row = -1
+	}
+	if ref.From.Col < 0 {
+		ref.To.Col = -1
+	}
+	return
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func maxInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
+
+// bounds returns the zero based range coordinates resolving the whole row and column references.
+func (ev *Evaluator) bounds(ref Reference) (sr, sc, er, ec int) {
+	sr, sc, er, ec = ref.From.Row, ref.From.Col, ref.To.Row, ref.To.Col
+	if sr < 0 || sc < 0 {
+		maxRow, maxCol := ev.Cells.Dimension(ref.Sheet)
+		if sr < 0 {
+			sr, er = 0, maxRow
+		}
+		if sc < 0 {
+			sc, ec = 0, maxCol
+		}
+	}
+	if sr > er {
+		sr, er = er, sr
+	}
+	if sc > ec {
+		sc, ec = ec, sc
+	}
+	return
+}
+
+// referenceValue returns the cell value or the values of the range cells.
+func (ev *Evaluator) referenceValue(ref Reference) (Value, error) {
+	if ref.IsError {
+		return Value{}, errRef
+	}
+	if ref.Workbook != "" {
+		return Value{}, fmt.Errorf("unsupported external reference %s", ref)
+	}
+	if ev.Cells == nil {
+		return Value{}, fmt.Errorf("no cell values to resolve %s", ref)
+	}
+	if !ref.IsRange && ref.From.Row >= 0 && ref.From.Col >= 0 {
+		return ev.Cells.CellValue(ref.Sheet, ref.From.Row, ref.From.Col), nil
+	}
+	sr, sc, er, ec := ev.bounds(ref)
+	if (er-sr+1)*(ec-sc+1) > maxRangeSize {
+		return Value{}, fmt.Errorf("the range %s is too large", ref)
+	}
+	rows := make([][]Value, er-sr+1)
+	for r := sr; r <= er; r++ {
+		rows[r-sr] = make([]Value, ec-sc+1)
+		for c := sc; c <= ec; c++ {
+			rows[r-sr][c-sc] = ev.Cells.CellValue(ref.Sheet, r, c)
+		}
+	}
+	return arrayValue(rows), nil
+}
+
+// mapValue applies the function to the value or to all the array values.
+func mapValue(v Value, f func(Value) Value) Value {
+	if v.Type != ValueArray {
+		return f(v)
+	}
+	rows := make([][]Value, len(v.Array))
+	for i, row := range v.Array {
+		rows[i] = make([]Value, len(row))
+		for j, x := range row {
+			rows[i][j] = f(x)
+		}
+	}
+	return arrayValue(rows)
+}
+
+// arrayElement returns the array element, a single row or column array (or a scalar) gets expanded.
+func arrayElement(v Value, i, j int) Value {
+	if v.Type != ValueArray {
+		return v
+	}
+	if len(v.Array) == 1 {
+		i = 0
+	}
+	if i >= len(v.Array) {
+		return ErrorValue(string(errNA))
+	}
+	if len(v.Array[i]) == 1 {
+		j = 0
+	}
+	if j >= len(v.Array[i]) {
+		return ErrorValue(string(errNA))
+	}
+	return v.Array[i][j]
+}
+
+func arrayDimension(v Value) (rows, cols int) {
+	if v.Type != ValueArray {
+		return 1, 1
+	}
+	if len(v.Array) > 0 {
+		cols = len(v.Array[0])
+	}
+	return len(v.Array), cols
+}
+
+// binaryOperation performs the arithmetic, comparison or concatenation operation
+// (element-wise if any of the operands is an array).
+func binaryOperation(op string, l, r Value) Value {
+	if l.Type == ValueArray || r.Type == ValueArray {
+		lr, lc := arrayDimension(l)
+		rr, rc := arrayDimension(r)
+		rows := make([][]Value, maxInt(lr, rr))
+		for i := range rows {
+			rows[i] = make([]Value, maxInt(lc, rc))
+			for j := range rows[i] {
+				rows[i][j] = binaryOperation(op, arrayElement(l, i, j), arrayElement(r, i, j))
+			}
+		}
+		return arrayValue(rows)
+	}
+	if l.IsError() {
+		return l
+	}
+	if r.IsError() {
+		return r
+	}
+	switch op {
+	case "&":
+		return TextValue(l.String() + r.String())
+	case "=":
+		return BoolValue(compareValues(l, r) == 0)
+	case "<>":
+		return BoolValue(compareValues(l, r) != 0)
+	case "<":
+		return BoolValue(compareValues(l, r) < 0)
+	case ">":
+		return BoolValue(compareValues(l, r) > 0)
+	case "<=":
+		return BoolValue(compareValues(l, r) <= 0)
+	case ">=":
+		return BoolValue(compareValues(l, r) >= 0)
+	}
+	a, err := toNumber(l)
+	if err != nil {
+		return ErrorValue(err.Error())
+	}
+	b, err := toNumber(r)
+	if err != nil {
+		return ErrorValue(err.Error())
+	}
+	var n float64
+	switch op {
+	case "+":
+		n = a + b
+	case "-":
+		n = a - b
+	case "*":
+		n = a * b
+	case "/":
+		if b == 0 {
+			return ErrorValue(string(errDiv0))
+		}
+		n = a / b
+	case "^":
+		if a == 0 && b == 0 {
+			return ErrorValue(string(errNum))
+		}
+		n = math.Pow(a, b)
+	default:
+		return ErrorValue(string(errValue))
+	}
+	return numberResult(n)
+}
+
+// numberResult maps the infinite and NaN results into #NUM!.
+func numberResult(n float64) Value {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return ErrorValue(string(errNum))
+	}
+	return NumberValue(n)
+}
+
+func typeOrder(v Value) int {
+	switch v.Type {
+	case ValueText:
+		return 1
+	case ValueBool:
+		return 2
+	}
+	return 0
+}
+
+// compareValues compares two scalar values the way Excel does:
+// numbers < text < logical values, the text is compared ignoring the case
+// and an empty value equals to 0, "" or FALSE.
+func compareValues(a, b Value) int {
+	if a.Type == ValueEmpty && b.Type == ValueEmpty {
+		return 0
+	}
+	if a.Type == ValueEmpty {
+		return -compareValues(b, a)
+	}
+	if b.Type == ValueEmpty {
+		switch a.Type {
+		case ValueText:
+			b = TextValue("")
+		case ValueBool:
+			b = BoolValue(false)
+		default:
+			b = NumberValue(0)
+		}
+	}
+	if oa, ob := typeOrder(a), typeOrder(b); oa != ob {
+		return oa - ob
+	}
+	switch a.Type {
+	case ValueText:
+		return strings.Compare(strings.ToLower(a.Text), strings.ToLower(b.Text))
+	case ValueBool:
+		if a.Bool == b.Bool {
+			return 0
+		} else if a.Bool {
+			return 1
+		}
+		return -1
+	}
+	switch {
+	case a.Number < b.Number:
+		return -1
+	case a.Number > b.Number:
+		return 1
+	}
+	return 0
+}
+
+func firstValue(v Value) Value {
+	if v.Type == ValueArray {
+		if len(v.Array) == 0 || len(v.Array[0]) == 0 {
+			return EmptyValue
+		}
+		return v.Array[0][0]
+	}
+	return v
+}
+
+// toNumber coerces the scalar value into a number.
+func toNumber(v Value) (float64, error) {
+	switch v = firstValue(v); v.Type {
+	case ValueNumber:
+		return v.Number, nil
+	case ValueBool:
+		if v.Bool {
+			return 1, nil
+		}
+		return 0, nil
+	case ValueText:
+		if n, ok := parseNumber(v.Text); ok {
+			return n, nil
+		}
+		return 0, errValue
+	case ValueError:
+		return 0, formulaError(v.Text)
+	}
+	return 0, nil
+}
+
+// toBool coerces the scalar value into a logical value.
+func toBool(v Value) (bool, error) {
+	switch v = firstValue(v); v.Type {
+	case ValueNumber:
+		return v.Number != 0, nil
+	case ValueBool:
+		return v.Bool, nil
+	case ValueText:
+		switch strings.ToUpper(v.Text) {
+		case "TRUE":
+			return true, nil
+		case "FALSE":
+			return false, nil
+		}
+		return false, errValue
+	case ValueError:
+		return false, formulaError(v.Text)
+	}
+	return false, nil
+}
+
+// toText coerces the scalar value into a text.
+func toText(v Value) (string, error) {
+	if v = firstValue(v); v.IsError() {
+		return "", formulaError(v.Text)
+	}
+	return v.String(), nil
+}
+
+// sameValues tests if the evaluation results are the same (the numbers are compared
+// with the relative tolerance).
+func sameValues(a, b Value) bool {
+	if a.Type == ValueEmpty {
+		a = NumberValue(0)
+	}
+	if b.Type == ValueEmpty {
+		b = NumberValue(0)
+	}
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case ValueNumber:
+		return math.Abs(a.Number-b.Number) <= 1e-9*math.Max(1.0, math.Max(math.Abs(a.Number), math.Abs(b.Number)))
+	case ValueBool:
+		return a.Bool == b.Bool
+	case ValueArray:
+		if len(a.Array) != len(b.Array) {
+			return false
+		}
+		for i := range a.Array {
+			if len(a.Array[i]) != len(b.Array[i]) {
+				return false
+			}
+			for j := range a.Array[i] {
+				if !sameValues(a.Array[i][j], b.Array[i][j]) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return a.Text == b.Text
+}
+
+// equivalenceTrials - the number of evaluations (the first one with the actual values)
+// testing the formula equivalence
+const equivalenceTrials = 5
+
+// perturbedCells - the cell values randomly perturbed for the equivalence testing.
+// The numbers get scaled, the empty cells get random values, the text and
+// the logical values stay intact. Within the trial the same cell always
+// gets the same value.
+type perturbedCells struct {
+	values         map[string]string // cell address (or "Sheet!A1") -> value
+	trial          int
+	maxRow, maxCol int
+}
+
+func newPerturbedCells(values map[string]string) *perturbedCells {
+	pc := perturbedCells{values: values}
+	for address := range values {
+		if strings.Contains(address, "!") {
+			continue
+		}
+		if col, row, err := cellCoordinates(address); err == nil {
+			pc.maxRow, pc.maxCol = maxInt(pc.maxRow, row), maxInt(pc.maxCol, col)
+		}
+	}
+	return &pc
+}
+
+func cellCoordinates(address string) (col, row int, err error) {
+	c, err := parseCellReference(address)
+	if err != nil || c.Row < 0 || c.Col < 0 {
+		return 0, 0, fmt.Errorf("invalid cell address %q", address)
+	}
+	return c.Col, c.Row, nil
+}
+
+// pseudoRandom returns the deterministic pseudo random number in [0, 1).
+func pseudoRandom(trial int, key string) float64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%s", trial, key)
+	return float64(h.Sum64()%1000003) / 1000003.0
+}
+
+func (pc *perturbedCells) CellValue(sheet string, row, col int) Value {
+	key := CellAddress(row, col)
+	if sheet != "" {
+		key = sheet + "!" + key
+	}
+	v := ParseValue(pc.values[key])
+	if pc.trial == 0 {
+		return v
+	}
+	r := pseudoRandom(pc.trial, strings.ToUpper(key))
+	switch v.Type {
+	case ValueEmpty:
+		return NumberValue(math.Round((1+99*r)*100) / 100)
+	case ValueNumber:
+		if v.Number == 0 {
+			return NumberValue(r)
+		}
+		return NumberValue(v.Number * (0.5 + r))
+	}
+	return v
+}
+
+func (pc *perturbedCells) Dimension(sheet string) (maxRow, maxCol int) {
+	return pc.maxRow, pc.maxCol
+}
+
+// EquivalentFormulas tests if two formulas of the cell (zero based row and column indexes)
+// compute the same results. Both formulas get evaluated against the same precedent cells
+// with the actual values (values: cell address -> value) and several random perturbations
+// of them. The formulas that cannot be evaluated (eg, containing volatile or unsupported
+// functions) are not equivalent.
+func EquivalentFormulas(rowIndex, colIndex int, formula, other string, values map[string]string) bool {
+	fe, err := ParseFormula(formula)
+	if err != nil {
+		return false
+	}
+	oe, err := ParseFormula(other)
+	if err != nil {
+		return false
+	}
+	cells := newPerturbedCells(values)
+	ev := Evaluator{Cells: cells, Row: rowIndex, Col: colIndex}
+	hasValue := false
+	for cells.trial = 0; cells.trial < equivalenceTrials; cells.trial++ {
+		fv, err := ev.Eval(fe)
+		if err != nil {
+			return false
+		}
+		ov, err := ev.Eval(oe)
+		if err != nil {
+			return false
+		}
+		if !sameValues(fv, ov) {
+			return false
+		}
+		hasValue = hasValue || !fv.IsError()
+	}
+	return hasValue
+}
+
+// EvaluateFormula evaluates the formula of the cell (zero based row and column indexes)
+// with the given cell values (cell address -> value).
+func EvaluateFormula(rowIndex, colIndex int, formula string, values map[string]string) (Value, error) {
+	ev := Evaluator{Cells: newPerturbedCells(values), Row: rowIndex, Col: colIndex}
+	return ev.Evaluate(formula)
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvaluator(t *testing.T) {
+	values := map[string]string{
+		"A1": "1", "A2": "2", "A3": "3", "A4": "x",
+		"B1": "Apple", "B2": "Banana", "B3": "Cherry",
+		"C1": "10%", "C2": "1,000.00", "C3": "TRUE",
+		"Data!A1": "42",
+	}
+	ev := Evaluator{Cells: newPerturbedCells(values)}
+	for _, r := range []struct {
+		formula  string
+		expected Value
+	}{
+		{"1+2*3", NumberValue(7)},
+		{"-2^2", NumberValue(4)},
+		{"SUM(A1:A4)", NumberValue(6)},
+		{"SUM(A1,\"2\",TRUE)", NumberValue(4)},
+		{"AVERAGE(A1:A3)", NumberValue(2)},
+		{"A1/0", ErrorValue("#DIV/0!")},
+		{"IFERROR(A1/0,-1)", NumberValue(-1)},
+		{"C2*C1", NumberValue(100)},
+		{"Data!A1+1", NumberValue(43)},
+		{"IF(C3,\"yes\",\"no\")", TextValue("yes")},
+		{"B1&\" \"&A1", TextValue("Apple 1")},
+		{"VLOOKUP(2,A1:B3,2,FALSE)", TextValue("Banana")},
+		{"INDEX(B1:B3,MATCH(3,A1:A3,0))", TextValue("Cherry")},
+		{"COUNTIF(A1:A3,\">1\")", NumberValue(2)},
+		{"SUMIF(B1:B3,\"B*\",A1:A3)", NumberValue(2)},
+		{"SUMPRODUCT(A1:A3,A1:A3)", NumberValue(14)},
+		{"ROUND(2.675,2)", NumberValue(2.68)},
+		{"MOD(-3,2)", NumberValue(1)},
+		{"FV(5%,10,0,-1000)", NumberValue(1628.894626777442)},
+		{"PMT(0.1,2,1000)", NumberValue(-576.1904761904763)},
+		{"RATE(10,0,-1000,1628.894626777442)", NumberValue(0.05)},
+		{"NPV(0.1,100,100)", NumberValue(173.55371900826447)},
+		{"{1,2;3,4}", arrayValue([][]Value{{NumberValue(1), NumberValue(2)}, {NumberValue(3), NumberValue(4)}})},
+	} {
+		v, err := ev.Evaluate(r.formula)
+		if err != nil {
+			t.Errorf("Failed to evaluate %q: %v", r.formula, err)
+			continue
+		}
+		if !sameValues(v, r.expected) {
+			t.Errorf("Expected %#v for %q, got %#v", r.expected, r.formula, v)
+		}
+	}
+
+	for _, formula := range []string{"RAND()*A1", "UNKNOWNFUNC(A1)", "Rate*2"} {
+		if _, err := ev.Evaluate(formula); err == nil {
+			t.Errorf("Expected an error evaluating %q", formula)
+		}
+	}
+}
+
+func TestEquivalentFormulas(t *testing.T) {
+	values := map[string]string{"B2": "100", "C2": "0.05", "B3": "3", "B4": "4", "D2": "10"}
+	for _, r := range []struct {
+		formula, other string
+		isEquivalent   bool
+	}{
+		{"B2*C2", "C2*B2", true},
+		{"SUM(B2:B4)", "B2+B3+B4", true},
+		{"B2*(1+C2)^D2", "FV(C2,D2,0,-B2)", true},
+		{"B2*(1+C2)^D2", "B2*(1+C2*D2)", false},
+		{"B2*C2", "B2+C2", false},
+		// Only the values of the referenced cells differ:
+		{"SUM(B2:B4)", "B2+B3", false},
+		{"B2*RAND()", "B2*RAND()", false},
+	} {
+		if got := EquivalentFormulas(1, 4, r.formula, r.other, values); got != r.isEquivalent {
+			t.Errorf("Expected %v comparing %q and %q", r.isEquivalent, r.formula, r.other)
+		}
+	}
+}
+
+func TestFinancialFunctions(t *testing.T) {
+	ev := Evaluator{Cells: newPerturbedCells(nil)}
+	for _, r := range []struct {
+		formula  string
+		expected float64
+	}{
+		{"PV(0.05,10,-100)", 772.1734929184818},
+		{"NPER(0.05,-100,772.1734929184818)", 10},
+		{"IPMT(0.1,1,1,1000)", -100},
+		{"PPMT(0.1,1,2,1000)", -476.1904761904763},
+		{"EFFECT(0.12,12)", 0.12682503013196977},
+		{"NOMINAL(0.12682503013196977,12)", 0.12},
+		{"IRR({-100,60,60})", 0.1306623862918075},
+	} {
+		v, err := ev.Evaluate(r.formula)
+		if err != nil || v.Type != ValueNumber {
+			t.Errorf("Failed to evaluate %q: %v, %#v", r.formula, err, v)
+			continue
+		}
+		if math.Abs(v.Number-r.expected) > 1e-9*math.Max(1, math.Abs(r.expected)) {
+			t.Errorf("Expected %v for %q, got %v", r.expected, r.formula, v.Number)
+		}
+	}
+}
+
+func TestDetectHardcodedConstants(t *testing.T) {
+	values := map[string]string{"B2": "100", "F1": "0.05", "F2": "12"}
+	for _, r := range []struct {
+		formula, model string
+		literals       []string
+	}{
+		{"B2*0.05", "B2*$F$1", []string{"0.05"}},
+		{"0.05*B2", "B2*$F$1", []string{"0.05"}},
+		{"B2*5%", "B2*$F$1", []string{"5%"}},
+		{"B2*(1+0.05)^12", "B2*(1+$F$1)^$F$2", []string{"0.05", "12"}},
+		{"B2*(1+F1)^F2", "B2*(1+$F$1)^$F$2", nil},
+		{"B2*0.07", "B2*$F$1", []string{"0.07"}},
+		{"B2*2", "B2*2", nil},
+		{"SUM(B2,7)", "SUM(B2,F2)", []string{"7"}},
+	} {
+		constants := DetectHardcodedConstants(r.formula, r.model, values)
+		if len(constants) != len(r.literals) {
+			t.Errorf("Expected %v for %q and %q, got %#v", r.literals, r.formula, r.model, constants)
+			continue
+		}
+		for i, c := range constants {
+			if c.Literal != r.literals[i] {
+				t.Errorf("Expected %v for %q and %q, got %#v", r.literals, r.formula, r.model, constants)
+				break
+			}
+		}
+	}
+}
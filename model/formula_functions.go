@@ -0,0 +1,1603 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// formulaFunction - the implementation of a worksheet function
+type formulaFunction func(ev *Evaluator, args []Expr) (Value, error)
+
+// formulaFunctions - the supported worksheet functions
+var formulaFunctions map[string]formulaFunction
+
+// volatileFunctions - the functions returning a different result on each recalculation
+var volatileFunctions = []string{"RAND", "RANDBETWEEN", "RANDARRAY", "NOW", "TODAY", "OFFSET", "INDIRECT"}
+
+func init() {
+	formulaFunctions = map[string]formulaFunction{
+		// Maths
+		"SUM":         aggregate(func(xs []float64) (float64, error) { return sum(xs), nil }),
+		"PRODUCT":     aggregate(product),
+		"SUMSQ":       aggregate(sumSquares),
+		"ABS":         math1(math.Abs),
+		"SQRT":        math1(sqrt),
+		"EXP":         math1(math.Exp),
+		"LN":          math1(ln),
+		"LOG10":       math1(log10),
+		"INT":         math1(math.Floor),
+		"SIGN":        math1(sign),
+		"LOG":         fnLog,
+		"POWER":       math2(power),
+		"MOD":         math2(mod),
+		"ROUND":       math2(round),
+		"ROUNDUP":     math2(roundUp),
+		"ROUNDDOWN":   math2(roundDown),
+		"TRUNC":       fnTrunc,
+		"CEILING":     math2(ceiling),
+		"FLOOR":       math2(floor),
+		"PI":          fnPi,
+		"SUMPRODUCT":  fnSumProduct,
+		"SUMIF":       fnSumIf,
+		"SUMIFS":      fnSumIfs,
+		"COUNTIF":     fnCountIf,
+		"COUNTIFS":    fnCountIfs,
+		"AVERAGEIF":   fnAverageIf,
+		"AVERAGEIFS":  fnAverageIfs,
+		"COUNT":       aggregate(func(xs []float64) (float64, error) { return float64(len(xs)), nil }),
+		"COUNTA":      fnCountA,
+		"COUNTBLANK":  fnCountBlank,
+		"AVERAGE":     aggregate(average),
+		"MIN":         aggregate(minimum),
+		"MAX":         aggregate(maximum),
+		"MEDIAN":      aggregate(median),
+		"MODE":        aggregate(mode),
+		"STDEV":       aggregate(stdev(1)),
+		"STDEVP":      aggregate(stdev(0)),
+		"STDEV.P":     aggregate(stdev(0)),
+		"VAR":         aggregate(variance(1)),
+		"VARP":        aggregate(variance(0)),
+		"LARGE":       fnKth(true),
+		"SMALL":       fnKth(false),
+		"RANK":        fnRank,
+		"RANK.EQ":     fnRank,
+		"IF":          fnIf,
+		"IFERROR":     fnIfError,
+		"IFNA":        fnIfNA,
+		"AND":         logical(true),
+		"OR":          logical(false),
+		"NOT":         fnNot,
+		"TRUE":        constant(BoolValue(true)),
+		"FALSE":       constant(BoolValue(false)),
+		"NA":          constant(ErrorValue(string(errNA))),
+		"ISBLANK":     is(func(v Value) bool { return v.Type == ValueEmpty }),
+		"ISNUMBER":    is(func(v Value) bool { return v.Type == ValueNumber }),
+		"ISTEXT":      is(func(v Value) bool { return v.Type == ValueText }),
+		"ISLOGICAL":   is(func(v Value) bool { return v.Type == ValueBool }),
+		"ISERROR":     is(func(v Value) bool { return v.IsError() }),
+		"ISNA":        is(func(v Value) bool { return v.IsError() && v.Text == string(errNA) }),
+		"VLOOKUP":     fnLookup(false),
+		"HLOOKUP":     fnLookup(true),
+		"LOOKUP":      fnLookupVector,
+		"MATCH":       fnMatch,
+		"INDEX":       fnIndex,
+		"CHOOSE":      fnChoose,
+		"ROW":         fnRowColumn(true),
+		"COLUMN":      fnRowColumn(false),
+		"ROWS":        fnRowsColumns(true),
+		"COLUMNS":     fnRowsColumns(false),
+		"CONCATENATE": fnConcatenate,
+		"CONCAT":      fnConcatenate,
+		"LEN":         fnLen,
+		"LEFT":        fnLeftRight(true),
+		"RIGHT":       fnLeftRight(false),
+		"MID":         fnMid,
+		"UPPER":       text1(strings.ToUpper),
+		"LOWER":       text1(strings.ToLower),
+		"TRIM":        text1(func(s string) string { return strings.Join(strings.Fields(s), " ") }),
+		"VALUE":       fnValue,
+		"EXACT":       fnExact,
+		// Financial
+		"FV":      fnFV,
+		"PV":      fnPV,
+		"PMT":     fnPMT,
+		"IPMT":    fnIPMT,
+		"PPMT":    fnPPMT,
+		"NPER":    fnNPER,
+		"RATE":    fnRate,
+		"NPV":     fnNPV,
+		"IRR":     fnIRR,
+		"EFFECT":  fnEffect,
+		"NOMINAL": fnNominal,
+	}
+	for _, name := range volatileFunctions {
+		name := name
+		formulaFunctions[name] = func(ev *Evaluator, args []Expr) (Value, error) {
+			return Value{}, fmt.Errorf("volatile function %s", name)
+		}
+	}
+}
+
+// result converts the Excel error into the error value.
+func result(v Value, err error) (Value, error) {
+	if fe, ok := err.(formulaError); ok {
+		return ErrorValue(string(fe)), nil
+	}
+	return v, err
+}
+
+func numberOrError(n float64, err error) (Value, error) {
+	if err != nil {
+		return result(Value{}, err)
+	}
+	return numberResult(n), nil
+}
+
+func checkArgs(args []Expr, min, max int) error {
+	if len(args) < min || max >= 0 && len(args) > max {
+		return errValue
+	}
+	return nil
+}
+
+// scalar evaluates the argument, the error values are returned as Excel errors.
+func (ev *Evaluator) scalar(e Expr) (Value, error) {
+	v, err := ev.eval(e)
+	if err != nil {
+		return v, err
+	}
+	if v = firstValue(v); v.IsError() {
+		return v, formulaError(v.Text)
+	}
+	return v, nil
+}
+
+func (ev *Evaluator) number(e Expr) (float64, error) {
+	v, err := ev.scalar(e)
+	if err != nil {
+		return 0, err
+	}
+	return toNumber(v)
+}
+
+// optionalNumber evaluates the optional argument (with the index i) or returns the default value.
+func (ev *Evaluator) optionalNumber(args []Expr, i int, defaultValue float64) (float64, error) {
+	if i >= len(args) {
+		return defaultValue, nil
+	}
+	if _, ok := args[i].(*MissingExpr); ok {
+		return defaultValue, nil
+	}
+	return ev.number(args[i])
+}
+
+func (ev *Evaluator) numbers(args []Expr) (ns []float64, err error) {
+	ns = make([]float64, len(args))
+	for i, a := range args {
+		if ns[i], err = ev.number(a); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (ev *Evaluator) text(e Expr) (string, error) {
+	v, err := ev.scalar(e)
+	if err != nil {
+		return "", err
+	}
+	return toText(v)
+}
+
+func (ev *Evaluator) boolean(e Expr) (bool, error) {
+	v, err := ev.scalar(e)
+	if err != nil {
+		return false, err
+	}
+	return toBool(v)
+}
+
+// array evaluates the argument into rows of values.
+func (ev *Evaluator) array(e Expr) ([][]Value, error) {
+	v, err := ev.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if v.Type == ValueArray {
+		return v.Array, nil
+	}
+	if v.IsError() {
+		return nil, formulaError(v.Text)
+	}
+	return [][]Value{{v}}, nil
+}
+
+// flatten returns the values row by row.
+func flatten(rows [][]Value) (values []Value) {
+	for _, row := range rows {
+		values = append(values, row...)
+	}
+	return
+}
+
+// collectNumbers collects the numbers of the arguments: the text and logical values
+// of the ranges and arrays are ignored, however, the directly given ones get converted.
+func (ev *Evaluator) collectNumbers(args []Expr) (ns []float64, err error) {
+	for _, a := range args {
+		if _, ok := a.(*MissingExpr); ok {
+			continue
+		}
+		v, err := ev.eval(a)
+		if err != nil {
+			return nil, err
+		}
+		if v.Type == ValueArray || isReferenceExpr(a) {
+			values := []Value{v}
+			if v.Type == ValueArray {
+				values = flatten(v.Array)
+			}
+			for _, x := range values {
+				switch x.Type {
+				case ValueNumber:
+					ns = append(ns, x.Number)
+				case ValueError:
+					return nil, formulaError(x.Text)
+				}
+			}
+			continue
+		}
+		n, err := toNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, n)
+	}
+	return
+}
+
+func aggregate(f func([]float64) (float64, error)) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 1, -1); err != nil {
+			return result(Value{}, err)
+		}
+		ns, err := ev.collectNumbers(args)
+		if err != nil {
+			return result(Value{}, err)
+		}
+		return numberOrError(f(ns))
+	}
+}
+
+func sum(xs []float64) (s float64) {
+	for _, x := range xs {
+		s += x
+	}
+	return
+}
+
+func product(xs []float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, nil
+	}
+	p := 1.0
+	for _, x := range xs {
+		p *= x
+	}
+	return p, nil
+}
+
+func sumSquares(xs []float64) (s float64, err error) {
+	for _, x := range xs {
+		s += x * x
+	}
+	return
+}
+
+func average(xs []float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, errDiv0
+	}
+	return sum(xs) / float64(len(xs)), nil
+}
+
+func minimum(xs []float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, nil
+	}
+	m := xs[0]
+	for _, x := range xs {
+		m = math.Min(m, x)
+	}
+	return m, nil
+}
+
+func maximum(xs []float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, nil
+	}
+	m := xs[0]
+	for _, x := range xs {
+		m = math.Max(m, x)
+	}
+	return m, nil
+}
+
+func median(xs []float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, errNum
+	}
+	s := append([]float64{}, xs...)
+	sort.Float64s(s)
+	if n := len(s); n%2 == 1 {
+		return s[n/2], nil
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2, nil
+}
+
+func mode(xs []float64) (float64, error) {
+	counts := make(map[float64]int)
+	best, bestCount := 0.0, 1
+	for _, x := range xs {
+		counts[x]++
+		if c := counts[x]; c > bestCount {
+			best, bestCount = x, c
+		}
+	}
+	if bestCount < 2 {
+		return 0, errNA
+	}
+	return best, nil
+}
+
+// variance returns the variance function, ddof is 1 for the sample and 0 for the population variance.
+func variance(ddof int) func([]float64) (float64, error) {
+	return func(xs []float64) (float64, error) {
+		if len(xs)-ddof <= 0 {
+			return 0, errDiv0
+		}
+		m := sum(xs) / float64(len(xs))
+		var s float64
+		for _, x := range xs {
+			s += (x - m) * (x - m)
+		}
+		return s / float64(len(xs)-ddof), nil
+	}
+}
+
+func stdev(ddof int) func([]float64) (float64, error) {
+	v := variance(ddof)
+	return func(xs []float64) (float64, error) {
+		r, err := v(xs)
+		return math.Sqrt(r), err
+	}
+}
+
+func math1(f func(float64) float64) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return result(Value{}, err)
+		}
+		x, err := ev.number(args[0])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		return numberResult(f(x)), nil
+	}
+}
+
+func math2(f func(x, y float64) (float64, error)) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 2, 2); err != nil {
+			return result(Value{}, err)
+		}
+		xs, err := ev.numbers(args)
+		if err != nil {
+			return result(Value{}, err)
+		}
+		return numberOrError(f(xs[0], xs[1]))
+	}
+}
+
+func sqrt(x float64) float64 {
+	if x < 0 {
+		return math.NaN()
+	}
+	return math.Sqrt(x)
+}
+
+func ln(x float64) float64 {
+	if x <= 0 {
+		return math.NaN()
+	}
+	return math.Log(x)
+}
+
+func log10(x float64) float64 {
+	if x <= 0 {
+		return math.NaN()
+	}
+	return math.Log10(x)
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+func fnLog(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return result(Value{}, err)
+	}
+	x, err := ev.number(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	base, err := ev.optionalNumber(args, 1, 10)
+	if err != nil {
+		return result(Value{}, err)
+	}
+	if x <= 0 || base <= 0 {
+		return ErrorValue(string(errNum)), nil
+	}
+	if base == 1 {
+		return ErrorValue(string(errDiv0)), nil
+	}
+	return numberResult(math.Log(x) / math.Log(base)), nil
+}
+
+func power(x, y float64) (float64, error) {
+	if x == 0 && y == 0 {
+		return 0, errNum
+	}
+	if x == 0 && y < 0 {
+		return 0, errDiv0
+	}
+	return math.Pow(x, y), nil
+}
+
+func mod(x, y float64) (float64, error) {
+	if y == 0 {
+		return 0, errDiv0
+	}
+	return x - y*math.Floor(x/y), nil
+}
+
+// roundTo rounds the number to the given number of digits with the rounding function
+// applied to the absolute value.
+func roundTo(x, digits float64, f func(float64) float64) float64 {
+	scale := math.Pow(10, math.Trunc(digits))
+	// compensate the binary representation error, eg, 2.675 is stored as 2.67499999...
+	v, _ := parseNumber(formatGeneral(math.Abs(x) * scale))
+	return sign(x) * f(v) / scale
+}
+
+func round(x, digits float64) (float64, error) {
+	return roundTo(x, digits, func(v float64) float64 { return math.Floor(v + 0.5) }), nil
+}
+
+func roundUp(x, digits float64) (float64, error) {
+	return roundTo(x, digits, math.Ceil), nil
+}
+
+func roundDown(x, digits float64) (float64, error) {
+	return roundTo(x, digits, math.Floor), nil
+}
+
+func fnTrunc(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return result(Value{}, err)
+	}
+	x, err := ev.number(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	digits, err := ev.optionalNumber(args, 1, 0)
+	if err != nil {
+		return result(Value{}, err)
+	}
+	return numberOrError(roundDown(x, digits))
+}
+
+func ceiling(x, significance float64) (float64, error) {
+	if significance == 0 {
+		return 0, nil
+	}
+	if x > 0 && significance < 0 {
+		return 0, errNum
+	}
+	return math.Ceil(x/significance) * significance, nil
+}
+
+func floor(x, significance float64) (float64, error) {
+	if significance == 0 {
+		return 0, errDiv0
+	}
+	if x > 0 && significance < 0 {
+		return 0, errNum
+	}
+	return math.Floor(x/significance) * significance, nil
+}
+
+func fnPi(ev *Evaluator, args []Expr) (Value, error) {
+	return NumberValue(math.Pi), checkArgs(args, 0, 0)
+}
+
+func constant(v Value) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 0, 0); err != nil {
+			return result(Value{}, err)
+		}
+		return v, nil
+	}
+}
+
+func fnSumProduct(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 1, -1); err != nil {
+		return result(Value{}, err)
+	}
+	var products []float64
+	var rows, cols int
+	for i, a := range args {
+		values, err := ev.array(a)
+		if err != nil {
+			return result(Value{}, err)
+		}
+		if i == 0 {
+			rows, cols = len(values), len(values[0])
+			products = make([]float64, rows*cols)
+			for k := range products {
+				products[k] = 1
+			}
+		} else if len(values) != rows || len(values[0]) != cols {
+			return ErrorValue(string(errValue)), nil
+		}
+		for k, v := range flatten(values) {
+			switch v.Type {
+			case ValueNumber:
+				products[k] *= v.Number
+			case ValueError:
+				return v, nil
+			default:
+				products[k] = 0
+			}
+		}
+	}
+	return numberResult(sum(products)), nil
+}
+
+// criteria returns the matcher of the COUNTIF, SUMIF, ... criteria, eg, ">5", "<>x", "a*".
+func criteria(c Value) func(Value) bool {
+	op, operand := "=", c
+	if c.Type == ValueText {
+		s := c.Text
+		for _, o := range []string{"<=", ">=", "<>", "<", ">", "="} {
+			if strings.HasPrefix(s, o) {
+				op, s = o, s[len(o):]
+				break
+			}
+		}
+		operand = ParseValue(s)
+		if operand.Type == ValueText {
+			operand = TextValue(s)
+		}
+	}
+	var wildcard *regexp.Regexp
+	if operand.Type == ValueText && strings.ContainsAny(operand.Text, "*?") && (op == "=" || op == "<>") {
+		pattern := regexp.QuoteMeta(operand.Text)
+		pattern = strings.Replace(pattern, `\*`, ".*", -1)
+		pattern = strings.Replace(pattern, `\?`, ".", -1)
+		wildcard = regexp.MustCompile("(?is)^" + pattern + "$")
+	}
+	return func(v Value) bool {
+		if operand.Type == ValueEmpty {
+			if op == "<>" {
+				return v.Type != ValueEmpty
+			}
+			return op == "=" && (v.Type == ValueEmpty || v.Type == ValueText && v.Text == "")
+		}
+		if v.Type == ValueText && operand.Type == ValueNumber {
+			if n, ok := parseNumber(v.Text); ok {
+				v = NumberValue(n)
+			}
+		}
+		if wildcard != nil {
+			matches := v.Type == ValueText && wildcard.MatchString(v.Text)
+			return matches == (op == "=")
+		}
+		if typeOrder(v) != typeOrder(operand) || v.Type == ValueEmpty {
+			return op == "<>"
+		}
+		c := compareValues(v, operand)
+		switch op {
+		case "<":
+			return c < 0
+		case ">":
+			return c > 0
+		case "<=":
+			return c <= 0
+		case ">=":
+			return c >= 0
+		case "<>":
+			return c != 0
+		}
+		return c == 0
+	}
+}
+
+// conditional evaluates the criteria range and criteria pairs of *IFS functions
+// returning the flags of the matching cells.
+func (ev *Evaluator) conditional(args []Expr) (matches []bool, rows, cols int, err error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, 0, 0, errValue
+	}
+	for i := 0; i < len(args); i += 2 {
+		values, err := ev.array(args[i])
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		c, err := ev.scalar(args[i+1])
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if i == 0 {
+			rows, cols = len(values), len(values[0])
+			matches = make([]bool, rows*cols)
+			for k := range matches {
+				matches[k] = true
+			}
+		} else if len(values) != rows || len(values[0]) != cols {
+			return nil, 0, 0, errValue
+		}
+		match := criteria(c)
+		for k, v := range flatten(values) {
+			matches[k] = matches[k] && match(v)
+		}
+	}
+	return
+}
+
+// conditionalNumbers returns the numbers of the values range matching the criteria.
+func (ev *Evaluator) conditionalNumbers(values Expr, conditions []Expr) ([]float64, error) {
+	matches, rows, cols, err := ev.conditional(conditions)
+	if err != nil {
+		return nil, err
+	}
+	var vs []Value
+	if values == nil {
+		vs, err = ev.flatArray(conditions[0])
+	} else {
+		var rs [][]Value
+		if rs, err = ev.array(values); err == nil {
+			if len(rs) != rows || len(rs[0]) != cols {
+				// the sum range gets resized to the criteria range
+				resized := make([]Value, 0, rows*cols)
+				for i := 0; i < rows; i++ {
+					for j := 0; j < cols; j++ {
+						if i < len(rs) && j < len(rs[i]) {
+							resized = append(resized, rs[i][j])
+						} else {
+							resized = append(resized, EmptyValue)
+						}
+					}
+				}
+				vs = resized
+			} else {
+				vs = flatten(rs)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ns []float64
+	for k, v := range vs {
+		if !matches[k] {
+			continue
+		}
+		switch v.Type {
+		case ValueNumber:
+			ns = append(ns, v.Number)
+		case ValueError:
+			return nil, formulaError(v.Text)
+		}
+	}
+	return ns, nil
+}
+
+func (ev *Evaluator) flatArray(e Expr) ([]Value, error) {
+	rows, err := ev.array(e)
+	return flatten(rows), err
+}
+
+func fnSumIf(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return result(Value{}, err)
+	}
+	var values Expr
+	if len(args) == 3 {
+		values = args[2]
+	}
+	ns, err := ev.conditionalNumbers(values, args[:2])
+	return numberOrError(sum(ns), err)
+}
+
+func fnSumIfs(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 3, -1); err != nil {
+		return result(Value{}, err)
+	}
+	ns, err := ev.conditionalNumbers(args[0], args[1:])
+	return numberOrError(sum(ns), err)
+}
+
+func fnAverageIf(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return result(Value{}, err)
+	}
+	var values Expr
+	if len(args) == 3 {
+		values = args[2]
+	}
+	ns, err := ev.conditionalNumbers(values, args[:2])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	return numberOrError(average(ns))
+}
+
+func fnAverageIfs(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 3, -1); err != nil {
+		return result(Value{}, err)
+	}
+	ns, err := ev.conditionalNumbers(args[0], args[1:])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	return numberOrError(average(ns))
+}
+
+func countMatches(ev *Evaluator, args []Expr) (Value, error) {
+	matches, _, _, err := ev.conditional(args)
+	if err != nil {
+		return result(Value{}, err)
+	}
+	count := 0
+	for _, m := range matches {
+		if m {
+			count++
+		}
+	}
+	return NumberValue(float64(count)), nil
+}
+
+func fnCountIf(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return result(Value{}, err)
+	}
+	return countMatches(ev, args)
+}
+
+func fnCountIfs(ev *Evaluator, args []Expr) (Value, error) {
+	return countMatches(ev, args)
+}
+
+func fnCountA(ev *Evaluator, args []Expr) (Value, error) {
+	count := 0
+	for _, a := range args {
+		if _, ok := a.(*MissingExpr); ok {
+			continue
+		}
+		values, err := ev.flatArray(a)
+		if err != nil {
+			if _, ok := err.(formulaError); !ok {
+				return Value{}, err
+			}
+			count++
+			continue
+		}
+		for _, v := range values {
+			if v.Type != ValueEmpty {
+				count++
+			}
+		}
+	}
+	return NumberValue(float64(count)), nil
+}
+
+func fnCountBlank(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return result(Value{}, err)
+	}
+	values, err := ev.flatArray(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	count := 0
+	for _, v := range values {
+		if v.Type == ValueEmpty || v.Type == ValueText && v.Text == "" {
+			count++
+		}
+	}
+	return NumberValue(float64(count)), nil
+}
+
+// fnKth returns LARGE (or SMALL) function.
+func fnKth(largest bool) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 2, 2); err != nil {
+			return result(Value{}, err)
+		}
+		ns, err := ev.collectNumbers(args[:1])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		k, err := ev.number(args[1])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		i := int(math.Ceil(k)) - 1
+		if i < 0 || i >= len(ns) {
+			return ErrorValue(string(errNum)), nil
+		}
+		sort.Float64s(ns)
+		if largest {
+			return NumberValue(ns[len(ns)-1-i]), nil
+		}
+		return NumberValue(ns[i]), nil
+	}
+}
+
+func fnRank(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return result(Value{}, err)
+	}
+	x, err := ev.number(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	ns, err := ev.collectNumbers(args[1:2])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	order, err := ev.optionalNumber(args, 2, 0)
+	if err != nil {
+		return result(Value{}, err)
+	}
+	rank, found := 1, false
+	for _, n := range ns {
+		if n == x {
+			found = true
+		} else if order == 0 && n > x || order != 0 && n < x {
+			rank++
+		}
+	}
+	if !found {
+		return ErrorValue(string(errNA)), nil
+	}
+	return NumberValue(float64(rank)), nil
+}
+
+func fnIf(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return result(Value{}, err)
+	}
+	condition, err := ev.boolean(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	if condition {
+		if _, ok := args[1].(*MissingExpr); ok {
+			return NumberValue(0), nil
+		}
+		return ev.eval(args[1])
+	}
+	if len(args) < 3 {
+		return BoolValue(false), nil
+	}
+	if _, ok := args[2].(*MissingExpr); ok {
+		return NumberValue(0), nil
+	}
+	return ev.eval(args[2])
+}
+
+func ifError(onlyNA bool) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 2, 2); err != nil {
+			return result(Value{}, err)
+		}
+		v, err := ev.scalar(args[0])
+		if fe, ok := err.(formulaError); ok && (!onlyNA || fe == errNA) {
+			return ev.eval(args[1])
+		}
+		return v, err
+	}
+}
+
+var (
+	fnIfError = ifError(false)
+	fnIfNA    = ifError(true)
+)
+
+// logical returns AND (all is set) or OR function.
+func logical(all bool) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 1, -1); err != nil {
+			return result(Value{}, err)
+		}
+		r, count := all, 0
+		for _, a := range args {
+			v, err := ev.eval(a)
+			if err != nil {
+				return result(Value{}, err)
+			}
+			var bs []bool
+			if v.Type == ValueArray || isReferenceExpr(a) {
+				values := []Value{v}
+				if v.Type == ValueArray {
+					values = flatten(v.Array)
+				}
+				for _, x := range values {
+					switch x.Type {
+					case ValueNumber, ValueBool:
+						b, _ := toBool(x)
+						bs = append(bs, b)
+					case ValueError:
+						return x, nil
+					}
+				}
+			} else {
+				b, err := toBool(v)
+				if err != nil {
+					return result(Value{}, err)
+				}
+				bs = append(bs, b)
+			}
+			for _, b := range bs {
+				count++
+				if all {
+					r = r && b
+				} else {
+					r = r || b
+				}
+			}
+		}
+		if count == 0 {
+			return ErrorValue(string(errValue)), nil
+		}
+		return BoolValue(r), nil
+	}
+}
+
+func fnNot(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return result(Value{}, err)
+	}
+	b, err := ev.boolean(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	return BoolValue(!b), nil
+}
+
+// is returns IS... function testing the value.
+func is(test func(Value) bool) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return result(Value{}, err)
+		}
+		v, err := ev.eval(args[0])
+		if fe, ok := err.(formulaError); ok {
+			v, err = ErrorValue(string(fe)), nil
+		}
+		if err != nil {
+			return v, err
+		}
+		return BoolValue(test(firstValue(v))), nil
+	}
+}
+
+// lookupMatch finds the position of the value within the values: matchType 0 - exact match,
+// 1 - the largest value less than or equal to the value (the values sorted in the ascending order),
+// -1 - the smallest value greater than or equal to the value (the values sorted in the descending order).
+func lookupMatch(value Value, values []Value, matchType int) int {
+	var wildcard func(Value) bool
+	if matchType == 0 && value.Type == ValueText && strings.ContainsAny(value.Text, "*?") {
+		wildcard = criteria(TextValue("=" + value.Text))
+	}
+	found := -1
+	for i, v := range values {
+		if v.Type == ValueEmpty {
+			continue
+		}
+		switch {
+		case matchType == 0:
+			if wildcard != nil && wildcard(v) ||
+				wildcard == nil && typeOrder(v) == typeOrder(value) && compareValues(v, value) == 0 {
+				return i
+			}
+		case typeOrder(v) != typeOrder(value):
+			continue
+		case matchType > 0:
+			if compareValues(v, value) > 0 {
+				return found
+			}
+			found = i
+		default:
+			if compareValues(v, value) < 0 {
+				return found
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+// fnLookup returns VLOOKUP (or HLOOKUP if horizontal is set) function.
+func fnLookup(horizontal bool) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 3, 4); err != nil {
+			return result(Value{}, err)
+		}
+		value, err := ev.scalar(args[0])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		table, err := ev.array(args[1])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		index, err := ev.number(args[2])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		approximate := true
+		if len(args) == 4 {
+			if _, ok := args[3].(*MissingExpr); !ok {
+				if approximate, err = ev.boolean(args[3]); err != nil {
+					return result(Value{}, err)
+				}
+			}
+		}
+		if horizontal {
+			table = transpose(table)
+		}
+		i := int(index) - 1
+		if i < 0 {
+			return ErrorValue(string(errValue)), nil
+		}
+		if i >= len(table[0]) {
+			return ErrorValue(string(errRef)), nil
+		}
+		keys := make([]Value, len(table))
+		for r, row := range table {
+			keys[r] = row[0]
+		}
+		matchType := 0
+		if approximate {
+			matchType = 1
+		}
+		if r := lookupMatch(value, keys, matchType); r >= 0 {
+			return table[r][i], nil
+		}
+		return ErrorValue(string(errNA)), nil
+	}
+}
+
+func transpose(rows [][]Value) [][]Value {
+	if len(rows) == 0 {
+		return rows
+	}
+	t := make([][]Value, len(rows[0]))
+	for j := range t {
+		t[j] = make([]Value, len(rows))
+		for i := range rows {
+			t[j][i] = rows[i][j]
+		}
+	}
+	return t
+}
+
+// vector returns the values of a single row or column array.
+func vector(rows [][]Value) ([]Value, bool) {
+	if len(rows) == 1 {
+		return rows[0], true
+	}
+	if len(rows) > 0 && len(rows[0]) == 1 {
+		return flatten(rows), true
+	}
+	return nil, false
+}
+
+func fnLookupVector(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return result(Value{}, err)
+	}
+	value, err := ev.scalar(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	rows, err := ev.array(args[1])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	var keys, results []Value
+	if len(args) == 3 {
+		var ok bool
+		if keys, ok = vector(rows); !ok {
+			return ErrorValue(string(errNA)), nil
+		}
+		if rows, err = ev.array(args[2]); err != nil {
+			return result(Value{}, err)
+		}
+		if results, ok = vector(rows); !ok {
+			return ErrorValue(string(errNA)), nil
+		}
+	} else {
+		// array form: searches in the first row or column and returns the last one
+		if len(rows[0]) > len(rows) {
+			rows = transpose(rows)
+		}
+		for _, row := range rows {
+			keys, results = append(keys, row[0]), append(results, row[len(row)-1])
+		}
+	}
+	if i := lookupMatch(value, keys, 1); i >= 0 && i < len(results) {
+		return results[i], nil
+	}
+	return ErrorValue(string(errNA)), nil
+}
+
+func fnMatch(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return result(Value{}, err)
+	}
+	value, err := ev.scalar(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	rows, err := ev.array(args[1])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	matchType, err := ev.optionalNumber(args, 2, 1)
+	if err != nil {
+		return result(Value{}, err)
+	}
+	values, ok := vector(rows)
+	if !ok {
+		return ErrorValue(string(errNA)), nil
+	}
+	if i := lookupMatch(value, values, int(sign(matchType))); i >= 0 {
+		return NumberValue(float64(i + 1)), nil
+	}
+	return ErrorValue(string(errNA)), nil
+}
+
+func fnIndex(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return result(Value{}, err)
+	}
+	rows, err := ev.array(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	r, err := ev.number(args[1])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	c, err := ev.optionalNumber(args, 2, 0)
+	if err != nil {
+		return result(Value{}, err)
+	}
+	if len(args) == 2 && len(rows) == 1 {
+		r, c = 1, r
+	}
+	i, j := int(r)-1, int(c)-1
+	if i >= len(rows) || j >= len(rows[0]) || i < -1 || j < -1 {
+		return ErrorValue(string(errRef)), nil
+	}
+	switch {
+	case i >= 0 && j >= 0:
+		return rows[i][j], nil
+	case i >= 0 && len(args) == 2 && len(rows[0]) == 1:
+		return rows[i][0], nil
+	case i >= 0:
+		return arrayValue([][]Value{rows[i]}), nil
+	case j >= 0:
+		column := make([][]Value, len(rows))
+		for k := range rows {
+			column[k] = []Value{rows[k][j]}
+		}
+		return arrayValue(column), nil
+	}
+	return arrayValue(rows), nil
+}
+
+func fnChoose(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, -1); err != nil {
+		return result(Value{}, err)
+	}
+	i, err := ev.number(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	if k := int(i); k >= 1 && k < len(args) {
+		return ev.eval(args[k])
+	}
+	return ErrorValue(string(errValue)), nil
+}
+
+// fnRowColumn returns ROW (or COLUMN) function.
+func fnRowColumn(isRow bool) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 0, 1); err != nil {
+			return result(Value{}, err)
+		}
+		r, c := ev.Row, ev.Col
+		if len(args) == 1 {
+			var ref Reference
+			switch a := args[0].(type) {
+			case *RefExpr:
+				ref = a.Reference
+			case *BinaryExpr:
+				var err error
+				if ref, err = rangeReference(a); err != nil {
+					return result(Value{}, err)
+				}
+			default:
+				return ErrorValue(string(errValue)), nil
+			}
+			r, c = ref.From.Row, ref.From.Col
+		}
+		if isRow {
+			return NumberValue(float64(r + 1)), nil
+		}
+		return NumberValue(float64(c + 1)), nil
+	}
+}
+
+// fnRowsColumns returns ROWS (or COLUMNS) function.
+func fnRowsColumns(isRows bool) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return result(Value{}, err)
+		}
+		rows, err := ev.array(args[0])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		if isRows {
+			return NumberValue(float64(len(rows))), nil
+		}
+		return NumberValue(float64(len(rows[0]))), nil
+	}
+}
+
+func fnConcatenate(ev *Evaluator, args []Expr) (Value, error) {
+	var sb strings.Builder
+	for _, a := range args {
+		values, err := ev.flatArray(a)
+		if err != nil {
+			return result(Value{}, err)
+		}
+		for _, v := range values {
+			s, err := toText(v)
+			if err != nil {
+				return result(Value{}, err)
+			}
+			sb.WriteString(s)
+		}
+	}
+	return TextValue(sb.String()), nil
+}
+
+func text1(f func(string) string) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return result(Value{}, err)
+		}
+		s, err := ev.text(args[0])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		return TextValue(f(s)), nil
+	}
+}
+
+func fnLen(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return result(Value{}, err)
+	}
+	s, err := ev.text(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	return NumberValue(float64(len([]rune(s)))), nil
+}
+
+// fnLeftRight returns LEFT (or RIGHT) function.
+func fnLeftRight(left bool) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		if err := checkArgs(args, 1, 2); err != nil {
+			return result(Value{}, err)
+		}
+		s, err := ev.text(args[0])
+		if err != nil {
+			return result(Value{}, err)
+		}
+		n, err := ev.optionalNumber(args, 1, 1)
+		if err != nil {
+			return result(Value{}, err)
+		}
+		if n < 0 {
+			return ErrorValue(string(errValue)), nil
+		}
+		rs := []rune(s)
+		k := int(math.Min(n, float64(len(rs))))
+		if left {
+			return TextValue(string(rs[:k])), nil
+		}
+		return TextValue(string(rs[len(rs)-k:])), nil
+	}
+}
+
+func fnMid(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 3, 3); err != nil {
+		return result(Value{}, err)
+	}
+	s, err := ev.text(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	ns, err := ev.numbers(args[1:])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	start, n := int(ns[0])-1, int(ns[1])
+	if start < 0 || n < 0 {
+		return ErrorValue(string(errValue)), nil
+	}
+	rs := []rune(s)
+	if start >= len(rs) {
+		return TextValue(""), nil
+	}
+	return TextValue(string(rs[start:minInt(len(rs), start+n)])), nil
+}
+
+func fnValue(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return result(Value{}, err)
+	}
+	n, err := ev.number(args[0])
+	return numberOrError(n, err)
+}
+
+func fnExact(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return result(Value{}, err)
+	}
+	a, err := ev.text(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	b, err := ev.text(args[1])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	return BoolValue(a == b), nil
+}
+
+// financialArgs evaluates the required and optional (defaulting to 0) arguments.
+func (ev *Evaluator) financialArgs(args []Expr, required, optional int) ([]float64, error) {
+	if err := checkArgs(args, required, required+optional); err != nil {
+		return nil, err
+	}
+	xs := make([]float64, required+optional)
+	for i := range xs {
+		var err error
+		if xs[i], err = ev.optionalNumber(args, i, 0); err != nil {
+			return nil, err
+		}
+	}
+	return xs, nil
+}
+
+func financial(required, optional int, f func(xs []float64) (float64, error)) formulaFunction {
+	return func(ev *Evaluator, args []Expr) (Value, error) {
+		xs, err := ev.financialArgs(args, required, optional)
+		if err != nil {
+			return result(Value{}, err)
+		}
+		return numberOrError(f(xs))
+	}
+}
+
+func fv(rate, nper, pmt, pv, typ float64) float64 {
+	if rate == 0 {
+		return -(pv + pmt*nper)
+	}
+	f := math.Pow(1+rate, nper)
+	return -(pv*f + pmt*(1+rate*typ)*(f-1)/rate)
+}
+
+func pmt(rate, nper, pv, fv, typ float64) (float64, error) {
+	if nper == 0 {
+		return 0, errNum
+	}
+	if rate == 0 {
+		return -(pv + fv) / nper, nil
+	}
+	f := math.Pow(1+rate, nper)
+	return -rate * (fv + pv*f) / ((1 + rate*typ) * (f - 1)), nil
+}
+
+func ipmt(rate, per, nper, pv, fvalue, typ float64) (float64, error) {
+	if per < 1 || per > nper {
+		return 0, errNum
+	}
+	p, err := pmt(rate, nper, pv, fvalue, typ)
+	if err != nil {
+		return 0, err
+	}
+	if typ != 0 && per == 1 {
+		return 0, nil
+	}
+	i := fv(rate, per-1, p, pv, typ) * rate
+	if typ != 0 {
+		i /= 1 + rate
+	}
+	return i, nil
+}
+
+var (
+	// FV(rate, nper, pmt, [pv], [type])
+	fnFV = financial(3, 2, func(xs []float64) (float64, error) {
+		return fv(xs[0], xs[1], xs[2], xs[3], xs[4]), nil
+	})
+	// PV(rate, nper, pmt, [fv], [type])
+	fnPV = financial(3, 2, func(xs []float64) (float64, error) {
+		rate, nper, pmt, fv, typ := xs[0], xs[1], xs[2], xs[3], xs[4]
+		if rate == 0 {
+			return -(fv + pmt*nper), nil
+		}
+		f := math.Pow(1+rate, nper)
+		return -(fv + pmt*(1+rate*typ)*(f-1)/rate) / f, nil
+	})
+	// PMT(rate, nper, pv, [fv], [type])
+	fnPMT = financial(3, 2, func(xs []float64) (float64, error) {
+		return pmt(xs[0], xs[1], xs[2], xs[3], xs[4])
+	})
+	// IPMT(rate, per, nper, pv, [fv], [type])
+	fnIPMT = financial(4, 2, func(xs []float64) (float64, error) {
+		return ipmt(xs[0], xs[1], xs[2], xs[3], xs[4], xs[5])
+	})
+	// PPMT(rate, per, nper, pv, [fv], [type])
+	fnPPMT = financial(4, 2, func(xs []float64) (float64, error) {
+		p, err := pmt(xs[0], xs[2], xs[3], xs[4], xs[5])
+		if err != nil {
+			return 0, err
+		}
+		i, err := ipmt(xs[0], xs[1], xs[2], xs[3], xs[4], xs[5])
+		return p - i, err
+	})
+	// NPER(rate, pmt, pv, [fv], [type])
+	fnNPER = financial(3, 2, func(xs []float64) (float64, error) {
+		rate, pmt, pv, fv, typ := xs[0], xs[1], xs[2], xs[3], xs[4]
+		if rate == 0 {
+			if pmt == 0 {
+				return 0, errNum
+			}
+			return -(pv + fv) / pmt, nil
+		}
+		p := pmt * (1 + rate*typ)
+		return math.Log((p-fv*rate)/(p+pv*rate)) / math.Log(1+rate), nil
+	})
+	// EFFECT(nominal_rate, npery)
+	fnEffect = financial(2, 0, func(xs []float64) (float64, error) {
+		rate, n := xs[0], math.Trunc(xs[1])
+		if rate <= 0 || n < 1 {
+			return 0, errNum
+		}
+		return math.Pow(1+rate/n, n) - 1, nil
+	})
+	// NOMINAL(effect_rate, npery)
+	fnNominal = financial(2, 0, func(xs []float64) (float64, error) {
+		rate, n := xs[0], math.Trunc(xs[1])
+		if rate <= 0 || n < 1 {
+			return 0, errNum
+		}
+		return n * (math.Pow(1+rate, 1/n) - 1), nil
+	})
+)
+
+// newton finds the root of the function with Newton's method (the derivative is approximated).
+func newton(f func(float64) float64, guess float64) (float64, error) {
+	x := guess
+	for i := 0; i < 100; i++ {
+		y := f(x)
+		if math.Abs(y) < 1e-10 {
+			return x, nil
+		}
+		h := 1e-7 * math.Max(1, math.Abs(x))
+		d := (f(x+h) - y) / h
+		if d == 0 || math.IsNaN(d) {
+			break
+		}
+		next := x - y/d
+		if math.Abs(next-x) < 1e-12 {
+			return next, nil
+		}
+		x = next
+	}
+	return 0, errNum
+}
+
+// RATE(nper, pmt, pv, [fv], [type], [guess])
+func fnRate(ev *Evaluator, args []Expr) (Value, error) {
+	xs, err := ev.financialArgs(args, 3, 3)
+	if err != nil {
+		return result(Value{}, err)
+	}
+	nper, pmt, pv, fvalue, typ, guess := xs[0], xs[1], xs[2], xs[3], xs[4], xs[5]
+	if len(args) < 6 {
+		guess = 0.1
+	}
+	return numberOrError(newton(func(rate float64) float64 {
+		return fv(rate, nper, pmt, pv, typ) - fvalue
+	}, guess))
+}
+
+func npv(rate float64, values []float64) float64 {
+	var s float64
+	for i, v := range values {
+		s += v / math.Pow(1+rate, float64(i+1))
+	}
+	return s
+}
+
+// NPV(rate, value1, [value2], ...)
+func fnNPV(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 2, -1); err != nil {
+		return result(Value{}, err)
+	}
+	rate, err := ev.number(args[0])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	values, err := ev.collectNumbers(args[1:])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	if rate == -1 {
+		return ErrorValue(string(errDiv0)), nil
+	}
+	return numberResult(npv(rate, values)), nil
+}
+
+// IRR(values, [guess])
+func fnIRR(ev *Evaluator, args []Expr) (Value, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return result(Value{}, err)
+	}
+	values, err := ev.collectNumbers(args[:1])
+	if err != nil {
+		return result(Value{}, err)
+	}
+	guess, err := ev.optionalNumber(args, 1, 0.1)
+	if err != nil {
+		return result(Value{}, err)
+	}
+	if len(values) < 2 {
+		return ErrorValue(string(errNum)), nil
+	}
+	return numberOrError(newton(func(rate float64) float64 {
+		return values[0] + npv(rate, values[1:])
+	}, guess))
+}
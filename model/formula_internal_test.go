@@ -0,0 +1,173 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	for _, r := range []struct {
+		formula string
+		types   []TokenType
+	}{
+		{"'Sheet 1'!B2*2", []TokenType{TokenReference, TokenOperator, TokenNumber}},
+		{"SUM(A:A,3:3)", []TokenType{TokenFunction, TokenOpen, TokenReference, TokenSeparator, TokenReference, TokenClose}},
+		{"LOG10(A1)+ATAN2(1,2)", []TokenType{
+			TokenFunction, TokenOpen, TokenReference, TokenClose, TokenOperator,
+			TokenFunction, TokenOpen, TokenNumber, TokenSeparator, TokenNumber, TokenClose}},
+		{`"A1"&B1`, []TokenType{TokenText, TokenOperator, TokenReference}},
+		{"SUM(Table1[Amount]) - [@Tax]", []TokenType{
+			TokenFunction, TokenOpen, TokenStructuredReference, TokenClose,
+			TokenSpace, TokenOperator, TokenSpace, TokenStructuredReference}},
+		{"Rate*Sheet1!Amount", []TokenType{TokenName, TokenOperator, TokenName}},
+		{"[1]Sheet1!$A$1:$B$2", []TokenType{TokenReference}},
+		{"Sheet1:Sheet3!A1", []TokenType{TokenReference}},
+		{"IF(A1>=1.5E+3,TRUE,#N/A)", []TokenType{
+			TokenFunction, TokenOpen, TokenReference, TokenOperator, TokenNumber, TokenSeparator,
+			TokenBool, TokenSeparator, TokenError, TokenClose}},
+		{"{1,2;3,4}", []TokenType{
+			TokenArrayOpen, TokenNumber, TokenSeparator, TokenNumber, TokenRowSeparator,
+			TokenNumber, TokenSeparator, TokenNumber, TokenArrayClose}},
+	} {
+		tokens, err := Tokenize(r.formula)
+		if err != nil {
+			t.Errorf("Failed to tokenize %q: %v", r.formula, err)
+			continue
+		}
+		var types []TokenType
+		var values []string
+		for _, tok := range tokens {
+			types = append(types, tok.Type)
+			values = append(values, tok.Value)
+		}
+		if strings.Join(values, "") != r.formula {
+			t.Errorf("Expected tokens to reproduce %q, got %q", r.formula, values)
+		}
+		if len(types) != len(r.types) {
+			t.Errorf("Expected %v for %q, got %v", r.types, r.formula, tokens)
+			continue
+		}
+		for i := range types {
+			if types[i] != r.types[i] {
+				t.Errorf("Expected %v for %q, got %v", r.types, r.formula, tokens)
+				break
+			}
+		}
+	}
+
+	if _, err := Tokenize(`"unterminated`); err == nil {
+		t.Error("Expected an error for an unterminated string literal")
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	for _, r := range []struct {
+		ref, sheet, expected string
+	}{
+		{"a1", "", "A1"},
+		{"$A$1:B$2", "", "$A$1:B$2"},
+		{"'Sheet 1'!B2", "Sheet 1", "'Sheet 1'!B2"},
+		{"'O''Brien'!A:A", "O'Brien", "'O''Brien'!A:A"},
+		{"Data!$3:$3", "Data", "Data!$3:$3"},
+		{"Data!#REF!", "Data", "Data!#REF!"},
+	} {
+		ref, err := ParseReference(r.ref)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", r.ref, err)
+			continue
+		}
+		if ref.Sheet != r.sheet || ref.String() != r.expected {
+			t.Errorf("Expected %q (sheet %q) for %q, got %q (sheet %q)", r.expected, r.sheet, r.ref, ref, ref.Sheet)
+		}
+	}
+}
+
+func TestRelativeFormula(t *testing.T) {
+	for _, r := range []struct {
+		row, col          int
+		formula, expected string
+	}{
+		{1, 1, "'Sheet 1'!B2 + 1", "'Sheet 1'!R[+0]C[+0] + 1"},
+		{1, 1, "SUM(A:A)/COUNT(2:$3)", "SUM(C[-1]:C[-1])/COUNT(R[+0]:R[2])"},
+		{1, 1, `LOG10(B2) & "A1"`, `LOG10(R[+0]C[+0]) & "A1"`},
+		{1, 1, "Rate * Table1[Amount]", "Rate * Table1[Amount]"},
+	} {
+		if got := RelativeFormula(r.row, r.col, r.formula); got != r.expected {
+			t.Errorf("Expected %q for %q, got %q", r.expected, r.formula, got)
+		}
+	}
+}
+
+func TestShiftFormula(t *testing.T) {
+	for _, r := range []struct {
+		rows, cols        int
+		formula, expected string
+	}{
+		{2, 0, "LOG10(A3)", "LOG10(A5)"},
+		{1, 1, "Sheet1!A1*$B$1+B$2", "Sheet1!B2*$B$1+C$2"},
+		{1, 1, "SUM(A:A,3:3)", "SUM(B:B,4:4)"},
+		{1, 0, `"A1"&Rate`, `"A1"&Rate`},
+	} {
+		if got := shiftFormula(r.formula, r.rows, r.cols); got != r.expected {
+			t.Errorf("Expected %q for %q, got %q", r.expected, r.formula, got)
+		}
+	}
+}
+
+func TestParseFormula(t *testing.T) {
+	for _, r := range []struct {
+		formula, expected string
+	}{
+		{"=1+2*3", "1+2*3"},
+		{"(1+2)*3", "(1+2)*3"},
+		{"((A1))+(B1*C1)", "A1+B1*C1"},
+		{"-2^2", "-2^2"},
+		{"-(2^2)", "-(2^2)"},
+		{"1-(2-3)", "1-(2-3)"},
+		{"5%", "5%"},
+		{"a1&\"x\"\"y\"", `A1&"x""y"`},
+		{"_xlfn.STDEV.S(A1:A10)", "STDEV(A1:A10)"},
+		{"if(a1,,1)", "IF(A1,,1)"},
+		{"SUM((A1,B1),C1:C2 D1:D3)", "SUM((A1,B1),C1:C2 D1:D3)"},
+		{"SUM({1,2;3,4})", "SUM({1,2;3,4})"},
+		{"NOW()", "NOW()"},
+	} {
+		e, err := ParseFormula(r.formula)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", r.formula, err)
+			continue
+		}
+		if got := e.String(); got != r.expected {
+			t.Errorf("Expected %q for %q, got %q", r.expected, r.formula, got)
+		}
+	}
+
+	for _, formula := range []string{"", "1+", "SUM(1,2", "(1))", "1 2"} {
+		if _, err := ParseFormula(formula); err == nil {
+			t.Errorf("Expected an error parsing %q", formula)
+		}
+	}
+}
+
+func TestSameFormula(t *testing.T) {
+	for _, r := range []struct {
+		row, col       int
+		formula, other string
+		isSame         bool
+	}{
+		{2, 2, "B3*2", "b3 * 2", true},
+		{2, 2, "(B3*2)", "B3*2", true},
+		{2, 2, "_xlfn.STDEV.S(A:A)", "stdev(A:A)", true},
+		{2, 2, `"a1"&B3`, `"A1"&B3`, false},
+		{2, 2, "B4*2", "B3*2", false},
+		{2, 2, "$B$3*2", "B3*2", false},
+	} {
+		if got := SameFormula(r.row, r.col, r.formula, r.other); got != r.isSame {
+			t.Errorf("Expected %v comparing %q and %q", r.isSame, r.formula, r.other)
+		}
+	}
+	// The same relative formulas in different cells:
+	if NormalizeFormula(0, 2, "A1+B1") != NormalizeFormula(1, 2, "A2 + B2") {
+		t.Error("Expected the same normalized formula")
+	}
+}
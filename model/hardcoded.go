@@ -0,0 +1,207 @@
+package model
+
+import (
+	"math"
+	"strings"
+)
+
+// HardcodedConstant - a numeric literal of the answer formula replacing
+// a cell reference of the model answer formula
+type HardcodedConstant struct {
+	Literal   string  // the literal as it appears in the formula, eg, "0.05" or "5%"
+	Value     float64 // the value of the literal
+	Reference string  // the replaced model answer reference, eg, "$F$1"
+}
+
+type numericLiteral struct {
+	expr  Expr
+	value float64
+}
+
+// literalValue returns the value of a numeric literal, eg, 5, 5% or -5.
+func literalValue(e Expr) (float64, bool) {
+	switch e := e.(type) {
+	case *NumberExpr:
+		return e.Value, true
+	case *UnaryExpr:
+		if v, ok := literalValue(e.Operand); ok {
+			switch e.Op {
+			case "%":
+				return v / 100, true
+			case "-":
+				return -v, true
+			}
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// walkExpr calls the function for the expression and all its subexpressions
+// (the subexpressions are skipped if the function returns false).
+func walkExpr(e Expr, f func(Expr) bool) {
+	if !f(e) {
+		return
+	}
+	switch e := e.(type) {
+	case *UnaryExpr:
+		walkExpr(e.Operand, f)
+	case *BinaryExpr:
+		walkExpr(e.Left, f)
+		walkExpr(e.Right, f)
+	case *FuncExpr:
+		for _, a := range e.Args {
+			walkExpr(a, f)
+		}
+	case *ArrayExpr:
+		for _, row := range e.Rows {
+			for _, x := range row {
+				walkExpr(x, f)
+			}
+		}
+	}
+}
+
+func numericLiterals(e Expr) (literals []numericLiteral) {
+	walkExpr(e, func(e Expr) bool {
+		if v, ok := literalValue(e); ok {
+			literals = append(literals, numericLiteral{e, v})
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// cellReferences returns the single cell references of the expression.
+func cellReferences(e Expr) (refs []Reference) {
+	walkExpr(e, func(e Expr) bool {
+		if r, ok := e.(*RefExpr); ok && !r.IsRange && !r.IsError && r.From.Row >= 0 && r.From.Col >= 0 {
+			refs = append(refs, r.Reference)
+		}
+		if b, ok := e.(*BinaryExpr); ok && b.Op == ":" {
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// cellKey returns the key of the referenced cell (cell address or "Sheet!A1").
+func cellKey(ref Reference) string {
+	key := CellAddress(ref.From.Row, ref.From.Col)
+	if ref.Sheet != "" {
+		key = ref.Sheet + "!" + key
+	}
+	return key
+}
+
+func sameNumbers(a, b float64) bool {
+	return math.Abs(a-b) <= valueTolerance*math.Max(1.0, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+// sameExprCount counts the operands of the binary expression that are the same as the given ones.
+func sameExprCount(left, right Expr, b *BinaryExpr) (count int) {
+	if left.String() == b.Left.String() {
+		count++
+	}
+	if right.String() == b.Right.String() {
+		count++
+	}
+	return
+}
+
+// alignLiterals walks the answer and the model answer formula expressions in parallel
+// and collects the answer literals standing in the places of the model answer cell references.
+func alignLiterals(answer, model Expr, found map[Expr]Reference) {
+	if ref, ok := model.(*RefExpr); ok {
+		if _, isLiteral := literalValue(answer); isLiteral && !ref.IsRange && !ref.IsError {
+			found[answer] = ref.Reference
+		}
+		return
+	}
+	switch m := model.(type) {
+	case *UnaryExpr:
+		if a, ok := answer.(*UnaryExpr); ok && a.Op == m.Op {
+			alignLiterals(a.Operand, m.Operand, found)
+		}
+	case *BinaryExpr:
+		if a, ok := answer.(*BinaryExpr); ok && a.Op == m.Op {
+			left, right := a.Left, a.Right
+			// the operands of the commutative operations can be swapped, eg, "2*B3" and "B3*2"
+			if (a.Op == "+" || a.Op == "*") && sameExprCount(right, left, m) > sameExprCount(left, right, m) {
+				left, right = right, left
+			}
+			alignLiterals(left, m.Left, found)
+			alignLiterals(right, m.Right, found)
+		}
+	case *FuncExpr:
+		if a, ok := answer.(*FuncExpr); ok && strings.EqualFold(a.Name, m.Name) && len(a.Args) == len(m.Args) {
+			for i := range a.Args {
+				alignLiterals(a.Args[i], m.Args[i], found)
+			}
+		}
+	}
+}
+
+// DetectHardcodedConstants compares the answer formula with the model answer formula
+// and returns the numeric literals of the answer formula replacing the cell references
+// of the model answer formula, eg, "B2*0.05" where the model answer has "B2*$F$1"
+// and F1 holds 0.05. The literal replaces a reference if it stands in the same place
+// of the formula or its value equals the value of the referenced cell (values:
+// cell address -> value) not referenced in the answer formula.
+func DetectHardcodedConstants(formula, modelFormula string, values map[string]string) (constants []HardcodedConstant) {
+	if formula == "" || modelFormula == "" {
+		return
+	}
+	answer, err := ParseFormula(formula)
+	if err != nil {
+		return
+	}
+	model, err := ParseFormula(modelFormula)
+	if err != nil {
+		return
+	}
+	aligned := make(map[Expr]Reference)
+	alignLiterals(answer, model, aligned)
+
+	// the model answer literals (eg, 1 in "B2*(1+$F$1)") are not hard-coded
+	var modelLiterals []float64
+	for _, l := range numericLiterals(model) {
+		modelLiterals = append(modelLiterals, l.value)
+	}
+	referenced := make(map[string]bool)
+	for _, ref := range cellReferences(answer) {
+		referenced[strings.ToUpper(cellKey(ref))] = true
+	}
+	modelRefs := cellReferences(model)
+
+	for _, l := range numericLiterals(answer) {
+		if ref, ok := aligned[l.expr]; ok {
+			constants = append(constants, HardcodedConstant{Literal: l.expr.String(), Value: l.value, Reference: ref.String()})
+			continue
+		}
+		matched := false
+		for i, v := range modelLiterals {
+			if sameNumbers(v, l.value) {
+				modelLiterals = append(modelLiterals[:i], modelLiterals[i+1:]...)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		for _, ref := range modelRefs {
+			key := cellKey(ref)
+			if referenced[strings.ToUpper(key)] {
+				continue
+			}
+			if v := ParseValue(values[key]); v.Type == ValueNumber && sameNumbers(v.Number, l.value) {
+				constants = append(constants, HardcodedConstant{Literal: l.expr.String(), Value: l.value, Reference: ref.String()})
+				break
+			}
+		}
+	}
+	return
+}
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"path"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -38,9 +37,9 @@ var DryRun bool
 // ModelAnswerUserID - the user ID of the model answers
 var ModelAnswerUserID = 10000
 
-var (
-	cellIDRe = regexp.MustCompile(`\$?[A-Z]+\$?[0-9]+`)
-)
+// CarriedForwardWeight - the share of the value marks given for the values
+// that are correct when the errors of the precedent cells get carried forward
+var CarriedForwardWeight = 0.5
 
 // SolverNames - solver name mapping
 var SolverNames = map[string]string{
@@ -89,38 +88,42 @@ func getMaxMinFromDimensionRef(ref string) (minx, miny, maxx, maxy int, err erro
 
 // RelativeCellAddress converts cell ID into a relative R1C1 representation
 func RelativeCellAddress(rowIndex, colIndex int, cellID string) string {
-	x, y, err := xlsx.GetCoordsFromCellIDString(cellID)
+	ref, err := ParseReference(cellID)
 	if err != nil {
 		log.WithError(err).Errorln("Failed to find coordinates for ", cellID)
 	}
-	var r1c1 string
-
-	if strings.Contains(cellID[1:], "$") {
-		r1c1 = fmt.Sprintf("R[%d]", y)
-	} else {
-		r1c1 = fmt.Sprintf("R[%+d]", y-rowIndex)
-	}
-
-	if cellID[0] == '$' {
-		r1c1 += fmt.Sprintf("C[%d]", x)
-	} else {
-		r1c1 += fmt.Sprintf("C[%+d]", x-colIndex)
-	}
-	//return fmt.Sprintf("R[%d]C[%d]", y-rowIndex, x-colIndex)
-	return r1c1
+	return ref.R1C1(rowIndex, colIndex)
 }
 
-// RelativeFormula transforms the cell formula into the relative in R1C1 notation
+// RelativeFormula transforms the cell formula into the relative in R1C1 notation.
+// Only the references get replaced, the rest of the formula (white spaces,
+// string literals, function and defined names) stays intact.
 func RelativeFormula(rowIndex, colIndex int, formula string) string {
-	cellIDs := cellIDRe.FindAllString(formula, -1)
-	for _, cellID := range cellIDs {
-		relCellID := RelativeCellAddress(rowIndex, colIndex, cellID)
+	tokens, err := Tokenize(formula)
+	if err != nil {
+		if DebugLevel > 1 {
+			log.WithError(err).Debugf("Failed to tokenize formula %q", formula)
+		}
+		return formula
+	}
+	var sb strings.Builder
+	for _, t := range tokens {
+		if t.Type != TokenReference {
+			sb.WriteString(t.Value)
+			continue
+		}
+		ref, err := ParseReference(t.Value)
+		if err != nil {
+			sb.WriteString(t.Value)
+			continue
+		}
+		relCellID := ref.R1C1(rowIndex, colIndex)
 		if DebugLevel > 1 {
-			log.Debugf("Replacing %q with %q at (%d, %d)", cellID, relCellID, rowIndex, colIndex)
+			log.Debugf("Replacing %q with %q at (%d, %d)", t.Value, relCellID, rowIndex, colIndex)
 		}
-		formula = strings.Replace(formula, cellID, relCellID, -1)
+		sb.WriteString(relCellID)
 	}
-	return formula
+	return sb.String()
 }
 
 // QuestionType - workaround for MySQL EMUM(...)
@@ -181,6 +184,7 @@ type Question struct {
 	ReferenceID        sql.NullInt64       `gorm:"index;type:int"`
 	IsFormatting       bool
 	IsRubricCreated    bool
+	Palette            string `gorm:"type:varchar(255)"` // the block color palette, see ParsePalette
 }
 
 // TableName overrides default table name for the model
@@ -195,7 +199,7 @@ func (q Question) String() string {
 
 // ImportFile imports form Excel file QuestionExcleData
 func (q *Question) ImportFile(fileName, color string, verbose, skipHidden bool) error {
-	file, err := xlsx.OpenFile(fileName)
+	file, _, formulas, err := openWorkbook(fileName)
 	if err != nil {
 		return err
 	}
@@ -215,6 +219,7 @@ func (q *Question) ImportFile(fileName, color string, verbose, skipHidden bool)
 			log.Infof("Processing worksheet %q", sheet.Name)
 		}
 
+		arrays := arrayFormulas(sheet, formulas)
 		for i, row := range sheet.Rows {
 			for j, cell := range row.Cells {
 
@@ -227,6 +232,11 @@ func (q *Question) ImportFile(fileName, color string, verbose, skipHidden bool)
 				} else {
 					commentText = ""
 				}
+				formula := cell.Formula()
+				if formula == "" {
+					// the spilled cells of the array formulas
+					formula = arrays[[2]int{i, j}]
+				}
 				var qed QuestionExcelData
 
 				Db.FirstOrCreate(&qed, QuestionExcelData{
@@ -234,7 +244,7 @@ func (q *Question) ImportFile(fileName, color string, verbose, skipHidden bool)
 					SheetName:  sheet.Name,
 					CellRange:  cellRange,
 					Value:      cell.Value,
-					Formula:    cell.Formula(),
+					Formula:    formula,
 					Comment:    commentText,
 				})
 				if Db.Error != nil {
@@ -244,17 +254,18 @@ func (q *Question) ImportFile(fileName, color string, verbose, skipHidden bool)
 		}
 
 	}
-	q.ImportBlocks(file, color, verbose, skipHidden)
+	q.ImportBlocks(file, formulas, color, verbose, skipHidden)
 
 	return nil
 }
 
 // ImportBlocks extracts blocks from the given question file and stores in the DB for referencing
-func (q *Question) ImportBlocks(file *xlsx.File, color string, verbose, skipHidden bool) (wb Workbook) {
+func (q *Question) ImportBlocks(file *xlsx.File, formulas workbookFormulas, color string, verbose, skipHidden bool) (wb Workbook) {
 
 	var source Source
 	Db.Model(&q).Related(&source, "Source")
 	fileName := source.FileName
+	palette := q.palette(color)
 	if !DryRun {
 		wb = Workbook{FileName: fileName, IsReference: true}
 
@@ -317,11 +328,12 @@ func (q *Question) ImportBlocks(file *xlsx.File, color string, verbose, skipHidd
 				}
 			MATCH:
 
-				if fgColor == color {
+				if category, ok := palette.Category(fgColor); ok {
 
 					b := Block{
 						WorksheetID:     ws.ID,
-						Color:           color,
+						Color:           fgColor,
+						Category:        category,
 						Formula:         cell.Formula(),
 						RelativeFormula: RelativeFormula(i, j, cell.Formula()),
 						IsReference:     true,
@@ -337,7 +349,7 @@ func (q *Question) ImportBlocks(file *xlsx.File, color string, verbose, skipHidd
 						log.Debugf("Created %#v", b)
 					}
 
-					b.findWhole(sheet, color)
+					b.findWhole(sheet, formulas, fgColor)
 					b.save()
 					blocks = append(blocks, b)
 					if verbose && b.Range != "" {
@@ -348,7 +360,7 @@ func (q *Question) ImportBlocks(file *xlsx.File, color string, verbose, skipHidd
 			}
 		}
 		if len(blocks) == 0 {
-			log.Warningf("No block found in the worksheet %q of the workbook %q with color %q", sheet.Name, fileName, color)
+			log.Warningf("No block found in the worksheet %q of the workbook %q with colors %q", sheet.Name, fileName, palette)
 			if len(sheetFillColors) > 0 {
 				log.Infof("Following colors were found in the worksheet you could use: %v", sheetFillColors)
 			}
@@ -518,6 +530,10 @@ type Workbook struct {
 	Answer      Answer        `gorm:"foreignkey:AnswerID"`
 	Worksheets  []Worksheet   // `gorm:"foreignkey:WorkbookID"`
 	IsReference bool          // the workbook is used for referencing the expected blocks
+	// HasCircularReferences - some formula cells depend on themselves directly or indirectly
+	HasCircularReferences bool
+	IsIterative           bool   // the iterative calculation is turned on (calcPr iterate)
+	CalcMode              string `gorm:"type:varchar(20)"` // the calculation mode: auto, manual or autoNoTable
 }
 
 // TableName overrides default table name for the model
@@ -533,9 +549,19 @@ func (wb *Workbook) Reset() {
 	if err := Db.Where("workbook_id = ?", wb.ID).Find(&worksheets).Error; err != nil {
 		log.WithError(err).Errorln("Couldn't find the record of the Workbook, ID:", wb.ID)
 	}
+	Db.Where("workbook_id = ?", wb.ID).Delete(BlockDependency{})
+	Db.Where("workbook_id = ?", wb.ID).Delete(CellDependency{})
+	Db.Where("workbook_id = ?", wb.ID).Delete(PrecedentValue{})
 	log.Debugf("Deleting worksheets: %#v", worksheets)
 	for _, ws := range worksheets {
+		Db.Where("chart_id IN (?)", Db.Table("charts").Select("id").Where("worksheet_id = ?", ws.ID).QueryExpr()).Delete(ChartSeries{})
 		Db.Delete(Chart{}, "worksheet_id = ?", ws.ID)
+		Db.Where("table_id IN (?)", Db.Table("ExcelTables").Select("id").Where("worksheet_id = ?", ws.ID).QueryExpr()).Delete(TableColumn{})
+		Db.Delete(Table{}, "worksheet_id = ?", ws.ID)
+		Db.Where("scenario_id IN (?)", Db.Table("Scenarios").Select("id").Where("worksheet_id = ?", ws.ID).QueryExpr()).Delete(ScenarioInputCell{})
+		Db.Delete(Scenario{}, "worksheet_id = ?", ws.ID)
+		Db.Delete(DataTable{}, "worksheet_id = ?", ws.ID)
+		Db.Delete(GoalSeek{}, "worksheet_id = ?", ws.ID)
 		var blocks []Block
 		Db.Model(&ws).Related(&blocks)
 		if err := Db.Where("worksheet_id = ?", ws.ID).Find(&blocks).Error; err != nil {
@@ -621,8 +647,13 @@ func (wb *Workbook) ImportWorksheets(fileName string) {
 		log.WithError(err).Errorf("failed to open file %q", fileName)
 		return
 	}
+	wb.ImportCalcProperties(file)
 
-	for sheetIdx, sheetName := range file.GetSheetMap() {
+	for i, sp := range workbookSheets(file) {
+		if sp.Type != "worksheet" {
+			continue // the chart sheets are imported with ImportChartsheets
+		}
+		sheetName := sp.Name
 		var ws Worksheet
 		result := Db.First(&ws, Worksheet{
 			Name:       sheetName,
@@ -643,30 +674,51 @@ func (wb *Workbook) ImportWorksheets(fileName string) {
 				log.Debugf("Created workbook entry %#v", wb)
 			}
 		}
-		ws.Idx = sheetIdx
+		ws.Idx = i + 1
+		ws.partName = sp.PartName
 		Db.Save(ws)
 		sharedStrings := GetSharedStrings(file)
 		ws.ImportCharts(file)
+		ws.ImportTables(file)
 		ws.ImportWorksheetData(file, sharedStrings)
 		wb.MatchPlagiarismKeys(file)
 	}
+	wb.ImportChartsheets(file, fileName)
+	wb.linkPivotCharts()
 }
 
 // ImportCharts - import charts for the worksheet
 func (ws *Worksheet) ImportCharts(file *excelize.File) {
+	ws.importCharts(file, ws.sheetPartName(file))
+}
 
-	name := "xl/worksheets/_rels/sheet" + strconv.Itoa(ws.Idx) + ".xml.rels"
-	sheetRels := unmarshalRelationships(file.XLSX[name])
-	for _, r := range sheetRels.Relationships {
-		if strings.Contains(r.Target, "drawings/drawing") {
-			name := "xl/drawings/_rels/" + filepath.Base(r.Target) + ".rels"
-			drawing := unmarshalDrawing(file.XLSX["xl/drawings/"+filepath.Base(r.Target)])
-			drawingRels := unmarshalRelationships(file.XLSX[name])
-			for _, dr := range drawingRels.Relationships {
-				if strings.Contains(dr.Target, "charts/chart") {
-					chartName := "xl/charts/" + filepath.Base(dr.Target)
+// sheetPartName returns the name of the worksheet part (eg, xl/worksheets/sheet1.xml)
+// resolved through the workbook relationships.
+func (ws *Worksheet) sheetPartName(file *excelize.File) string {
+	if ws.partName == "" {
+		for _, sp := range workbookSheets(file) {
+			if sp.Name == ws.Name {
+				ws.partName = sp.PartName
+				break
+			}
+		}
+	}
+	return ws.partName
+}
+
+// importCharts imports the charts of the drawings referenced from the sheet part (sheetPartName).
+func (ws *Worksheet) importCharts(file *excelize.File, sheetPartName string) {
+
+	for _, r := range partRelationships(file, sheetPartName) {
+		if relationshipType(r) == "drawing" {
+			drawing := unmarshalDrawing(file.XLSX[r.Target])
+			for _, dr := range partRelationships(file, r.Target) {
+				if relationshipType(dr) == "chart" {
+					chartName := dr.Target
 					chart := UnmarshalChart(file.XLSX[chartName])
 					chartTitle := chart.Title.Value()
+					chartSpace := unmarshalChartSpace(file.XLSX[chartName])
+					series, dataLabels := chartSpace.chartSeries()
 					log.Infof("Found %q chart (titled: %q) on the sheet %q", chart.Type(), chartTitle, ws.Name)
 					itemCount := chart.ItemCount()
 					chartEntry := Chart{
@@ -687,6 +739,11 @@ func (ws *Worksheet) ImportCharts(file *excelize.File) {
 						XMaxValue:   chart.XMaxValue(),
 						YMaxValue:   chart.YMaxValue(),
 						YMinValue:   chart.YMinValue(),
+
+						LegendPosition: chartSpace.legendPosition(),
+						DataLabels:     dataLabels,
+						SeriesCount:    len(series),
+						PivotName:      chartSpace.PivotSource,
 					}
 					Db.Create(&chartEntry)
 					chartID := NewNullInt64(chartEntry.ID)
@@ -716,6 +773,12 @@ func (ws *Worksheet) ImportCharts(file *excelize.File) {
 						{"Y-Axis MinValue", normalizeFloatRepr(chart.YMinValue())},
 						{"X-Axis MaxValue", normalizeFloatRepr(chart.XMaxValue())},
 						{"Y-Axis MaxValue", normalizeFloatRepr(chart.YMaxValue())},
+						{"Legend", chartEntry.LegendPosition},
+						{"DataLabels", dataLabels},
+						{"SeriesCount", strconv.Itoa(len(series))},
+					}
+					if chartEntry.PivotName != "" {
+						properties = append(properties, struct{ Name, Value string }{"PivotTable", chartEntry.PivotName})
 					}
 					for _, p := range properties {
 						block := Block{
@@ -728,6 +791,7 @@ func (ws *Worksheet) ImportCharts(file *excelize.File) {
 						ws.AddAuxBlock(&block, "Chart")
 						propCount++
 					}
+					ws.importChartSeries(&chartEntry, series, propCount)
 				}
 			}
 		}
@@ -750,59 +814,27 @@ func joinStr(del string, strs ...string) (js string) {
 // ImportWorksheetData imports all filters
 func (ws *Worksheet) ImportWorksheetData(file *excelize.File, sharedStrings SharedStrings) {
 
-	name := "xl/worksheets/sheet" + strconv.Itoa(ws.Idx) + ".xml"
+	name := ws.sheetPartName(file)
 	sheet := UnmarshalWorksheet(file.XLSX[name])
 
-	// Sorting:
-	for _, ss := range sheet.SortState {
-		ds := DataSource{
-			WorksheetID: ws.ID,
-			Range:       ss.Ref,
-		}
-		Db.Create(&ds)
-		Db.Create(&Block{
-			WorksheetID: ws.ID,
-			Range:       "SortSource",
-			Formula:     ss.Ref,
-		})
+	values := sheetValues(&sheet, sharedStrings)
+	hidden := sheetHiddenRows(&sheet)
+	styleSheet := workbookStyleSheet(file)
 
-		var method string
-		switch ss.ColumnSort {
-		case "1":
-			method = "Horizontal"
-		default:
-			method = "Vertical"
-		}
-		for _, sc := range ss.SortCondition {
-			var st string
-			if sc.Descending == "1" {
-				st = "descending"
-			} else {
-				st = "ascending"
-			}
-			sorting := Sorting{
-				DataSourceID: ds.ID,
-				Method:       method,
-				Reference:    sc.Ref,
-				Type:         st,
-				CustomList:   sc.CustomList,
-				IconSet:      sc.IconSet,
-				IconID:       sc.IconId,
-			}
-			Db.Create(&sorting)
-			ws.AddAuxBlock(&Block{
-				Range: sc.Ref,
-				Formula: joinStr(",",
-					sorting.Method,
-					sorting.Type,
-					sorting.SortBy,
-					sorting.CustomList,
-					sorting.IconSet,
-					sorting.IconID),
-				SortingID: NewNullInt64(sorting.ID),
-			}, "Sorting")
+	// Sorting:
+	sortStates := sheet.SortState
+	for _, af := range sheet.AutoFilter {
+		if af.SortState != nil {
+			sortStates = append(sortStates, *af.SortState)
 		}
 	}
+	colors := newCellColors(file, &styleSheet, &sheet)
+	for _, ss := range sortStates {
+		ws.importSortState(ss, styleSheet.Dxfs.Dxf, values, colors)
+	}
+	if len(sortStates) == 0 {
+		ws.inferSorting(values, colors)
+	}
 
 	// Filters:
 	for _, af := range sheet.AutoFilter {
@@ -810,6 +842,7 @@ func (ws *Worksheet) ImportWorksheetData(file *excelize.File, sharedStrings Shar
 			WorksheetID: ws.ID,
 			Range:       af.Ref,
 		}
+		ds.verifyFilter(af.FilterColumn, values, hidden)
 		Db.Create(&ds)
 		ws.AddAuxBlock(&Block{
 			Range:   "FilterSource",
@@ -929,157 +962,128 @@ func (ws *Worksheet) ImportWorksheetData(file *excelize.File, sharedStrings Shar
 		}
 	}
 
-	// Pivot Tables:
-	if content, ok := file.XLSX["xl/pivotCache/pivotCacheDefinition"+strconv.Itoa(ws.Idx)+".xml"]; ok {
-		pcd := UnmarshalPivotCacheDefinition(content)
-		ptd := UnmarshalPivotTableDefinition(
-			file.XLSX["xl/pivotTables/pivotTable"+strconv.Itoa(ws.Idx)+".xml"])
-		ds := DataSource{
-			WorksheetID: ws.ID,
-			Range:       pcd.CacheSource.WorksheetSource.Ref,
-		}
-		Db.Create(&ds)
-		ws.AddAuxBlock(&Block{
-			Range:   "PivotSource",
-			Formula: ds.Range,
-		}, "Pivot")
-		log.Info(ptd.XMLName)
-		if ptd.PivotFields.Count >= "0" {
-			var pfIdx, rfIdx, cfIdx, dfIdx = 0, 0, 0, 0
-			for _, pf := range ptd.PivotFields.PivotField {
-				var label, fieldType, blockCellRange string
-				var rec PivotTable
-
-				if pf.DataField == "" {
-					switch pf.Axis {
-					case "axisPage":
-						fieldType, blockCellRange = "Filter", "PageField"
-						label = sharedStrings.Get(ptd.PageFields.PageField[pfIdx].Fld)
-						pfIdx++
-					case "axisRow":
-						fieldType, blockCellRange = "Row", "RowField"
-						label = sharedStrings.Get(ptd.RowFields.Field[rfIdx].X)
-						rfIdx++
-					case "axisCol":
-						fieldType, blockCellRange = "Column", "ColField"
-						label = sharedStrings.Get(ptd.ColFields.Field[cfIdx].X)
-						cfIdx++
-					default:
-						log.Warnf("Unhandled pivot field: %#v", pf)
-						continue
-					}
-
-					rec = PivotTable{
-						DataSourceID: ds.ID,
-						Type:         fieldType,
-						Label:        label,
-					}
-
-				} else {
-					// DataField
-					var function string
-					df := ptd.DataFields.DataField[dfIdx]
-					fieldType, blockCellRange = "Value", "DataField"
-					label = sharedStrings.Get(df.Fld)
-					if df.Subtotal != "" {
-						function = df.Subtotal
-					} else {
-						function = "sum"
-					}
-					dfIdx++
-
-					rec = PivotTable{
-						DataSourceID: ds.ID,
-						Type:         "Value",
-						Label:        label,
-						Function:     function,
-						DisplayName:  df.Name,
-					}
-				}
+	if len(sheet.AutoFilter) == 0 {
+		ws.inferFilter(hidden)
+	}
 
-				Db.Create(&rec)
-				ws.AddAuxBlock(&Block{
-					Range:   blockCellRange,
-					Formula: label,
-					PivotID: NewNullInt64(rec.ID),
-				}, "Pivot")
-			}
+	// Pivot Tables:
+	for _, r := range partRelationships(file, name) {
+		if relationshipType(r) == "pivotTable" {
+			ws.importPivotTable(file, r.Target, sharedStrings)
 		}
 	}
 
 	// Conditional Formatting
-	for _, cf := range sheet.ConditionalFormatting {
+	if len(sheet.ConditionalFormatting) > 0 {
+		ws.importConditionalFormatting(&sheet, styleSheet.Dxfs.Dxf, values)
+	}
+
+	// Data Validations
+	for _, dv := range sheet.DataValidations.DataValidation {
 		ds := DataSource{
 			WorksheetID: ws.ID,
-			Range:       cf.Sqref,
+			Range:       dv.Sqref,
 		}
 		Db.Create(&ds)
 		ws.AddAuxBlock(&Block{
-			Range:        "CFSource",
+			Range:        "ValidationSource",
 			Formula:      ds.Range,
 			DataSourceID: NewNullInt64(ds.ID),
-		}, "CF")
-		for _, cfr := range cf.CfRule {
-			var operator, formula1, formula2, formula3 string
-			switch cfr.Type {
-			case "iconSet":
-				operator = cfr.IconSet.IconSet
-			case "aboveAverage":
-				if cfr.AboveAverage == "0" {
-					operator = "bellow average"
-				} else {
-					operator = "above average"
-				}
-			case "top10":
-				if cfr.Bottom == "1" {
-					operator = "bottom"
-				} else {
-					operator = "top"
-				}
-			default:
-				operator = cfr.Operator
-			}
-			switch cfr.Type {
-			case "containsText":
-				formula1 = cfr.AttrText
-			case "timePeriod":
-				formula1 = cfr.TimePeriod
-			case "top10":
-				formula1 = cfr.Rank
-			default:
-				if len(cfr.Formula) > 0 {
-					formula1 = cfr.Formula[0].Text
-				}
-			}
-			if cfr.Type == "top10" {
-				if cfr.Percent != "" {
-					formula2 = "percent"
-				}
-			} else if len(cfr.Formula) > 1 {
-				formula2 = cfr.Formula[1].Text
-			}
-			if len(cfr.Formula) > 2 {
-				formula3 = cfr.Formula[2].Text
+		}, "Validation")
+
+		rec := DataValidation{
+			DataSourceID:     ds.ID,
+			Type:             dv.Type,
+			Operator:         dv.Operator,
+			Formula1:         dv.Formula1,
+			Formula2:         dv.Formula2,
+			AllowBlank:       dv.AllowBlank == "1" || dv.AllowBlank == "true",
+			ShowDropDown:     dv.ShowDropDown == "1" || dv.ShowDropDown == "true",
+			ShowInputMessage: dv.ShowInputMessage == "1" || dv.ShowInputMessage == "true",
+			ShowErrorMessage: dv.ShowErrorMessage == "1" || dv.ShowErrorMessage == "true",
+			ErrorStyle:       dv.ErrorStyle,
+			ErrorTitle:       dv.ErrorTitle,
+			Error:            dv.Error,
+			PromptTitle:      dv.PromptTitle,
+			Prompt:           dv.Prompt,
+		}
+		// the defaults omitted in the file
+		if rec.Type == "" {
+			rec.Type = "none"
+		}
+		if rec.Operator == "" && rec.Type != "none" && rec.Type != "list" && rec.Type != "custom" {
+			rec.Operator = "between"
+		}
+		if rec.ErrorStyle == "" {
+			rec.ErrorStyle = "stop"
+		}
+		Db.Create(&rec)
+		ws.AddAuxBlock(&Block{
+			Range:        rec.Type,
+			Formula:      joinStr(",", rec.Operator, rec.Formula1, rec.Formula2),
+			DataSourceID: NewNullInt64(ds.ID),
+		}, "Validation")
+	}
+
+	// Scenarios
+	current, _ := strconv.Atoi(sheet.Scenarios.Current)
+	for i, sc := range sheet.Scenarios.Scenario {
+		rec := Scenario{
+			WorksheetID: ws.ID,
+			Name:        sc.Name,
+			Comment:     sc.Comment,
+			User:        sc.User,
+			IsLocked:    sc.Locked == "1" || sc.Locked == "true",
+			IsHidden:    sc.Hidden == "1" || sc.Hidden == "true",
+			IsCurrent:   i == current,
+			ResultCells: sheet.Scenarios.Sqref,
+		}
+		var values []string
+		for _, ic := range sc.InputCells {
+			input := ScenarioInputCell{
+				Range:     ic.R,
+				Value:     ic.Val,
+				IsDeleted: ic.Deleted == "1" || ic.Deleted == "true",
 			}
+			rec.InputCells = append(rec.InputCells, input)
+			values = append(values, input.String())
+		}
+		Db.Create(&rec)
+		ws.AddAuxBlock(&Block{
+			Range:   "Scenario",
+			Formula: joinStr(",", append([]string{rec.Name}, values...)...),
+		}, "WhatIf")
+	}
+	if sheet.Scenarios.Sqref != "" {
+		ws.AddAuxBlock(&Block{
+			Range:   "ScenarioResult",
+			Formula: sheet.Scenarios.Sqref,
+		}, "WhatIf")
+	}
 
-			rec := ConditionalFormatting{
-				DataSourceID: ds.ID,
-				Type:         cfr.Type,
-				Operator:     operator,
-				Formula1:     formula1,
-				Formula2:     formula2,
-				Formula3:     formula3,
+	// Data Tables
+	for _, row := range sheet.SheetData.Row {
+		for _, c := range row.C {
+			if c.F == nil || c.F.T != "dataTable" {
+				continue
 			}
+			rec := DataTable{
+				WorksheetID: ws.ID,
+				Range:       c.F.Ref,
+				Is2D:        c.F.Dt2D == "1" || c.F.Dt2D == "true",
+			}
+			rec.Formula, rec.RowInputCell, rec.ColumnInputCell = dataTableFormula(
+				rec.Is2D, c.F.Dtr == "1" || c.F.Dtr == "true", c.F.R1, c.F.R2)
 			Db.Create(&rec)
 			ws.AddAuxBlock(&Block{
-				Range:        rec.Type,
-				Formula:      joinStr(",", operator, formula1, formula2, formula3),
-				DataSourceID: NewNullInt64(ds.ID),
-			}, "CF")
-
+				Range:   "DataTable",
+				Formula: joinStr(",", rec.Range, rec.Formula),
+			}, "WhatIf")
 		}
-
 	}
+
+	// Goal Seek
+	ws.detectGoalSeek(file, &sheet, sharedStrings)
 }
 
 // normalizeFloatRepr - if val is float representation round it to 3 digits after the '.'
@@ -1105,10 +1109,16 @@ type Worksheet struct {
 	WorkbookID       int           `gorm:"index"`
 	IsReference      bool
 	OrderNum         int
-	Idx              int
+	Idx              int    // the position of the sheet in the workbook (1-based)
 	IsPlagiarised    bool   // sql.NullBool
+	IsChartsheet     bool   // the sheet contains only a chart (xl/chartsheets/sheetN.xml)
 	Cells            []Cell `gorm:"foreignkey:WorksheetID"`
-	questionID       int    `gorm:"-"`
+	// HasCircularReferences - some formula cells depend on themselves directly or indirectly
+	HasCircularReferences bool
+	CircularCells         string           `gorm:"size:2000"` // comma separated list of the cells involved in the circular references
+	questionID            int              `gorm:"-"`
+	partName              string           `gorm:"-"` // the sheet part name, eg, xl/worksheets/sheet1.xml
+	formulas              workbookFormulas `gorm:"-"` // the formula details of the workbook cells (see openWorkbook)
 }
 
 // TableName overrides default table name for the model
@@ -1128,6 +1138,8 @@ func (ws *Worksheet) AddAuxBlock(b *Block, cellType string) {
 		"Solver":     6,
 		"Chart":      7,
 		"Sorting":    9,
+		"Validation": 10,
+		"WhatIf":     11,
 	}[cellType]; !ok {
 		log.Errorf("incorrect cell type value: %q", cellType)
 	}
@@ -1229,29 +1241,34 @@ func (ws *Worksheet) GetCellComments() (res []CellCommentRow, err error) {
 
 // Block - Excel block
 type Block struct {
-	ID              int `gorm:"column:ExcelBlockID;primary_key:true;AUTO_INCREMENT"`
-	Color           string
-	Range           string                       `gorm:"column:BlockCellRange"`
-	Formula         string                       `gorm:"column:BlockFormula"` // first block cell formula
-	RelativeFormula string                       // first block cell relative formula formula
-	Cells           []Cell                       `gorm:"foreignkey:BlockID"`
-	Worksheet       Worksheet                    `gorm:"foreignkey:WorksheetID"`
-	WorksheetID     int                          `gorm:"index"`
-	CommentMappings []BlockCommentMapping        `gorm:"foreignkey:ExcelBlockID"`
-	Chart           Chart                        `gorm:"foreignkey:ChartId"`
-	ChartID         sql.NullInt64                `grom:"type:int;index"`
-	IsReference     bool                         // the block is used for referencing the expected bloks
-	TRow            int                          `gorm:"index"` // Top row
-	LCol            int                          `gorm:"index"` // Left column
-	BRow            int                          `gorm:"index"` // Bottom row
-	RCol            int                          `gorm:"index"` // Right column
-	DataSourceID    sql.NullInt64                `gorm:"column:source_id;type:int"`
-	FilterID        sql.NullInt64                `gorm:"type:int"`
-	SortingID       sql.NullInt64                `gorm:"column:sort_id;type:int"`
-	PivotID         sql.NullInt64                `gorm:"type:int"`
-	i               struct{ sr, sc, er, ec int } `gorm:"-"` // "Inner" block - the block containing values
-	isEmpty         bool                         `gorm:"-"` // All block cells are empty
-	questionID      int                          `gorm:"-"`
+	ID               int `gorm:"column:ExcelBlockID;primary_key:true;AUTO_INCREMENT"`
+	Color            string
+	Category         BlockCategory                `gorm:"type:varchar(20)"` // the category defined by the color
+	Range            string                       `gorm:"column:BlockCellRange"`
+	Formula          string                       `gorm:"column:BlockFormula"` // first block cell formula
+	RelativeFormula  string                       // first block cell relative formula formula
+	Cells            []Cell                       `gorm:"foreignkey:BlockID"`
+	Worksheet        Worksheet                    `gorm:"foreignkey:WorksheetID"`
+	WorksheetID      int                          `gorm:"index"`
+	CommentMappings  []BlockCommentMapping        `gorm:"foreignkey:ExcelBlockID"`
+	Chart            Chart                        `gorm:"foreignkey:ChartId"`
+	ChartID          sql.NullInt64                `grom:"type:int;index"`
+	IsReference      bool                         // the block is used for referencing the expected bloks
+	IsAutoDiscovered bool                         // the block was found ignoring the filling color
+	IsArray          bool                         // the block is the range of an array formula (CSE or dynamic array spill)
+	TRow             int                          `gorm:"index"` // Top row
+	LCol             int                          `gorm:"index"` // Left column
+	BRow             int                          `gorm:"index"` // Bottom row
+	RCol             int                          `gorm:"index"` // Right column
+	DataSourceID     sql.NullInt64                `gorm:"column:source_id;type:int"`
+	FilterID         sql.NullInt64                `gorm:"type:int"`
+	SortingID        sql.NullInt64                `gorm:"column:sort_id;type:int"`
+	PivotID          sql.NullInt64                `gorm:"type:int"`
+	i                struct{ sr, sc, er, ec int } `gorm:"-"` // "Inner" block - the block containing values
+	isEmpty          bool                         `gorm:"-"` // All block cells are empty
+	questionID       int                          `gorm:"-"`
+	// canonical first block cell formula, see NormalizeFormula
+	normalizedFormula *string `gorm:"-"`
 }
 
 // TableName overrides default table name for the model
@@ -1344,26 +1361,46 @@ func cellValue(cell *xlsx.Cell) (value string) {
 // ChangeFormula removes _xlfn from cell formulas CWA-295
 // convert formulas to POI compatible formulas
 func ChangeFormula(formula string) string {
-	switch {
-	case strings.Contains(formula, "_xlfn."):
-		formula = strings.Replace(formula, "_xlfn.", "", -1)
-	case strings.Contains(formula, "STDEV.S"):
-		formula = strings.Replace(formula, "STDEV.S", "STDEV", -1)
-	case strings.Contains(formula, "VAR.S"):
-		formula = strings.Replace(formula, "VAR.S", "VAR", -1)
-	case strings.Contains(formula, "MODE.SNGL"):
-		formula = strings.Replace(formula, "MODE.SNGL", "MODE", -1)
-	case strings.Contains(formula, "VAR.P"):
-		formula = strings.Replace(formula, "VAR.P", "VARP", -1)
+	tokens, err := Tokenize(formula)
+	if err != nil {
+		if DebugLevel > 1 {
+			log.WithError(err).Debugf("Failed to tokenize formula %q", formula)
+		}
+		return formula
+	}
+	var sb strings.Builder
+	for _, t := range tokens {
+		if t.Type == TokenFunction {
+			sb.WriteString(canonicalFunctionName(t.Value))
+		} else {
+			sb.WriteString(t.Value)
+		}
+	}
+	return sb.String()
+}
+
+// hasSameFormula tests if the cell (r, c) formula is the same as the formula of the block
+// (the first block cell formula).
+func (b *Block) hasSameFormula(r, c int, formula string) bool {
+	if b.normalizedFormula == nil {
+		nf := NormalizeFormula(b.TRow, b.LCol, b.Formula)
+		b.normalizedFormula = &nf
 	}
-	return formula
+	return NormalizeFormula(r, c, formula) == *b.normalizedFormula
 }
 
 // fildWhole finds whole range of the specified color
 // and the same "relative" formula starting with the set top-left cell.
-func (b *Block) findWhole(sheet *xlsx.Sheet, color string) {
+func (b *Block) findWhole(sheet *xlsx.Sheet, formulas workbookFormulas, color string) {
 
 	b.BRow, b.RCol = b.TRow, b.LCol
+	if b.expandArray(sheet, formulas, nil) {
+		if !b.IsReference {
+			b.storeCells(sheet, formulas)
+			b.findInner(sheet)
+		}
+		return
+	}
 	for i, row := range sheet.Rows {
 
 		// skip all rows until the first block row
@@ -1374,8 +1411,8 @@ func (b *Block) findWhole(sheet *xlsx.Sheet, color string) {
 		log.Debugf("Total cells: %d at %d", len(row.Cells), i)
 		// Range is discontinued or of a differnt color
 		if len(row.Cells) <= b.RCol ||
-			row.Cells[b.RCol].GetStyle().Fill.FgColor != color ||
-			RelativeFormula(i, b.RCol, row.Cells[b.RCol].Formula()) != b.RelativeFormula {
+			!SameColor(row.Cells[b.RCol].GetStyle().Fill.FgColor, color) ||
+			!b.hasSameFormula(i, b.RCol, row.Cells[b.RCol].Formula()) {
 			log.Debugf("Reached the edge row of the block at row %d", i)
 			b.BRow = i - 1
 			break
@@ -1390,17 +1427,17 @@ func (b *Block) findWhole(sheet *xlsx.Sheet, color string) {
 			}
 
 			// Reached the top-right corner:
-			if fgColor := cell.GetStyle().Fill.FgColor; fgColor == color {
+			if fgColor := cell.GetStyle().Fill.FgColor; SameColor(fgColor, color) {
 				if !b.IsReference {
-					relFormula := RelativeFormula(i, j, cell.Formula())
-					if relFormula == b.RelativeFormula {
+					if b.hasSameFormula(i, j, cell.Formula()) {
 						cellID := CellAddress(i, j)
 						c := Cell{
-							BlockID:     NewNullInt64(b.ID),
-							WorksheetID: b.WorksheetID,
-							Formula:     cell.Formula(),
-							Value:       cellValue(cell),
-							Range:       cellID,
+							BlockID:         NewNullInt64(b.ID),
+							WorksheetID:     b.WorksheetID,
+							Formula:         cell.Formula(),
+							OriginalFormula: originalFormula(cell, formulas),
+							Value:           cellValue(cell),
+							Range:           cellID,
 						}
 						if DebugLevel > 1 {
 							log.Debugf("Inserting %#v", c)
@@ -1431,14 +1468,16 @@ func (b *Block) findWhole(sheet *xlsx.Sheet, color string) {
 
 // fildWholeWithin finds whole range with the same "relative" formula
 // withing the specific reference block ignoring the filling color.
-func (b *Block) findWholeWithin(sheet *xlsx.Sheet, rb Block, importFormatting bool) {
+func (b *Block) findWholeWithin(sheet *xlsx.Sheet, formulas workbookFormulas, rb Block, importFormatting bool) {
 	b.BRow, b.RCol = b.TRow, b.LCol
-	for r := b.TRow; r <= rb.BRow; r++ {
+	// the array formula block covers the whole array formula range
+	isArray := b.expandArray(sheet, formulas, &rb)
+	for r := b.TRow; r <= rb.BRow && !isArray; r++ {
 
 		row := sheet.Row(r)
 		// Range is discontinued or of a differnt relative formula
 		if len(row.Cells) <= b.RCol ||
-			RelativeFormula(r, b.RCol, row.Cells[b.RCol].Formula()) != b.RelativeFormula {
+			!b.hasSameFormula(r, b.RCol, row.Cells[b.RCol].Formula()) {
 			log.Debugf("Reached the edge row of the block at row %d", r)
 			b.BRow = r - 1
 			break
@@ -1451,7 +1490,7 @@ func (b *Block) findWholeWithin(sheet *xlsx.Sheet, rb Block, importFormatting bo
 			cell := sheet.Cell(r, c)
 
 			// Reached the bottom-right corner:
-			if relFormula := RelativeFormula(r, c, cell.Formula()); relFormula == b.RelativeFormula {
+			if b.hasSameFormula(r, c, cell.Formula()) {
 				b.RCol = c
 			} else {
 				log.Debugf("Reached the edge column  of the block at column %d", c)
@@ -1466,38 +1505,48 @@ func (b *Block) findWholeWithin(sheet *xlsx.Sheet, rb Block, importFormatting bo
 	for r := b.TRow; r <= b.BRow; r++ {
 		for c := b.LCol; c <= b.RCol; c++ {
 			wsCell := sheet.Cell(r, c)
-			updatedFormula := ChangeFormula(wsCell.Formula())
+			updatedFormula := ChangeFormula(b.cellFormula(wsCell))
 			cell := Cell{
-				BlockID:     NewNullInt64(b.ID),
-				WorksheetID: b.WorksheetID,
-				Formula:     updatedFormula,
-				Value:       cellValue(wsCell),
-				Range:       CellAddress(r, c),
+				BlockID:         NewNullInt64(b.ID),
+				WorksheetID:     b.WorksheetID,
+				Formula:         updatedFormula,
+				OriginalFormula: originalFormula(wsCell, formulas),
+				Value:           cellValue(wsCell),
+				Range:           CellAddress(r, c),
 			}
 			if b.questionID > 0 {
-				var result struct {
-					CommentID int `gorm:"column:CommentID"`
+				var results []struct {
+					CommentID int    `gorm:"column:CommentID"`
+					Formula   string `gorm:"column:Formula"`
 				}
 				if err := Db.Raw(`
-					SELECT c.CommentID AS CommentID
+					SELECT c.CommentID AS CommentID, c.Formula AS Formula
 					FROM Cells AS c
-						-- JOIN ExcelBlocks AS b ON b.ExcelBlockID = c.block_id
 						JOIN WorkSheets AS ws ON ws.id = c.worksheet_id
 						JOIN StudentAnswers AS sa ON sa.StudentAnswerID = ws.StudentAnswerID
 					WHERE
 						sa.QuestionID = ?
 						AND c.Value = ?
 						AND c.cell_range = ?
-						-- AND b.BlockCellRange = ?
-						-- AND b.BlockFormula= ?
 						AND ws.name = ?
-					LIMIT 1
-				`, b.questionID, cell.Value, cell.Range, b.Range, b.Formula, sheet.Name).Scan(&result).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+					ORDER BY c.id
+				`, b.questionID, cell.Value, cell.Range, sheet.Name).Scan(&results).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
 					log.WithError(err).Errorf("Failed to select a matching cell: %#v.", cell)
 				}
-				if result.CommentID > 0 {
-					log.Debugf("Linked comment ID: %d to range: %q", result.CommentID, cell.Range)
-					cell.CommentID = NewNullInt64(result.CommentID)
+				// Prefer the comment of the cell with the same formula:
+				commentID := 0
+				if len(results) > 0 {
+					commentID = results[0].CommentID
+				}
+				for _, m := range results {
+					if SameFormula(r, c, m.Formula, updatedFormula) {
+						commentID = m.CommentID
+						break
+					}
+				}
+				if commentID > 0 {
+					log.Debugf("Linked comment ID: %d to range: %q", commentID, cell.Range)
+					cell.CommentID = NewNullInt64(commentID)
 				}
 			}
 			err := Db.Create(&cell).Error
@@ -1572,6 +1621,7 @@ type Cell struct {
 	WorksheetID           int    `gorm:"index"`
 	Range                 string `gorm:"column:cell_range"`
 	Formula               string
+	OriginalFormula       string // the formula as entered if it got rewritten, eg, with the structured references
 	Value                 string `gorm:"size:2000"`
 	Comment               Comment
 	CommentID             sql.NullInt64   `gorm:"column:CommentID;type:int"`
@@ -1586,6 +1636,11 @@ type Cell struct {
 	Border                *Border
 	AlignmentID           sql.NullInt64 `gorm:"index;type:int"`
 	Alignment             *Alignment
+	FontID                sql.NullInt64 `gorm:"index;type:int"`
+	FontStyle             *Font         `gorm:"foreignkey:FontID"`
+	FillID                sql.NullInt64 `gorm:"index;type:int"`
+	FillStyle             *Fill         `gorm:"foreignkey:FillID"`
+	IsCircular            bool          // the cell is involved in a circular reference
 }
 
 // TableName overrides default table name for the model
@@ -1600,6 +1655,14 @@ type AutoEvaluation struct {
 	IsValueCorrect   bool   `gorm:"column:IsValueCorrect"`
 	IsFormulaCorrect bool   `gorm:"column:IsFormulaCorrect"`
 	IsHardcoded      bool
+	HardcodedValues  string `gorm:"type:varchar(255)"` // the hard-coded literals or the constant entered instead of the formula
+	// the value matches the model answer formula recomputed with
+	// the answer precedent cell values (error carried forward)
+	IsCarriedForwardCorrect bool
+	// the formatting of the cell (the formatting questions only) is the same as the formatting
+	// of the model answer cell, the differences, eg, "border missing bottom, font should be bold"
+	IsFormattingCorrect sql.NullBool
+	FormattingResult    string `gorm:"type:varchar(1000)"`
 }
 
 // TableName overrides default table name for the model
@@ -1665,6 +1728,7 @@ type MySQLQuestion struct {
 	ReferenceID        sql.NullInt64       `gorm:"index;type:int"`
 	IsFormatting       bool
 	IsRubricCreated    bool
+	Palette            string `gorm:"type:varchar(255)"` // the block color palette, see ParsePalette
 }
 
 // TableName overrides default table name for the model
@@ -1748,6 +1812,33 @@ func (Alignment) TableName() string {
 	return "alignments"
 }
 
+// Font - cell font style definition
+type Font struct {
+	ID                   int
+	Name                 string
+	Size                 float64
+	Bold, Italic, Strike bool
+	Underline            string // single, double, singleAccounting, doubleAccounting or empty
+	Color                string // ARGB value (the theme colors resolved), eg, FFFF0000
+}
+
+// TableName overrides default table name for the model
+func (Font) TableName() string {
+	return "fonts"
+}
+
+// Fill - cell fill style definition
+type Fill struct {
+	ID               int
+	Pattern          string // none, solid, gray125, etc.
+	FgColor, BgColor string // ARGB value (the theme colors resolved)
+}
+
+// TableName overrides default table name for the model
+func (Fill) TableName() string {
+	return "fills"
+}
+
 // Rubric ...
 type Rubric struct {
 	ID         int
@@ -1759,6 +1850,7 @@ type Rubric struct {
 	Item5      sql.NullFloat64
 	Range      string `gorm:"column:block_cell_range"`
 	NumCell    int
+	Category   BlockCategory `gorm:"type:varchar(20)"` // the category of the model answer block
 	Block      *Block
 	BlockID    int `gorm:"column:ExcelBlockID;index;not null"`
 	Question   *Question
@@ -1785,6 +1877,8 @@ func SetDb() {
 	}
 	Db.AutoMigrate(&Border{})
 	Db.AutoMigrate(&Alignment{})
+	Db.AutoMigrate(&Font{})
+	Db.AutoMigrate(&Fill{})
 	Db.AutoMigrate(&User{})
 	Db.AutoMigrate(&QuestionExcelData{})
 	Db.AutoMigrate(&Answer{})
@@ -1795,8 +1889,18 @@ func SetDb() {
 	Db.AutoMigrate(&DateGroupItem{})
 	Db.AutoMigrate(&Sorting{})
 	Db.AutoMigrate(&PivotTable{})
+	Db.AutoMigrate(&PivotOptions{})
 	Db.AutoMigrate(&ConditionalFormatting{})
+	Db.AutoMigrate(&DataValidation{})
+	Db.AutoMigrate(&Table{})
+	Db.AutoMigrate(&TableColumn{})
+	Db.AutoMigrate(&Scenario{})
+	Db.AutoMigrate(&ScenarioInputCell{})
+	Db.AutoMigrate(&DataTable{})
+	Db.AutoMigrate(&GoalSeek{})
+	Db.AutoMigrate(&SolverVerification{})
 	Db.AutoMigrate(&Chart{})
+	Db.AutoMigrate(&ChartSeries{})
 	Db.AutoMigrate(&Block{})
 	Db.AutoMigrate(&Cell{})
 	Db.AutoMigrate(&Comment{})
@@ -1814,6 +1918,9 @@ func SetDb() {
 	Db.AutoMigrate(&ProblemSheetData{})
 	Db.AutoMigrate(&QuestionFile{})
 	Db.AutoMigrate(&QuestionFileSheet{})
+	Db.AutoMigrate(&CellDependency{})
+	Db.AutoMigrate(&BlockDependency{})
+	Db.AutoMigrate(&PrecedentValue{})
 	if isMySQL {
 		// Add some foreing key constraints to MySQL DB:
 		log.Debug("Adding a constraint to Wroksheets -> Answers...")
@@ -1822,6 +1929,8 @@ func SetDb() {
 		Db.Model(&Cell{}).AddForeignKey("block_id", "ExcelBlocks(ExcelBlockID)", "CASCADE", "CASCADE")
 		Db.Model(&Cell{}).AddForeignKey("alignment_id", "alignments(id)", "CASCADE", "CASCADE")
 		Db.Model(&Cell{}).AddForeignKey("border_id", "borders(id)", "CASCADE", "CASCADE")
+		Db.Model(&Cell{}).AddForeignKey("font_id", "fonts(id)", "CASCADE", "CASCADE")
+		Db.Model(&Cell{}).AddForeignKey("fill_id", "fills(id)", "CASCADE", "CASCADE")
 		log.Debug("Adding a constraint to Blocks...")
 		Db.Model(&Block{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
 		log.Debug("Adding a constraint to Worksheets -> Workbooks...")
@@ -1837,8 +1946,19 @@ func SetDb() {
 		Db.Model(&DataSource{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
 		Db.Model(&Filter{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
 		Db.Model(&Filter{}).AddForeignKey("DataSourceID", "DataSources(id)", "CASCADE", "CASCADE")
+		Db.Model(&DataValidation{}).AddForeignKey("DataSourceID", "DataSources(id)", "CASCADE", "CASCADE")
+		Db.Model(&Table{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
+		Db.Model(&TableColumn{}).AddForeignKey("table_id", "ExcelTables(id)", "CASCADE", "CASCADE")
+		Db.Model(&ChartSeries{}).AddForeignKey("chart_id", "charts(id)", "CASCADE", "CASCADE")
+		Db.Model(&Chart{}).AddForeignKey("pivot_source_id", "DataSources(id)", "SET NULL", "CASCADE")
+		Db.Model(&Scenario{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
+		Db.Model(&ScenarioInputCell{}).AddForeignKey("scenario_id", "Scenarios(id)", "CASCADE", "CASCADE")
+		Db.Model(&DataTable{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
+		Db.Model(&GoalSeek{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
+		Db.Model(&SolverVerification{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
 		Db.Model(&DateGroupItem{}).AddForeignKey("filter_id", "Filters(id)", "CASCADE", "CASCADE")
 		Db.Model(&PivotTable{}).AddForeignKey("DataSourceID", "DataSources(id)", "CASCADE", "CASCADE")
+		Db.Model(&PivotOptions{}).AddForeignKey("DataSourceID", "DataSources(id)", "CASCADE", "CASCADE")
 
 		Db.Model(&XLQTransformation{}).AddForeignKey("UserID", "Users(UserID)", "CASCADE", "CASCADE")
 		Db.Model(&XLQTransformation{}).AddForeignKey("QuestionID", "Questions(QuestionID)", "CASCADE", "CASCADE")
@@ -1851,6 +1971,11 @@ func SetDb() {
 		Db.Model(&Rubric{}).AddForeignKey("QuestionID", "Questions(QuestionID)", "CASCADE", "CASCADE")
 		Db.Model(&DefinedName{}).AddForeignKey("worksheet_id", "WorkSheets(id)", "CASCADE", "CASCADE")
 		Db.Model(&DefinedName{}).AddForeignKey("cell_id", "Cells(id)", "CASCADE", "CASCADE")
+		Db.Model(&CellDependency{}).AddForeignKey("workbook_id", "WorkBooks(id)", "CASCADE", "CASCADE")
+		Db.Model(&BlockDependency{}).AddForeignKey("workbook_id", "WorkBooks(id)", "CASCADE", "CASCADE")
+		Db.Model(&PrecedentValue{}).AddForeignKey("workbook_id", "WorkBooks(id)", "CASCADE", "CASCADE")
+		Db.Model(&BlockDependency{}).AddForeignKey("block_id", "ExcelBlocks(ExcelBlockID)", "CASCADE", "CASCADE")
+		Db.Model(&BlockDependency{}).AddForeignKey("precedent_block_id", "ExcelBlocks(ExcelBlockID)", "CASCADE", "CASCADE")
 		Db.Model(&Problem{}).AddForeignKey("FileID", "FileSources(FileID)", "CASCADE", "CASCADE")
 		Db.Model(&ProblemSheet{}).AddForeignKey("Problem_ID", "Problems(ID)", "CASCADE", "CASCADE")
 		Db.Model(&ProblemSheetData{}).AddForeignKey("Problem_ID", "Problems(ID)", "CASCADE", "CASCADE")
@@ -2053,6 +2178,7 @@ func (ws *Worksheet) FindBlocksInside(sheet *xlsx.Sheet, rb Block, importFormatt
 					LCol:            c,
 					Formula:         formula,
 					RelativeFormula: RelativeFormula(r, c, formula),
+					Category:        rb.Category,
 					questionID:      ws.questionID,
 				}
 				if !DryRun {
@@ -2063,7 +2189,7 @@ func (ws *Worksheet) FindBlocksInside(sheet *xlsx.Sheet, rb Block, importFormatt
 					log.Debugf("Created %#v", b)
 				}
 
-				b.findWholeWithin(sheet, rb, importFormatting)
+				b.findWholeWithin(sheet, ws.formulas, rb, importFormatting)
 				b.Range = b.Address()
 				Db.Save(b)
 				blocks = append(blocks, b)
@@ -2098,7 +2224,7 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 		return
 	}
 
-	file, err := xlsx.OpenFile(fileName)
+	file, _, formulas, err := openWorkbook(fileName)
 	if err != nil {
 		log.WithError(err).Errorf("failed to open the file %q (AnswerID: %d), file might be corrupt.",
 			fileName, answerID)
@@ -2154,6 +2280,7 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 	if verbose {
 		log.Infof("*** Processing the answer ID: %d for the question %s", answerID, q)
 	}
+	palette := q.palette(color)
 
 	var sa StudentAssignment
 	if err = Db.Model(&answer).Related(&sa, "StudentAssignmentID").Error; err != nil {
@@ -2168,6 +2295,13 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 	allSheets := file.Sheets
 	sheetIDs := make([]int, len(allSheets))
 	wbReferences := make(map[string]blockList)
+	// the worksheets without color-coded blocks for the discovery (see DiscoverBlocks)
+	type sheetEntry struct {
+		ws    *Worksheet
+		sheet *xlsx.Sheet
+	}
+	var blockless []sheetEntry
+	hasColorBlocks := false
 	for orderNum, sheet := range allSheets {
 
 		if (skipHidden && sheet.Hidden) || sheet.Name == gradingAssistanceSheetName {
@@ -2206,6 +2340,7 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 			}
 		}
 		ws.questionID = q.ID // track internally the question
+		ws.formulas = formulas
 		wbReferences[sheet.Name] = references
 		sheetIDs[orderNum] = ws.ID
 
@@ -2256,11 +2391,12 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 					}
 				MATCH:
 
-					if fgColor == color {
+					if category, ok := palette.Category(fgColor); ok && !DiscoverBlocks {
 
 						b := Block{
 							WorksheetID:     ws.ID,
-							Color:           color,
+							Color:           fgColor,
+							Category:        category,
 							Formula:         cell.Formula(),
 							RelativeFormula: RelativeFormula(i, j, cell.Formula()),
 							TRow:            i,
@@ -2275,7 +2411,7 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 							log.Debugf("Created %#v", b)
 						}
 
-						b.findWhole(sheet, color)
+						b.findWhole(sheet, formulas, fgColor)
 						b.save()
 						blocks = append(blocks, b)
 						if verbose && b.Range != "" {
@@ -2285,14 +2421,30 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 					}
 				}
 			}
-			if len(blocks) == 0 {
-				log.Warningf("No block found ot the worksheet %q of the workbook %q with color %q", sheet.Name, fileName, color)
-				if len(sheetFillColors) > 0 {
-					log.Infof("Following colors were found in the worksheet you could use: %v", sheetFillColors)
+			if len(blocks) > 0 {
+				hasColorBlocks = true
+			} else {
+				if !DiscoverBlocks {
+					log.Warningf("No block found ot the worksheet %q of the workbook %q with colors %q", sheet.Name, fileName, palette)
+					if len(sheetFillColors) > 0 {
+						log.Infof("Following colors were found in the worksheet you could use: %v", sheetFillColors)
+					}
 				}
+				blockless = append(blockless, sheetEntry{&ws, sheet})
+			}
+		}
+	}
+	// Fall back to the discovery ignoring the filling colors if no color-coded block
+	// was found in the whole workbook
+	if DiscoverBlocks || !hasColorBlocks {
+		for _, e := range blockless {
+			if blocks := e.ws.discoverBlocks(e.sheet, formulas, verbose); len(blocks) > 0 {
+				log.Infof("Discovered %d block(s) in the worksheet %q of the workbook %q", len(blocks), e.sheet.Name, fileName)
+				wbReferences[e.sheet.Name] = blocks
 			}
 		}
 	}
+	wb.ExtractDependencies(file, formulas, sheetIDs)
 	wb.ImportWorksheets(fileName)
 
 	// Add missing blocks and cells from the model:
@@ -2304,8 +2456,8 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 			log.Debugf("Inserting missing or partially answered blocks (AnswerID: %d, Model AnswerID: %d).", answerID, ma.ID)
 
 			if _, err := Db.DB().Exec(`
-					INSERT INTO ExcelBlocks(BlockCellRange, worksheet_id)
-					SELECT mb.BlockCellRange, s.ID
+					INSERT INTO ExcelBlocks(BlockCellRange, worksheet_id, category)
+					SELECT mb.BlockCellRange, s.ID, mb.category
 					FROM WorkSheets AS ms JOIN ExcelBlocks AS mb ON  mb.worksheet_id = ms.ID
 					JOIN WorkSheets s ON ms.idx = s.idx
 					LEFT JOIN ExcelBlocks AS b ON b.worksheet_id = s.ID
@@ -2474,7 +2626,7 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 				} else {
 					xfs := ss.CellXfs.Xf
 					borders := ss.Borders.Border
-					numFmts := ss.NumFmts.NumFmt
+					styles := newCellStyles(file, &ss)
 					for orderNum, sheet := range allSheets {
 
 						if skipHidden && sheet.Hidden {
@@ -2508,7 +2660,7 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 							var id int
 							for rows.Next() {
 								rows.Scan(&r, &id)
-								if cellIDRe.MatchString(r) {
+								if refKind(r) == 'c' {
 									cells[r] = id
 								}
 							}
@@ -2519,7 +2671,7 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 							for i, row := range sheet.Rows {
 								for j, c := range row.Cells {
 									if references == nil {
-										if c.GetStyle().Fill.FgColor != color {
+										if _, ok := palette.Category(c.GetStyle().Fill.FgColor); !ok {
 											continue // skip the cell
 										}
 									} else if !references.includes(i, j) {
@@ -2561,6 +2713,8 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 										xf := xfs[s]
 										cell.Fill = (xf.FillId != "0" || (xf.ApplyFill != "0" && xf.ApplyFill != "false"))
 										cell.Font = (xf.ApplyFont == "1" || xf.ApplyFont == "true")
+										cell.FontID = styles.font(xf.FontId)
+										cell.FillID = styles.fill(xf.FillId)
 
 										// Alignments:
 										if xf.ApplyAlignment == "1" || xf.ApplyAlignment == "true" {
@@ -2597,15 +2751,8 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 
 										// Cell format:
 										if (xf.ApplyNumberFormat != "0" && xf.ApplyNumberFormat != "false") || xf.NumFmtId != "0" {
-											if id, _ := strconv.Atoi(xf.NumFmtId); id > 0 && (len(numFmts) >= 1) {
-												for i := 0; i < len(numFmts); i++ {
-													if xf.NumFmtId == numFmts[i].NumFmtId {
-														cell.CellFormat = numFmts[i].FormatCode
-														goto FOUND
-													}
-												}
-												cell.CellFormat = "ID: " + xf.NumFmtId
-											FOUND:
+											if id, _ := strconv.Atoi(xf.NumFmtId); id > 0 {
+												cell.CellFormat = numberFormatCode(&ss, xf.NumFmtId)
 											}
 										}
 
@@ -2635,9 +2782,9 @@ func ExtractBlocksFromFile(fileName, color string, force, verbose, skipHidden bo
 	// Rubrics
 	{
 		if err := Db.Exec(`
-INSERT INTO Rubrics(QuestionID, ExcelBlockID, block_cell_range, num_cell)
+INSERT INTO Rubrics(QuestionID, ExcelBlockID, block_cell_range, num_cell, category)
 SELECT
-    q.QuestionID, b.ExcelBlockID, b.BlockCellRange, (b.b_row-b.t_row+1)*(b.r_col-b.l_col+1) AS num_cell
+    q.QuestionID, b.ExcelBlockID, b.BlockCellRange, (b.b_row-b.t_row+1)*(b.r_col-b.l_col+1) AS num_cell, b.category
 FROM "Users" AS u
 	JOIN StudentAssignments AS sa ON sa.UserID = u.UserID
 	JOIN StudentAnswers AS a ON a.StudentAssignmentID = sa.StudentAssignmentID
@@ -2687,7 +2834,7 @@ WHERE is_rubric_created = 0 AND QuestionID IN (SELECT QuestionID FROM Rubrics)
 				}
 				var modifiedValue = strings.Replace(value, "$", "", -1)
 
-				if cellIDRe.MatchString(modifiedValue) {
+				if refKind(modifiedValue) == 'c' {
 					col, row, err := xlsx.GetCoordsFromCellIDString(modifiedValue)
 					if err != nil {
 						log.WithError(err).Error("Failed to map address ", modifiedValue)
@@ -2783,6 +2930,7 @@ WHERE is_rubric_created = 0 AND QuestionID IN (SELECT QuestionID FROM Rubrics)
 				}
 			}
 		}
+		wb.verifySolverModels(file, sheetIDs)
 	}
 
 	return
@@ -2797,6 +2945,12 @@ type Chart struct {
 	FromCol, FromRow, ToCol, ToRow, ItemCount  int
 	Data, XData, YData, Type                   string
 	XMinValue, XMaxValue, YMaxValue, YMinValue string
+	PivotName                                  string        // the source pivot table of the pivot chart, eg, [Book1.xlsx]Sheet2!PivotTable1
+	PivotSourceID                              sql.NullInt64 `gorm:"type:int"` // the data source of the pivot table
+	LegendPosition                             string        // "" - no legend
+	DataLabels                                 string        // the content of the chart data labels, eg, value,percent
+	SeriesCount                                int
+	Series                                     []ChartSeries `gorm:"foreignkey:ChartID"`
 }
 
 // DataSource - autofilter
@@ -2805,6 +2959,13 @@ type DataSource struct {
 	WorksheetID int
 	Worksheet   Workbook
 	Range       string `gorm:"column:Sourcerange;type:varchar(255)"`
+	Name        string // the name of the source object, eg, the pivot table
+	// the data rows of the filtered range left visible, eg, 2:5,8, and the verification of the filter
+	VisibleRows        sql.NullString `gorm:"column:VisibleRows;type:text"`
+	IsFilterConsistent sql.NullBool   `gorm:"column:IsFilterConsistent"`              // the criteria keep the visible rows
+	FilterMismatch     string         `gorm:"column:FilterMismatch;type:varchar(50)"` // stale filter, hidden by hand or wrong column
+	IsFilterInferred   bool           `gorm:"column:IsFilterInferred"`                // the rows hidden without the autofilter
+	IsFilterCorrect    bool           `gorm:"column:IsFilterCorrect"`                 // the model answer leaves the same rows visible
 }
 
 // TableName overrides default table name for the model
@@ -2864,6 +3025,17 @@ type Sorting struct {
 	CustomList   string `gorm:"column:customList;type:varchar(255)"`
 	IconSet      string `gorm:"column:iconSet;type:varchar(255)"`
 	IconID       string `gorm:"column:iconId;type:varchar(255)"`
+	Level        int    `gorm:"column:sortLevel"` // the precedence of the sort level (condition), 1 - the first level
+	// the sort state options shared by all the levels
+	CaseSensitive bool
+	CharacterSort string `gorm:"column:characterSort;type:varchar(10)"` // the sort method of the characters: pinYin or stroke
+	// the cell or font color sorted on top (ascending) or on bottom (descending)
+	DxfID sql.NullInt64 `gorm:"column:dxfId;type:int"`
+	Color string        `gorm:"column:sortColor;type:varchar(20)"`
+	// the data are in the order of the levels up to this one, NULL if it cannot be verified, eg, sorting by icons
+	IsOrdered sql.NullBool `gorm:"column:isOrdered"`
+	// the sort state was missing, the levels of the model answer were verified on the data
+	IsInferred bool `gorm:"column:isInferred"`
 }
 
 // TableName overrides default table name for the model
@@ -2873,12 +3045,19 @@ func (Sorting) TableName() string {
 
 // PivotTable - pivot table
 type PivotTable struct {
-	ID           int
-	DataSourceID int    `gorm:"column:DataSourceId"`
-	Type         string `gorm:"column:Type;type:varchar(50)"`
-	Label        string `gorm:"column:Label;type:varchar(255)"`
-	DisplayName  string `gorm:"column:DisplayName;type:varchar(255)"`
-	Function     string `gorm:"column:Function;type:varchar(255)"`
+	ID            int
+	DataSourceID  int    `gorm:"column:DataSourceId"`
+	Type          string `gorm:"column:Type;type:varchar(50)"`
+	Label         string `gorm:"column:Label;type:varchar(255)"`
+	DisplayName   string `gorm:"column:DisplayName;type:varchar(255)"`
+	Function      string `gorm:"column:Function;type:varchar(255)"`
+	SelectedItems string `gorm:"column:SelectedItems;size:2000"`     // the selected items of the page field (report filter)
+	HiddenItems   string `gorm:"column:HiddenItems;size:2000"`       // the items excluded from the row or the column field
+	Filter        string `gorm:"column:Filter;type:varchar(255)"`    // the label or the value filter, eg, captionBeginsWith,B
+	ShowDataAs    string `gorm:"column:ShowDataAs;type:varchar(50)"` // "show values as", eg, percentOfTotal
+	BaseField     string `gorm:"column:BaseField;type:varchar(255)"` // the base field of "show values as"
+	BaseItem      string `gorm:"column:BaseItem;type:varchar(255)"`  // the base item of "show values as"
+	Formula       string `gorm:"column:Formula;size:2000"`           // the formula of the calculated field or item
 }
 
 // TableName overrides default table name for the model
@@ -2888,13 +3067,30 @@ func (PivotTable) TableName() string {
 
 // ConditionalFormatting - conditional formatting entries
 type ConditionalFormatting struct {
-	ID           int
-	DataSourceID int    `gorm:"column:DataSourceId"`
-	Type         string `gorm:"column:Type;type:varchar(50)"`
-	Operator     string `gorm:"column:Operator;type:varchar(50)"`
-	Formula1     string `gorm:"column:Formula1;type:varchar(255)"`
-	Formula2     string `gorm:"column:Formula2;type:varchar(255)"`
-	Formula3     string `gorm:"column:Formula3;type:varchar(255)"`
+	ID            int
+	DataSourceID  int    `gorm:"column:DataSourceId"`
+	Type          string `gorm:"column:Type;type:varchar(50)"`
+	Operator      string `gorm:"column:Operator;type:varchar(50)"`
+	Formula1      string `gorm:"column:Formula1;type:varchar(255)"`
+	Formula2      string `gorm:"column:Formula2;type:varchar(255)"`
+	Formula3      string `gorm:"column:Formula3;type:varchar(255)"`
+	Priority      int    `gorm:"column:Priority"`
+	StopIfTrue    bool   `gorm:"column:StopIfTrue"`
+	FillColor     string `gorm:"column:FillColor;type:varchar(20)"` // the applied format (dxf) fill color
+	FontColor     string `gorm:"column:FontColor;type:varchar(20)"`
+	FontBold      bool   `gorm:"column:FontBold"`
+	FontItalic    bool   `gorm:"column:FontItalic"`
+	FontUnderline bool   `gorm:"column:FontUnderline"`
+	FontStrike    bool   `gorm:"column:FontStrike"`
+	BorderColor   string `gorm:"column:BorderColor;type:varchar(20)"`
+	BorderStyle   string `gorm:"column:BorderStyle;type:varchar(20)"`
+	NumberFormat  string `gorm:"column:NumberFormat;type:varchar(255)"`
+	Thresholds    string `gorm:"column:Thresholds;type:varchar(255)"` // color scale, data bar or icon set cfvo, eg, min,percentile:50,max
+	Colors        string `gorm:"column:Colors;type:varchar(255)"`     // color scale or data bar colors, eg, FFF8696B,FFFFEB84,FF63BE7B
+	// the comma separated list of the cells the rule applies to (evaluated with the cached cell values),
+	// NULL if the rule cannot be evaluated, eg, it depends on the current date
+	Highlighted sql.NullString `gorm:"column:Highlighted;type:text"`
+	IsCorrect   bool           `gorm:"column:IsCorrect"` // highlights the same cells as a rule of the model answer
 }
 
 // TableName overrides default table name for the model
@@ -2902,6 +3098,31 @@ func (ConditionalFormatting) TableName() string {
 	return "ConditionalFormattings"
 }
 
+// DataValidation - data validation rules
+type DataValidation struct {
+	ID               int
+	DataSourceID     int `gorm:"column:DataSourceID"`
+	DataSource       *DataSource
+	Type             string `gorm:"column:Type;type:varchar(50)"`     // none, whole, decimal, list, date, time, textLength or custom
+	Operator         string `gorm:"column:Operator;type:varchar(50)"` // between, notBetween, equal, greaterThan...
+	Formula1         string `gorm:"column:Formula1;type:varchar(255)"`
+	Formula2         string `gorm:"column:Formula2;type:varchar(255)"`
+	AllowBlank       bool
+	ShowDropDown     bool // NB! "1" means the in-cell drop-down list is hidden
+	ShowInputMessage bool
+	ShowErrorMessage bool
+	ErrorStyle       string `gorm:"type:varchar(20)"` // stop (default), warning or information
+	ErrorTitle       string
+	Error            string `gorm:"size:1000"`
+	PromptTitle      string
+	Prompt           string `gorm:"size:1000"`
+}
+
+// TableName overrides default table name for the model
+func (DataValidation) TableName() string {
+	return "DataValidations"
+}
+
 // XLQTransformation - XLQ Transformations
 type XLQTransformation struct {
 	ID             int
@@ -2979,6 +3200,10 @@ func AutoCommentAnswerCells(isPlagiarisedCommentID, modelAnswerUserID int) {
 			IsPlagiarised                                 bool
 			HasAutoEvaluation                             bool
 			IsFormulaCorrect, IsValueCorrect, IsHardcoded bool
+			IsCarriedForwardCorrect                       bool
+			IsCircular, IsIterative                       bool
+			HardcodedValues, FormattingResult             string
+			Category                                      BlockCategory
 			IsCorrectCellBlocks                           bool
 			HasRubric                                     bool
 			Marks                                         float64
@@ -2996,15 +3221,26 @@ SELECT
     ae.IsFormulaCorrect AS is_formula_correct,
     ae.IsValueCorrect AS is_value_correct,
     ae.is_hardcoded,
+    COALESCE(ae.is_carried_forward_correct, 0) AS is_carried_forward_correct,
+    COALESCE(ae.hardcoded_values, '') AS hardcoded_values,
+    COALESCE(ae.formatting_result, '') AS formatting_result,
+    COALESCE(c.is_circular, 0) AS is_circular,
+    COALESCE(wb.is_iterative, 0) AS is_iterative,
 	(CASE WHEN b.BlockCellRange = ma.BlockCellRange THEN 1 ELSE 0 END) AS is_correct_cell_blocks,
 	(r.id IS NOT NULL) AS has_rubric,
+	COALESCE(ma.category, '') AS category,
 	CASE
+		-- only the cell blocks are graded for the formatting blocks
+		WHEN ma.category = 'formatting' THEN (r.item3 * (CASE WHEN b.BlockCellRange = ma.BlockCellRange THEN 1 ELSE 0 END))/r.num_cell
+		-- the formulas aren't expected in the input blocks
+		WHEN ma.category = 'input' THEN (r.item3 * (CASE WHEN b.BlockCellRange = ma.BlockCellRange THEN 1 ELSE 0 END) +r.item5 * ae.IsValueCorrect)/r.num_cell
 		WHEN c.Formula = '' OR c.Formula IS NULL THEN 0.0
-		ELSE (r.item2 * (CASE WHEN ae.is_hardcoded = 1 THEN -0.5 ELSE 0 END) +r.item3 * (CASE WHEN b.BlockCellRange = ma.BlockCellRange THEN 1 ELSE 0 END) +r.item4 * ae.IsFormulaCorrect+r.item5 * ae.IsValueCorrect)/r.num_cell
+		ELSE (r.item2 * (CASE WHEN ae.is_hardcoded = 1 THEN -0.5 ELSE 0 END) +r.item3 * (CASE WHEN b.BlockCellRange = ma.BlockCellRange THEN 1 ELSE 0 END) +r.item4 * ae.IsFormulaCorrect+r.item5 * (CASE WHEN ae.IsValueCorrect = 1 THEN 1 WHEN ae.is_carried_forward_correct = 1 THEN ? ELSE 0 END))/r.num_cell
 	END AS marks
 FROM StudentAssignments AS sa
     JOIN StudentAnswers AS a ON a.StudentAssignmentID = sa.StudentAssignmentID
     JOIN WorkSheets AS ws ON ws.StudentAnswerID = a.StudentAnswerID
+    LEFT JOIN WorkBooks AS wb ON wb.id = ws.workbook_id
     JOIN ExcelBlocks AS b ON b.worksheet_id = ws.id
     JOIN Cells AS c ON c.block_id = b.ExcelBlockID
 	LEFT JOIN Rubrics AS r ON r.QuestionID = a.QuestionID AND r.block_cell_range = b.BlockCellRange
@@ -3016,6 +3252,7 @@ FROM StudentAssignments AS sa
 			c.cell_range,
 			c.Formula,
 			b.BlockCellRange,
+			b.category,
 			a.QuestionID,
 			ws.idx
 		FROM StudentAssignments AS sa
@@ -3029,7 +3266,7 @@ FROM StudentAssignments AS sa
 		AND a.QuestionID = ?
 		AND a.was_autocommented = 0
 		AND a.StudentAnswerID = ?
-`, modelAnswerUserID, a.QuestionID, modelAnswerUserID, a.QuestionID, a.ID).Rows()
+`, CarriedForwardWeight, modelAnswerUserID, a.QuestionID, modelAnswerUserID, a.QuestionID, a.ID).Rows()
 		if err != nil {
 			log.WithError(err).Errorln("Failed to retrieve auto-evaluation data")
 			continue
@@ -3059,7 +3296,7 @@ FROM StudentAssignments AS sa
 				}
 			} else {
 				var comments string
-				if r.Formula == "" {
+				if r.Formula == "" && r.Category != InputBlock && r.Category != FormattingBlock {
 					comments = "You have entered a value where a formula is expected; "
 				}
 				if r.IsCorrectCellBlocks {
@@ -3067,15 +3304,31 @@ FROM StudentAssignments AS sa
 				} else {
 					comments += "You have made in-correct cell blocks"
 				}
-				if r.HasAutoEvaluation {
-					if !r.IsFormulaCorrect {
+				if r.HasAutoEvaluation && r.Category != FormattingBlock {
+					if !r.IsFormulaCorrect && r.Category != InputBlock {
 						comments += "; Your cell formula is wrong"
 					}
 					if !r.IsValueCorrect {
-						comments += "; Your cell value is wrong"
+						if r.IsCarriedForwardCorrect {
+							comments += "; Your cell value is wrong only due to the errors in the precedent cells"
+						} else {
+							comments += "; Your cell value is wrong"
+						}
 					}
 					if r.IsHardcoded {
 						comments += "; You have hard coded some parts of the formula"
+						if r.HardcodedValues != "" {
+							comments += " (" + r.HardcodedValues + ")"
+						}
+					}
+				}
+				if r.HasAutoEvaluation && r.FormattingResult != "" {
+					comments += "; Your cell formatting is wrong: " + r.FormattingResult
+				}
+				if r.IsCircular {
+					comments += "; Your cell is a part of a circular reference, its value might be stale"
+					if r.IsIterative {
+						comments += " (the iterative calculation turned on hides the problem)"
 					}
 				}
 				if comments == "" {
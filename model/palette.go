@@ -0,0 +1,295 @@
+package model
+
+import (
+	"encoding/xml"
+	x "extract-blocks/model/xlsx"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/excelize"
+	"github.com/nad2000/xlsx"
+)
+
+// BlockCategory - the category of the block defined by the block filling color
+type BlockCategory string
+
+// Block categories
+const (
+	CalculationBlock BlockCategory = "calculation" // the blocks of formulas (the default)
+	InputBlock       BlockCategory = "input"       // the blocks of the input values
+	FormattingBlock  BlockCategory = "formatting"  // the blocks graded only for the formatting
+)
+
+var blockCategories = []BlockCategory{CalculationBlock, InputBlock, FormattingBlock}
+
+// ColorTolerance - the maximum Euclidean distance between the colors in the RGB space
+// (0..441.7) for the colors to be considered the same, eg, the tints of yellow (0 - exact match)
+var ColorTolerance float64
+
+// Palette - the block filling colors (ARGB, eg, "FFFFFF00") mapped to the block categories
+type Palette map[string]BlockCategory
+
+// ParsePalette parses the comma separated list of the colors with the categories,
+// eg, "FFFFFF00=calculation,FF00FF00=input,FF0000FF=formatting". A color without
+// the category, eg, "FFFFFF00", stands for the calculation blocks.
+func ParsePalette(s string) (Palette, error) {
+	p := make(Palette)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		color, category := entry, CalculationBlock
+		if i := strings.Index(entry, "="); i >= 0 {
+			color = strings.TrimSpace(entry[:i])
+			category = BlockCategory(strings.ToLower(strings.TrimSpace(entry[i+1:])))
+			if !category.IsValid() {
+				return nil, fmt.Errorf("unknown block category %q of the color %q", category, color)
+			}
+		}
+		if color == "" {
+			return nil, fmt.Errorf("missing color in the palette entry %q", entry)
+		}
+		p[strings.ToUpper(color)] = category
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("empty palette %q", s)
+	}
+	return p, nil
+}
+
+// IsValid tests if the category is one of the known block categories.
+func (c BlockCategory) IsValid() bool {
+	for _, bc := range blockCategories {
+		if c == bc {
+			return true
+		}
+	}
+	return false
+}
+
+// Category returns the category of the blocks filled with the color.
+func (p Palette) Category(color string) (category BlockCategory, ok bool) {
+	_, category, ok = p.Match(color)
+	return
+}
+
+// Match finds the palette color matching the color, ie, the same color or
+// the nearest one within the color distance tolerance (see ColorTolerance).
+func (p Palette) Match(color string) (paletteColor string, category BlockCategory, ok bool) {
+	if color == "" {
+		return
+	}
+	color = strings.ToUpper(color)
+	if category, ok = p[color]; ok {
+		paletteColor = color
+		return
+	}
+	if ColorTolerance <= 0 {
+		return
+	}
+	minDistance := ColorTolerance
+	for _, c := range p.Colors() {
+		if d, valid := colorDistance(color, c); valid && d <= minDistance {
+			paletteColor, category, ok, minDistance = c, p[c], true, d
+		}
+	}
+	return
+}
+
+// rgb returns the red, green and blue components of the ARGB (or RGB) color.
+func rgb(color string) (r, g, b float64, ok bool) {
+	if len(color) == 8 {
+		color = color[2:]
+	}
+	if len(color) != 6 {
+		return
+	}
+	v, err := strconv.ParseUint(color, 16, 32)
+	if err != nil {
+		return
+	}
+	return float64(v >> 16 & 0xFF), float64(v >> 8 & 0xFF), float64(v & 0xFF), true
+}
+
+// colorDistance returns the Euclidean distance between the colors in the RGB space (0..441.7).
+func colorDistance(color, other string) (float64, bool) {
+	r1, g1, b1, ok := rgb(color)
+	if !ok {
+		return 0, false
+	}
+	r2, g2, b2, ok := rgb(other)
+	if !ok {
+		return 0, false
+	}
+	return math.Sqrt((r1-r2)*(r1-r2) + (g1-g2)*(g1-g2) + (b1-b2)*(b1-b2)), true
+}
+
+// tintRoundingDistance - the maximum distance between the colors differing by the rounding
+// of the tinted colors (by 1 per component), the colors are considered the same
+var tintRoundingDistance = math.Sqrt(3)
+
+// SameColor tests if the colors are the same within the color distance tolerance (see ColorTolerance)
+// or the rounding differences of the tinted colors.
+func SameColor(color, other string) bool {
+	if strings.EqualFold(color, other) {
+		return true
+	}
+	d, ok := colorDistance(color, other)
+	return ok && d <= math.Max(ColorTolerance, tintRoundingDistance)
+}
+
+// Colors returns the sorted palette colors.
+func (p Palette) Colors() []string {
+	colors := make([]string, 0, len(p))
+	for color := range p {
+		colors = append(colors, color)
+	}
+	sort.Strings(colors)
+	return colors
+}
+
+func (p Palette) String() string {
+	entries := make([]string, 0, len(p))
+	for _, color := range p.Colors() {
+		entries = append(entries, color+"="+string(p[color]))
+	}
+	return strings.Join(entries, ",")
+}
+
+// palette returns the question block color palette if it's set or
+// the palette given with the color (or the palette definition).
+func (q *Question) palette(color string) Palette {
+	if q.Palette != "" {
+		p, err := ParsePalette(q.Palette)
+		if err == nil {
+			return p
+		}
+		log.WithError(err).Errorf("invalid palette of the question (ID: %d)", q.ID)
+	}
+	return colorPalette(color)
+}
+
+// colorPalette returns the palette given with the color or the palette definition
+// (see ParsePalette). If the definition is invalid, the color stands for the calculation blocks.
+func colorPalette(color string) Palette {
+	p, err := ParsePalette(color)
+	if err != nil {
+		log.WithError(err).Errorf("invalid palette %q", color)
+		return Palette{strings.ToUpper(color): CalculationBlock}
+	}
+	return p
+}
+
+// defaultIndexedColors - the default (legacy) indexed color palette
+var defaultIndexedColors = []string{
+	"FF000000", "FFFFFFFF", "FFFF0000", "FF00FF00", "FF0000FF", "FFFFFF00", "FFFF00FF", "FF00FFFF",
+	"FF000000", "FFFFFFFF", "FFFF0000", "FF00FF00", "FF0000FF", "FFFFFF00", "FFFF00FF", "FF00FFFF",
+	"FF800000", "FF008000", "FF000080", "FF808000", "FF800080", "FF008080", "FFC0C0C0", "FF808080",
+	"FF9999FF", "FF993366", "FFFFFFCC", "FFCCFFFF", "FF660066", "FFFF8080", "FF0066CC", "FFCCCCFF",
+	"FF000080", "FFFF00FF", "FFFFFF00", "FF00FFFF", "FF800080", "FF800000", "FF008080", "FF0000FF",
+	"FF00CCFF", "FFCCFFFF", "FFCCFFCC", "FFFFFF99", "FF99CCFF", "FFFF99CC", "FFCC99FF", "FFFFCC99",
+	"FF3366FF", "FF33CCCC", "FF99CC00", "FFFFCC00", "FFFF9900", "FFFF6600", "FF666699", "FF969696",
+	"FF003366", "FF339966", "FF003300", "FF333300", "FF993300", "FF993366", "FF333399", "FF333333",
+}
+
+// indexedColor returns the indexed color either from the custom palette
+// of the style sheet or from the default one.
+func indexedColor(styleSheet *x.StyleSheet, index int) string {
+	if styleSheet != nil {
+		if colors := styleSheet.Colors.IndexedColors.RgbColor; index >= 0 && index < len(colors) {
+			return strings.ToUpper(colors[index].Rgb)
+		}
+	}
+	if index >= 0 && index < len(defaultIndexedColors) {
+		return defaultIndexedColors[index]
+	}
+	// 64 - the system foreground, 65 - the system background color
+	return ""
+}
+
+// applyTint lightens (tint > 0) or darkens (tint < 0) the ARGB (or RGB) color.
+func applyTint(color string, tint float64) string {
+	r, g, b, ok := rgb(color)
+	if tint == 0 || !ok {
+		return color
+	}
+	h, s, l := xlsx.RGBToHSL(uint8(r), uint8(g), uint8(b))
+	if tint < 0 {
+		l *= 1 + tint
+	} else {
+		l = l*(1-tint) + tint
+	}
+	r8, g8, b8 := xlsx.HSLToRGB(h, s, l)
+	return fmt.Sprintf("FF%02X%02X%02X", r8, g8, b8)
+}
+
+// cellColors resolves the fill and the font colors of the worksheet cells
+type cellColors struct {
+	styleSheet  *x.StyleSheet
+	styles      map[string]int // cell address -> style (cellXfs) index
+	themeColors []string       // the theme colors (RGB) by the indexes
+}
+
+// newCellColors creates the color resolver of the worksheet cells.
+func newCellColors(file *excelize.File, styleSheet *x.StyleSheet, sheet *x.Worksheet) cellColors {
+	cc := cellColors{styleSheet: styleSheet, styles: sheetCellStyles(sheet)}
+	if content, ok := file.XLSX[workbookPartName(file, "theme")]; ok {
+		var theme x.Theme
+		if err := xml.Unmarshal(content, &theme); err != nil {
+			log.WithError(err).Errorln("Failed to load the workbook theme")
+		} else {
+			cc.themeColors = theme.Colors()
+		}
+	}
+	return cc
+}
+
+// resolve returns the color value with the theme and the indexed colors and
+// the tint resolved into ARGB value, eg, FFB7DEE8.
+func (cc cellColors) resolve(c *x.Color) string {
+	if c == nil {
+		return ""
+	}
+	tint, _ := strconv.ParseFloat(c.Tint, 64)
+	switch {
+	case c.Rgb != "":
+		return applyTint(strings.ToUpper(c.Rgb), tint)
+	case c.Theme != "":
+		if i := atoi(c.Theme); i >= 0 && i < len(cc.themeColors) && cc.themeColors[i] != "" {
+			return applyTint("FF"+strings.ToUpper(cc.themeColors[i]), tint)
+		}
+	case c.Indexed != "":
+		if color := indexedColor(cc.styleSheet, atoi(c.Indexed)); color != "" {
+			return applyTint(color, tint)
+		}
+	}
+	return c.String()
+}
+
+// color returns the fill (sortBy: cellColor) or the font (sortBy: fontColor) color of the cell.
+func (cc cellColors) color(address, sortBy string) string {
+	if cc.styleSheet == nil {
+		return ""
+	}
+	xfs := cc.styleSheet.CellXfs.Xf
+	i := cc.styles[address]
+	if i < 0 || i >= len(xfs) {
+		return ""
+	}
+	switch sortBy {
+	case "cellColor":
+		if fills, id := cc.styleSheet.Fills.Fill, atoi(xfs[i].FillId); id >= 0 && id < len(fills) {
+			return cc.resolve(fills[id].PatternFill.FgColor)
+		}
+	case "fontColor":
+		if fonts, id := cc.styleSheet.Fonts.Font, atoi(xfs[i].FontId); id >= 0 && id < len(fonts) {
+			return cc.resolve(fonts[id].Color)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	x "extract-blocks/model/xlsx"
+	"testing"
+)
+
+func TestParsePalette(t *testing.T) {
+	p, err := ParsePalette("FFFFFF00=calculation, ff00ff00=Input,FF0000FF=formatting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for color, expected := range map[string]BlockCategory{
+		"FFFFFF00": CalculationBlock,
+		"FF00FF00": InputBlock,
+		"ff0000ff": FormattingBlock,
+	} {
+		if category, ok := p.Category(color); !ok || category != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, color, category)
+		}
+	}
+	if _, ok := p.Category("FFFF0000"); ok {
+		t.Error("Expected no category for the color not in the palette")
+	}
+	if s := p.String(); s != "FF0000FF=formatting,FF00FF00=input,FFFFFF00=calculation" {
+		t.Errorf("Unexpected palette %q", s)
+	}
+
+	// A single color stands for the calculation blocks:
+	if p, err := ParsePalette("FFFFFF00"); err != nil || p["FFFFFF00"] != CalculationBlock || len(p) != 1 {
+		t.Errorf("Unexpected palette %v (%v)", p, err)
+	}
+
+	for _, s := range []string{"", "FFFFFF00=unknown", "=input"} {
+		if _, err := ParsePalette(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestColorTolerance(t *testing.T) {
+	defer func(tolerance float64) { ColorTolerance = tolerance }(ColorTolerance)
+	p := Palette{"FFFFFF00": CalculationBlock, "FF00FF00": InputBlock}
+
+	ColorTolerance = 0
+	if _, ok := p.Category("FFFFFF66"); ok {
+		t.Error("Expected no match without the color tolerance")
+	}
+	ColorTolerance = 120
+	if c, category, ok := p.Match("FFFFFF66"); !ok || c != "FFFFFF00" || category != CalculationBlock {
+		t.Errorf("Expected the light yellow matching yellow, got %q, %q", c, category)
+	}
+	if !SameColor("FFFFFF00", "FFFFF000") || SameColor("FFFFFF00", "FF0000FF") || SameColor("FFFFFF00", "") {
+		t.Error("Unexpected color comparison result")
+	}
+	ColorTolerance = 0
+	if !SameColor("FFBFBF00", "FFC0BE01") || SameColor("FFBFBF00", "FFC1BF00") {
+		t.Error("Expected only the rounding differences of the tinted colors to be ignored")
+	}
+}
+
+func TestIndexedAndTintedColors(t *testing.T) {
+	var styleSheet x.StyleSheet
+	cc := cellColors{styleSheet: &styleSheet}
+	for _, tc := range []struct {
+		color    x.Color
+		expected string
+	}{
+		{x.Color{Rgb: "ffffff00"}, "FFFFFF00"},
+		{x.Color{Rgb: "FFFFFF00", Tint: "-0.25"}, "FFBFBF00"},
+		{x.Color{Indexed: "13"}, "FFFFFF00"},
+		{x.Color{Indexed: "13", Tint: "-0.25"}, "FFBFBF00"},
+		{x.Color{Indexed: "64"}, "indexed:64"},
+	} {
+		if color := cc.resolve(&tc.color); color != tc.expected {
+			t.Errorf("Expected %q for %#v, got %q", tc.expected, tc.color, color)
+		}
+	}
+
+	// The custom palette of the style sheet:
+	styleSheet.Colors.IndexedColors.RgbColor = make([]struct {
+		Text string `xml:",chardata"`
+		Rgb  string `xml:"rgb,attr"`
+	}, 14)
+	styleSheet.Colors.IndexedColors.RgbColor[13].Rgb = "FF00FF00"
+	if color := cc.resolve(&x.Color{Indexed: "13"}); color != "FF00FF00" {
+		t.Errorf("Expected the custom palette color FF00FF00, got %q", color)
+	}
+}
@@ -0,0 +1,346 @@
+package model
+
+import (
+	x "extract-blocks/model/xlsx"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/excelize"
+)
+
+// PivotOptions - the pivot table layout, totals and the cached source
+type PivotOptions struct {
+	ID             int
+	DataSourceID   int    `gorm:"column:DataSourceId;index"`
+	Location       string `gorm:"type:varchar(255)"` // the range of the pivot table, eg, A4:AH18
+	Layout         string `gorm:"type:varchar(10)"`  // compact, outline or tabular
+	RowGrandTotals bool
+	ColGrandTotals bool
+	SourceSheet    string
+	SourceRange    string `gorm:"type:varchar(255)"` // the cached source range, eg, A1:J8
+	SourceName     string // the defined name or the table used as the source
+	RecordCount    int    // the number of the cached source records
+}
+
+// TableName overrides default table name for the model
+func (PivotOptions) TableName() string {
+	return "PivotOptions"
+}
+
+// GrandTotals returns the grand totals shown in the pivot table, eg, rows,columns
+func (o PivotOptions) GrandTotals() string {
+	var totals []string
+	if o.RowGrandTotals {
+		totals = append(totals, "rows")
+	}
+	if o.ColGrandTotals {
+		totals = append(totals, "columns")
+	}
+	if len(totals) == 0 {
+		return "none"
+	}
+	return strings.Join(totals, ",")
+}
+
+// boolAttr parses the boolean attribute value falling back to the default value if the attribute is missing.
+func boolAttr(value string, defaultValue bool) bool {
+	if value == "" {
+		return defaultValue
+	}
+	return value == "1" || value == "true"
+}
+
+// pivotLayout returns the report layout of the pivot table: compact, outline or tabular.
+// The layout is set on the row fields, the pivot table attributes are used if there are none.
+func pivotLayout(ptd *x.PivotTableDefinition) string {
+	compact, outline := boolAttr(ptd.Compact, true), boolAttr(ptd.Outline, false)
+	for _, f := range ptd.RowFields.Field {
+		if i := atoi(f.X); i >= 0 && i < len(ptd.PivotFields.PivotField) {
+			pf := ptd.PivotFields.PivotField[i]
+			compact, outline = boolAttr(pf.Compact, true), boolAttr(pf.Outline, true)
+			break
+		}
+	}
+	switch {
+	case compact:
+		return "compact"
+	case outline:
+		return "outline"
+	}
+	return "tabular"
+}
+
+// showDataAsWithBase - "show values as" calculations that use the base field (and item)
+var showDataAsWithBase = map[string]bool{
+	"difference":  true,
+	"percent":     true,
+	"percentDiff": true,
+	"runTotal":    true,
+}
+
+// the special base items of "show values as" calculations
+const (
+	basePreviousItem = 1048828
+	baseNextItem     = 1048829
+)
+
+// pivotCache resolves the field and the item names of the pivot table through its cache definition
+type pivotCache struct {
+	pcd           *x.PivotCacheDefinition
+	ptd           *x.PivotTableDefinition
+	sharedStrings SharedStrings
+}
+
+// fieldName returns the name of the cache field
+func (pc pivotCache) fieldName(fld int) string {
+	if fld >= 0 && fld < len(pc.pcd.CacheFields.CacheField) {
+		return pc.pcd.CacheFields.CacheField[fld].Name
+	}
+	return pc.sharedStrings.Get(strconv.Itoa(fld))
+}
+
+// sharedItem returns the value of the shared item of the cache field
+func (pc pivotCache) sharedItem(fld, i int) string {
+	if fld < 0 || fld >= len(pc.pcd.CacheFields.CacheField) {
+		return ""
+	}
+	items := pc.pcd.CacheFields.CacheField[fld].SharedItems.Item
+	if i < 0 || i >= len(items) {
+		return ""
+	}
+	switch item := items[i]; item.XMLName.Local {
+	case "m":
+		return "(blank)"
+	case "d":
+		return strings.TrimSuffix(item.V, "T00:00:00")
+	default:
+		return item.V
+	}
+}
+
+// itemName returns the name of the item of the pivot field (i is the index within the pivot field items)
+func (pc pivotCache) itemName(fld, i int) string {
+	fields := pc.ptd.PivotFields.PivotField
+	if fld < 0 || fld >= len(fields) || i < 0 || i >= len(fields[fld].Items.Item) {
+		return ""
+	}
+	item := fields[fld].Items.Item[i]
+	if item.N != "" {
+		return item.N
+	}
+	return pc.sharedItem(fld, atoi(item.X))
+}
+
+// items returns the names of the hidden or the visible data items (the subtotals are skipped) of the pivot field
+func (pc pivotCache) items(fld int, hidden bool) (names []string) {
+	fields := pc.ptd.PivotFields.PivotField
+	if fld < 0 || fld >= len(fields) {
+		return
+	}
+	for i, item := range fields[fld].Items.Item {
+		if item.T != "" && item.T != "data" {
+			continue
+		}
+		if boolAttr(item.H, false) == hidden {
+			names = append(names, pc.itemName(fld, i))
+		}
+	}
+	return
+}
+
+// selectedItems returns the selected items of the page field (report filter)
+func (pc pivotCache) selectedItems(fld int, item string) string {
+	if item != "" {
+		return pc.itemName(fld, atoi(item))
+	}
+	if len(pc.items(fld, true)) > 0 {
+		return strings.Join(pc.items(fld, false), ",")
+	}
+	return "(All)"
+}
+
+// fieldFilter returns the label, the date or the value filter of the pivot field, eg, captionBeginsWith,B
+func (pc pivotCache) fieldFilter(fld int) string {
+	for _, f := range pc.ptd.Filters.Filter {
+		if atoi(f.Fld) != fld {
+			continue
+		}
+		var measure string
+		if f.IMeasureFld != "" {
+			if i := atoi(f.IMeasureFld); i >= 0 && i < len(pc.ptd.DataFields.DataField) {
+				measure = pc.ptd.DataFields.DataField[i].Name
+			}
+		}
+		return joinStr(",", f.Type, measure, f.StringValue1, f.StringValue2)
+	}
+	return ""
+}
+
+// baseItem returns the name of the base item of "show values as" calculation
+func (pc pivotCache) baseItem(fld int, item string) string {
+	switch i := atoi(item); i {
+	case basePreviousItem:
+		return "(previous)"
+	case baseNextItem:
+		return "(next)"
+	default:
+		return pc.itemName(fld, i)
+	}
+}
+
+// calculatedItemName returns the field and the name of the calculated item
+func (pc pivotCache) calculatedItemName(field string, refs []x.PivotAreaReference) (fld int, name string) {
+	fld = -1
+	if field != "" {
+		fld = atoi(field)
+	}
+	for _, r := range refs {
+		if fld < 0 {
+			fld = atoi(r.Field)
+		}
+		if atoi(r.Field) == fld && len(r.X) > 0 {
+			name = pc.sharedItem(fld, atoi(r.X[0].V))
+			break
+		}
+	}
+	return
+}
+
+// importPivotTable imports the pivot table (partName) together with its cache definition
+func (ws *Worksheet) importPivotTable(file *excelize.File, partName string, sharedStrings SharedStrings) {
+	var pcd x.PivotCacheDefinition
+	for _, r := range partRelationships(file, partName) {
+		if relationshipType(r) == "pivotCacheDefinition" {
+			pcd = UnmarshalPivotCacheDefinition(file.XLSX[r.Target])
+		}
+	}
+	ptd := UnmarshalPivotTableDefinition(file.XLSX[partName])
+	pc := pivotCache{&pcd, &ptd, sharedStrings}
+
+	ds := DataSource{
+		WorksheetID: ws.ID,
+		Range:       pcd.CacheSource.WorksheetSource.Ref,
+		Name:        ptd.Name,
+	}
+	Db.Create(&ds)
+	ws.AddAuxBlock(&Block{
+		Range:   "PivotSource",
+		Formula: ds.Range,
+	}, "Pivot")
+
+	options := PivotOptions{
+		DataSourceID:   ds.ID,
+		Location:       ptd.Location.Ref,
+		Layout:         pivotLayout(&ptd),
+		RowGrandTotals: boolAttr(ptd.RowGrandTotals, true),
+		ColGrandTotals: boolAttr(ptd.ColGrandTotals, true),
+		SourceSheet:    pcd.CacheSource.WorksheetSource.Sheet,
+		SourceRange:    pcd.CacheSource.WorksheetSource.Ref,
+		SourceName:     pcd.CacheSource.WorksheetSource.Name,
+		RecordCount:    atoi(pcd.RecordCount),
+	}
+	if err := Db.Create(&options).Error; err != nil {
+		log.WithError(err).Errorf("Failed to create the pivot table %q options entry", ptd.Name)
+	}
+	ws.AddAuxBlock(&Block{Range: "PivotLayout", Formula: options.Layout}, "Pivot")
+	ws.AddAuxBlock(&Block{Range: "GrandTotals", Formula: options.GrandTotals()}, "Pivot")
+
+	addField := func(rec PivotTable, blockCellRange string) {
+		rec.DataSourceID = ds.ID
+		Db.Create(&rec)
+		pivotID := NewNullInt64(rec.ID)
+		addBlock := func(name, value string) {
+			ws.AddAuxBlock(&Block{Range: name, Formula: value, PivotID: pivotID}, "Pivot")
+		}
+		switch rec.Type {
+		case "CalculatedField":
+			addBlock(blockCellRange, rec.Label+"="+rec.Formula)
+		case "CalculatedItem":
+			addBlock(blockCellRange, joinStr(",", rec.Label, rec.DisplayName+"="+rec.Formula))
+		default:
+			addBlock(blockCellRange, rec.Label)
+		}
+		if rec.SelectedItems != "" {
+			addBlock("PageItem", joinStr(",", rec.Label, rec.SelectedItems))
+		}
+		if rec.HiddenItems != "" {
+			addBlock("HiddenItems", joinStr(",", rec.Label, rec.HiddenItems))
+		}
+		if rec.Filter != "" {
+			addBlock("FieldFilter", joinStr(",", rec.Label, rec.Filter))
+		}
+		if rec.ShowDataAs != "" {
+			addBlock("ShowValuesAs", joinStr(",", rec.DisplayName, rec.ShowDataAs, rec.BaseField, rec.BaseItem))
+		}
+	}
+
+	for _, f := range ptd.PageFields.PageField {
+		fld := atoi(f.Fld)
+		addField(PivotTable{
+			Type:          "Filter",
+			Label:         pc.fieldName(fld),
+			SelectedItems: pc.selectedItems(fld, f.Item),
+		}, "PageField")
+	}
+	for _, area := range []struct {
+		fieldType, blockCellRange string
+		fields                    []x.PivotFieldRef
+	}{
+		{"Row", "RowField", ptd.RowFields.Field},
+		{"Column", "ColField", ptd.ColFields.Field},
+	} {
+		for _, f := range area.fields {
+			fld := atoi(f.X)
+			if fld < 0 {
+				continue // the values (-2) placed on the rows or the columns
+			}
+			addField(PivotTable{
+				Type:        area.fieldType,
+				Label:       pc.fieldName(fld),
+				HiddenItems: strings.Join(pc.items(fld, true), ","),
+				Filter:      pc.fieldFilter(fld),
+			}, area.blockCellRange)
+		}
+	}
+	for _, df := range ptd.DataFields.DataField {
+		rec := PivotTable{
+			Type:        "Value",
+			Label:       pc.fieldName(atoi(df.Fld)),
+			Function:    df.Subtotal,
+			DisplayName: df.Name,
+		}
+		if rec.Function == "" {
+			rec.Function = "sum"
+		}
+		if df.ShowDataAs != "" && df.ShowDataAs != "normal" {
+			rec.ShowDataAs = df.ShowDataAs
+			if showDataAsWithBase[df.ShowDataAs] {
+				baseField := atoi(df.BaseField)
+				rec.BaseField = pc.fieldName(baseField)
+				if df.ShowDataAs != "runTotal" {
+					rec.BaseItem = pc.baseItem(baseField, df.BaseItem)
+				}
+			}
+		}
+		addField(rec, "DataField")
+	}
+	for _, cf := range pcd.CacheFields.CacheField {
+		if cf.Formula != "" {
+			addField(PivotTable{
+				Type:    "CalculatedField",
+				Label:   cf.Name,
+				Formula: cf.Formula,
+			}, "CalculatedField")
+		}
+	}
+	for _, ci := range pcd.CalculatedItems.CalculatedItem {
+		fld, name := pc.calculatedItemName(ci.Field, ci.PivotArea.References.Reference)
+		addField(PivotTable{
+			Type:        "CalculatedItem",
+			Label:       pc.fieldName(fld),
+			DisplayName: name,
+			Formula:     ci.Formula,
+		}, "CalculatedItem")
+	}
+}
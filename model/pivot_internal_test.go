@@ -0,0 +1,24 @@
+package model
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestPivotLayout(t *testing.T) {
+	for _, c := range []struct{ content, expected string }{
+		{`<pivotTableDefinition outline="1"><pivotFields><pivotField axis="axisRow"/></pivotFields><rowFields><field x="0"/></rowFields></pivotTableDefinition>`, "compact"},
+		{`<pivotTableDefinition compact="0" outline="1"><pivotFields><pivotField axis="axisRow" compact="0"/></pivotFields><rowFields><field x="0"/></rowFields></pivotTableDefinition>`, "outline"},
+		{`<pivotTableDefinition compact="0"><pivotFields><pivotField axis="axisRow" compact="0" outline="0"/></pivotFields><rowFields><field x="-2"/><field x="0"/></rowFields></pivotTableDefinition>`, "tabular"},
+		{`<pivotTableDefinition compact="0" outline="1"/>`, "outline"},
+	} {
+		content, expected := c.content, c.expected
+		ptd := UnmarshalPivotTableDefinition([]byte(content))
+		if ptd.XMLName == (xml.Name{}) {
+			t.Fatalf("Failed to unmarshal %q", content)
+		}
+		if got := pivotLayout(&ptd); got != expected {
+			t.Errorf("Expected the layout %q of %q, got: %q", expected, content, got)
+		}
+	}
+}
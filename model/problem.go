@@ -11,7 +11,6 @@ import (
 	"strconv"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/nad2000/excelize"
 	"github.com/nad2000/xlsx"
 )
 
@@ -74,12 +73,8 @@ func (p Problem) String() string {
 
 // ImportFile imports form Excel file QuestionExcleData
 func (p *Problem) ImportFile(fileName, color string, verbose, skipHidden bool, manager s3.FileManager) error {
-	file, err := xlsx.OpenFile(fileName)
-	if err != nil {
-		return err
-	}
 	// For the output use "excelize"
-	output, err := excelize.OpenFile(fileName)
+	file, output, formulas, err := openWorkbook(fileName)
 	if err != nil {
 		return err
 	}
@@ -147,7 +142,7 @@ func (p *Problem) ImportFile(fileName, color string, verbose, skipHidden bool, m
 		output.SetCellValue(detailSheetName, "B"+row, ps.ID)
 	}
 	output.SetCellValue(detailSheetName, "B1", p.ID)
-	p.ImportBlocks(file, color, verbose, skipHidden)
+	p.ImportBlocks(file, formulas, color, verbose, skipHidden)
 
 	// Choose the output file name
 	outputName := path.Join(os.TempDir(), filepath.Base(fileName))
@@ -190,11 +185,12 @@ func (p *Problem) ImportFile(fileName, color string, verbose, skipHidden bool, m
 }
 
 // ImportBlocks extracts blocks from the given question file and stores in the DB for referencing
-func (p *Problem) ImportBlocks(file *xlsx.File, color string, verbose, skipHidden bool) (wb Workbook) {
+func (p *Problem) ImportBlocks(file *xlsx.File, formulas workbookFormulas, color string, verbose, skipHidden bool) (wb Workbook) {
 
 	// var source Source
 	// Db.Model(&p).Related(&source, "Source")
 	fileName := p.Source.FileName
+	palette := colorPalette(color)
 	if !DryRun {
 		wb = Workbook{FileName: fileName, IsReference: true}
 
@@ -258,11 +254,12 @@ func (p *Problem) ImportBlocks(file *xlsx.File, color string, verbose, skipHidde
 				}
 			MATCH:
 
-				if fgColor == color {
+				if category, ok := palette.Category(fgColor); ok {
 
 					b := Block{
 						WorksheetID:     ws.ID,
-						Color:           color,
+						Color:           fgColor,
+						Category:        category,
 						Formula:         cell.Formula(),
 						RelativeFormula: RelativeFormula(i, j, cell.Formula()),
 						IsReference:     true,
@@ -278,7 +275,7 @@ func (p *Problem) ImportBlocks(file *xlsx.File, color string, verbose, skipHidde
 						log.Debugf("Created %#v", b)
 					}
 
-					b.findWhole(sheet, color)
+					b.findWhole(sheet, formulas, fgColor)
 					b.save()
 					blocks = append(blocks, b)
 					if verbose && b.Range != "" {
@@ -289,7 +286,7 @@ func (p *Problem) ImportBlocks(file *xlsx.File, color string, verbose, skipHidde
 			}
 		}
 		if len(blocks) == 0 {
-			log.Warningf("No block found in the worksheet %q of the workbook %q with color %q", sheet.Name, fileName, color)
+			log.Warningf("No block found in the worksheet %q of the workbook %q with colors %q", sheet.Name, fileName, palette)
 			if len(sheetFillColors) > 0 {
 				log.Infof("Following colors were found in the worksheet you could use: %v", sheetFillColors)
 			}
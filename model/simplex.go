@@ -0,0 +1,334 @@
+package model
+
+import (
+	"math"
+)
+
+// LP solution statuses
+const (
+	lpOptimal    = "optimal"
+	lpInfeasible = "infeasible"
+	lpUnbounded  = "unbounded"
+	lpNodeLimit  = "node limit"
+)
+
+// simplexEpsilon - the tolerance of the simplex pivoting
+const simplexEpsilon = 1e-9
+
+// maxBranchNodes - the maximum number of the branch and bound nodes solving the integer program
+const maxBranchNodes = 10000
+
+// linearProgram - maximize (or minimize) c·x subject to the linear constraints
+// (the relation: -1 - "<=", 0 - "=", 1 - ">=") and the bounds of the variables.
+type linearProgram struct {
+	c            []float64
+	maximize     bool
+	rows         [][]float64
+	relations    []int
+	rhs          []float64
+	lower, upper []float64 // the bounds of the variables, math.Inf(-1) and math.Inf(1) if unbounded
+	integer      []bool
+}
+
+// newLinearProgram creates the program of n unbounded continuous variables without constraints.
+func newLinearProgram(n int) *linearProgram {
+	lp := linearProgram{
+		c:       make([]float64, n),
+		lower:   make([]float64, n),
+		upper:   make([]float64, n),
+		integer: make([]bool, n),
+	}
+	for j := 0; j < n; j++ {
+		lp.lower[j], lp.upper[j] = math.Inf(-1), math.Inf(1)
+	}
+	return &lp
+}
+
+// addConstraint adds the constraint a·x (relation) b.
+func (lp *linearProgram) addConstraint(a []float64, relation int, b float64) {
+	lp.rows = append(lp.rows, a)
+	lp.relations = append(lp.relations, relation)
+	lp.rhs = append(lp.rhs, b)
+}
+
+// objective computes the value of the objective function.
+func (lp *linearProgram) objective(x []float64) float64 {
+	return dot(lp.c, x)
+}
+
+func dot(a, b []float64) (s float64) {
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return
+}
+
+// solve solves the program using branch and bound on the integer variables
+// and returns the status, the optimal solution and the optimum.
+func (lp *linearProgram) solve() (status string, x []float64, optimum float64) {
+	type node struct{ lower, upper []float64 }
+	stack := []node{{lp.lower, lp.upper}}
+	status = lpInfeasible
+	better := func(a, b float64) bool {
+		if lp.maximize {
+			return a > b+simplexEpsilon*math.Max(1, math.Abs(b))
+		}
+		return a < b-simplexEpsilon*math.Max(1, math.Abs(b))
+	}
+	for count := 0; len(stack) > 0; count++ {
+		if count == maxBranchNodes {
+			if x == nil {
+				status = lpNodeLimit
+			}
+			return
+		}
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		s, nx := lp.solveRelaxation(n.lower, n.upper)
+		if s == lpUnbounded {
+			return lpUnbounded, nil, 0
+		}
+		if s != lpOptimal {
+			continue
+		}
+		v := lp.objective(nx)
+		if x != nil && !better(v, optimum) {
+			continue
+		}
+		branch := -1
+		for j, isInteger := range lp.integer {
+			if isInteger && math.Abs(nx[j]-math.Round(nx[j])) > 1e-6 {
+				branch = j
+				break
+			}
+		}
+		if branch < 0 {
+			for j, isInteger := range lp.integer {
+				if isInteger {
+					nx[j] = math.Round(nx[j])
+				}
+			}
+			status, x, optimum = lpOptimal, nx, lp.objective(nx)
+			continue
+		}
+		down := node{n.lower, append([]float64(nil), n.upper...)}
+		down.upper[branch] = math.Floor(nx[branch])
+		up := node{append([]float64(nil), n.lower...), n.upper}
+		up.lower[branch] = math.Ceil(nx[branch])
+		stack = append(stack, up, down)
+	}
+	return
+}
+
+// solveRelaxation solves the continuous program with the given bounds of the variables.
+// The variables get shifted by their lower bounds, the unbounded ones get split into
+// the difference of two non-negative variables and the upper bounds become constraints.
+func (lp *linearProgram) solveRelaxation(lower, upper []float64) (status string, x []float64) {
+	n := len(lp.c)
+	pos, neg := make([]int, n), make([]int, n) // the columns of the variables (neg: -1 if not split)
+	cols := 0
+	for j := 0; j < n; j++ {
+		if lower[j] > upper[j]+simplexEpsilon {
+			return lpInfeasible, nil
+		}
+		pos[j], neg[j] = cols, -1
+		cols++
+		if math.IsInf(lower[j], -1) {
+			neg[j] = cols
+			cols++
+		}
+	}
+	column := func(a []float64) (row []float64, shift float64) {
+		row = make([]float64, cols)
+		for j, v := range a {
+			row[pos[j]] = v
+			if neg[j] >= 0 {
+				row[neg[j]] = -v
+			} else {
+				shift += v * lower[j]
+			}
+		}
+		return
+	}
+	var (
+		A   [][]float64
+		rel []int
+		b   []float64
+	)
+	for i, a := range lp.rows {
+		row, shift := column(a)
+		A, rel, b = append(A, row), append(rel, lp.relations[i]), append(b, lp.rhs[i]-shift)
+	}
+	for j := 0; j < n; j++ {
+		if math.IsInf(upper[j], 1) {
+			continue
+		}
+		a := make([]float64, n)
+		a[j] = 1
+		row, shift := column(a)
+		A, rel, b = append(A, row), append(rel, -1), append(b, upper[j]-shift)
+	}
+	cost, _ := column(lp.c)
+	if lp.maximize {
+		for j := range cost {
+			cost[j] = -cost[j]
+		}
+	}
+	status, y := simplex(cost, A, rel, b)
+	if status != lpOptimal {
+		return
+	}
+	x = make([]float64, n)
+	for j := 0; j < n; j++ {
+		x[j] = y[pos[j]]
+		if neg[j] >= 0 {
+			x[j] -= y[neg[j]]
+		} else {
+			x[j] += lower[j]
+		}
+	}
+	return
+}
+
+// simplex minimizes c·y subject to A y (rel) b and y >= 0 using the two-phase
+// tableau simplex method with Bland's rule preventing the cycling.
+func simplex(c []float64, A [][]float64, rel []int, b []float64) (status string, y []float64) {
+	m, n := len(A), len(c)
+	// the columns: the variables, the slack and surplus variables, the artificial variables
+	slacks, artificials := 0, 0
+	for i := range A {
+		if b[i] < 0 { // make the right hand sides non-negative
+			row := make([]float64, n)
+			for j, v := range A[i] {
+				row[j] = -v
+			}
+			A[i], b[i], rel[i] = row, -b[i], -rel[i]
+		}
+		if rel[i] != 0 {
+			slacks++
+		}
+		if rel[i] >= 0 {
+			artificials++
+		}
+	}
+	width := n + slacks + artificials
+	T := make([][]float64, m)
+	basis := make([]int, m)
+	isArtificial := func(j int) bool { return j >= n+slacks && j < width }
+	s, a := n, n+slacks
+	for i := range A {
+		T[i] = make([]float64, width+1)
+		copy(T[i], A[i])
+		T[i][width] = b[i]
+		switch rel[i] {
+		case -1:
+			T[i][s], basis[i] = 1, s
+			s++
+		case 1:
+			T[i][s] = -1
+			s++
+			T[i][a], basis[i] = 1, a
+			a++
+		default:
+			T[i][a], basis[i] = 1, a
+			a++
+		}
+	}
+	pivot := func(r, col int) {
+		p := T[r][col]
+		for j := range T[r] {
+			T[r][j] /= p
+		}
+		for i := range T {
+			if i == r || T[i][col] == 0 {
+				continue
+			}
+			f := T[i][col]
+			for j := range T[i] {
+				T[i][j] -= f * T[r][j]
+			}
+		}
+		basis[r] = col
+	}
+	iterate := func(cost []float64, allowed func(j int) bool) string {
+		for k := 0; k < 50000; k++ {
+			entering := -1
+			for j := 0; j < width && entering < 0; j++ {
+				if !allowed(j) {
+					continue
+				}
+				r := cost[j]
+				for i := range T {
+					r -= cost[basis[i]] * T[i][j]
+				}
+				if r < -simplexEpsilon {
+					entering = j
+				}
+			}
+			if entering < 0 {
+				return lpOptimal
+			}
+			leaving := -1
+			for i := range T {
+				if T[i][entering] <= simplexEpsilon {
+					continue
+				}
+				ratio := T[i][width] / T[i][entering]
+				if leaving < 0 {
+					leaving = i
+					continue
+				}
+				best := T[leaving][width] / T[leaving][entering]
+				if ratio < best-simplexEpsilon || ratio <= best+simplexEpsilon && basis[i] < basis[leaving] {
+					leaving = i
+				}
+			}
+			if leaving < 0 {
+				return lpUnbounded
+			}
+			pivot(leaving, entering)
+		}
+		return lpNodeLimit
+	}
+
+	if artificials > 0 {
+		cost := make([]float64, width)
+		for j := n + slacks; j < width; j++ {
+			cost[j] = 1
+		}
+		iterate(cost, func(int) bool { return true })
+		infeasibility := 0.0
+		for i := range T {
+			if isArtificial(basis[i]) {
+				infeasibility += T[i][width]
+			}
+		}
+		if infeasibility > 1e-7 {
+			return lpInfeasible, nil
+		}
+		// drive the artificial variables at zero level out of the basis
+		for i := range T {
+			if !isArtificial(basis[i]) {
+				continue
+			}
+			for j := 0; j < n+slacks; j++ {
+				if math.Abs(T[i][j]) > simplexEpsilon {
+					pivot(i, j)
+					break
+				}
+			}
+		}
+	}
+	cost := make([]float64, width)
+	copy(cost, c)
+	if status = iterate(cost, func(j int) bool { return !isArtificial(j) }); status != lpOptimal {
+		return status, nil
+	}
+	y = make([]float64, n)
+	for i, j := range basis {
+		if j < n {
+			y[j] = T[i][width]
+		}
+	}
+	return lpOptimal, y
+}
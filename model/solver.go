@@ -0,0 +1,608 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/xlsx"
+)
+
+// SolverVerification - the Solver model of the worksheet (the solver_* defined names)
+// re-solved as a linear program and compared with the submitted changing cell values
+type SolverVerification struct {
+	ID              int
+	WorksheetID     int    `gorm:"index"`
+	Structure       string `gorm:"size:2000"` // the canonical objective, changing cells and constraints
+	Engine          string
+	Status          string          // optimal, infeasible, unbounded, not linear, etc.
+	Optimum         sql.NullFloat64 // the optimum of the re-solved program
+	Solution        string          `gorm:"size:2000"` // the optimal changing cell values, eg, "C6=5,C7=4"
+	Objective       sql.NullFloat64 // the objective cell value with the submitted changing cell values
+	IsFeasible      sql.NullBool    // the submitted values satisfy the constraints
+	IsOptimal       sql.NullBool    // the submitted values are feasible and reach the optimum (or the target value)
+	IsSameSolution  sql.NullBool    // the submitted values are the same as the re-solved ones
+	IsSameStructure sql.NullBool    // the same Solver set up as the model answer
+}
+
+// TableName overrides default table name for the model
+func (SolverVerification) TableName() string {
+	return "SolverVerifications"
+}
+
+// SolverTolerance - the relative tolerance comparing the constraint sides, the optimum
+// and the changing cell values (scaled by the magnitude of the value if it's above 1)
+var SolverTolerance = 1e-5
+
+// solverEngines - the Solver engines (solver_eng)
+var solverEngines = map[string]string{
+	"1": "GRG Nonlinear",
+	"2": "Simplex LP",
+	"3": "Evolutionary",
+}
+
+// solverRelations - the Solver constraint relations (solver_relN)
+var solverRelations = map[string]string{
+	"1": "<=",
+	"2": "=",
+	"3": ">=",
+	"4": "int",
+	"5": "bin",
+	"6": "dif",
+}
+
+// solverCells - the workbook cells with the formulas re-evaluated for the trial values of the changing cells
+type solverCells struct {
+	values   map[string]string // SHEET!A1 (upper case sheet name) -> value
+	formulas map[string]Expr
+	dims     map[string][2]int // the last used row and column of the sheets
+	inputs   map[string]float64
+	cache    map[string]Value
+	visiting map[string]bool
+	err      error // the first failure evaluating the formulas
+}
+
+func solverKey(sheet string, row, col int) string {
+	return strings.ToUpper(sheet) + "!" + CellAddress(row, col)
+}
+
+func newSolverCells(file *xlsx.File) *solverCells {
+	sc := solverCells{
+		values:   make(map[string]string),
+		formulas: make(map[string]Expr),
+		dims:     make(map[string][2]int),
+	}
+	for _, sheet := range file.Sheets {
+		name := strings.ToUpper(sheet.Name)
+		sc.dims[name] = [2]int{len(sheet.Rows) - 1, sheet.MaxCol - 1}
+		for r, row := range sheet.Rows {
+			for c, cell := range row.Cells {
+				key := solverKey(sheet.Name, r, c)
+				sc.values[key] = cell.Value
+				if formula := cell.Formula(); formula != "" {
+					if e, err := ParseFormula(formula); err == nil {
+						sc.formulas[key] = e
+					}
+				}
+			}
+		}
+	}
+	return &sc
+}
+
+// set sets the changing cell values (keys - the cell references qualified
+// with the sheet name, eg, 'My Sheet'!C6) resetting the computed values.
+func (sc *solverCells) set(keys []string, x []float64) {
+	sc.inputs = make(map[string]float64, len(keys))
+	for j, key := range keys {
+		if ref, err := ParseReference(key); err == nil {
+			sc.inputs[solverKey(ref.Sheet, ref.From.Row, ref.From.Col)] = x[j]
+		}
+	}
+	sc.cache = make(map[string]Value)
+	sc.visiting = make(map[string]bool)
+	sc.err = nil
+}
+
+func (sc *solverCells) value(sheet string, row, col int) Value {
+	key := solverKey(sheet, row, col)
+	if x, ok := sc.inputs[key]; ok {
+		return NumberValue(x)
+	}
+	e, ok := sc.formulas[key]
+	if !ok {
+		return ParseValue(sc.values[key])
+	}
+	if v, ok := sc.cache[key]; ok {
+		return v
+	}
+	if sc.visiting[key] {
+		if sc.err == nil {
+			sc.err = fmt.Errorf("circular reference in %s", key)
+		}
+		return ErrorValue("#REF!")
+	}
+	sc.visiting[key] = true
+	ev := Evaluator{Cells: sheetCells{sc, sheet}, Row: row, Col: col}
+	v, err := ev.Eval(e)
+	if err != nil {
+		if sc.err == nil {
+			sc.err = fmt.Errorf("failed to evaluate %s: %v", key, err)
+		}
+		v = ErrorValue("#VALUE!")
+	}
+	v = firstValue(v)
+	sc.visiting[key] = false
+	sc.cache[key] = v
+	return v
+}
+
+// number evaluates the expression on the sheet with the changing cells (keys) set to x.
+func (sc *solverCells) number(sheet string, e Expr, keys []string, x []float64) (float64, error) {
+	sc.set(keys, x)
+	ev := Evaluator{Cells: sheetCells{sc, sheet}}
+	v, err := ev.Eval(e)
+	if err == nil {
+		err = sc.err
+	}
+	if err != nil {
+		return 0, err
+	}
+	return toNumber(firstValue(v))
+}
+
+// sheetCells - the cells of the Solver model sheet (the references without the sheet name)
+type sheetCells struct {
+	cells *solverCells
+	sheet string
+}
+
+func (sc sheetCells) CellValue(sheet string, row, col int) Value {
+	if sheet == "" {
+		sheet = sc.sheet
+	}
+	return sc.cells.value(sheet, row, col)
+}
+
+func (sc sheetCells) Dimension(sheet string) (maxRow, maxCol int) {
+	if sheet == "" {
+		sheet = sc.sheet
+	}
+	d := sc.cells.dims[strings.ToUpper(sheet)]
+	return d[0], d[1]
+}
+
+// solverCellRefs expands the cell references (eg, Sheet1!$C$6:$C$7,Sheet1!$E$6)
+// into the single cell references qualified with the sheet name.
+func solverCellRefs(refs, sheet string) (cells []string, err error) {
+	for _, s := range strings.Split(refs, ",") {
+		ref, err := ParseReference(strings.TrimSpace(strings.TrimPrefix(s, "=")))
+		if err != nil {
+			return nil, err
+		}
+		if ref.IsError || ref.Workbook != "" || ref.From.Row < 0 || ref.From.Col < 0 || ref.To.Row < 0 || ref.To.Col < 0 {
+			return nil, fmt.Errorf("unsupported reference %q", s)
+		}
+		if ref.Sheet == "" {
+			ref.Sheet = sheet
+		}
+		a := referenceArea(ref)
+		for r := a.tRow; r <= a.bRow; r++ {
+			for c := a.lCol; c <= a.rCol; c++ {
+				cells = append(cells, Reference{Sheet: ref.Sheet, From: CellReference{Row: r, Col: c}}.String())
+			}
+		}
+	}
+	return
+}
+
+// solverConstraint - a single cell constraint of the Solver model
+type solverConstraint struct {
+	lhs      string // the cell reference
+	relation string
+	rhs      string // the cell reference or the formula, empty for int, bin and dif
+}
+
+// solverModel - the Solver set up of the worksheet
+type solverModel struct {
+	sheet       string
+	objective   string // the objective cell reference
+	goal        string // max, min or value
+	target      float64
+	changing    []string
+	constraints []solverConstraint
+	nonNegative bool
+	engine      string
+}
+
+// parseSolverModel parses the solver_* defined names (name -> value) of the sheet.
+func parseSolverModel(sheet string, names map[string]string) (m solverModel, err error) {
+	m.sheet = sheet
+	m.engine = solverEngines[names["solver_eng"]]
+	m.nonNegative = names["solver_neg"] == "1"
+	objective, err := solverCellRefs(names["solver_opt"], sheet)
+	if err != nil {
+		return m, err
+	}
+	if len(objective) != 1 {
+		return m, fmt.Errorf("the objective %q is not a single cell", names["solver_opt"])
+	}
+	m.objective = objective[0]
+	if m.changing, err = solverCellRefs(names["solver_adj"], sheet); err != nil {
+		return m, err
+	}
+	switch names["solver_typ"] {
+	case "2":
+		m.goal = "min"
+	case "3":
+		m.goal = "value"
+		if m.target, err = strconv.ParseFloat(names["solver_val"], 64); err != nil {
+			return m, fmt.Errorf("invalid target value %q", names["solver_val"])
+		}
+	default:
+		m.goal = "max"
+	}
+	count := -1
+	if num, ok := names["solver_num"]; ok {
+		count = atoi(num)
+	}
+	for k := 1; count < 0 || k <= count; k++ {
+		n := strconv.Itoa(k)
+		lhs, ok := names["solver_lhs"+n]
+		if !ok {
+			if count < 0 {
+				break
+			}
+			continue
+		}
+		relation, ok := solverRelations[names["solver_rel"+n]]
+		if !ok {
+			return m, fmt.Errorf("unsupported constraint relation %q", names["solver_rel"+n])
+		}
+		cells, err := solverCellRefs(lhs, sheet)
+		if err != nil {
+			return m, err
+		}
+		rhs := strings.TrimPrefix(names["solver_rhs"+n], "=")
+		if relation == "int" || relation == "bin" || relation == "dif" {
+			for _, c := range cells {
+				m.constraints = append(m.constraints, solverConstraint{lhs: c, relation: relation})
+			}
+			continue
+		}
+		rhsCells, err := solverCellRefs(rhs, sheet)
+		for i, c := range cells {
+			sc := solverConstraint{lhs: c, relation: relation, rhs: rhs}
+			if err == nil && len(rhsCells) == len(cells) {
+				sc.rhs = rhsCells[i]
+			} else if err == nil && len(rhsCells) == 1 {
+				sc.rhs = rhsCells[0]
+			}
+			m.constraints = append(m.constraints, sc)
+		}
+	}
+	return
+}
+
+// local strips the model sheet name and the absolute reference markers.
+func (m *solverModel) local(ref string) string {
+	ref = strings.Replace(ref, "$", "", -1)
+	prefix := Reference{Sheet: m.sheet}.SheetPrefix()
+	if strings.HasPrefix(strings.ToUpper(ref), strings.ToUpper(prefix)) {
+		return ref[len(prefix):]
+	}
+	return ref
+}
+
+// structure returns the canonical representation of the Solver set up, eg,
+// "C8=15; C6,C7; C6<=5; C7>=2; nonnegative".
+func (m *solverModel) structure() string {
+	var goal string
+	switch m.goal {
+	case "value":
+		goal = m.local(m.objective) + "=" + formatGeneral(m.target)
+	default:
+		goal = m.goal + " " + m.local(m.objective)
+	}
+	changing := make([]string, len(m.changing))
+	for i, c := range m.changing {
+		changing[i] = m.local(c)
+	}
+	sort.Strings(changing)
+	var constraints []string
+	seen := make(map[string]bool)
+	for _, c := range m.constraints {
+		s := m.local(c.lhs)
+		if c.rhs == "" {
+			s += " " + c.relation
+		} else if n, err := strconv.ParseFloat(c.rhs, 64); err == nil {
+			s += c.relation + formatGeneral(n)
+		} else {
+			s += c.relation + m.local(c.rhs)
+		}
+		if !seen[s] {
+			seen[s] = true
+			constraints = append(constraints, s)
+		}
+	}
+	sort.Strings(constraints)
+	parts := append([]string{goal, strings.Join(changing, ",")}, constraints...)
+	if m.nonNegative {
+		parts = append(parts, "nonnegative")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// linearForm finds the coefficients and the intercept of the function of the
+// changing cells at x0 and verifies the linearity at several trial points.
+func linearForm(f func(x []float64) (float64, error), x0 []float64) (a []float64, b float64, err error) {
+	n := len(x0)
+	f0, err := f(x0)
+	if err != nil {
+		return
+	}
+	a = make([]float64, n)
+	x := append([]float64(nil), x0...)
+	for j := 0; j < n; j++ {
+		x[j] = x0[j] + 1
+		v, err := f(x)
+		if err != nil {
+			return nil, 0, err
+		}
+		a[j] = v - f0
+		x[j] = x0[j]
+	}
+	b = f0 - dot(a, x0)
+	for trial := 1; trial <= 3; trial++ {
+		for j := range x {
+			x[j] = x0[j] + 100*(pseudoRandom(trial, strconv.Itoa(j))-0.5)
+		}
+		v, err := f(x)
+		if err != nil {
+			return nil, 0, err
+		}
+		expected := dot(a, x) + b
+		if math.Abs(v-expected) > 1e-7*math.Max(1, math.Abs(expected)) {
+			return nil, 0, fmt.Errorf("not linear")
+		}
+	}
+	return
+}
+
+// solverClose tests if the values are the same within the Solver tolerance.
+func solverClose(a, b float64) bool {
+	return math.Abs(a-b) <= SolverTolerance*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+// verify re-solves the Solver model as a linear program and compares
+// the optimum with the submitted changing cell values. Any linear model gets
+// checked whatever its engine (solver_eng), eg, GRG Nonlinear finds the same
+// optimum of a linear model as Simplex LP; the models that aren't linear get
+// the status "not linear".
+func (m *solverModel) verify(cells *solverCells) (v SolverVerification) {
+	v.Structure = m.structure()
+	v.Engine = m.engine
+	n := len(m.changing)
+	x0 := make([]float64, n)
+	for j, ref := range m.changing {
+		r, _ := ParseReference(ref)
+		if x, err := toNumber(cells.value(r.Sheet, r.From.Row, r.From.Col)); err == nil {
+			x0[j] = x
+		}
+	}
+	linear := func(formula string) ([]float64, float64, error) {
+		e, err := ParseFormula(formula)
+		if err != nil {
+			return nil, 0, err
+		}
+		return linearForm(func(x []float64) (float64, error) {
+			return cells.number(m.sheet, e, m.changing, x)
+		}, x0)
+	}
+	fail := func(err error) SolverVerification {
+		v.Status = err.Error()
+		return v
+	}
+	c, c0, err := linear(m.objective)
+	if err != nil {
+		return fail(err)
+	}
+	lp := newLinearProgram(n)
+	index := make(map[string]int, n)
+	for j, ref := range m.changing {
+		index[strings.ToUpper(ref)] = j
+	}
+	hasLower := make([]bool, n)
+	for _, sc := range m.constraints {
+		j, isChanging := index[strings.ToUpper(sc.lhs)]
+		switch sc.relation {
+		case "dif":
+			return fail(fmt.Errorf("unsupported constraint %s dif", m.local(sc.lhs)))
+		case "int", "bin":
+			if !isChanging {
+				return fail(fmt.Errorf("%s is not a changing cell", m.local(sc.lhs)))
+			}
+			lp.integer[j] = true
+			if sc.relation == "bin" {
+				lp.lower[j], lp.upper[j] = math.Max(lp.lower[j], 0), math.Min(lp.upper[j], 1)
+				hasLower[j] = true
+			}
+			continue
+		}
+		a, b, err := linear(sc.lhs + "-(" + sc.rhs + ")")
+		if err != nil {
+			return fail(err)
+		}
+		relation := map[string]int{"<=": -1, "=": 0, ">=": 1}[sc.relation]
+		lp.addConstraint(a, relation, -b)
+		if isChanging && relation >= 0 {
+			hasLower[j] = true
+		}
+	}
+	if m.nonNegative {
+		for j := range hasLower {
+			if !hasLower[j] {
+				lp.lower[j] = math.Max(lp.lower[j], 0)
+			}
+		}
+	}
+	switch m.goal {
+	case "value":
+		lp.addConstraint(c, 0, m.target-c0)
+	default:
+		lp.c, lp.maximize = c, m.goal == "max"
+	}
+
+	objective := dot(c, x0) + c0
+	v.Objective = sql.NullFloat64{Float64: objective, Valid: true}
+	feasible := true
+	for i, a := range lp.rows {
+		lhs, rhs := dot(a, x0), lp.rhs[i]
+		if lp.relations[i] < 0 && lhs > rhs && !solverClose(lhs, rhs) ||
+			lp.relations[i] > 0 && lhs < rhs && !solverClose(lhs, rhs) ||
+			lp.relations[i] == 0 && !solverClose(lhs, rhs) {
+			feasible = false
+		}
+	}
+	for j, x := range x0 {
+		if lp.integer[j] && !solverClose(x, math.Round(x)) ||
+			x < lp.lower[j] && !solverClose(x, lp.lower[j]) ||
+			x > lp.upper[j] && !solverClose(x, lp.upper[j]) {
+			feasible = false
+		}
+	}
+	v.IsFeasible = sql.NullBool{Bool: feasible, Valid: true}
+
+	status, x, _ := lp.solve()
+	v.Status = status
+	if status != lpOptimal {
+		v.IsOptimal = sql.NullBool{Bool: false, Valid: true}
+		return
+	}
+	optimum := dot(c, x) + c0
+	v.Optimum = sql.NullFloat64{Float64: optimum, Valid: true}
+	solution := make([]string, n)
+	same := true
+	for j, ref := range m.changing {
+		solution[j] = m.local(ref) + "=" + formatGeneral(math.Round(x[j]*1e9)/1e9)
+		same = same && solverClose(x[j], x0[j])
+	}
+	v.Solution = strings.Join(solution, ",")
+	v.IsSameSolution = sql.NullBool{Bool: same, Valid: true}
+	v.IsOptimal = sql.NullBool{Bool: feasible && solverClose(objective, optimum), Valid: true}
+	return
+}
+
+// solverNames groups the solver_* defined names by the local sheet index.
+func solverNames(file *xlsx.File) map[int]map[string]string {
+	models := make(map[int]map[string]string)
+	for _, dn := range file.DefinedNames {
+		if !strings.HasPrefix(dn.Name, "solver_") {
+			continue
+		}
+		if models[dn.LocalSheetID] == nil {
+			models[dn.LocalSheetID] = make(map[string]string)
+		}
+		models[dn.LocalSheetID][dn.Name] = dn.Data
+	}
+	return models
+}
+
+// verifySolverModels re-solves the Solver models of the workbook sheets whatever their engine
+// (see verify), sheetIDs - the IDs of the worksheet entries in the order of the file sheets.
+func (wb *Workbook) verifySolverModels(file *xlsx.File, sheetIDs []int) {
+	models := solverNames(file)
+	if len(models) == 0 || DryRun {
+		return
+	}
+	indexes := make([]int, 0, len(models))
+	for idx := range models {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	cells := newSolverCells(file)
+	for _, idx := range indexes {
+		names := models[idx]
+		if idx >= len(file.Sheets) || idx >= len(sheetIDs) || sheetIDs[idx] == 0 ||
+			names["solver_opt"] == "" || names["solver_adj"] == "" {
+			continue
+		}
+		sheet := file.Sheets[idx].Name
+		m, err := parseSolverModel(sheet, names)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to parse the Solver model of the sheet %q", sheet)
+			continue
+		}
+		v := m.verify(cells)
+		v.WorksheetID = sheetIDs[idx]
+		if err := Db.Create(&v).Error; err != nil {
+			log.WithError(err).Errorf("Failed to create the Solver verification entry %#v", v)
+			continue
+		}
+		if VerboseLevel > 0 {
+			log.Infof("Verified the Solver model %q of the sheet %q: %s, optimal: %v",
+				v.Structure, sheet, v.Status, v.IsOptimal.Bool)
+		}
+		ws := Worksheet{ID: v.WorksheetID}
+		ws.AddAuxBlock(&Block{
+			Range:   "SolverVerification",
+			Formula: joinStr(",", v.Status, v.Solution),
+		}, "Solver")
+	}
+}
+
+// solverEvaluationRow - the verified Solver model with the index of its worksheet
+type solverEvaluationRow struct {
+	ID        int
+	Idx       int
+	Structure string
+}
+
+const solverEvaluationQuery = `
+SELECT v.id, ws.idx, v.structure
+FROM SolverVerifications AS v
+	JOIN WorkSheets AS ws ON ws.id = v.worksheet_id
+`
+
+// EvaluateSolverModels compares the Solver set up of the answer with the one of the model answer.
+// The structure is the same if the Solver model of the model answer on the same worksheet (by
+// the sheet index) has the same objective, changing cells and constraints in any order.
+func EvaluateSolverModels(answerID, modelAnswerUserID int) (count int, err error) {
+	var models, modelAnswerModels []solverEvaluationRow
+	if err = Db.Raw(solverEvaluationQuery+"WHERE ws.StudentAnswerID = ?", answerID).Scan(&models).Error; err != nil || len(models) == 0 {
+		return
+	}
+	if err = Db.Raw(solverEvaluationQuery+`
+	JOIN StudentAnswers AS ma ON ma.StudentAnswerID = ws.StudentAnswerID
+	JOIN StudentAssignments AS sa ON sa.StudentAssignmentID = ma.StudentAssignmentID
+	JOIN StudentAnswers AS a ON a.QuestionID = ma.QuestionID
+WHERE sa.UserID = ? AND a.StudentAnswerID = ?`, modelAnswerUserID, answerID).Scan(&modelAnswerModels).Error; err != nil {
+		return
+	}
+	for _, s := range models {
+		var isSame bool
+		for _, m := range modelAnswerModels {
+			if m.Idx == s.Idx && m.Structure == s.Structure {
+				isSame = true
+				break
+			}
+		}
+		if DebugLevel > 1 {
+			log.Debugf("Evaluated the Solver model %#v: %t", s, isSame)
+		}
+		if DryRun {
+			continue
+		}
+		if err := Db.Model(&SolverVerification{}).Where("id = ?", s.ID).
+			Update("IsSameStructure", sql.NullBool{Bool: isSame, Valid: true}).Error; err != nil {
+			log.WithError(err).Errorf("failed to store the evaluation of the Solver model (ID: %d)", s.ID)
+			continue
+		}
+		count++
+	}
+	return
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nad2000/xlsx"
+)
+
+func TestLinearProgram(t *testing.T) {
+	// max 3x + 5y s.t. x <= 4, 2y <= 12, 3x + 2y <= 18, x, y >= 0
+	lp := newLinearProgram(2)
+	lp.c, lp.maximize = []float64{3, 5}, true
+	lp.lower = []float64{0, 0}
+	lp.addConstraint([]float64{1, 0}, -1, 4)
+	lp.addConstraint([]float64{0, 2}, -1, 12)
+	lp.addConstraint([]float64{3, 2}, -1, 18)
+	status, x, optimum := lp.solve()
+	if status != lpOptimal || math.Abs(optimum-36) > 1e-9 || math.Abs(x[0]-2) > 1e-9 || math.Abs(x[1]-6) > 1e-9 {
+		t.Errorf("Expected the optimum 36 at (2, 6), got: %s, %v, %v", status, x, optimum)
+	}
+
+	// min x + y s.t. x + 2y >= 4, x - y = 1 (unbounded below variables)
+	lp = newLinearProgram(2)
+	lp.c = []float64{1, 1}
+	lp.addConstraint([]float64{1, 2}, 1, 4)
+	lp.addConstraint([]float64{1, -1}, 0, 1)
+	if status, x, optimum = lp.solve(); status != lpOptimal || math.Abs(optimum-3) > 1e-9 || math.Abs(x[0]-2) > 1e-9 {
+		t.Errorf("Expected the optimum 3 at (2, 1), got: %s, %v, %v", status, x, optimum)
+	}
+
+	// integer: max x + y s.t. 2x + 2y <= 7, x, y >= 0 and integer
+	lp.c, lp.maximize = []float64{1, 1}, true
+	lp.rows, lp.relations, lp.rhs = nil, nil, nil
+	lp.lower = []float64{0, 0}
+	lp.integer = []bool{true, true}
+	lp.addConstraint([]float64{2, 2}, -1, 7)
+	if status, x, optimum = lp.solve(); status != lpOptimal || optimum != 3 || x[0] != math.Round(x[0]) {
+		t.Errorf("Expected the integer optimum 3, got: %s, %v, %v", status, x, optimum)
+	}
+
+	lp = newLinearProgram(1)
+	lp.c, lp.maximize = []float64{1}, true
+	lp.addConstraint([]float64{1}, 1, 5)
+	if status, _, _ = lp.solve(); status != lpUnbounded {
+		t.Errorf("Expected the program to be unbounded, got: %s", status)
+	}
+	lp.addConstraint([]float64{1}, -1, 4)
+	if status, _, _ = lp.solve(); status != lpInfeasible {
+		t.Errorf("Expected the program to be infeasible, got: %s", status)
+	}
+}
+
+func TestLinearForm(t *testing.T) {
+	a, b, err := linearForm(func(x []float64) (float64, error) {
+		return 2*x[0] - 3*x[1] + 7, nil
+	}, []float64{1, 1})
+	if err != nil || math.Abs(a[0]-2) > 1e-9 || math.Abs(a[1]+3) > 1e-9 || math.Abs(b-7) > 1e-9 {
+		t.Errorf("Expected 2x - 3y + 7, got: %v, %v, %v", a, b, err)
+	}
+	if _, _, err = linearForm(func(x []float64) (float64, error) {
+		return x[0] * x[1], nil
+	}, []float64{1, 1}); err == nil {
+		t.Error("Expected x*y not to be linear")
+	}
+}
+
+func TestSolverModelStructure(t *testing.T) {
+	m, err := parseSolverModel("Sheet1", map[string]string{
+		"solver_opt":  "Sheet1!$C$8",
+		"solver_adj":  "Sheet1!$C$6:$C$7",
+		"solver_typ":  "3",
+		"solver_val":  "15",
+		"solver_num":  "3",
+		"solver_lhs1": "Sheet1!$C$7",
+		"solver_rel1": "3",
+		"solver_rhs1": "2",
+		"solver_lhs2": "Sheet1!$C$6",
+		"solver_rel2": "1",
+		"solver_rhs2": "Sheet2!$A$1",
+		"solver_lhs3": "Sheet1!$C$6:$C$7",
+		"solver_rel3": "4",
+		"solver_rhs3": "integer",
+		"solver_lhs4": "Sheet1!$C$6",
+		"solver_rel4": "2",
+		"solver_rhs4": "1",
+		"solver_neg":  "1",
+	})
+	expected := "C8=15; C6,C7; C6 int; C6<=Sheet2!A1; C7 int; C7>=2; nonnegative"
+	if err != nil || m.structure() != expected {
+		t.Errorf("Expected the structure %q, got: %q, %v", expected, m.structure(), err)
+	}
+}
+
+func TestSolverQuotedSheetName(t *testing.T) {
+	// max 3x + 5y s.t. x <= 4, y <= 6, x, y >= 0 on the sheet with the quoted name
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet("My Sheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet.Cell(5, 2).SetFloat(1)
+	sheet.Cell(6, 2).SetFloat(1)
+	sheet.Cell(7, 2).SetFormula("3*C6+5*C7")
+	m, err := parseSolverModel(sheet.Name, map[string]string{
+		"solver_opt":  "'My Sheet'!$C$8",
+		"solver_adj":  "'My Sheet'!$C$6:$C$7",
+		"solver_typ":  "1",
+		"solver_num":  "2",
+		"solver_lhs1": "'My Sheet'!$C$6",
+		"solver_rel1": "1",
+		"solver_rhs1": "4",
+		"solver_lhs2": "'My Sheet'!$C$7",
+		"solver_rel2": "1",
+		"solver_rhs2": "6",
+		"solver_neg":  "1",
+		"solver_eng":  "2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := m.verify(newSolverCells(file))
+	if v.Status != lpOptimal || !v.Optimum.Valid || v.Optimum.Float64 != 42 || v.Solution != "C6=4,C7=6" || v.IsOptimal.Bool {
+		t.Errorf("Expected the optimum 42 at C6=4,C7=6 (the submitted values not optimal), got: %#v", v)
+	}
+}
@@ -0,0 +1,323 @@
+package model
+
+import (
+	"database/sql"
+	x "extract-blocks/model/xlsx"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// dxfColor returns the color of the differential format used sorting by the cell or the font color.
+func (cc cellColors) dxfColor(dxf x.Dxf, sortBy string) string {
+	switch sortBy {
+	case "cellColor":
+		if dxf.Fill != nil {
+			// unlike the conditional formatting the solid fill color is the foreground color
+			if color := cc.resolve(dxf.Fill.PatternFill.FgColor); color != "" {
+				return color
+			}
+			return cc.resolve(dxf.Fill.PatternFill.BgColor)
+		}
+	case "fontColor":
+		if dxf.Font != nil {
+			return cc.resolve(dxf.Font.Color)
+		}
+	}
+	return ""
+}
+
+// sortTypeOrder - the order of the value types sorting ascending: numbers, text, logical values and errors
+func sortTypeOrder(v Value) int {
+	switch v.Type {
+	case ValueText:
+		return 1
+	case ValueBool:
+		return 2
+	case ValueError:
+		return 3
+	}
+	return 0
+}
+
+// swapCase swaps the case of the letters, ie, the lower case letters get sorted first
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// compareSortValues compares two non-empty values the way Excel sorts them ascending.
+// The text gets compared ignoring the case (unless caseSensitive), the hyphens and the apostrophes.
+func compareSortValues(a, b Value, caseSensitive bool) int {
+	if oa, ob := sortTypeOrder(a), sortTypeOrder(b); oa != ob {
+		return oa - ob
+	}
+	switch a.Type {
+	case ValueNumber:
+		switch {
+		case a.Number < b.Number:
+			return -1
+		case a.Number > b.Number:
+			return 1
+		}
+	case ValueText:
+		ignored := strings.NewReplacer("-", "", "'", "")
+		c := strings.Compare(ignored.Replace(strings.ToLower(a.Text)), ignored.Replace(strings.ToLower(b.Text)))
+		if c == 0 {
+			c = strings.Compare(strings.ToLower(a.Text), strings.ToLower(b.Text))
+		}
+		if c == 0 && caseSensitive {
+			c = strings.Compare(swapCase(a.Text), swapCase(b.Text))
+		}
+		return c
+	case ValueBool:
+		if a.Bool != b.Bool {
+			if a.Bool {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// customListIndex returns the position of the value in the comma separated custom list,
+// the values missing in the list follow the list values.
+func customListIndex(list string, v Value) int {
+	items := strings.Split(list, ",")
+	for i, item := range items {
+		if strings.EqualFold(strings.TrimSpace(item), v.String()) {
+			return i
+		}
+	}
+	return len(items)
+}
+
+// compareSortKeys compares the sort keys (the cells a and b) of the sort level.
+func compareSortKeys(level Sorting, a, b string, values map[string]string, color func(address, sortBy string) string) int {
+	descending := level.Type == "descending"
+	if level.SortBy == "cellColor" || level.SortBy == "fontColor" {
+		// the cells of the color are on top (ascending) or on bottom (descending)
+		rank := func(address string) int {
+			if SameColor(color(address, level.SortBy), level.Color) != descending {
+				return 0
+			}
+			return 1
+		}
+		return rank(a) - rank(b)
+	}
+	va, vb := ParseValue(values[a]), ParseValue(values[b])
+	// the blank cells are always sorted last
+	switch {
+	case va.Type == ValueEmpty && vb.Type == ValueEmpty:
+		return 0
+	case va.Type == ValueEmpty:
+		return 1
+	case vb.Type == ValueEmpty:
+		return -1
+	}
+	var c int
+	if level.CustomList != "" {
+		c = customListIndex(level.CustomList, va) - customListIndex(level.CustomList, vb)
+	}
+	if c == 0 {
+		c = compareSortValues(va, vb, level.CaseSensitive)
+	}
+	if descending {
+		return -c
+	}
+	return c
+}
+
+// VerifySortOrder tests if the rows (the columns if the method is Horizontal) of the range are in the order
+// of the sort levels. The cell values (cell address -> value) are compared and color returns the fill
+// (sortBy: cellColor) or the font color (sortBy: fontColor) of the cell. The sorting by icons cannot be verified.
+// The range is ordered only if it has at least two distinct (non-blank) sort keys.
+func VerifySortOrder(ref string, levels []Sorting, values map[string]string, color func(address, sortBy string) string) (bool, error) {
+	if len(levels) == 0 {
+		return false, fmt.Errorf("no sort levels of %q", ref)
+	}
+	r, err := ParseReference(ref)
+	if err != nil {
+		return false, err
+	}
+	a := referenceArea(r)
+	cv := newPerturbedCells(values)
+	if a.bRow == math.MaxInt32 {
+		a.bRow = cv.maxRow
+	}
+	if a.rCol == math.MaxInt32 {
+		a.rCol = cv.maxCol
+	}
+	isHorizontal := levels[0].Method == "Horizontal"
+	keys := make([]int, len(levels))
+	for i, l := range levels {
+		if l.SortBy == "icon" {
+			return false, fmt.Errorf("the sorting by icons (level %d) cannot be verified", l.Level)
+		}
+		key, err := ParseReference(l.Reference)
+		if err != nil {
+			return false, err
+		}
+		if isHorizontal {
+			keys[i] = key.From.Row
+		} else {
+			keys[i] = key.From.Col
+		}
+	}
+	first, last := a.tRow, a.bRow
+	address := func(line, key int) string {
+		return CellAddress(line, key)
+	}
+	if isHorizontal {
+		first, last = a.lCol, a.rCol
+		address = func(line, key int) string {
+			return CellAddress(key, line)
+		}
+	}
+	// the range of the blank or the same keys isn't sorted, eg, an empty range
+	var isVaried bool
+	for line := first; line < last; line++ {
+		for i, l := range levels {
+			a, b := address(line, keys[i]), address(line+1, keys[i])
+			c := compareSortKeys(l, a, b, values, color)
+			if c > 0 {
+				return false, nil
+			}
+			if c < 0 {
+				isVaried = isVaried || l.SortBy == "cellColor" || l.SortBy == "fontColor" ||
+					ParseValue(values[a]).Type != ValueEmpty && ParseValue(values[b]).Type != ValueEmpty
+				break
+			}
+		}
+	}
+	return isVaried, nil
+}
+
+// importSortState imports the sort levels of the sort state (dxfs - the differential formats
+// of the workbook with the colors of the sorting by color).
+func (ws *Worksheet) importSortState(ss x.SortState, dxfs []x.Dxf, values map[string]string, colors cellColors) {
+	method := "Vertical"
+	if ss.ColumnSort == "1" || ss.ColumnSort == "true" {
+		method = "Horizontal"
+	}
+	levels := make([]Sorting, len(ss.SortCondition))
+	for i, sc := range ss.SortCondition {
+		level := Sorting{
+			Method:        method,
+			Reference:     sc.Ref,
+			Type:          "ascending",
+			SortBy:        sc.SortBy,
+			CustomList:    sc.CustomList,
+			IconSet:       sc.IconSet,
+			IconID:        sc.IconId,
+			Level:         i + 1,
+			CaseSensitive: ss.CaseSensitive == "1" || ss.CaseSensitive == "true",
+			CharacterSort: ss.SortMethod,
+			DxfID:         NewNullInt64(sc.DxfId),
+		}
+		if sc.Descending == "1" || sc.Descending == "true" {
+			level.Type = "descending"
+		}
+		if j := atoi(sc.DxfId); level.DxfID.Valid && j >= 0 && j < len(dxfs) {
+			level.Color = colors.dxfColor(dxfs[j], sc.SortBy)
+		}
+		levels[i] = level
+	}
+	ws.addSortState(ss.Ref, levels, values, colors)
+}
+
+// addSortState stores the sort levels of the range verifying the order of the data.
+func (ws *Worksheet) addSortState(ref string, levels []Sorting, values map[string]string, colors cellColors) {
+	ds := DataSource{
+		WorksheetID: ws.ID,
+		Range:       ref,
+	}
+	Db.Create(&ds)
+	Db.Create(&Block{
+		WorksheetID: ws.ID,
+		Range:       "SortSource",
+		Formula:     ref,
+	})
+	for i := range levels {
+		sorting := levels[i]
+		sorting.ID, sorting.DataSourceID = 0, ds.ID
+		if isOrdered, err := VerifySortOrder(ref, levels[:i+1], values, colors.color); err == nil {
+			sorting.IsOrdered = sql.NullBool{Bool: isOrdered, Valid: true}
+		} else if DebugLevel > 1 {
+			log.WithError(err).Debugf("Failed to verify the order of %q", ref)
+		}
+		if err := Db.Create(&sorting).Error; err != nil {
+			log.WithError(err).Errorf("Failed to create the sorting entry %#v", sorting)
+			continue
+		}
+		ws.AddAuxBlock(&Block{
+			Range: sorting.Reference,
+			Formula: joinStr(",",
+				sorting.Method,
+				sorting.Type,
+				sorting.SortBy,
+				sorting.Color,
+				sorting.CustomList,
+				sorting.IconSet,
+				sorting.IconID),
+			SortingID: NewNullInt64(sorting.ID),
+		}, "Sorting")
+	}
+}
+
+// inferSorting verifies the order of the data of the worksheet without the sort state against
+// the sort levels of the model answer worksheet (by the sheet index). The answers often get saved
+// in the way that drops the sort state. The levels get stored as inferred if the data are in the order.
+func (ws *Worksheet) inferSorting(values map[string]string, colors cellColors) {
+	if !ws.AnswerID.Valid || ws.Idx == 0 {
+		return
+	}
+	var levels []Sorting
+	if err := Db.
+		Select("Sortings.*").
+		Joins("JOIN DataSources AS ds ON ds.id = Sortings.DataSourceID").
+		Joins("JOIN WorkSheets AS mws ON mws.id = ds.worksheet_id").
+		Joins("JOIN StudentAnswers AS ma ON ma.StudentAnswerID = mws.StudentAnswerID").
+		Joins("JOIN StudentAssignments AS msa ON msa.StudentAssignmentID = ma.StudentAssignmentID").
+		Joins("JOIN StudentAnswers AS a ON a.QuestionID = ma.QuestionID").
+		Where("msa.UserID = ? AND a.StudentAnswerID = ? AND ma.StudentAnswerID <> a.StudentAnswerID",
+			ModelAnswerUserID, ws.AnswerID.Int64).
+		Where("mws.idx = ? AND Sortings.isInferred = ?", ws.Idx, false).
+		Order("Sortings.DataSourceID, Sortings.sortLevel").
+		Find(&levels).Error; err != nil {
+		log.WithError(err).Errorf("Failed to retrieve the model answer sorting of the worksheet %q", ws.Name)
+		return
+	}
+	for len(levels) > 0 {
+		n := 1
+		for n < len(levels) && levels[n].DataSourceID == levels[0].DataSourceID {
+			n++
+		}
+		state := levels[:n]
+		levels = levels[n:]
+
+		var ds DataSource
+		if err := Db.First(&ds, state[0].DataSourceID).Error; err != nil {
+			log.WithError(err).Errorf("Failed to retrieve the sorted range (ID: %d)", state[0].DataSourceID)
+			continue
+		}
+		if isOrdered, err := VerifySortOrder(ds.Range, state, values, colors.color); err != nil || !isOrdered {
+			continue
+		}
+		for i := range state {
+			state[i].IsInferred = true
+		}
+		ws.addSortState(ds.Range, state, values, colors)
+		if VerboseLevel > 0 {
+			log.Infof("The data of %q of the worksheet %q are in the order of the model answer sorting", ds.Range, ws.Name)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package model
+
+import "testing"
+
+func TestVerifySortOrder(t *testing.T) {
+	values := map[string]string{
+		"A1": "b", "A2": "b", "A3": "a", "A4": "Mon", "A5": "Wed",
+		"B1": "1", "B2": "2", "B3": "3", "B4": "", "B5": "1",
+	}
+	colors := map[string]string{"A1": "FFFF0000", "A2": "FFFF0000"}
+	color := func(address, sortBy string) string { return colors[address] }
+	for _, c := range []struct {
+		ref      string
+		levels   []Sorting
+		expected bool
+	}{
+		{"A1:B3", []Sorting{{Reference: "B1:B3"}}, true},
+		{"A1:B3", []Sorting{{Reference: "B1:B3", Type: "descending"}}, false},
+		{"A1:B3", []Sorting{{Reference: "A1:A3", Type: "descending"}, {Reference: "B1:B3"}}, true},
+		{"A1:B3", []Sorting{{Reference: "A1:A3", Type: "descending"}, {Reference: "B1:B3", Type: "descending"}}, false},
+		{"A1:B3", []Sorting{{Reference: "A1:A3"}}, false},
+		{"A3:B5", []Sorting{{Reference: "B3:B5", Type: "descending"}}, false},
+		{"A3:B5", []Sorting{{Reference: "B3:B5"}}, false},
+		{"A4:B5", []Sorting{{Reference: "B4:B5"}}, false},
+		{"A4:B5", []Sorting{{Reference: "A4:A5", CustomList: "Sun,Mon,Tue,Wed"}}, true},
+		{"A1:B3", []Sorting{{Reference: "A1:A3", SortBy: "cellColor", Color: "FFFF0001"}}, true},
+		{"A1:B3", []Sorting{{Reference: "A1:A3", SortBy: "cellColor", Color: "FFFF0000", Type: "descending"}}, false},
+		{"A1:C1", []Sorting{{Method: "Horizontal", Reference: "A1:C1"}}, false},
+		{"A1:A2", []Sorting{{Reference: "A1:A2"}}, false},
+		{"C1:D10", []Sorting{{Reference: "C1:C10"}, {Reference: "D1:D10"}}, false},
+	} {
+		isOrdered, err := VerifySortOrder(c.ref, c.levels, values, color)
+		if err != nil {
+			t.Errorf("Failed to verify %q sorted by %#v: %v", c.ref, c.levels, err)
+			continue
+		}
+		if isOrdered != c.expected {
+			t.Errorf("Expected %q sorted by %#v to be ordered: %v, got: %v", c.ref, c.levels, c.expected, isOrdered)
+		}
+	}
+	if _, err := VerifySortOrder("A1:B3", []Sorting{{Reference: "A1:A3", SortBy: "icon"}}, values, color); err == nil {
+		t.Error("Expected the verification of the sorting by icons to fail")
+	}
+}
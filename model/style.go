@@ -0,0 +1,134 @@
+package model
+
+import (
+	"database/sql"
+	x "extract-blocks/model/xlsx"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/excelize"
+)
+
+// builtinNumberFormats - the canonical format codes of the built-in number formats
+// (numFmtId 0..49 as defined by ECMA-376, the currency formats 5..8 for en-US)
+var builtinNumberFormats = map[string]string{
+	"0":  "General",
+	"1":  "0",
+	"2":  "0.00",
+	"3":  "#,##0",
+	"4":  "#,##0.00",
+	"5":  `"$"#,##0_);("$"#,##0)`,
+	"6":  `"$"#,##0_);[Red]("$"#,##0)`,
+	"7":  `"$"#,##0.00_);("$"#,##0.00)`,
+	"8":  `"$"#,##0.00_);[Red]("$"#,##0.00)`,
+	"9":  "0%",
+	"10": "0.00%",
+	"11": "0.00E+00",
+	"12": "# ?/?",
+	"13": "# ??/??",
+	"14": "mm-dd-yy",
+	"15": "d-mmm-yy",
+	"16": "d-mmm",
+	"17": "mmm-yy",
+	"18": "h:mm AM/PM",
+	"19": "h:mm:ss AM/PM",
+	"20": "h:mm",
+	"21": "h:mm:ss",
+	"22": "m/d/yy h:mm",
+	"37": "#,##0 ;(#,##0)",
+	"38": "#,##0 ;[Red](#,##0)",
+	"39": "#,##0.00;(#,##0.00)",
+	"40": "#,##0.00;[Red](#,##0.00)",
+	"41": `_(* #,##0_);_(* \(#,##0\);_(* "-"_);_(@_)`,
+	"42": `_("$"* #,##0_);_("$"* \(#,##0\);_("$"* "-"_);_(@_)`,
+	"43": `_(* #,##0.00_);_(* \(#,##0.00\);_(* "-"??_);_(@_)`,
+	"44": `_("$"* #,##0.00_);_("$"* \(#,##0.00\);_("$"* "-"??_);_(@_)`,
+	"45": "mm:ss",
+	"46": "[h]:mm:ss",
+	"47": "mmss.0",
+	"48": "##0.0E+0",
+	"49": "@",
+}
+
+// numberFormatCode returns the format code of the number format: the custom format
+// of the style sheet, the built-in one or "ID: n" if the format is not known.
+func numberFormatCode(ss *x.StyleSheet, id string) string {
+	for _, f := range ss.NumFmts.NumFmt {
+		if f.NumFmtId == id {
+			return f.FormatCode
+		}
+	}
+	if code, ok := builtinNumberFormats[id]; ok {
+		return code
+	}
+	return "ID: " + id
+}
+
+// cellStyles stores the fonts and the fills of the style sheet, every font
+// and fill of the style sheet gets stored only once.
+type cellStyles struct {
+	cellColors
+	fonts, fills map[string]sql.NullInt64 // fontId/fillId -> the ID of the stored entry
+}
+
+func newCellStyles(file *excelize.File, styleSheet *x.StyleSheet) cellStyles {
+	return cellStyles{
+		cellColors: newCellColors(file, styleSheet, &x.Worksheet{}),
+		fonts:      make(map[string]sql.NullInt64),
+		fills:      make(map[string]sql.NullInt64),
+	}
+}
+
+// font returns the ID of the stored font of the style sheet.
+func (cs cellStyles) font(id string) sql.NullInt64 {
+	if rec, ok := cs.fonts[id]; ok {
+		return rec
+	}
+	fonts, i := cs.styleSheet.Fonts.Font, atoi(id)
+	if id == "" || i < 0 || i >= len(fonts) {
+		return sql.NullInt64{}
+	}
+	f := fonts[i]
+	rec := Font{
+		Name:   f.Name.Val,
+		Bold:   f.B.IsOn(),
+		Italic: f.I.IsOn(),
+		Strike: f.Strike.IsOn(),
+		Color:  cs.resolve(f.Color),
+	}
+	rec.Size, _ = strconv.ParseFloat(f.Sz.Val, 64)
+	if u := f.Underline; u != nil && u.Val != "none" {
+		if rec.Underline = u.Val; rec.Underline == "" {
+			rec.Underline = "single"
+		}
+	}
+	if err := Db.Create(&rec).Error; err != nil {
+		log.WithError(err).Errorf("Failed to create the font entry %#v", rec)
+		return sql.NullInt64{}
+	}
+	cs.fonts[id] = NewNullInt64(rec.ID)
+	return cs.fonts[id]
+}
+
+// fill returns the ID of the stored fill of the style sheet.
+func (cs cellStyles) fill(id string) sql.NullInt64 {
+	if rec, ok := cs.fills[id]; ok {
+		return rec
+	}
+	fills, i := cs.styleSheet.Fills.Fill, atoi(id)
+	if id == "" || i < 0 || i >= len(fills) {
+		return sql.NullInt64{}
+	}
+	f := fills[i].PatternFill
+	rec := Fill{
+		Pattern: f.PatternType,
+		FgColor: cs.resolve(f.FgColor),
+		BgColor: cs.resolve(f.BgColor),
+	}
+	if err := Db.Create(&rec).Error; err != nil {
+		log.WithError(err).Errorf("Failed to create the fill entry %#v", rec)
+		return sql.NullInt64{}
+	}
+	cs.fills[id] = NewNullInt64(rec.ID)
+	return cs.fills[id]
+}
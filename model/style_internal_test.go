@@ -0,0 +1,27 @@
+package model
+
+import (
+	x "extract-blocks/model/xlsx"
+	"testing"
+)
+
+func TestNumberFormatCode(t *testing.T) {
+	var ss x.StyleSheet
+	ss.NumFmts.NumFmt = append(ss.NumFmts.NumFmt, struct {
+		Text       string `xml:",chardata"`
+		NumFmtId   string `xml:"numFmtId,attr"`
+		FormatCode string `xml:"formatCode,attr"`
+	}{NumFmtId: "164", FormatCode: "0.0%"})
+	for id, expected := range map[string]string{
+		"2":   "0.00",
+		"8":   `"$"#,##0.00_);[Red]("$"#,##0.00)`,
+		"44":  `_("$"* #,##0.00_);_("$"* \(#,##0.00\);_("$"* "-"??_);_(@_)`,
+		"49":  "@",
+		"164": "0.0%",
+		"30":  "ID: 30",
+	} {
+		if got := numberFormatCode(&ss, id); got != expected {
+			t.Errorf("Expected the format code of %s to be %q, got: %q", id, expected, got)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package model
+
+import (
+	x "extract-blocks/model/xlsx"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/excelize"
+	"github.com/nad2000/xlsx"
+)
+
+// Table - Excel table (ListObject)
+type Table struct {
+	ID                int
+	WorksheetID       int    `gorm:"index"`
+	Name              string // the display name used in the structured references, eg, Sales[Total]
+	Range             string // the whole table range including the header and the totals rows
+	HeaderRowCount    int
+	TotalsRowCount    int
+	HasAutoFilter     bool
+	Style             string
+	ShowFirstColumn   bool
+	ShowLastColumn    bool
+	ShowRowStripes    bool
+	ShowColumnStripes bool
+	Columns           []TableColumn `gorm:"foreignkey:TableID"`
+}
+
+// TableName overrides default table name for the model
+func (Table) TableName() string {
+	return "ExcelTables"
+}
+
+// TableColumn - Excel table column
+type TableColumn struct {
+	ID                      int
+	TableID                 int `gorm:"index"`
+	Idx                     int // zero based index of the column within the table
+	Name                    string
+	TotalsRowFunction       string `gorm:"type:varchar(20)"` // sum, average, count, custom...
+	TotalsRowLabel          string
+	TotalsRowFormula        string `gorm:"size:2000"`
+	CalculatedColumnFormula string `gorm:"size:2000"`
+}
+
+// TableName overrides default table name for the model
+func (TableColumn) TableName() string {
+	return "ExcelTableColumns"
+}
+
+// sheetTables reads the table parts referenced from the sheet part relationships.
+func sheetTables(file *excelize.File, sheetPartName string) (tables []x.Table) {
+	for _, r := range partRelationships(file, sheetPartName) {
+		if relationshipType(r) == "table" {
+			if content, ok := file.XLSX[r.Target]; ok {
+				tables = append(tables, UnmarshalTable(content))
+			}
+		}
+	}
+	return
+}
+
+// ImportTables imports the tables (ListObjects) of the worksheet
+func (ws *Worksheet) ImportTables(file *excelize.File) {
+	for _, t := range sheetTables(file, ws.sheetPartName(file)) {
+		name := t.DisplayName
+		if name == "" {
+			name = t.Name
+		}
+		rec := Table{
+			WorksheetID:       ws.ID,
+			Name:              name,
+			Range:             t.Ref,
+			HeaderRowCount:    1,
+			TotalsRowCount:    atoi(t.TotalsRowCount),
+			HasAutoFilter:     t.AutoFilter != nil,
+			Style:             t.TableStyleInfo.Name,
+			ShowFirstColumn:   t.TableStyleInfo.ShowFirstColumn == "1" || t.TableStyleInfo.ShowFirstColumn == "true",
+			ShowLastColumn:    t.TableStyleInfo.ShowLastColumn == "1" || t.TableStyleInfo.ShowLastColumn == "true",
+			ShowRowStripes:    t.TableStyleInfo.ShowRowStripes == "1" || t.TableStyleInfo.ShowRowStripes == "true",
+			ShowColumnStripes: t.TableStyleInfo.ShowColumnStripes == "1" || t.TableStyleInfo.ShowColumnStripes == "true",
+		}
+		if t.HeaderRowCount != "" {
+			rec.HeaderRowCount = atoi(t.HeaderRowCount)
+		}
+		for i, tc := range t.TableColumns.TableColumn {
+			rec.Columns = append(rec.Columns, TableColumn{
+				Idx:                     i,
+				Name:                    tc.Name,
+				TotalsRowFunction:       tc.TotalsRowFunction,
+				TotalsRowLabel:          tc.TotalsRowLabel,
+				TotalsRowFormula:        tc.TotalsRowFormula,
+				CalculatedColumnFormula: tc.CalculatedColumnFormula,
+			})
+		}
+		if DryRun {
+			continue
+		}
+		if err := Db.Create(&rec).Error; err != nil {
+			log.WithError(err).Errorf("Failed to create the table %q entry of the worksheet %q", name, ws.Name)
+		}
+		if VerboseLevel > 0 {
+			log.Infof("Found table %q (%s) on the sheet %q", name, rec.Range, ws.Name)
+		}
+	}
+}
+
+// tableDefinition - the table ranges and columns for resolving the structured references
+type tableDefinition struct {
+	name, sheet            string
+	area                   // the whole table range
+	headerRows, totalsRows int
+	columns                []string
+}
+
+func newTableDefinition(sheet string, t x.Table) (td tableDefinition, err error) {
+	ref, err := ParseReference(t.Ref)
+	if err != nil {
+		return
+	}
+	td = tableDefinition{name: t.DisplayName, sheet: sheet, area: referenceArea(ref), headerRows: 1}
+	if td.name == "" {
+		td.name = t.Name
+	}
+	if t.HeaderRowCount != "" {
+		td.headerRows = atoi(t.HeaderRowCount)
+	}
+	td.totalsRows = atoi(t.TotalsRowCount)
+	for _, tc := range t.TableColumns.TableColumn {
+		td.columns = append(td.columns, tc.Name)
+	}
+	return
+}
+
+// column returns the worksheet column index of the table column.
+func (td *tableDefinition) column(name string) (int, error) {
+	name = unescapeColumnName(strings.TrimSpace(name))
+	for i, c := range td.columns {
+		if strings.EqualFold(c, name) {
+			return td.lCol + i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column %q of the table %q", name, td.name)
+}
+
+// unescapeColumnName removes the escape character (') from the column name of
+// the structured reference, eg, Sales['#Units] refers to the column "#Units".
+func unescapeColumnName(name string) string {
+	if !strings.Contains(name, "'") {
+		return name
+	}
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\'' && i+1 < len(name) {
+			i++
+		}
+		sb.WriteByte(name[i])
+	}
+	return sb.String()
+}
+
+// splitSpecifiers splits the structured reference specifiers separated by the commas,
+// eg, "[#Headers],[#Data],[Qty]:[Price]".
+func splitSpecifiers(spec string) (items []string) {
+	depth, start := 0, 0
+	for i := 0; i < len(spec); i++ {
+		switch spec[i] {
+		case '\'':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(spec[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(items, strings.TrimSpace(spec[start:]))
+}
+
+// resolve returns the range of the table refered by the specifiers of the structured
+// reference (the part within the outer brackets), eg, "[#This Row],[Qty]" or "Total".
+func (td *tableDefinition) resolve(spec string, rowIndex int) (a area, err error) {
+	var items []string
+	if spec = strings.TrimSpace(spec); strings.HasPrefix(spec, "@") {
+		items = append([]string{"#This Row"}, splitSpecifiers(spec[1:])...)
+	} else if strings.HasPrefix(spec, "[") {
+		items = splitSpecifiers(spec)
+	} else {
+		items = []string{spec}
+	}
+
+	var (
+		dataTop, dataBottom = td.tRow + td.headerRows, td.bRow - td.totalsRows
+		hasRows, hasColumns bool
+	)
+	a = area{tRow: -1, lCol: -1, bRow: -1, rCol: -1}
+	addRows := func(top, bottom int) {
+		if !hasRows || top < a.tRow {
+			a.tRow = top
+		}
+		if !hasRows || bottom > a.bRow {
+			a.bRow = bottom
+		}
+		hasRows = true
+	}
+	addColumns := func(left, right int) {
+		if !hasColumns || left < a.lCol {
+			a.lCol = left
+		}
+		if !hasColumns || right > a.rCol {
+			a.rCol = right
+		}
+		hasColumns = true
+	}
+
+	for _, item := range items {
+		if item == "" {
+			continue
+		}
+		// column range, eg, [Qty]:[Price]
+		if parts := splitColumnRange(item); len(parts) == 2 {
+			left, err := td.column(parts[0])
+			if err != nil {
+				return a, err
+			}
+			right, err := td.column(parts[1])
+			if err != nil {
+				return a, err
+			}
+			if left > right {
+				left, right = right, left
+			}
+			addColumns(left, right)
+			continue
+		}
+		if strings.HasPrefix(item, "[") && strings.HasSuffix(item, "]") {
+			item = item[1 : len(item)-1]
+		}
+		switch strings.ToUpper(strings.Join(strings.Fields(item), " ")) {
+		case "#ALL":
+			addRows(td.tRow, td.bRow)
+		case "#DATA":
+			addRows(dataTop, dataBottom)
+		case "#HEADERS":
+			if td.headerRows == 0 {
+				return a, fmt.Errorf("the table %q has no header row", td.name)
+			}
+			addRows(td.tRow, dataTop-1)
+		case "#TOTALS":
+			if td.totalsRows == 0 {
+				return a, fmt.Errorf("the table %q has no totals row", td.name)
+			}
+			addRows(dataBottom+1, td.bRow)
+		case "#THIS ROW":
+			addRows(rowIndex, rowIndex)
+		default:
+			c, err := td.column(item)
+			if err != nil {
+				return a, err
+			}
+			addColumns(c, c)
+		}
+	}
+	if !hasRows {
+		addRows(dataTop, dataBottom)
+	}
+	if !hasColumns {
+		addColumns(td.lCol, td.rCol)
+	}
+	return
+}
+
+// splitColumnRange splits the column range specifier, eg, "[Qty]:[Price]".
+func splitColumnRange(item string) []string {
+	depth := 0
+	for i := 0; i < len(item); i++ {
+		switch item[i] {
+		case '\'':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				left, right := strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+				return []string{strings.Trim(left, "[]"), strings.Trim(right, "[]")}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveStructuredReference maps the structured reference of the cell on the sheet,
+// eg, Sales[Total] or [@Qty], to the A1 reference. The table name can be omitted
+// within the table.
+func resolveStructuredReference(sheet string, rowIndex, colIndex int, text string, tables []tableDefinition) (string, error) {
+	i := strings.Index(text, "[")
+	if i < 0 || !strings.HasSuffix(text, "]") {
+		return "", fmt.Errorf("invalid structured reference %q", text)
+	}
+	name, spec := text[:i], text[i+1:len(text)-1]
+	var td *tableDefinition
+	for k := range tables {
+		t := &tables[k]
+		if name == "" && t.sheet == sheet && t.includes(rowIndex, colIndex) ||
+			name != "" && strings.EqualFold(t.name, name) {
+			td = t
+			break
+		}
+	}
+	if td == nil {
+		return "", fmt.Errorf("no table found for the structured reference %q", text)
+	}
+	a, err := td.resolve(spec, rowIndex)
+	if err != nil {
+		return "", err
+	}
+	ref := Reference{
+		From:    CellReference{Row: a.tRow, Col: a.lCol},
+		To:      CellReference{Row: a.bRow, Col: a.rCol},
+		IsRange: a.tRow != a.bRow || a.lCol != a.rCol,
+	}
+	if td.sheet != sheet {
+		ref.Sheet = td.sheet
+	}
+	return ref.String(), nil
+}
+
+// resolveStructuredReferences replaces the structured references of the formula
+// of the cell (the zero based indexes) on the sheet with the A1 references.
+func resolveStructuredReferences(sheet string, rowIndex, colIndex int, formula string, tables []tableDefinition) (string, error) {
+	if !strings.Contains(formula, "[") {
+		return formula, nil
+	}
+	tokens, err := Tokenize(formula)
+	if err != nil {
+		return formula, err
+	}
+	var sb strings.Builder
+	for _, t := range tokens {
+		if t.Type != TokenStructuredReference {
+			sb.WriteString(t.Value)
+			continue
+		}
+		ref, err := resolveStructuredReference(sheet, rowIndex, colIndex, t.Value, tables)
+		if err != nil {
+			return formula, err
+		}
+		sb.WriteString(ref)
+	}
+	return sb.String(), nil
+}
+
+// resolveTableReferences replaces the structured references in the formulas of
+// the workbook cells with the A1 references, so the blocks and the formulas
+// match regardless whether a table or a plain range was used. The formulas
+// as entered are kept (see originalFormula).
+func resolveTableReferences(file *xlsx.File, xf *excelize.File, formulas workbookFormulas) {
+	var tables []tableDefinition
+	for _, sp := range workbookSheets(xf) {
+		for _, t := range sheetTables(xf, sp.PartName) {
+			td, err := newTableDefinition(sp.Name, t)
+			if err != nil {
+				log.WithError(err).Errorf("invalid table %q range %q", t.DisplayName, t.Ref)
+				continue
+			}
+			tables = append(tables, td)
+		}
+	}
+	if len(tables) == 0 {
+		return
+	}
+	for _, sheet := range file.Sheets {
+		for i, row := range sheet.Rows {
+			for j, cell := range row.Cells {
+				formula := cell.Formula()
+				if !strings.Contains(formula, "[") {
+					continue
+				}
+				resolved, err := resolveStructuredReferences(sheet.Name, i, j, formula, tables)
+				if err != nil {
+					log.WithError(err).Warnf("Failed to resolve the structured references of %s!%s: %q",
+						sheet.Name, CellAddress(i, j), formula)
+					continue
+				}
+				if DebugLevel > 1 {
+					log.Debugf("Resolved the structured references of %s!%s: %q -> %q",
+						sheet.Name, CellAddress(i, j), formula, resolved)
+				}
+				f := formulas[cell]
+				f.Original = formula
+				formulas[cell] = f
+				setFormula(cell, resolved)
+			}
+		}
+	}
+}
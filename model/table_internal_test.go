@@ -0,0 +1,46 @@
+package model
+
+import "testing"
+
+func TestResolveStructuredReferences(t *testing.T) {
+	// Sales table on the sheet "Data" at A1:D5: the header row, 3 data rows and the totals row
+	tables := []tableDefinition{{
+		name:       "Sales",
+		sheet:      "Data",
+		area:       area{tRow: 0, lCol: 0, bRow: 4, rCol: 3},
+		headerRows: 1,
+		totalsRows: 1,
+		columns:    []string{"Item", "Qty", "Price", "#Total"},
+	}}
+	for _, c := range []struct {
+		sheet             string
+		row, col          int
+		formula, expected string
+	}{
+		{"Data", 2, 3, "[@Qty]*[@Price]", "B3*C3"},
+		{"Data", 1, 3, "Sales[[#This Row],[Qty]]*Sales[[#This Row],[Price]]", "B2*C2"},
+		{"Data", 4, 1, "SUBTOTAL(109,[Qty])", "SUBTOTAL(109,B2:B4)"},
+		{"Data", 4, 3, "SUM(Sales['#Total])", "SUM(D2:D4)"},
+		{"Data", 6, 0, "Sales[[#Headers],[Qty]]", "B1"},
+		{"Data", 6, 0, "Sales[[#Totals],[Qty]:[Price]]", "B5:C5"},
+		{"Data", 6, 0, "ROWS(Sales[#All])", "ROWS(A1:D5)"},
+		{"Data", 6, 0, "SUM(Sales[[#Data],[Qty]:[Price]])", "SUM(B2:C4)"},
+		{"Report", 0, 0, "AVERAGE(Sales[Price])", "AVERAGE(Data!C2:C4)"},
+		{"Report", 0, 0, "COUNTA(sales)", "COUNTA(sales)"},
+	} {
+		got, err := resolveStructuredReferences(c.sheet, c.row, c.col, c.formula, tables)
+		if err != nil {
+			t.Errorf("Failed to resolve %q: %v", c.formula, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("Expected %q to be resolved to %q, got: %q", c.formula, c.expected, got)
+		}
+	}
+
+	for _, formula := range []string{"Sales[Discount]", "Orders[Qty]", "[@Qty]"} {
+		if _, err := resolveStructuredReferences("Report", 0, 0, formula, tables); err == nil {
+			t.Errorf("Expected an error resolving %q", formula)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package model
+
+import (
+	x "extract-blocks/model/xlsx"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nad2000/excelize"
+)
+
+// Scenario - Scenario Manager scenario
+type Scenario struct {
+	ID          int
+	WorksheetID int `gorm:"index"`
+	Name        string
+	Comment     string `gorm:"size:2000"`
+	User        string
+	IsLocked    bool
+	IsHidden    bool
+	IsCurrent   bool                // the last scenario shown
+	ResultCells string              // the result cells selected for the summary report
+	InputCells  []ScenarioInputCell `gorm:"foreignkey:ScenarioID"`
+}
+
+// TableName overrides default table name for the model
+func (Scenario) TableName() string {
+	return "Scenarios"
+}
+
+// ScenarioInputCell - the value of a changing cell of the scenario
+type ScenarioInputCell struct {
+	ID         int
+	ScenarioID int    `gorm:"index"`
+	Range      string `gorm:"column:cell_range;size:10"`
+	Value      string
+	IsDeleted  bool
+}
+
+// TableName overrides default table name for the model
+func (ScenarioInputCell) TableName() string {
+	return "ScenarioInputCells"
+}
+
+// String returns the input cell value assignment, eg, B3=0.05
+func (ic ScenarioInputCell) String() string {
+	return ic.Range + "=" + ic.Value
+}
+
+// DataTable - one- or two-variable Data Table ({=TABLE(row_input_cell,column_input_cell)})
+type DataTable struct {
+	ID              int
+	WorksheetID     int `gorm:"index"`
+	Range           string
+	Formula         string // TABLE(,B3)
+	Is2D            bool
+	RowInputCell    string
+	ColumnInputCell string
+}
+
+// TableName overrides default table name for the model
+func (DataTable) TableName() string {
+	return "DataTables"
+}
+
+// dataTableFormula returns the formula of the data table as it's shown by Excel.
+func dataTableFormula(is2D, isRow bool, r1, r2 string) (formula, rowInput, columnInput string) {
+	switch {
+	case is2D:
+		rowInput, columnInput = r1, r2
+	case isRow:
+		rowInput = r1
+	default:
+		columnInput = r1
+	}
+	return "TABLE(" + rowInput + "," + columnInput + ")", rowInput, columnInput
+}
+
+// GoalSeek - the detected Goal Seek result: the formula cell (the target) was
+// set to the value by changing a constant cell
+type GoalSeek struct {
+	ID            int
+	WorksheetID   int `gorm:"index"`
+	TargetCell    string
+	TargetValue   string
+	ChangingCell  string // the cell address prefixed with the sheet name if it's on another sheet
+	ChangingValue string
+}
+
+// TableName overrides default table name for the model
+func (GoalSeek) TableName() string {
+	return "GoalSeeks"
+}
+
+// GoalSeekTolerance - the maximum difference between the target cell value
+// and the requested value (the default Goal Seek "Maximum Change")
+var GoalSeekTolerance = 0.001
+
+// isGoalSeekValue tests if the value of the constant cell looks like found by the
+// Goal Seek, ie, it has more decimal places than a user would usually type.
+func isGoalSeekValue(value string) bool {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v == 0 {
+		return false
+	}
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	i := strings.Index(s, ".")
+	return i >= 0 && len(s)-i-1 > 6
+}
+
+// requestedValue returns the value with at most 2 decimal places within
+// the tolerance from the given value, ie, the value requested by the user.
+func requestedValue(value string) (string, bool) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", false
+	}
+	r := math.Round(v*100) / 100
+	if math.Abs(v-r) > GoalSeekTolerance {
+		return "", false
+	}
+	if r == 0 {
+		r = 0 // -0
+	}
+	return strconv.FormatFloat(r, 'f', -1, 64), true
+}
+
+// cellGraph - the formula cell dependencies of the workbook with the cell values
+type cellGraph struct {
+	sheetIDs    map[string]int // the worksheet IDs by the upper case names
+	sheetNames  map[int]string
+	values      map[cellNode]string
+	isFormula   map[cellNode]bool
+	precedents  map[cellNode][]sheetArea // the precedent ranges of the formula cells
+	formulaRows map[int]map[int][]cellNode
+	valueRows   map[int]map[int][]cellNode // the constant cells
+}
+
+// sheetArea - the area of the worksheet
+type sheetArea struct {
+	worksheetID int
+	area
+}
+
+// newCellGraph loads the dependencies of the workbook formula cells with the cell values
+// of the worksheet and the other worksheets of the workbook.
+func (ws *Worksheet) newCellGraph(file *excelize.File, sheet *x.Worksheet, sharedStrings SharedStrings) (*cellGraph, error) {
+	g := cellGraph{
+		sheetIDs:   make(map[string]int),
+		sheetNames: make(map[int]string),
+		values:     make(map[cellNode]string),
+		isFormula:  make(map[cellNode]bool),
+		precedents: make(map[cellNode][]sheetArea),
+	}
+	var worksheets []Worksheet
+	if err := Db.Where("workbook_id = ?", ws.WorkbookID).Find(&worksheets).Error; err != nil {
+		return nil, err
+	}
+	for _, w := range worksheets {
+		g.sheetIDs[strings.ToUpper(w.Name)], g.sheetNames[w.ID] = w.ID, w.Name
+	}
+	var dependencies []CellDependency
+	if err := Db.Where("workbook_id = ?", ws.WorkbookID).Find(&dependencies).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range dependencies {
+		n, ok := g.node(d.WorksheetID, d.CellRange)
+		if !ok {
+			continue
+		}
+		ref, err := ParseReference(d.PrecedentRange)
+		if err != nil {
+			continue
+		}
+		g.isFormula[n] = true
+		g.precedents[n] = append(g.precedents[n], sheetArea{d.PrecedentWorksheetID, referenceArea(ref)})
+	}
+	for _, row := range sheet.SheetData.Row {
+		for _, c := range row.C {
+			if n, ok := g.node(ws.ID, c.R); ok && c.F != nil {
+				g.isFormula[n] = true
+			}
+		}
+	}
+	for _, w := range worksheets {
+		data := sheet
+		if w.ID != ws.ID {
+			content, ok := file.XLSX[w.sheetPartName(file)]
+			if !ok {
+				continue
+			}
+			other := UnmarshalWorksheet(content)
+			data = &other
+		}
+		for address, value := range sheetValues(data, sharedStrings) {
+			if n, ok := g.node(w.ID, address); ok {
+				g.values[n] = value
+			}
+		}
+	}
+
+	var formulaCells, valueCells []cellNode
+	for n := range g.isFormula {
+		formulaCells = append(formulaCells, n)
+	}
+	for n := range g.values {
+		if !g.isFormula[n] {
+			valueCells = append(valueCells, n)
+		}
+	}
+	g.formulaRows, g.valueRows = rowIndex(formulaCells), rowIndex(valueCells)
+	return &g, nil
+}
+
+// node returns the cell of the graph given with the address, eg, A1 or Sheet2!A1
+// (on another worksheet than the worksheet with the ID).
+func (g *cellGraph) node(worksheetID int, address string) (n cellNode, ok bool) {
+	ref, err := ParseReference(address)
+	if err != nil || ref.IsError || ref.IsRange || ref.Workbook != "" || ref.From.Row < 0 || ref.From.Col < 0 {
+		return
+	}
+	if ref.Sheet != "" {
+		if worksheetID, ok = g.sheetIDs[strings.ToUpper(ref.Sheet)]; !ok {
+			return
+		}
+	}
+	return cellNode{worksheetID, ref.From.Row, ref.From.Col}, true
+}
+
+// dependsOn tests if the formula cell depends directly or indirectly on the cell.
+func (g *cellGraph) dependsOn(n, precedent cellNode) bool {
+	visited := map[cellNode]bool{n: true}
+	for queue := []cellNode{n}; len(queue) > 0; queue = queue[1:] {
+		for _, p := range g.precedents[queue[0]] {
+			if p.worksheetID == precedent.worksheetID && p.includes(precedent.row, precedent.col) {
+				return true
+			}
+			for _, m := range areaCells(g.formulaRows[p.worksheetID], p.area) {
+				if !visited[m] {
+					visited[m] = true
+					queue = append(queue, m)
+				}
+			}
+		}
+	}
+	return false
+}
+
+// goalSeekCells returns the constant cells with "non-round" values the formula cell depends on.
+// The paths through the formula cells with "round" values are skipped (they are the targets).
+func (g *cellGraph) goalSeekCells(n cellNode) (cells []cellNode) {
+	visited := map[cellNode]bool{n: true}
+	for queue := []cellNode{n}; len(queue) > 0; queue = queue[1:] {
+		for _, p := range g.precedents[queue[0]] {
+			for _, m := range areaCells(g.valueRows[p.worksheetID], p.area) {
+				if !visited[m] && isGoalSeekValue(g.values[m]) {
+					cells = append(cells, m)
+				}
+				visited[m] = true
+			}
+			for _, m := range areaCells(g.formulaRows[p.worksheetID], p.area) {
+				if _, ok := requestedValue(g.values[m]); !visited[m] && !ok {
+					queue = append(queue, m)
+				}
+				visited[m] = true
+			}
+		}
+	}
+	sortCells(cells)
+	return
+}
+
+// sortCells sorts the cells by the worksheets, the rows and the columns.
+func sortCells(cells []cellNode) {
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := cells[i], cells[j]
+		return a.worksheetID < b.worksheetID || a.worksheetID == b.worksheetID &&
+			(a.row < b.row || a.row == b.row && a.col < b.col)
+	})
+}
+
+// detectGoalSeek finds the Goal Seek results with the target cells on the worksheet.
+// In the model answer the Goal Seek result is a formula cell with a "round" value that
+// depends on a constant cell with a "non-round" value. The answers get checked only for
+// the Goal Seek results of the model answer worksheet (by the sheet index): the target cell
+// value should match the model answer target value and the target cell should depend on
+// the changing cell.
+func (ws *Worksheet) detectGoalSeek(file *excelize.File, sheet *x.Worksheet, sharedStrings SharedStrings) {
+	if !ws.AnswerID.Valid || ws.Idx == 0 || DryRun {
+		return
+	}
+	g, err := ws.newCellGraph(file, sheet, sharedStrings)
+	if err != nil {
+		log.WithError(err).Errorf("Failed to load the cell dependencies of the worksheet %q", ws.Name)
+		return
+	}
+	var sa StudentAssignment
+	if err := Db.
+		Joins("JOIN StudentAnswers AS a ON a.StudentAssignmentID = StudentAssignments.StudentAssignmentID").
+		Where("a.StudentAnswerID = ?", ws.AnswerID.Int64).
+		First(&sa).Error; err != nil {
+		log.WithError(err).Errorf("Failed to retrieve the student assignment of the answer (ID: %d)", ws.AnswerID.Int64)
+		return
+	}
+
+	if sa.UserID == ModelAnswerUserID {
+		var targets []cellNode
+		for n := range g.isFormula {
+			if n.worksheetID == ws.ID {
+				targets = append(targets, n)
+			}
+		}
+		sortCells(targets)
+		for _, target := range targets {
+			targetValue, ok := requestedValue(g.values[target])
+			if !ok {
+				continue
+			}
+			for _, changing := range g.goalSeekCells(target) {
+				ws.addGoalSeek(g, target, targetValue, changing)
+			}
+		}
+		return
+	}
+
+	var expected []GoalSeek
+	if err := Db.
+		Select("GoalSeeks.*").
+		Joins("JOIN WorkSheets AS mws ON mws.id = GoalSeeks.worksheet_id").
+		Joins("JOIN StudentAnswers AS ma ON ma.StudentAnswerID = mws.StudentAnswerID").
+		Joins("JOIN StudentAssignments AS msa ON msa.StudentAssignmentID = ma.StudentAssignmentID").
+		Joins("JOIN StudentAnswers AS a ON a.QuestionID = ma.QuestionID").
+		Where("msa.UserID = ? AND a.StudentAnswerID = ? AND ma.StudentAnswerID <> a.StudentAnswerID",
+			ModelAnswerUserID, ws.AnswerID.Int64).
+		Where("mws.idx = ?", ws.Idx).
+		Order("GoalSeeks.id").
+		Find(&expected).Error; err != nil {
+		log.WithError(err).Errorf("Failed to retrieve the model answer Goal Seek results of the worksheet %q", ws.Name)
+		return
+	}
+	for _, mg := range expected {
+		target, ok := g.node(ws.ID, mg.TargetCell)
+		if !ok || !g.isFormula[target] {
+			continue
+		}
+		value, err := strconv.ParseFloat(g.values[target], 64)
+		if err != nil {
+			continue
+		}
+		if targetValue, err := strconv.ParseFloat(mg.TargetValue, 64); err != nil || math.Abs(value-targetValue) > GoalSeekTolerance {
+			continue
+		}
+		changing, ok := g.node(ws.ID, mg.ChangingCell)
+		if !ok || g.isFormula[changing] || !g.dependsOn(target, changing) {
+			continue
+		}
+		ws.addGoalSeek(g, target, mg.TargetValue, changing)
+	}
+}
+
+// addGoalSeek stores the detected Goal Seek result with an auxiliary block.
+func (ws *Worksheet) addGoalSeek(g *cellGraph, target cellNode, targetValue string, changing cellNode) {
+	rec := GoalSeek{
+		WorksheetID:   ws.ID,
+		TargetCell:    CellAddress(target.row, target.col),
+		TargetValue:   targetValue,
+		ChangingCell:  CellAddress(changing.row, changing.col),
+		ChangingValue: g.values[changing],
+	}
+	if changing.worksheetID != ws.ID {
+		rec.ChangingCell = Reference{Sheet: g.sheetNames[changing.worksheetID]}.SheetPrefix() + rec.ChangingCell
+	}
+	if err := Db.Create(&rec).Error; err != nil {
+		log.WithError(err).Errorf("Failed to create the Goal Seek entry %#v", rec)
+		return
+	}
+	if VerboseLevel > 0 {
+		log.Infof("Detected Goal Seek in the worksheet %q: %s = %s by changing %s",
+			ws.Name, rec.TargetCell, rec.TargetValue, rec.ChangingCell)
+	}
+	ws.AddAuxBlock(&Block{
+		Range:   "GoalSeek",
+		Formula: joinStr(",", rec.TargetCell, rec.TargetValue, rec.ChangingCell),
+	}, "WhatIf")
+}
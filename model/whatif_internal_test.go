@@ -0,0 +1,47 @@
+package model
+
+import "testing"
+
+func TestGoalSeekValues(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"0.07123521869212139": true,
+		"-12.34567891":        true,
+		"0.05":                false,
+		"1000":                false,
+		"0":                   false,
+		"text":                false,
+	} {
+		if got := isGoalSeekValue(value); got != expected {
+			t.Errorf("Expected isGoalSeekValue(%q) to be %v", value, expected)
+		}
+	}
+	for value, expected := range map[string]string{
+		"100.00000000000001": "100",
+		"99.99995":           "100",
+		"-0.0004":            "0",
+		"12.25":              "12.25",
+		"12.2549":            "",
+		"#N/A":               "",
+	} {
+		got, ok := requestedValue(value)
+		if got != expected || ok != (expected != "") {
+			t.Errorf("Expected the requested value of %q to be %q, got: %q", value, expected, got)
+		}
+	}
+}
+
+func TestDataTableFormula(t *testing.T) {
+	for _, c := range []struct {
+		is2D, isRow bool
+		r1, r2      string
+		expected    string
+	}{
+		{false, false, "B3", "", "TABLE(,B3)"},
+		{false, true, "B3", "", "TABLE(B3,)"},
+		{true, true, "B2", "B1", "TABLE(B2,B1)"},
+	} {
+		if got, _, _ := dataTableFormula(c.is2D, c.isRow, c.r1, c.r2); got != c.expected {
+			t.Errorf("Expected %q, got: %q", c.expected, got)
+		}
+	}
+}
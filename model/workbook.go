@@ -0,0 +1,48 @@
+package model
+
+import (
+	"github.com/nad2000/excelize"
+	"github.com/nad2000/xlsx"
+)
+
+// openWorkbook opens the workbook with xlsx (the cells) and excelize (the raw parts)
+// and resolves the cell details the xlsx library leaves out, eg, the indexed fill colors,
+// the formula types or the structured references. The formula details get returned
+// along with the files (see originalFormula and arrayFormulas).
+func openWorkbook(fileName string) (file *xlsx.File, xf *excelize.File, formulas workbookFormulas, err error) {
+	if file, err = xlsx.OpenFile(fileName); err != nil {
+		return
+	}
+	if xf, err = excelize.OpenFile(fileName); err != nil {
+		return
+	}
+	formulas = make(workbookFormulas)
+	styleSheet := workbookStyleSheet(xf)
+	for _, sp := range workbookSheets(xf) {
+		sheet, ok := file.Sheet[sp.Name]
+		if !ok || sp.Type != "worksheet" {
+			continue
+		}
+		ws := UnmarshalWorksheet(xf.XLSX[sp.PartName])
+		resolveFillColors(sheet, newCellColors(xf, &styleSheet, &ws))
+		resolveFormulas(sheet, &ws, formulas)
+	}
+	resolveTableReferences(file, xf, formulas)
+	return
+}
+
+// resolveFillColors replaces the cell fill colors with the theme and the indexed colors
+// and the tint resolved into ARGB values, so the blocks get found by their fill color.
+func resolveFillColors(sheet *xlsx.Sheet, colors cellColors) {
+	for i, row := range sheet.Rows {
+		for j, cell := range row.Cells {
+			if cell == nil {
+				continue
+			}
+			color := colors.color(CellAddress(i, j), "cellColor")
+			if _, _, _, ok := rgb(color); ok {
+				cell.GetStyle().Fill.FgColor = color
+			}
+		}
+	}
+}
@@ -10,6 +10,8 @@ package model
 import (
 	"encoding/xml"
 	"extract-blocks/model/xlsx"
+	"path"
+	"regexp"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -25,33 +27,184 @@ func saveFileList(file *excelize.File, name string, content []byte) {
 	file.XLSX[name] = newContent
 }
 
-func deleteAllRelationshipsToName(file *excelize.File, name string) {
-	for _, n := range file.GetSheetMap() {
-		rels := "xl/worksheets/_rels/" + strings.TrimPrefix(n, "xl/worksheets/") + ".rels"
-		var sheetRels xlsxWorkbookRels
-		content, ok := file.XLSX[rels]
+// sheetPart - the sheet part (eg, xl/worksheets/sheet1.xml) resolved through the workbook relationships
+type sheetPart struct {
+	Name     string // the sheet name
+	PartName string // the sheet part name, eg, xl/worksheets/sheet1.xml
+	Type     string // the relationship type: worksheet, chartsheet, dialogsheet, ...
+}
+
+// relsPartName returns the name of the relationship part of the given part,
+// eg, xl/worksheets/sheet1.xml -> xl/worksheets/_rels/sheet1.xml.rels
+func relsPartName(partName string) string {
+	dir, base := path.Split(partName)
+	return dir + "_rels/" + base + ".rels"
+}
+
+// resolveTarget resolves the relationship target relative to the source part,
+// eg, ../drawings/drawing1.xml of xl/worksheets/sheet1.xml -> xl/drawings/drawing1.xml
+func resolveTarget(sourcePartName, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join(path.Dir(sourcePartName), target)
+}
+
+// partRelationships returns the relationships of the part with the internal targets
+// resolved to the part names.
+func partRelationships(file *excelize.File, partName string) (rels []xlsxRelationship) {
+	for _, r := range unmarshalRelationships(file.XLSX[relsPartName(partName)]).Relationships {
+		if r.TargetMode != "External" {
+			r.Target = resolveTarget(partName, r.Target)
+		}
+		rels = append(rels, r)
+	}
+	return
+}
+
+// relationshipType returns the short relationship type, eg, worksheet, drawing, chart...
+func relationshipType(r xlsxRelationship) string {
+	return path.Base(r.Type)
+}
+
+// workbookSheets returns the sheet parts in the workbook order mapped through
+// the sheet relationship IDs (r:id) of the workbook.
+func workbookSheets(file *excelize.File) (sheets []sheetPart) {
+	const workbookPartName = "xl/workbook.xml"
+	rels := make(map[string]xlsxRelationship)
+	for _, r := range partRelationships(file, workbookPartName) {
+		rels[r.ID] = r
+	}
+	for _, s := range UnmarshalWorkbook(file.XLSX[workbookPartName]).Sheets.Sheet {
+		r, ok := rels[s.ID]
 		if !ok {
+			log.Warnf("The part of the sheet %q (r:id=%q) is missing", s.Name, s.ID)
 			continue
 		}
-		_ = xml.Unmarshal(content, &sheetRels)
-		for k, v := range sheetRels.Relationships {
-			if strings.Contains(v.Target, name) {
-				sheetRels.Relationships = append(sheetRels.Relationships[:k], sheetRels.Relationships[k+1:]...)
+		sheets = append(sheets, sheetPart{Name: s.Name, PartName: r.Target, Type: relationshipType(r)})
+	}
+	return
+}
+
+// workbookPartName returns the name of the part of the workbook relationship type, eg, styles
+func workbookPartName(file *excelize.File, relType string) string {
+	for _, r := range partRelationships(file, "xl/workbook.xml") {
+		if relationshipType(r) == relType {
+			return r.Target
+		}
+	}
+	return ""
+}
+
+// workbookStyleSheet unmarshals the style sheet of the workbook (xl/styles.xml)
+func workbookStyleSheet(file *excelize.File) (ss xlsx.StyleSheet) {
+	if content, ok := file.XLSX[workbookPartName(file, "styles")]; ok {
+		if err := xml.Unmarshal(content, &ss); err != nil {
+			log.WithError(err).Errorln("Failed to load the style sheet")
+		}
+	}
+	return
+}
+
+// sheetValues returns the (cached) values of the worksheet cells (cell address -> value),
+// the logical values are mapped to TRUE and FALSE.
+func sheetValues(sheet *xlsx.Worksheet, sharedStrings SharedStrings) map[string]string {
+	values := make(map[string]string)
+	for _, row := range sheet.SheetData.Row {
+		for _, c := range row.C {
+			value := c.V
+			switch c.T {
+			case "s":
+				value = sharedStrings.Get(c.V)
+			case "inlineStr":
+				if c.Is != nil {
+					value = c.Is.T
+				}
+			case "b":
+				if c.V == "1" {
+					value = "TRUE"
+				} else {
+					value = "FALSE"
+				}
+			}
+			if c.R != "" && value != "" {
+				values[c.R] = value
+			}
+		}
+	}
+	return values
+}
+
+// sheetCellStyles returns the style (cellXfs) indexes of the worksheet cells (cell address -> index)
+func sheetCellStyles(sheet *xlsx.Worksheet) map[string]int {
+	styles := make(map[string]int)
+	for _, row := range sheet.SheetData.Row {
+		for _, c := range row.C {
+			if c.R != "" && c.S != "" {
+				styles[c.R] = atoi(c.S)
 			}
 		}
+	}
+	return styles
+}
+
+// sheetHiddenRows returns the hidden rows of the worksheet (the row numbers, eg, 1 - the first row).
+func sheetHiddenRows(sheet *xlsx.Worksheet) map[int]bool {
+	hidden := make(map[int]bool)
+	r := 0
+	for _, row := range sheet.SheetData.Row {
+		if row.R != "" {
+			r = atoi(row.R)
+		} else {
+			r++
+		}
+		if row.Hidden == "1" || row.Hidden == "true" {
+			hidden[r] = true
+		}
+	}
+	return hidden
+}
+
+// legacyDrawingRegexp matches the reference to the VML drawing of the comments in the sheet XML
+var legacyDrawingRegexp = regexp.MustCompile(`<legacyDrawing\b[^>]*/>`)
+
+// deleteSheetRelationships deletes the relationships of the given types (eg, comments)
+// and the parts they target from the sheet relationship part.
+func deleteSheetRelationships(file *excelize.File, sp sheetPart, types ...string) (wasRemoved bool) {
+	rels := relsPartName(sp.PartName)
+	var sheetRels xlsxWorkbookRels
+	content, ok := file.XLSX[rels]
+	if !ok {
+		return
+	}
+	_ = xml.Unmarshal(content, &sheetRels)
+	toDelete := make(map[string]bool, len(types))
+	for _, t := range types {
+		toDelete[t] = true
+	}
+	relationships := sheetRels.Relationships[:0]
+	for _, v := range sheetRels.Relationships {
+		if v.TargetMode != "External" && toDelete[path.Base(v.Type)] {
+			delete(file.XLSX, resolveTarget(sp.PartName, v.Target))
+			wasRemoved = true
+			continue
+		}
+		relationships = append(relationships, v)
+	}
+	if wasRemoved {
+		sheetRels.Relationships = relationships
 		output, _ := xml.Marshal(sheetRels)
 		saveFileList(file, rels, output)
 	}
+	return
 }
 
 // DeleteAllComments deletes all the comments in the workbook
 func DeleteAllComments(file *excelize.File) (wasRemoved bool) {
-	for name := range file.XLSX {
-		if strings.HasPrefix(name, "xl/comment") {
-			delete(file.XLSX, name)
-			id := strings.TrimPrefix(strings.TrimSuffix(name, ".xml"), "xl/comment")
-			vmlName := "xl/drawings/vmlDrawing" + id + ".vml"
-			deleteAllRelationshipsToName(file, vmlName)
+	for _, sp := range workbookSheets(file) {
+		if deleteSheetRelationships(file, sp, "comments", "vmlDrawing") {
+			// drop the dangling reference to the removed VML drawing
+			file.XLSX[sp.PartName] = legacyDrawingRegexp.ReplaceAll(file.XLSX[sp.PartName], nil)
 			wasRemoved = true
 		}
 	}
@@ -96,6 +249,66 @@ type xlsxAnyChart struct {
 	// XML     string `xml:",innerxml"`
 }
 
+// xlsxChartSpace - the chart part with all the chart groups (combo charts) and series
+type xlsxChartSpace struct {
+	XMLName     xml.Name `xml:"http://schemas.openxmlformats.org/drawingml/2006/chart chartSpace"`
+	PivotSource string   `xml:"pivotSource>name"` // [Book1.xlsx]Sheet2!PivotTable1
+	Legend      *struct {
+		Position *xlsxAnyWithStringValAttribute `xml:"legendPos"`
+	} `xml:"chart>legend"`
+	PlotArea struct {
+		Groups []xlsxChartGroup `xml:",any"` // barChart, lineChart... and the axes
+	} `xml:"chart>plotArea"`
+}
+
+// xlsxChartGroup - the chart of a single type within the plot area, eg, c:barChart
+type xlsxChartGroup struct {
+	XMLName    xml.Name
+	BarDir     xlsxAnyWithStringValAttribute   `xml:"barDir"`
+	Series     []xlsxChartSeries               `xml:"ser"`
+	DataLabels *xlsxDataLabels                 `xml:"dLbls"`
+	AxisIDs    []xlsxAnyWithStringValAttribute `xml:"axId"`
+}
+
+type xlsxChartSeries struct {
+	Idx              xlsxAnyWithIntValAttribute `xml:"idx"`
+	Order            xlsxAnyWithIntValAttribute `xml:"order"`
+	NameRef          string                     `xml:"tx>strRef>f"`
+	NameCache        string                     `xml:"tx>strRef>strCache>pt>v"`
+	Name             string                     `xml:"tx>v"`
+	CategoryStrRef   string                     `xml:"cat>strRef>f"`
+	CategoryNumRef   string                     `xml:"cat>numRef>f"`
+	CategoryMultiRef string                     `xml:"cat>multiLvlStrRef>f"`
+	ValueRef         string                     `xml:"val>numRef>f"`
+	XStrRef          string                     `xml:"xVal>strRef>f"`
+	XNumRef          string                     `xml:"xVal>numRef>f"`
+	YRef             string                     `xml:"yVal>numRef>f"`
+	Trendlines       []xlsxTrendline            `xml:"trendline"`
+	DataLabels       *xlsxDataLabels            `xml:"dLbls"`
+}
+
+type xlsxTrendline struct {
+	Name      string                         `xml:"name"`
+	Type      xlsxAnyWithStringValAttribute  `xml:"trendlineType"` // linear, exp, log, movingAvg, poly, power
+	Order     *xlsxAnyWithStringValAttribute `xml:"order"`
+	Period    *xlsxAnyWithStringValAttribute `xml:"period"`
+	Forward   *xlsxAnyWithStringValAttribute `xml:"forward"`
+	Backward  *xlsxAnyWithStringValAttribute `xml:"backward"`
+	Intercept *xlsxAnyWithStringValAttribute `xml:"intercept"`
+	DispRSqr  *xlsxAnyWithStringValAttribute `xml:"dispRSqr"`
+	DispEq    *xlsxAnyWithStringValAttribute `xml:"dispEq"`
+}
+
+type xlsxDataLabels struct {
+	Delete         *xlsxAnyWithStringValAttribute `xml:"delete"`
+	ShowLegendKey  *xlsxAnyWithStringValAttribute `xml:"showLegendKey"`
+	ShowVal        *xlsxAnyWithStringValAttribute `xml:"showVal"`
+	ShowCatName    *xlsxAnyWithStringValAttribute `xml:"showCatName"`
+	ShowSerName    *xlsxAnyWithStringValAttribute `xml:"showSerName"`
+	ShowPercent    *xlsxAnyWithStringValAttribute `xml:"showPercent"`
+	ShowBubbleSize *xlsxAnyWithStringValAttribute `xml:"showBubbleSize"`
+}
+
 type anyHolder struct {
 	// XMLName Name
 	// XML string `xml:",innerxml"`
@@ -161,11 +374,7 @@ func (c *XlsxBareChart) ItemCount() int {
 
 // Type - chart type - short-cut
 func (c *XlsxBareChart) Type() string {
-	fromElementName := strings.Title(strings.TrimSuffix(c.PlotArea.Chart.XMLName.Local, "Chart"))
-	if fromElementName == "Bar" && c.PlotArea.Chart.BarDir.Value == "col" {
-		return "Column"
-	}
-	return fromElementName
+	return chartTypeName(c.PlotArea.Chart.XMLName.Local, c.PlotArea.Chart.BarDir.Value)
 }
 
 // XLabel - X-axis title
@@ -248,6 +457,12 @@ func UnmarshalChart(fileContent []byte) (content XlsxBareChart) {
 	return
 }
 
+// unmarshalChartSpace unmarshals the chart groups and the series of the chart
+func unmarshalChartSpace(fileContent []byte) (content xlsxChartSpace) {
+	xml.Unmarshal(fileContent, &content)
+	return
+}
+
 // UnmarshalWorksheet unmarshals a worksheets autofilter
 func UnmarshalWorksheet(fileContent []byte) (content xlsx.Worksheet) {
 	err := xml.Unmarshal(fileContent, &content)
@@ -258,6 +473,26 @@ func UnmarshalWorksheet(fileContent []byte) (content xlsx.Worksheet) {
 	return
 }
 
+// UnmarshalWorkbook unmarshals the workbook part (xl/workbook.xml)
+func UnmarshalWorkbook(fileContent []byte) (content xlsx.Workbook) {
+	err := xml.Unmarshal(fileContent, &content)
+	if err != nil {
+		log.Errorf("ERROR: %#v", err)
+		log.Info(string(fileContent))
+	}
+	return
+}
+
+// UnmarshalTable unmarshals the table (ListObject) part
+func UnmarshalTable(fileContent []byte) (content xlsx.Table) {
+	err := xml.Unmarshal(fileContent, &content)
+	if err != nil {
+		log.Errorf("ERROR: %#v", err)
+		log.Info(string(fileContent))
+	}
+	return
+}
+
 // UnmarshalPivotCacheDefinition unmarshals a worksheets autofilter
 func UnmarshalPivotCacheDefinition(fileContent []byte) (content xlsx.PivotCacheDefinition) {
 	err := xml.Unmarshal(fileContent, &content)
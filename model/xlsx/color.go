@@ -0,0 +1,32 @@
+package xlsx
+
+import "strings"
+
+// Color - the color of a font, a fill or a border given with ARGB value,
+// the theme color (optionally with the tint) or the indexed color.
+type Color struct {
+	Auto    string `xml:"auto,attr"`
+	Rgb     string `xml:"rgb,attr"`
+	Theme   string `xml:"theme,attr"`
+	Indexed string `xml:"indexed,attr"`
+	Tint    string `xml:"tint,attr"`
+}
+
+// String returns the color value: ARGB (eg, FFFFC7CE), theme:N (theme:N:tint), indexed:N or auto.
+func (c *Color) String() string {
+	switch {
+	case c == nil:
+		return ""
+	case c.Rgb != "":
+		return strings.ToUpper(c.Rgb)
+	case c.Theme != "" && c.Tint != "" && c.Tint != "0":
+		return "theme:" + c.Theme + ":" + c.Tint
+	case c.Theme != "":
+		return "theme:" + c.Theme
+	case c.Indexed != "":
+		return "indexed:" + c.Indexed
+	case c.Auto == "1" || c.Auto == "true":
+		return "auto"
+	}
+	return ""
+}
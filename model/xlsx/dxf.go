@@ -0,0 +1,66 @@
+package xlsx
+
+// BoolProperty - a boolean element, eg, <b/> or <b val="0"/>
+type BoolProperty struct {
+	Val string `xml:"val,attr"`
+}
+
+// IsOn tests if the property is present and is not switched off.
+func (p *BoolProperty) IsOn() bool {
+	return p != nil && (p.Val == "" || p.Val == "1" || p.Val == "true")
+}
+
+// BorderPr - the border side properties
+type BorderPr struct {
+	Style string `xml:"style,attr"`
+	Color *Color `xml:"color"`
+}
+
+// Dxf - the differential formatting applied by a conditional formatting rule
+type Dxf struct {
+	Font *struct {
+		B         *BoolProperty `xml:"b"`
+		I         *BoolProperty `xml:"i"`
+		Strike    *BoolProperty `xml:"strike"`
+		Underline *struct {
+			Val string `xml:"val,attr"` // single (default), double, ..., none
+		} `xml:"u"`
+		Color *Color `xml:"color"`
+	} `xml:"font"`
+	NumFmt *struct {
+		NumFmtId   string `xml:"numFmtId,attr"`
+		FormatCode string `xml:"formatCode,attr"`
+	} `xml:"numFmt"`
+	Fill *struct {
+		PatternFill struct {
+			PatternType string `xml:"patternType,attr"`
+			FgColor     *Color `xml:"fgColor"`
+			BgColor     *Color `xml:"bgColor"`
+		} `xml:"patternFill"`
+	} `xml:"fill"`
+	Border *struct {
+		Left   *BorderPr `xml:"left"`
+		Right  *BorderPr `xml:"right"`
+		Top    *BorderPr `xml:"top"`
+		Bottom *BorderPr `xml:"bottom"`
+	} `xml:"border"`
+}
+
+// Cfvo - the conditional formatting value object, ie, a threshold of a color scale,
+// a data bar or an icon set
+type Cfvo struct {
+	Type string `xml:"type,attr"` // num, percent, max, min, formula, percentile
+	Val  string `xml:"val,attr"`
+	Gte  string `xml:"gte,attr"` // default: true (greater than or equal)
+}
+
+// String returns the threshold, eg, min, percentile:50 or percent:>33 (if the value is excluded)
+func (c Cfvo) String() string {
+	if c.Val == "" {
+		return c.Type
+	}
+	if c.Gte == "0" || c.Gte == "false" {
+		return c.Type + ":>" + c.Val
+	}
+	return c.Type + ":" + c.Val
+}
@@ -0,0 +1,51 @@
+package xlsx
+
+// FilterColumn - the filter criteria of the column of the autofilter range
+// (colId - the offset of the column in the range)
+type FilterColumn struct {
+	Text          string `xml:",chardata"`
+	ColId         string `xml:"colId,attr"`
+	CustomFilters struct {
+		Text         string `xml:",chardata"`
+		And          string `xml:"and,attr"`
+		CustomFilter []struct {
+			Text     string `xml:",chardata"`
+			Val      string `xml:"val,attr"`
+			Operator string `xml:"operator,attr"`
+		} `xml:"customFilter"`
+	} `xml:"customFilters"`
+	Filters struct {
+		Text   string `xml:",chardata"`
+		Blank  string `xml:"blank,attr"` // the blank cells are kept
+		Filter []struct {
+			Text string `xml:",chardata"`
+			Val  string `xml:"val,attr"`
+		} `xml:"filter"`
+		DateGroupItem []struct {
+			Text             string `xml:",chardata"`
+			Year             string `xml:"year,attr"`
+			DateTimeGrouping string `xml:"dateTimeGrouping,attr"`
+			Month            string `xml:"month,attr"`
+			Day              string `xml:"day,attr"`
+			Hour             string `xml:"hour,attr"`
+			Minute           string `xml:"minute,attr"`
+			Second           string `xml:"second,attr"`
+		} `xml:"dateGroupItem"`
+	} `xml:"filters"`
+	Top10 struct {
+		Text      string `xml:",chardata"`
+		Val       string `xml:"val,attr"`
+		FilterVal string `xml:"filterVal,attr"` // the value of the cut-off
+		Top       string `xml:"top,attr"`
+		Percent   string `xml:"percent,attr"`
+	} `xml:"top10"`
+	DynamicFilter struct {
+		Text string `xml:",chardata"`
+		Type string `xml:"type,attr"`
+		Val  string `xml:"val,attr"`
+	} `xml:"dynamicFilter"`
+	ColorFilter struct {
+		Text  string `xml:",chardata"`
+		DxfId string `xml:"dxfId,attr"`
+	} `xml:"colorFilter"`
+}
@@ -19,16 +19,19 @@ type PivotCacheDefinition struct {
 			Text  string `xml:",chardata"`
 			Ref   string `xml:"ref,attr"`
 			Sheet string `xml:"sheet,attr"`
+			Name  string `xml:"name,attr"` // the defined name or the table used as the source
 		} `xml:"worksheetSource"`
 	} `xml:"cacheSource"`
 	CacheFields struct {
 		Text       string `xml:",chardata"`
 		Count      string `xml:"count,attr"`
 		CacheField []struct {
-			Text        string `xml:",chardata"`
-			Name        string `xml:"name,attr"`
-			NumFmtId    string `xml:"numFmtId,attr"`
-			SharedItems struct {
+			Text          string `xml:",chardata"`
+			Name          string `xml:"name,attr"`
+			NumFmtId      string `xml:"numFmtId,attr"`
+			Formula       string `xml:"formula,attr"`       // the formula of the calculated field
+			DatabaseField string `xml:"databaseField,attr"` // "0" for the calculated fields
+			SharedItems   struct {
 				Text                   string `xml:",chardata"`
 				ContainsSemiMixedTypes string `xml:"containsSemiMixedTypes,attr"`
 				ContainsNonDate        string `xml:"containsNonDate,attr"`
@@ -41,17 +44,30 @@ type PivotCacheDefinition struct {
 				ContainsInteger        string `xml:"containsInteger,attr"`
 				MinValue               string `xml:"minValue,attr"`
 				MaxValue               string `xml:"maxValue,attr"`
-				D                      []struct {
-					Text string `xml:",chardata"`
-					V    string `xml:"v,attr"`
-				} `xml:"d"`
-				S []struct {
-					Text string `xml:",chardata"`
-					V    string `xml:"v,attr"`
-				} `xml:"s"`
+				// the items in the order of their indexes: s, n, d, b, e or m (missing)
+				Item []struct {
+					XMLName xml.Name
+					V       string `xml:"v,attr"`
+				} `xml:",any"`
 			} `xml:"sharedItems"`
 		} `xml:"cacheField"`
 	} `xml:"cacheFields"`
+	CalculatedItems struct {
+		Text           string `xml:",chardata"`
+		Count          string `xml:"count,attr"`
+		CalculatedItem []struct {
+			Text      string `xml:",chardata"`
+			Field     string `xml:"field,attr"`
+			Formula   string `xml:"formula,attr"`
+			PivotArea struct {
+				Text       string `xml:",chardata"`
+				References struct {
+					Text      string `xml:",chardata"`
+					Reference []PivotAreaReference `xml:"reference"`
+				} `xml:"references"`
+			} `xml:"pivotArea"`
+		} `xml:"calculatedItem"`
+	} `xml:"calculatedItems"`
 	ExtLst struct {
 		Text string `xml:",chardata"`
 		Ext  struct {
@@ -65,3 +81,13 @@ type PivotCacheDefinition struct {
 	} `xml:"extLst"`
 } 
 
+// PivotAreaReference - the items (the shared item indexes) of the field
+// referenced by the pivot area, eg, of the calculated item
+type PivotAreaReference struct {
+	Text  string `xml:",chardata"`
+	Field string `xml:"field,attr"`
+	X     []struct {
+		Text string `xml:",chardata"`
+		V    string `xml:"v,attr"`
+	} `xml:"x"`
+}
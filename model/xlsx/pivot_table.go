@@ -22,6 +22,10 @@ type PivotTableDefinition struct {
 	Outline                 string   `xml:"outline,attr"`
 	OutlineData             string   `xml:"outlineData,attr"`
 	MultipleFieldFilters    string   `xml:"multipleFieldFilters,attr"`
+	Compact                 string   `xml:"compact,attr"`        // default: true
+	CompactData             string   `xml:"compactData,attr"`    // default: true
+	RowGrandTotals          string   `xml:"rowGrandTotals,attr"` // default: true
+	ColGrandTotals          string   `xml:"colGrandTotals,attr"` // default: true
 	Location                struct {
 		Text           string `xml:",chardata"`
 		Ref            string `xml:"ref,attr"`
@@ -35,18 +39,24 @@ type PivotTableDefinition struct {
 		Text       string `xml:",chardata"`
 		Count      string `xml:"count,attr"`
 		PivotField []struct {
-			Text      string `xml:",chardata"`
-			Axis      string `xml:"axis,attr"`
-			NumFmtId  string `xml:"numFmtId,attr"`
-			ShowAll   string `xml:"showAll,attr"`
-			DataField string `xml:"dataField,attr"`
-			Items     struct {
+			Text                         string `xml:",chardata"`
+			Name                         string `xml:"name,attr"`
+			Axis                         string `xml:"axis,attr"`
+			NumFmtId                     string `xml:"numFmtId,attr"`
+			ShowAll                      string `xml:"showAll,attr"`
+			DataField                    string `xml:"dataField,attr"`
+			Compact                      string `xml:"compact,attr"` // default: true
+			Outline                      string `xml:"outline,attr"` // default: true
+			MultipleItemSelectionAllowed string `xml:"multipleItemSelectionAllowed,attr"`
+			Items                        struct {
 				Text  string `xml:",chardata"`
 				Count string `xml:"count,attr"`
 				Item  []struct {
 					Text string `xml:",chardata"`
 					X    string `xml:"x,attr"`
 					T    string `xml:"t,attr"`
+					H    string `xml:"h,attr"` // hidden
+					N    string `xml:"n,attr"` // custom name
 				} `xml:"item"`
 			} `xml:"items"`
 		} `xml:"pivotField"`
@@ -54,10 +64,7 @@ type PivotTableDefinition struct {
 	RowFields struct {
 		Text  string `xml:",chardata"`
 		Count string `xml:"count,attr"`
-		Field []struct {
-			Text string `xml:",chardata"`
-			X    string `xml:"x,attr"`
-		} `xml:"field"`
+		Field []PivotFieldRef `xml:"field"`
 	} `xml:"rowFields"`
 	RowItems struct {
 		Text  string `xml:",chardata"`
@@ -75,10 +82,7 @@ type PivotTableDefinition struct {
 	ColFields struct {
 		Text  string `xml:",chardata"`
 		Count string `xml:"count,attr"`
-		Field []struct {
-			Text string `xml:",chardata"`
-			X    string `xml:"x,attr"`
-		} `xml:"field"`
+		Field []PivotFieldRef `xml:"field"`
 	} `xml:"colFields"`
 	ColItems struct {
 		Text  string `xml:",chardata"`
@@ -100,19 +104,23 @@ type PivotTableDefinition struct {
 		PageField []struct {
 			Text string `xml:",chardata"`
 			Fld  string `xml:"fld,attr"`
+			Item string `xml:"item,attr"` // the selected item
 			Hier string `xml:"hier,attr"`
+			Name string `xml:"name,attr"`
 		} `xml:"pageField"`
 	} `xml:"pageFields"`
 	DataFields struct {
 		Text      string `xml:",chardata"`
 		Count     string `xml:"count,attr"`
 		DataField []struct {
-			Text      string `xml:",chardata"`
-			Name      string `xml:"name,attr"`
-			Fld       string `xml:"fld,attr"`
-			BaseField string `xml:"baseField,attr"`
-			BaseItem  string `xml:"baseItem,attr"`
-			Subtotal  string `xml:"subtotal,attr"`
+			Text       string `xml:",chardata"`
+			Name       string `xml:"name,attr"`
+			Fld        string `xml:"fld,attr"`
+			BaseField  string `xml:"baseField,attr"`
+			BaseItem   string `xml:"baseItem,attr"`
+			Subtotal   string `xml:"subtotal,attr"`
+			ShowDataAs string `xml:"showDataAs,attr"`
+			NumFmtId   string `xml:"numFmtId,attr"`
 		} `xml:"dataField"`
 	} `xml:"dataFields"`
 	PivotTableStyleInfo struct {
@@ -124,6 +132,22 @@ type PivotTableDefinition struct {
 		ShowColStripes string `xml:"showColStripes,attr"`
 		ShowLastColumn string `xml:"showLastColumn,attr"`
 	} `xml:"pivotTableStyleInfo"`
+	Filters struct {
+		Text   string `xml:",chardata"`
+		Count  string `xml:"count,attr"`
+		Filter []struct {
+			Text         string `xml:",chardata"`
+			Fld          string `xml:"fld,attr"`
+			Type         string `xml:"type,attr"` // captionEqual, valueGreaterThan, count, ...
+			IMeasureFld  string `xml:"iMeasureFld,attr"`
+			StringValue1 string `xml:"stringValue1,attr"`
+			StringValue2 string `xml:"stringValue2,attr"`
+			EvalOrder    string `xml:"evalOrder,attr"`
+			ID           string `xml:"id,attr"`
+			Name         string `xml:"name,attr"`
+			Description  string `xml:"description,attr"`
+		} `xml:"filter"`
+	} `xml:"filters"`
 	ExtLst struct {
 		Text string `xml:",chardata"`
 		Ext  struct {
@@ -139,3 +163,9 @@ type PivotTableDefinition struct {
 	} `xml:"extLst"`
 } 
 
+// PivotFieldRef - the reference (the index) of the pivot field placed
+// on the rows or the columns, -2 stands for the values
+type PivotFieldRef struct {
+	Text string `xml:",chardata"`
+	X    string `xml:"x,attr"`
+}
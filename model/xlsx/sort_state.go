@@ -0,0 +1,20 @@
+package xlsx
+
+// SortState - the sort levels (conditions) of the range
+type SortState struct {
+	Text          string `xml:",chardata"`
+	Ref           string `xml:"ref,attr"`
+	ColumnSort    string `xml:"columnSort,attr"`    // sort left to right
+	CaseSensitive string `xml:"caseSensitive,attr"` // default: false
+	SortMethod    string `xml:"sortMethod,attr"`    // pinYin or stroke
+	SortCondition []struct {
+		Text       string `xml:",chardata"`
+		SortBy     string `xml:"sortBy,attr"` // value (default), cellColor, fontColor or icon
+		Ref        string `xml:"ref,attr"`
+		DxfId      string `xml:"dxfId,attr"` // the color of sortBy cellColor or fontColor
+		Descending string `xml:"descending,attr"`
+		CustomList string `xml:"customList,attr"`
+		IconSet    string `xml:"iconSet,attr"`
+		IconId     string `xml:"iconId,attr"`
+	} `xml:"sortCondition"`
+}
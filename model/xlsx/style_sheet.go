@@ -34,14 +34,13 @@ type StyleSheet struct {
 				Text string `xml:",chardata"`
 				Val  string `xml:"val,attr"`
 			} `xml:"charset"`
-			B struct {
-				Text string `xml:",chardata"`
-				Val  string `xml:"val,attr"`
-			} `xml:"b"`
-			Color struct {
-				Text string `xml:",chardata"`
-				Rgb  string `xml:"rgb,attr"`
-			} `xml:"color"`
+			B         *BoolProperty `xml:"b"`
+			I         *BoolProperty `xml:"i"`
+			Strike    *BoolProperty `xml:"strike"`
+			Underline *struct {
+				Val string `xml:"val,attr"` // single (default), double, ..., none
+			} `xml:"u"`
+			Color *Color `xml:"color"`
 		} `xml:"font"`
 	} `xml:"fonts"`
 	Fills struct {
@@ -52,6 +51,8 @@ type StyleSheet struct {
 			PatternFill struct {
 				Text        string `xml:",chardata"`
 				PatternType string `xml:"patternType,attr"`
+				FgColor     *Color `xml:"fgColor"`
+				BgColor     *Color `xml:"bgColor"`
 			} `xml:"patternFill"`
 		} `xml:"fill"`
 	} `xml:"fills"`
@@ -158,6 +159,11 @@ type StyleSheet struct {
 			CustomBuiltin string `xml:"customBuiltin,attr"`
 		} `xml:"cellStyle"`
 	} `xml:"cellStyles"`
+	Dxfs struct {
+		Text  string `xml:",chardata"`
+		Count string `xml:"count,attr"`
+		Dxf   []Dxf  `xml:"dxf"`
+	} `xml:"dxfs"`
 	Colors struct {
 		Text          string `xml:",chardata"`
 		IndexedColors struct {
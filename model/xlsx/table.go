@@ -0,0 +1,42 @@
+package xlsx
+
+import "encoding/xml"
+
+// Table - the table (ListObject) part, eg, xl/tables/table1.xml
+type Table struct {
+	XMLName        xml.Name `xml:"table"`
+	Text           string   `xml:",chardata"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	ID             string   `xml:"id,attr"`
+	Name           string   `xml:"name,attr"`
+	DisplayName    string   `xml:"displayName,attr"`
+	Ref            string   `xml:"ref,attr"`
+	HeaderRowCount string   `xml:"headerRowCount,attr"` // 1 (default) or 0
+	TotalsRowCount string   `xml:"totalsRowCount,attr"`
+	TotalsRowShown string   `xml:"totalsRowShown,attr"`
+	AutoFilter     *struct {
+		Text string `xml:",chardata"`
+		Ref  string `xml:"ref,attr"`
+	} `xml:"autoFilter"`
+	TableColumns struct {
+		Text        string `xml:",chardata"`
+		Count       string `xml:"count,attr"`
+		TableColumn []struct {
+			Text                    string `xml:",chardata"`
+			ID                      string `xml:"id,attr"`
+			Name                    string `xml:"name,attr"`
+			TotalsRowFunction       string `xml:"totalsRowFunction,attr"`
+			TotalsRowLabel          string `xml:"totalsRowLabel,attr"`
+			CalculatedColumnFormula string `xml:"calculatedColumnFormula"` // [@Qty]*[@Price]
+			TotalsRowFormula        string `xml:"totalsRowFormula"`
+		} `xml:"tableColumn"`
+	} `xml:"tableColumns"`
+	TableStyleInfo struct {
+		Text              string `xml:",chardata"`
+		Name              string `xml:"name,attr"` // TableStyleMedium2
+		ShowFirstColumn   string `xml:"showFirstColumn,attr"`
+		ShowLastColumn    string `xml:"showLastColumn,attr"`
+		ShowRowStripes    string `xml:"showRowStripes,attr"`
+		ShowColumnStripes string `xml:"showColumnStripes,attr"`
+	} `xml:"tableStyleInfo"`
+}
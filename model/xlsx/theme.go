@@ -0,0 +1,44 @@
+package xlsx
+
+import "encoding/xml"
+
+// Theme - the workbook theme (xl/theme/theme1.xml), only the color scheme
+type Theme struct {
+	XMLName   xml.Name `xml:"theme"`
+	ClrScheme struct {
+		Name  string `xml:"name,attr"`
+		Color []struct {
+			XMLName xml.Name // dk1, lt1, dk2, lt2, accent1..6, hlink or folHlink
+			SysClr  *struct {
+				Val     string `xml:"val,attr"`
+				LastClr string `xml:"lastClr,attr"` // RGB, eg, 000000
+			} `xml:"sysClr"`
+			SrgbClr *struct {
+				Val string `xml:"val,attr"` // RGB, eg, 1F497D
+			} `xml:"srgbClr"`
+		} `xml:",any"`
+	} `xml:"themeElements>clrScheme"`
+}
+
+// themeColorNames - the theme color scheme elements in the order of the theme color indexes
+var themeColorNames = []string{"lt1", "dk1", "lt2", "dk2", "accent1", "accent2",
+	"accent3", "accent4", "accent5", "accent6", "hlink", "folHlink"}
+
+// Colors returns the RGB values of the color scheme by the theme color indexes
+// (NB! the light and the dark colors are swapped), eg, FFFFFF, 000000, EEECE1...
+func (t *Theme) Colors() []string {
+	scheme := make(map[string]string)
+	for _, c := range t.ClrScheme.Color {
+		switch {
+		case c.SysClr != nil:
+			scheme[c.XMLName.Local] = c.SysClr.LastClr
+		case c.SrgbClr != nil:
+			scheme[c.XMLName.Local] = c.SrgbClr.Val
+		}
+	}
+	colors := make([]string, len(themeColorNames))
+	for i, name := range themeColorNames {
+		colors[i] = scheme[name]
+	}
+	return colors
+}
@@ -28,10 +28,11 @@ type Workbook struct {
 	} `xml:"bookViews"`
 	Sheets struct {
 		Text  string `xml:",chardata"`
-		Sheet struct {
+		Sheet []struct {
 			Text    string `xml:",chardata"`
 			Name    string `xml:"name,attr"`
 			SheetId string `xml:"sheetId,attr"`
+			State   string `xml:"state,attr"`
 			ID      string `xml:"id,attr"`
 		} `xml:"sheet"`
 	} `xml:"sheets"`
@@ -45,8 +46,13 @@ type Workbook struct {
 		} `xml:"definedName"`
 	} `xml:"definedNames"`
 	CalcPr struct {
-		Text   string `xml:",chardata"`
-		CalcId string `xml:"calcId,attr"`
+		Text           string `xml:",chardata"`
+		CalcId         string `xml:"calcId,attr"`
+		CalcMode       string `xml:"calcMode,attr"` // auto (default), manual, autoNoTable
+		FullCalcOnLoad string `xml:"fullCalcOnLoad,attr"`
+		Iterate        string `xml:"iterate,attr"` // iterative calculation: 1, true
+		IterateCount   string `xml:"iterateCount,attr"`
+		IterateDelta   string `xml:"iterateDelta,attr"`
 	} `xml:"calcPr"`
 } 
 
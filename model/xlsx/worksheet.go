@@ -1,76 +1,19 @@
 package xlsx; import "encoding/xml"
 // Worksheet was generated 2019-04-06 22:26:52 by rcir178 on rcir178-Latitude-E7470.
 type Worksheet struct {
-	XMLName   xml.Name `xml:"worksheet"`
-	Text      string   `xml:",chardata"`
-	Xmlns     string   `xml:"xmlns,attr"`
-	R         string   `xml:"r,attr"`
-	Mc        string   `xml:"mc,attr"`
-	X14ac     string   `xml:"x14ac,attr"`
-	Ignorable string   `xml:"Ignorable,attr"`
-	SortState []struct {
-		Text          string `xml:",chardata"`
-		Ref           string `xml:"ref,attr"`
-		ColumnSort    string `xml:"columnSort,attr"`
-		SortCondition []struct {
-			Text       string `xml:",chardata"`
-			SortBy     string `xml:"sortBy,attr"`
-			Ref        string `xml:"ref,attr"`
-			DxfId      string `xml:"dxfId,attr"`
-			Descending string `xml:"descending,attr"`
-			CustomList string `xml:"customList,attr"`
-			IconSet    string `xml:"iconSet,attr"`
-			IconId     string `xml:"iconId,attr"`
-		} `xml:"sortCondition"`
-	} `xml:"sortState"`
+	XMLName    xml.Name    `xml:"worksheet"`
+	Text       string      `xml:",chardata"`
+	Xmlns      string      `xml:"xmlns,attr"`
+	R          string      `xml:"r,attr"`
+	Mc         string      `xml:"mc,attr"`
+	X14ac      string      `xml:"x14ac,attr"`
+	Ignorable  string      `xml:"Ignorable,attr"`
+	SortState  []SortState `xml:"sortState"`
 	AutoFilter []struct {
-		Text         string `xml:",chardata"`
-		Ref          string `xml:"ref,attr"`
-		FilterColumn []struct {
-			Text          string `xml:",chardata"`
-			ColId         string `xml:"colId,attr"`
-			CustomFilters struct {
-				Text         string `xml:",chardata"`
-				And          string `xml:"and,attr"`
-				CustomFilter []struct {
-					Text     string `xml:",chardata"`
-					Val      string `xml:"val,attr"`
-					Operator string `xml:"operator,attr"`
-				} `xml:"customFilter"`
-			} `xml:"customFilters"`
-			Filters struct {
-				Text   string `xml:",chardata"`
-				Filter []struct {
-					Text string `xml:",chardata"`
-					Val  string `xml:"val,attr"`
-				} `xml:"filter"`
-				DateGroupItem []struct {
-					Text             string `xml:",chardata"`
-					Year             string `xml:"year,attr"`
-					DateTimeGrouping string `xml:"dateTimeGrouping,attr"`
-					Month            string `xml:"month,attr"`
-					Day              string `xml:"day,attr"`
-					Hour             string `xml:"hour,attr"`
-					Minute           string `xml:"minute,attr"`
-					Second           string `xml:"second,attr"`
-				} `xml:"dateGroupItem"`
-			} `xml:"filters"`
-			Top10 struct {
-				Text      string `xml:",chardata"`
-				Val       string `xml:"val,attr"`
-				FilterVal string `xml:"filterVal,attr"`
-				Top       string `xml:"top,attr"`
-			} `xml:"top10"`
-			DynamicFilter struct {
-				Text string `xml:",chardata"`
-				Type string `xml:"type,attr"`
-				Val  string `xml:"val,attr"`
-			} `xml:"dynamicFilter"`
-			ColorFilter struct {
-				Text  string `xml:",chardata"`
-				DxfId string `xml:"dxfId,attr"`
-			} `xml:"colorFilter"`
-		} `xml:"filterColumn"`
+		Text         string         `xml:",chardata"`
+		Ref          string         `xml:"ref,attr"`
+		FilterColumn []FilterColumn `xml:"filterColumn"`
+		SortState    *SortState     `xml:"sortState"` // the sorting of the filtered range
 	} `xml:"autoFilter"`
 	ConditionalFormatting []struct {
 		Text   string `xml:",chardata"`
@@ -80,10 +23,13 @@ type Worksheet struct {
 			Type         string `xml:"type,attr"`
 			DxfId        string `xml:"dxfId,attr"`
 			Priority     string `xml:"priority,attr"`
+			StopIfTrue   string `xml:"stopIfTrue,attr"`
 			Operator     string `xml:"operator,attr"`
 			AttrText     string `xml:"text,attr"`
 			TimePeriod   string `xml:"timePeriod,attr"`
 			AboveAverage string `xml:"aboveAverage,attr"`
+			EqualAverage string `xml:"equalAverage,attr"`
+			StdDev       string `xml:"stdDev,attr"`
 			Percent      string `xml:"percent,attr"`
 			Bottom       string `xml:"bottom,attr"`
 			Rank         string `xml:"rank,attr"`
@@ -91,15 +37,10 @@ type Worksheet struct {
 				Text string `xml:",chardata"` // 10, 20, 10, 20, 84, 99, 3...
 			} `xml:"formula"`
 			DataBar struct {
-				Text string `xml:",chardata"`
-				Cfvo []struct {
-					Text string `xml:",chardata"`
-					Type string `xml:"type,attr"`
-				} `xml:"cfvo"`
-				Color struct {
-					Text string `xml:",chardata"`
-					Rgb  string `xml:"rgb,attr"`
-				} `xml:"color"`
+				Text      string `xml:",chardata"`
+				ShowValue string `xml:"showValue,attr"`
+				Cfvo      []Cfvo `xml:"cfvo"`
+				Color     Color  `xml:"color"`
 			} `xml:"dataBar"`
 			ExtLst struct {
 				Text string `xml:",chardata"`
@@ -113,28 +54,90 @@ type Worksheet struct {
 				} `xml:"ext"`
 			} `xml:"extLst"`
 			ColorScale struct {
-				Text string `xml:",chardata"`
-				Cfvo []struct {
-					Text string `xml:",chardata"`
-					Type string `xml:"type,attr"`
-					Val  string `xml:"val,attr"`
-				} `xml:"cfvo"`
-				Color []struct {
-					Text string `xml:",chardata"`
-					Rgb  string `xml:"rgb,attr"`
-				} `xml:"color"`
+				Text  string  `xml:",chardata"`
+				Cfvo  []Cfvo  `xml:"cfvo"`
+				Color []Color `xml:"color"`
 			} `xml:"colorScale"`
 			IconSet struct {
-				Text    string `xml:",chardata"`
-				IconSet string `xml:"iconSet,attr"`
-				Cfvo    []struct {
-					Text string `xml:",chardata"`
-					Type string `xml:"type,attr"`
-					Val  string `xml:"val,attr"`
-				} `xml:"cfvo"`
+				Text      string `xml:",chardata"`
+				IconSet   string `xml:"iconSet,attr"` // default: 3TrafficLights1
+				ShowValue string `xml:"showValue,attr"`
+				Reverse   string `xml:"reverse,attr"`
+				Cfvo      []Cfvo `xml:"cfvo"`
 			} `xml:"iconSet"`
 		} `xml:"cfRule"`
 	} `xml:"conditionalFormatting"`
+	DataValidations struct {
+		Text           string `xml:",chardata"`
+		Count          string `xml:"count,attr"`
+		DataValidation []struct {
+			Text             string `xml:",chardata"`
+			Type             string `xml:"type,attr"`
+			ErrorStyle       string `xml:"errorStyle,attr"`
+			Operator         string `xml:"operator,attr"`
+			AllowBlank       string `xml:"allowBlank,attr"`
+			ShowDropDown     string `xml:"showDropDown,attr"`
+			ShowInputMessage string `xml:"showInputMessage,attr"`
+			ShowErrorMessage string `xml:"showErrorMessage,attr"`
+			ErrorTitle       string `xml:"errorTitle,attr"`
+			Error            string `xml:"error,attr"`
+			PromptTitle      string `xml:"promptTitle,attr"`
+			Prompt           string `xml:"prompt,attr"`
+			Sqref            string `xml:"sqref,attr"`
+			Formula1         string `xml:"formula1"` // "Yes,No", $A$1:$A$5, 10...
+			Formula2         string `xml:"formula2"`
+		} `xml:"dataValidation"`
+	} `xml:"dataValidations"`
+	Scenarios struct {
+		Text     string `xml:",chardata"`
+		Current  string `xml:"current,attr"`
+		Show     string `xml:"show,attr"`
+		Sqref    string `xml:"sqref,attr"` // the result cells
+		Scenario []struct {
+			Text       string `xml:",chardata"`
+			Name       string `xml:"name,attr"`
+			Locked     string `xml:"locked,attr"`
+			Hidden     string `xml:"hidden,attr"`
+			Count      string `xml:"count,attr"`
+			User       string `xml:"user,attr"`
+			Comment    string `xml:"comment,attr"`
+			InputCells []struct {
+				Text    string `xml:",chardata"`
+				R       string `xml:"r,attr"`
+				Deleted string `xml:"deleted,attr"`
+				Undone  string `xml:"undone,attr"`
+				Val     string `xml:"val,attr"`
+			} `xml:"inputCells"`
+		} `xml:"scenario"`
+	} `xml:"scenarios"`
+	SheetData struct {
+		Text string `xml:",chardata"`
+		Row  []struct {
+			Text   string `xml:",chardata"`
+			R      string `xml:"r,attr"`
+			Hidden string `xml:"hidden,attr"`
+			C      []struct {
+				Text string `xml:",chardata"`
+				R    string `xml:"r,attr"`
+				S    string `xml:"s,attr"` // the style (cellXfs) index
+				T    string `xml:"t,attr"` // s (shared string), str, inlineStr, b, e, n (default)
+				V    string `xml:"v"`
+				Is   *struct {
+					T string `xml:"t"`
+				} `xml:"is"`
+				F *struct {
+					Text string `xml:",chardata"`
+					T    string `xml:"t,attr"` // shared, array or dataTable
+					Ref  string `xml:"ref,attr"`
+					Si   string `xml:"si,attr"` // the shared formula index
+					Dt2D string `xml:"dt2D,attr"`
+					Dtr  string `xml:"dtr,attr"`
+					R1   string `xml:"r1,attr"`
+					R2   string `xml:"r2,attr"`
+				} `xml:"f"`
+			} `xml:"c"`
+		} `xml:"row"`
+	} `xml:"sheetData"`
 	PageMargins struct {
 		Text   string `xml:",chardata"`
 		Left   string `xml:"left,attr"`
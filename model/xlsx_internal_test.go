@@ -288,3 +288,19 @@ func TestAutoFilterUnmarshaling(t *testing.T) {
 	UnmarshalWorksheet([]byte(worksheet1))
 	// dumpStruct(t, sheet)
 }
+
+func TestResolveTarget(t *testing.T) {
+	for _, c := range []struct{ source, target, expected string }{
+		{"xl/workbook.xml", "worksheets/sheet1.xml", "xl/worksheets/sheet1.xml"},
+		{"xl/workbook.xml", "/xl/worksheets/sales.xml", "xl/worksheets/sales.xml"},
+		{"xl/worksheets/sheet2.xml", "../drawings/drawing1.xml", "xl/drawings/drawing1.xml"},
+		{"xl/chartsheets/sheet1.xml", "../drawings/./drawing2.xml", "xl/drawings/drawing2.xml"},
+	} {
+		if got := resolveTarget(c.source, c.target); got != c.expected {
+			t.Errorf("Expected %q of %q to be resolved to %q, got: %q", c.target, c.source, c.expected, got)
+		}
+	}
+	if got := relsPartName("xl/worksheets/sales.xml"); got != "xl/worksheets/_rels/sales.xml.rels" {
+		t.Errorf("Unexpected relationship part name: %q", got)
+	}
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TestChartSeries tests the import of the series of a combo chart with a secondary axis.
+func TestChartSeries(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Chart Series...")
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, "combo_chart.xlsx")
+	var ws model.Worksheet
+	db.Where("workbook_id = ? AND name = ?", wb.ID, "Sales").First(&ws)
+
+	var chart model.Chart
+	db.Preload("Series", func(db *gorm.DB) *gorm.DB { return db.Order("idx") }).
+		Where("worksheet_id = ?", ws.ID).First(&chart)
+	if chart.Title != "Revenue and Margin" || chart.LegendPosition != "bottom" ||
+		chart.DataLabels != "" || chart.SeriesCount != 3 {
+		t.Errorf("Unexpected chart entry: title: %q, legend: %q, data labels: %q, series count: %d",
+			chart.Title, chart.LegendPosition, chart.DataLabels, chart.SeriesCount)
+	}
+	if len(chart.Series) != 3 {
+		t.Fatalf("Expected 3 chart series, got: %#v", chart.Series)
+	}
+	for i, expected := range []model.ChartSeries{
+		{Idx: 0, Order: 0, Type: "Column", Name: "Revenue", NameRef: "Sales!$B$1",
+			CategoryRange: "Sales!$A$2:$A$5", ValueRange: "Sales!$B$2:$B$5", AxisGroup: "primary",
+			TrendlineType: "linear", TrendlineOptions: "forward=1,R²,equation"},
+		{Idx: 1, Order: 1, Type: "Column", Name: "Cost", NameRef: "Sales!$C$1",
+			CategoryRange: "Sales!$A$2:$A$5", ValueRange: "Sales!$C$2:$C$5", AxisGroup: "primary",
+			DataLabels: "value"},
+		{Idx: 2, Order: 2, Type: "Line", Name: "Margin", NameRef: "Sales!$D$1",
+			CategoryRange: "Sales!$A$2:$A$5", ValueRange: "Sales!$D$2:$D$5", AxisGroup: "secondary"},
+	} {
+		s := chart.Series[i]
+		expected.ID, expected.ChartID = s.ID, chart.ID
+		if s != expected {
+			t.Errorf("Expected the series %#v, got: %#v", expected, s)
+		}
+	}
+
+	var cell model.Cell
+	db.Where("worksheet_id = ? AND cell_type = ? AND cell_range = ?", ws.ID, "Chart", "Series 3").First(&cell)
+	if expected := "Sales!$D$1,Line,secondary,Sales!$A$2:$A$5,Sales!$D$2:$D$5"; cell.Formula != expected {
+		t.Errorf("Expected the series auxiliary cell formula %q, got: %q", expected, cell.Formula)
+	}
+	var count int
+	db.Model(&model.Cell{}).Where("worksheet_id = ? AND cell_type = ?", ws.ID, "Chart").Count(&count)
+	if count != 20 {
+		t.Errorf("Expected 20 chart auxiliary cells, got: %d", count)
+	}
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestChartsheets tests the import of the chart sheets and linking of the pivot charts.
+func TestChartsheets(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Chart Sheets...")
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, "pivot_chart.xlsx")
+
+	var ws model.Worksheet
+	if db.Where("workbook_id = ? AND name = ?", wb.ID, "Pivot Chart").First(&ws).RecordNotFound() {
+		t.Fatal("The chart sheet entry is missing")
+	}
+	if !ws.IsChartsheet {
+		t.Errorf("Expected the worksheet %q to be marked as a chart sheet", ws.Name)
+	}
+	var count int
+	db.Model(&model.Worksheet{}).Where("workbook_id = ? AND is_chartsheet", wb.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 chart sheet, got: %d", count)
+	}
+
+	var chart model.Chart
+	if db.Where("worksheet_id = ?", ws.ID).First(&chart).RecordNotFound() {
+		t.Fatal("The chart of the chart sheet is missing")
+	}
+	if chart.Title != "Sales by Region" || chart.Type != "Column" || chart.SeriesCount != 1 ||
+		chart.PivotName != "[Pivot 2.xlsx]Sheet2!PivotTable2" {
+		t.Errorf("Unexpected chart: title: %q, type: %q, series count: %d, pivot: %q",
+			chart.Title, chart.Type, chart.SeriesCount, chart.PivotName)
+	}
+	if !chart.PivotSourceID.Valid {
+		t.Fatal("Expected the pivot chart to be linked to the pivot table")
+	}
+	var ds model.DataSource
+	db.First(&ds, chart.PivotSourceID.Int64)
+	if ds.Name != "PivotTable2" || ds.Range != "A1:J8" {
+		t.Errorf("Unexpected pivot table data source: %#v", ds)
+	}
+	db.Model(&model.PivotTable{}).Where("DataSourceId = ?", ds.ID).Count(&count)
+	if count == 0 {
+		t.Error("Expected the pivot table entries of the linked data source")
+	}
+
+	var cell model.Cell
+	db.Where("worksheet_id = ? AND cell_type = ? AND cell_range = ?", ws.ID, "Chart", "PivotTable").First(&cell)
+	if cell.Formula != chart.PivotName {
+		t.Errorf("Expected the pivot table auxiliary cell, got: %#v", cell)
+	}
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestCircularReferences tests the detection of the circular references and the iterative calculation.
+func TestCircularReferences(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Circular References...")
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, "circular_references.xlsx")
+
+	db.First(&wb, wb.ID)
+	if !wb.HasCircularReferences || !wb.IsIterative || wb.CalcMode != "manual" {
+		t.Errorf("Expected the circular references, the iterative and manual calculation, got: %#v", wb)
+	}
+	for name, expected := range map[string]string{"Inputs": "A1", "Calc": "B3,D1"} {
+		var ws model.Worksheet
+		db.First(&ws, "workbook_id = ? AND name = ?", wb.ID, name)
+		if !ws.HasCircularReferences || ws.CircularCells != expected {
+			t.Errorf("Expected the circular references %q in the worksheet %q, got: %q", expected, name, ws.CircularCells)
+		}
+	}
+	var cells []model.Cell
+	db.Joins("JOIN WorkSheets AS ws ON ws.id = Cells.worksheet_id").
+		Where("ws.workbook_id = ? AND Cells.is_circular", wb.ID).
+		Order("Cells.cell_range").
+		Find(&cells)
+	if len(cells) != 3 || cells[0].Range != "A1" || cells[1].Range != "B3" || cells[2].Range != "D1" {
+		t.Errorf("Expected the cells A1, B3 and D1 marked as circular, got: %v", cells)
+	}
+
+	// No circular references in the workbook:
+	_, wb = importWorkbook(t, q, assignment.ID, 4952, "dependencies.xlsx")
+	db.First(&wb, wb.ID)
+	if wb.HasCircularReferences || wb.IsIterative || wb.CalcMode != "auto" {
+		t.Errorf("Expected no circular references and the automatic calculation, got: %#v", wb)
+	}
+}
@@ -153,11 +153,11 @@ func TestDemoFile(t *testing.T) {
 	}
 	var count int
 	db.Model(&model.Block{}).Count(&count)
-	if expected := 16; count != expected {
+	if expected := 20; count != expected {
 		t.Errorf("Expected %d blocks, got: %d", expected, count)
 	}
 	db.Model(&model.Cell{}).Count(&count)
-	if expected := 42; count != expected {
+	if expected := 46; count != expected {
 		t.Errorf("Expected %d cells, got: %d", expected, count)
 	}
 
@@ -181,11 +181,11 @@ func TestDemoFile(t *testing.T) {
 		t.Errorf("Expected %d block -> comment mapping entries, got: %d", expected, count)
 	}
 	db.Model(&model.Block{}).Count(&count)
-	if expected := 32; count != expected {
+	if expected := 40; count != expected {
 		t.Errorf("Expected %d blocks, got: %d", expected, count)
 	}
 	db.Model(&model.Cell{}).Count(&count)
-	if expected := 84; count != expected {
+	if expected := 92; count != expected {
 		t.Errorf("Expected %d cells, got: %d", expected, count)
 	}
 
@@ -295,8 +295,12 @@ func deleteData() {
 	for _, m := range []interface{}{
 		&model.XLQTransformation{},
 		&model.StudentAssignment{},
+		&model.CellDependency{},
+		&model.BlockDependency{},
+		&model.PrecedentValue{},
 		&model.Cell{},
 		&model.Block{},
+		&model.ChartSeries{},
 		&model.Chart{},
 		&model.BlockCommentMapping{},
 		&model.AnswerComment{},
@@ -310,13 +314,24 @@ func deleteData() {
 		&model.Source{},
 		&model.Comment{},
 		&model.ConditionalFormatting{},
+		&model.DataValidation{},
+		&model.TableColumn{},
+		&model.Table{},
+		&model.ScenarioInputCell{},
+		&model.Scenario{},
+		&model.DataTable{},
+		&model.GoalSeek{},
+		&model.SolverVerification{},
 		&model.Filter{},
 		&model.Sorting{},
 		&model.PivotTable{},
+		&model.PivotOptions{},
 		&model.DataSource{},
 		&model.User{},
 		&model.Alignment{},
 		&model.Border{},
+		&model.Font{},
+		&model.Fill{},
 	} {
 		err := db.Delete(m).Error
 		if err != nil {
@@ -472,6 +487,12 @@ func createTestDB() *gorm.DB {
 	return db
 }
 
+// closeTestDB closes the test database, the following tests reopen it (see deleteData).
+func closeTestDB() {
+	db.Close()
+	db = nil
+}
+
 var db *gorm.DB
 
 func testQuestionsToProcess(t *testing.T) {
@@ -1302,6 +1323,7 @@ func testImportWorksheets(t *testing.T) {
 		"Salesman filter.xlsx",
 		"Pivot 2.xlsx",
 		"Multi text custom filter.xlsx",
+		"Data Validation ALL TYPES.xlsx",
 	} {
 		wb := model.Workbook{FileName: fn}
 		db.Create(&wb)
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"database/sql"
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestConditionalFormatting tests the import of the conditional formatting rules
+// with the applied formats, the priorities and the color scale, data bar and icon set thresholds.
+func TestConditionalFormatting(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Conditional Formatting...")
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, "CF ALL TYPES.xlsx")
+
+	for _, expected := range []struct {
+		sheet, sqref string
+		rule         model.ConditionalFormatting
+		format       string
+		highlighted  string
+	}{
+		{"Sheet1", "A2:A13", model.ConditionalFormatting{
+			Type: "cellIs", Operator: "between", Formula1: "10", Formula2: "20", Priority: 24,
+			FillColor: "FFFFEB9C", FontColor: "FF9C6500"}, "fill=FFFFEB9C,font=FF9C6500", "A6,A10"},
+		{"Sheet1", "G2:G13", model.ConditionalFormatting{
+			Type: "aboveAverage", Operator: "above average", Priority: 2,
+			BorderColor: "FF9C0006", BorderStyle: "thin"}, "border=thin:FF9C0006", "G5,G6,G7,G8,G10"},
+		{"databar", "G2:G15", model.ConditionalFormatting{
+			Type: "colorScale", Priority: 26,
+			Thresholds: "min,percentile:50,max", Colors: "FFF8696B,FFFFEB84,FF63BE7B"}, "", "G2,G3,G4,G5,G6,G7,G8,G9,G10,G11,G12,G13,G14,G15"},
+		{"databar", "B2:B15", model.ConditionalFormatting{
+			Type: "dataBar", Priority: 31, Thresholds: "min,max", Colors: "FF638EC6"}, "", "B2,B3,B4,B5,B6,B7,B8,B9,B10,B11,B12,B13,B14,B15"},
+		{"databar", "O2:O15", model.ConditionalFormatting{
+			Type: "iconSet", Operator: "3TrafficLights1", Priority: 18,
+			Thresholds: "percent:0,percent:33,percent:67"}, "", "O2,O3,O4,O5,O6,O7,O8,O9,O10,O11,O12,O13,O14,O15"},
+	} {
+		var rules []model.ConditionalFormatting
+		db.
+			Joins("JOIN DataSources AS ds ON ds.id = ConditionalFormattings.DataSourceId").
+			Joins("JOIN WorkSheets AS ws ON ws.id = ds.worksheet_id").
+			Where("ws.workbook_id = ? AND ws.name = ? AND ds.Sourcerange = ?", wb.ID, expected.sheet, expected.sqref).
+			Order("ConditionalFormattings.id").
+			Find(&rules)
+		var found bool
+		for _, r := range rules {
+			if r.Priority != expected.rule.Priority {
+				continue
+			}
+			found = true
+			expected.rule.ID, expected.rule.DataSourceID = r.ID, r.DataSourceID
+			expected.rule.Highlighted = sql.NullString{String: expected.highlighted, Valid: true}
+			if r != expected.rule {
+				t.Errorf("Expected the rule %#v, got: %#v", expected.rule, r)
+			}
+			if format := r.Format(); format != expected.format {
+				t.Errorf("Expected the format %q of %s!%s, got: %q", expected.format, expected.sheet, expected.sqref, format)
+			}
+		}
+		if !found {
+			t.Errorf("The rule of %s!%s (priority: %d) is missing", expected.sheet, expected.sqref, expected.rule.Priority)
+		}
+	}
+
+	var count int
+	db.Model(&model.Cell{}).
+		Joins("JOIN WorkSheets AS ws ON ws.id = Cells.worksheet_id").
+		Where("ws.workbook_id = ? AND cell_type = ? AND cell_range = ?", wb.ID, "CF", "CFScale").
+		Count(&count)
+	if count != 28 {
+		t.Errorf("Expected 28 color scale, data bar and icon set auxiliary cells, got: %d", count)
+	}
+}
+
+// TestConditionalFormattingEvaluation tests the evaluation of the conditional formatting rules
+// comparing the highlighted cells with the ones of the model answer rules.
+func TestConditionalFormattingEvaluation(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test CF Evaluation...")
+	var answerID int
+	for _, r := range []struct {
+		fileName string
+		uid      int
+	}{
+		{"CF ALL TYPES.xlsx", 10000}, // Model answer
+		{"CF equivalent rules.xlsx", 4951},
+	} {
+		answerID = importAnswer(t, q, assignment.ID, r.uid, r.fileName).ID
+	}
+
+	count, err := model.EvaluateConditionalFormatting(answerID, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Error("Expected the conditional formatting rules to get evaluated.")
+	}
+
+	for _, expected := range []struct {
+		sqref     string
+		priority  int
+		isCorrect bool
+	}{
+		{"A2:A13", 24, true},  // "between 10 and 20" vs "=AND($A2>=10,$A2<=20)"
+		{"A2:A13", 25, false}, // "less than 10" vs "less than 5"
+		{"A2:A13", 26, true},  // "greater than 20" vs "greater than or equal to 21"
+		{"C2:C16", 21, true},
+		{"E2:E12", 18, true},
+		{"O2:O19", 7, false}, // time period rules depend on the current date
+	} {
+		var cf model.ConditionalFormatting
+		db.
+			Joins("JOIN DataSources AS ds ON ds.id = ConditionalFormattings.DataSourceId").
+			Joins("JOIN WorkSheets AS ws ON ws.id = ds.worksheet_id").
+			Where("ws.StudentAnswerID = ? AND ds.Sourcerange = ? AND Priority = ?", answerID, expected.sqref, expected.priority).
+			First(&cf)
+		if cf.ID == 0 {
+			t.Errorf("The rule of %q (priority: %d) is missing", expected.sqref, expected.priority)
+			continue
+		}
+		if cf.IsCorrect != expected.isCorrect {
+			t.Errorf("Expected the rule %q of %q (priority: %d, highlighted: %q) correct=%t, got: %t",
+				cf.Type, expected.sqref, expected.priority, cf.Highlighted.String, expected.isCorrect, cf.IsCorrect)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestDataValidations tests the import of the data validation rules.
+func TestDataValidations(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	const fileName = "Data Validation ALL TYPES.xlsx"
+	wb := model.Workbook{FileName: fileName}
+	db.Create(&wb)
+	wb.ImportWorksheets(fileName)
+
+	var validations []model.DataValidation
+	db.Preload("DataSource").Order("id").Find(&validations)
+	if len(validations) != 4 {
+		t.Fatalf("Expected 4 data validations, got: %d", len(validations))
+	}
+	for i, expected := range []struct {
+		sqref, validationType, operator, formula1, formula2, errorStyle string
+		allowBlank                                                      bool
+	}{
+		{"A1:A10", "list", "", `"Yes,No"`, "", "stop", true},
+		{"B1:B10", "whole", "between", "1", "10", "warning", true},
+		{"C1:C10", "decimal", "between", "0", "1", "stop", false},
+		{"D1:D10 F1:F10", "custom", "", "ISNUMBER(D1)", "", "stop", false},
+	} {
+		v := validations[i]
+		if v.DataSource == nil || v.DataSource.Range != expected.sqref || v.Type != expected.validationType ||
+			v.Operator != expected.operator || v.Formula1 != expected.formula1 || v.Formula2 != expected.formula2 ||
+			v.ErrorStyle != expected.errorStyle || v.AllowBlank != expected.allowBlank || !v.ShowErrorMessage {
+			t.Errorf("Expected %#v, got: %#v", expected, v)
+		}
+	}
+	if v := validations[1]; v.ErrorTitle != "Wrong quantity" || v.Error != "Enter a whole number between 1 and 10" ||
+		v.PromptTitle != "Quantity" || v.Prompt != "1 to 10" {
+		t.Errorf("Expected the error and the prompt messages, got: %#v", v)
+	}
+
+	var count int
+	db.Model(&model.Cell{}).Where("cell_type = ?", "Validation").Count(&count)
+	if count != 8 {
+		t.Errorf("Expected 8 data validation aux cells, got: %d", count)
+	}
+	var b model.Block
+	db.First(&b, "BlockCellRange = ? AND BlockFormula = ?", "whole", "between,1,10")
+	if b.ID == 0 || !b.DataSourceID.Valid {
+		t.Errorf("Expected the data validation aux block, got: %#v", b)
+	}
+}
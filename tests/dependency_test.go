@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	model "extract-blocks/model"
+	"strings"
+	"testing"
+)
+
+// TestDependencies tests the extraction and the export of the cell and block dependency graph.
+func TestDependencies(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Dependencies...")
+	a, wb := importWorkbook(t, q, assignment.ID, 4951, "dependencies.xlsx")
+
+	var count int
+	db.Model(&model.CellDependency{}).Where("workbook_id = ?", wb.ID).Count(&count)
+	if count != 11 {
+		t.Errorf("Expected 11 cell dependencies, got: %d", count)
+	}
+	var d model.CellDependency
+	db.Joins("JOIN WorkSheets AS ws ON ws.id = CellDependencies.precedent_worksheet_id").
+		Where("CellDependencies.workbook_id = ? AND CellDependencies.cell_range = ? AND ws.name = ?", wb.ID, "D2", "Inputs").
+		First(&d)
+	if d.PrecedentRange != "D1" || d.Reference != "Rate" {
+		t.Errorf("Expected the cell D2 to depend on Inputs!D1 via Rate, got: %#v", d)
+	}
+
+	g, err := model.AnswerDependencyGraph(a.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edges := make(map[string]int)
+	for _, e := range g.Edges {
+		var from, to model.DependencyNode
+		for _, n := range g.Nodes {
+			if n.ID == e.From {
+				from = n
+			}
+			if n.ID == e.To {
+				to = n
+			}
+		}
+		edges[from.Sheet+"!"+from.Range+" -> "+to.Sheet+"!"+to.Range] = e.Count
+	}
+	expected := map[string]int{
+		"Inputs!A1:A3 -> Calc!B1:B3": 3,
+		"Calc!B1:B3 -> Calc!D1:D3":   3,
+		"Inputs!D1:D1 -> Calc!D1:D3": 3,
+		"Calc!D1:D3 -> Calc!F1:F1":   1,
+		"Inputs!A1:A3 -> Calc!F1:F1": 1,
+	}
+	if len(edges) != len(expected) {
+		t.Errorf("Expected %d block dependencies, got: %v", len(expected), edges)
+	}
+	for e, c := range expected {
+		if edges[e] != c {
+			t.Errorf("Expected the block dependency %s with %d references, got: %v", e, c, edges)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Error(err)
+	}
+	if dot := buf.String(); !strings.HasPrefix(dot, `digraph "dependencies.xlsx" {`) ||
+		strings.Count(dot, " -> ") != len(expected) || !strings.Contains(dot, `fillcolor="#FFFF00"`) {
+		t.Errorf("Unexpected DOT output: %s", dot)
+	}
+
+	g, err = model.AnswerDependencyGraph(a.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Edges) != 11 {
+		t.Errorf("Expected 11 edges of the cell graph, got: %d", len(g.Edges))
+	}
+}
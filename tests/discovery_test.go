@@ -0,0 +1,71 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestBlockDiscovery tests the block discovery ignoring the filling colors.
+func TestBlockDiscovery(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+	defer func() { model.DiscoverBlocks = false }()
+
+	assignment, q := createQuestion(t, "Test Block Discovery...")
+
+	for _, r := range []struct {
+		color                      string
+		discover                   bool
+		colorCoded, autoDiscovered int
+	}{
+		{"FFFFFF00", false, 3, 0},
+		{"FF123456", false, 0, 10}, // no block of the color, falls back to the discovery
+		{"FFFFFF00", true, 0, 10},
+	} {
+		a := createAnswer(q, assignment.ID, 4951)
+		model.DiscoverBlocks = r.discover
+		wb, err := model.ExtractBlocksFromFile("demo.xlsx", r.color, true, true, true, a.ID)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		var colorCoded, autoDiscovered int
+		db.Model(&model.Block{}).
+			Joins("JOIN WorkSheets AS ws ON ws.id = ExcelBlocks.worksheet_id").
+			Where("ws.workbook_id = ? AND ExcelBlocks.color = ? AND NOT ExcelBlocks.is_auto_discovered", wb.ID, r.color).
+			Count(&colorCoded)
+		db.Model(&model.Block{}).
+			Joins("JOIN WorkSheets AS ws ON ws.id = ExcelBlocks.worksheet_id").
+			Where("ws.workbook_id = ? AND ExcelBlocks.is_auto_discovered", wb.ID).
+			Count(&autoDiscovered)
+		if colorCoded != r.colorCoded || autoDiscovered != r.autoDiscovered {
+			t.Errorf("Expected %d color-coded and %d auto-discovered blocks (color: %q, discover: %v), got: %d and %d",
+				r.colorCoded, r.autoDiscovered, r.color, r.discover, colorCoded, autoDiscovered)
+		}
+		var count int
+		db.Model(&model.Block{}).
+			Joins("JOIN WorkSheets AS ws ON ws.id = ExcelBlocks.worksheet_id").
+			Where("ws.workbook_id = ? AND ExcelBlocks.BlockCellRange = ?", wb.ID, "I3:M6").
+			Count(&count)
+		if count != 1 {
+			t.Errorf("Expected the block I3:M6 (color: %q, discover: %v)", r.color, r.discover)
+		}
+	}
+
+	// the worksheet without color-coded blocks gets skipped if the other worksheets have them
+	a := createAnswer(q, assignment.ID, 4952)
+	model.DiscoverBlocks = false
+	wb, err := model.ExtractBlocksFromFile("discovery mixed.xlsx", "FFFFFF00", true, true, true, a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var autoDiscovered int
+	db.Model(&model.Block{}).
+		Joins("JOIN WorkSheets AS ws ON ws.id = ExcelBlocks.worksheet_id").
+		Where("ws.workbook_id = ? AND ExcelBlocks.is_auto_discovered", wb.ID).
+		Count(&autoDiscovered)
+	if autoDiscovered != 0 {
+		t.Errorf("Expected no auto-discovered blocks in the workbook with the color-coded blocks, got: %d", autoDiscovered)
+	}
+}
@@ -0,0 +1,199 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestEvaluation tests the answer cell evaluation against the model answer.
+func TestEvaluation(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment := model.Assignment{
+		Title: "Test Evaluation...",
+		State: "READY_FOR_GRADING",
+	}
+	db.Create(&assignment)
+
+	qf := model.Source{FileName: "Q3 Compounding1.xlsx", S3BucketName: "studentanswers"}
+	db.Create(&qf)
+	q := model.Question{
+		SourceID:     model.NewNullInt64(qf.ID),
+		QuestionType: model.QuestionType("FileUpload"),
+		QuestionText: "Test Evaluation...",
+		MaxScore:     1010.88,
+		AuthorUserID: 123456789,
+	}
+	if err := db.Create(&q).Error; err != nil {
+		t.Error(err)
+	}
+	q.ImportFile(qf.FileName, "FFFFFF00", true, true)
+
+	var answerIDs []int
+	for _, r := range []struct {
+		fileName string
+		uid      int
+	}{
+		{"Answer stud 1 Q3 Compounding1.xlsx", 10000}, // Model answer
+		{"Answer stud 2 Q3 Compounding1.xlsx", 4951},
+		{"Answer stud 3 Q3 Compounding1.xlsx", 4952},
+	} {
+		sa := model.StudentAssignment{UserID: r.uid, AssignmentID: assignment.ID}
+		db.Create(&sa)
+		af := model.Source{FileName: r.fileName, S3BucketName: "studentanswers"}
+		db.Create(&af)
+		a := model.Answer{
+			SourceID:            model.NewNullInt64(af.ID),
+			QuestionID:          model.NewNullInt64(q.ID),
+			SubmissionTime:      *parseTime("2018-09-30 12:42"),
+			StudentAssignmentID: sa.ID,
+		}
+		db.Create(&a)
+		if _, err := model.ExtractBlocksFromFile(r.fileName, "FFFFFF00", true, true, true, a.ID); err != nil {
+			t.Error(err)
+		}
+		answerIDs = append(answerIDs, a.ID)
+	}
+
+	if err := model.EvaluateAnswers(assignment.ID, 10000); err != nil {
+		t.Fatal(err)
+	}
+	var countBefore int
+	db.Model(&model.AutoEvaluation{}).Count(&countBefore)
+	if countBefore == 0 {
+		t.Error("Expected the answer cells to get evaluated.")
+	}
+
+	// Re-evaluation should update the existing entries:
+	if err := model.EvaluateAnswers(assignment.ID, 10000); err != nil {
+		t.Fatal(err)
+	}
+	var countAfter int
+	db.Model(&model.AutoEvaluation{}).Count(&countAfter)
+	if countAfter != countBefore {
+		t.Errorf("Expected unchanged rowcount of AutoEvaluation table. Expected: %d, got: %d", countBefore, countAfter)
+	}
+
+	// The model answer shouldn't get evaluated:
+	var count int
+	db.Table("AutoEvaluation").
+		Joins("JOIN Cells AS c ON c.id = AutoEvaluation.cell_id").
+		Joins("JOIN WorkSheets AS ws ON ws.id = c.worksheet_id").
+		Where("ws.StudentAnswerID = ?", answerIDs[0]).
+		Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the model answer not evaluated, got %d entries.", count)
+	}
+
+	for _, r := range []struct {
+		value, expected string
+		isCorrect       bool
+	}{
+		{"", "", true},
+		{"42", "42.0000000001", true},
+		{"42", "42.1", false},
+		{"ABC", "ABC", true},
+		{"ABC", "abc", false},
+	} {
+		row := model.EvaluationRow{Range: "A1", Value: r.value, ModelValue: r.expected}
+		if ae := row.Evaluate(); ae.IsValueCorrect != r.isCorrect {
+			t.Errorf("Expected IsValueCorrect = %v for %q and %q", r.isCorrect, r.value, r.expected)
+		}
+	}
+	for _, r := range []struct {
+		cellRange, formula, expected string
+		isCorrect, isHardcoded       bool
+	}{
+		{"C3", "B3*2", "B3 * 2", true, false},
+		{"C3", "b3*2", "B3*2", true, false},
+		{"C3", "2*B3", "B3*2", true, false},
+		{"C3", "SUM(B3,B3)", "B3*2", true, false},
+		{"C3", "", "B3*2", false, true},
+		{"C3", "B4*2", "B3*2", false, false},
+		{"C3", "", "", true, false},
+	} {
+		row := model.EvaluationRow{Range: r.cellRange, Formula: r.formula, ModelFormula: r.expected, Value: "1"}
+		ae := row.Evaluate()
+		if ae.IsFormulaCorrect != r.isCorrect {
+			t.Errorf("Expected IsFormulaCorrect = %v for %q and %q", r.isCorrect, r.formula, r.expected)
+		}
+		if ae.IsHardcoded != r.isHardcoded {
+			t.Errorf("Expected IsHardcoded = %v for %q and %q", r.isHardcoded, r.formula, r.expected)
+		}
+	}
+
+	// Error carried forward: the answer input B3 is wrong (3 instead of 2)
+	precedents := map[string]string{"B3": "3", "C3": "6"}
+	for _, r := range []struct {
+		formula, value, expected, modelValue string
+		isCarriedForwardCorrect              bool
+	}{
+		{"B3*2", "6", "B3*2", "4", true},
+		{"2*B3", "6", "B3*2", "4", true},
+		{"B3+2", "5", "B3*2", "4", false},
+		{"", "6", "B3*2", "4", false},
+		{"B3*2", "6", "", "4", false},
+	} {
+		row := model.EvaluationRow{
+			Range:        "C3",
+			Formula:      r.formula,
+			Value:        r.value,
+			ModelFormula: r.expected,
+			ModelValue:   r.modelValue,
+			Precedents:   precedents,
+		}
+		ae := row.Evaluate()
+		if ae.IsValueCorrect {
+			t.Errorf("Expected IsValueCorrect = false for %q and %q", r.value, r.modelValue)
+		}
+		if ae.IsCarriedForwardCorrect != r.isCarriedForwardCorrect {
+			t.Errorf("Expected IsCarriedForwardCorrect = %v for %q and %q", r.isCarriedForwardCorrect, r.formula, r.expected)
+		}
+	}
+}
+
+// TestPrecedentCellsOutsideBlocks tests the evaluation with the precedent
+// (input) cells outside the answer blocks.
+func TestPrecedentCellsOutsideBlocks(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Precedent Cells...")
+	importAnswer(t, q, assignment.ID, 10000, "ECF model answer.xlsx")
+	a := importAnswer(t, q, assignment.ID, 4951, "ECF student answer.xlsx")
+	if _, err := model.EvaluateAnswer(a.ID, 10000); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []struct {
+		address                              string
+		isCarriedForwardCorrect, isHardcoded bool
+		hardcodedValues                      string
+	}{
+		// "B2*0.05" instead of "B2*$F$1" (F1 is outside the blocks)
+		{"C2", false, true, "0.05"},
+		// the wrong input B2 (200 instead of 100) carried forward
+		{"C3", true, false, ""},
+		// "B2*(1+0.05)" instead of "B2*$F$1+B2" matched by the value of F1
+		{"C4", false, true, "0.05"},
+	} {
+		var ae model.AutoEvaluation
+		if err := db.
+			Joins("JOIN Cells AS c ON c.id = AutoEvaluation.cell_id").
+			Joins("JOIN WorkSheets AS ws ON ws.id = c.worksheet_id").
+			Where("ws.StudentAnswerID = ? AND c.cell_range = ?", a.ID, r.address).
+			First(&ae).Error; err != nil {
+			t.Fatalf("Failed to retrieve the evaluation of %s: %v", r.address, err)
+		}
+		if ae.IsValueCorrect || ae.IsCarriedForwardCorrect != r.isCarriedForwardCorrect {
+			t.Errorf("Expected IsValueCorrect = false and IsCarriedForwardCorrect = %v for %s, got: %#v", r.isCarriedForwardCorrect, r.address, ae)
+		}
+		if ae.IsHardcoded != r.isHardcoded || ae.HardcodedValues != r.hardcodedValues {
+			t.Errorf("Expected IsHardcoded = %v (%q) for %s, got: %v (%q)",
+				r.isHardcoded, r.hardcodedValues, r.address, ae.IsHardcoded, ae.HardcodedValues)
+		}
+	}
+}
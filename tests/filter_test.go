@@ -0,0 +1,82 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// answerFilters returns the filtered ranges of the answer.
+func answerFilters(answerID int) (sources []model.DataSource) {
+	db.
+		Select("DataSources.*").
+		Joins("JOIN WorkSheets AS ws ON ws.id = DataSources.worksheet_id").
+		Where("ws.StudentAnswerID = ? AND DataSources.VisibleRows IS NOT NULL", answerID).
+		Order("DataSources.id").
+		Find(&sources)
+	return
+}
+
+func TestFilterVerification(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Filters...")
+
+	// the criteria of the filters of the sample files keep the visible rows
+	for _, c := range []struct {
+		fileName    string
+		consistency []bool // false - cannot be verified, eg, the color filter
+	}{
+		{"Filter ALL TYPES.xlsx", []bool{true, false}},
+		{"Filter Sort validation and pivot data.xlsx", []bool{true, true, true}},
+		{"Multi text custom filter.xlsx", []bool{true}},
+		{"Salesman filter.xlsx", []bool{true}},
+	} {
+		a := importAnswer(t, q, assignment.ID, 4951, c.fileName)
+		sources := answerFilters(a.ID)
+		if len(sources) != len(c.consistency) {
+			t.Errorf("Expected %d filtered ranges in %q, got: %d", len(c.consistency), c.fileName, len(sources))
+			continue
+		}
+		for i, s := range sources {
+			if s.IsFilterConsistent.Valid != c.consistency[i] || s.IsFilterConsistent.Valid && !s.IsFilterConsistent.Bool {
+				t.Errorf("Expected the filter of %q in %q consistent: %v, got: %v %q",
+					s.Range, c.fileName, c.consistency[i], s.IsFilterConsistent, s.FilterMismatch)
+			}
+		}
+	}
+
+	base := "data/missing-or-partial/Filter_2_answers/"
+	ma := importAnswer(t, q, assignment.ID, 10000, base+"FilterModelAnswer.xlsx")
+	for _, c := range []struct {
+		fileName, visibleRows, mismatch string
+		isInferred, isCorrect           bool
+	}{
+		{base + "FilterModelAnswer.xlsx", "2,4", "", false, true},
+		{base + "FilterStudentAnswer2.xlsx", "2:3", "", false, false},
+		{"Filter equivalent criteria.xlsx", "2,4", "", false, true},
+		{"Filter hidden rows.xlsx", "2,4", "hidden by hand", true, true},
+		{"Filter hidden by hand.xlsx", "2", "hidden by hand", false, false},
+		{"Filter stale.xlsx", "2,4,6", "stale filter", false, false},
+		{"Filter wrong column.xlsx", "2,4,6,8,10", "wrong column", false, false},
+	} {
+		a := ma
+		if c.fileName != base+"FilterModelAnswer.xlsx" {
+			a = importAnswer(t, q, assignment.ID, 4952, c.fileName)
+		}
+		if _, err := model.EvaluateFilters(a.ID, 10000); err != nil {
+			t.Fatal(err)
+		}
+		sources := answerFilters(a.ID)
+		if len(sources) != 1 {
+			t.Errorf("Expected a single filtered range in %q, got: %d", c.fileName, len(sources))
+			continue
+		}
+		s := sources[0]
+		if s.Range != "A1:C12" || s.VisibleRows.String != c.visibleRows || s.FilterMismatch != c.mismatch ||
+			s.IsFilterConsistent.Bool != (c.mismatch == "") || s.IsFilterInferred != c.isInferred || s.IsFilterCorrect != c.isCorrect {
+			t.Errorf("Unexpected filter of %q: %#v", c.fileName, s)
+		}
+	}
+}
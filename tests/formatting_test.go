@@ -0,0 +1,139 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"strings"
+	"testing"
+)
+
+func TestFontsFillsAndNumberFormats(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment := model.Assignment{Title: "Test Formatting...", State: "READY_FOR_GRADING"}
+	db.Create(&assignment)
+	q := model.Question{
+		QuestionType: model.QuestionType("FileUpload"),
+		QuestionText: "Test Formatting...",
+		MaxScore:     999.99,
+		AuthorUserID: 123456789,
+		IsFormatting: true,
+	}
+	if err := db.Create(&q).Error; err != nil {
+		t.Error(err)
+	}
+	a := importAnswer(t, q, assignment.ID, 4951, "Formatting fonts fills.xlsx")
+
+	for _, c := range []struct {
+		address, format string
+		font            model.Font
+	}{
+		{"A1", `"$"#,##0.00_);("$"#,##0.00)`, model.Font{Name: "Arial", Size: 12, Bold: true, Italic: true, Underline: "single", Color: "FFFF0000"}},
+		{"A2", "0.0%", model.Font{Name: "Calibri", Size: 11, Color: "FF000000"}},
+		{"A3", "#,##0.00", model.Font{Name: "Calibri", Size: 11, Color: "FF000000"}},
+	} {
+		var cell model.Cell
+		if err := db.
+			Select("Cells.*").
+			Joins("JOIN WorkSheets AS ws ON ws.id = Cells.worksheet_id").
+			Where("ws.StudentAnswerID = ? AND Cells.cell_range = ?", a.ID, c.address).
+			Preload("FontStyle").Preload("FillStyle").
+			First(&cell).Error; err != nil {
+			t.Fatalf("Failed to retrieve the cell %s: %v", c.address, err)
+		}
+		if cell.CellFormat != c.format {
+			t.Errorf("Expected the number format of %s to be %q, got: %q", c.address, c.format, cell.CellFormat)
+		}
+		if cell.FontStyle == nil {
+			t.Errorf("Missing the font of %s", c.address)
+		} else if c.font.ID = cell.FontStyle.ID; *cell.FontStyle != c.font {
+			t.Errorf("Expected the font of %s to be %#v, got: %#v", c.address, c.font, *cell.FontStyle)
+		}
+		if f := cell.FillStyle; f == nil || f.Pattern != "solid" || f.FgColor != "FFFFFF00" || f.BgColor != "indexed:64" {
+			t.Errorf("Expected the solid yellow fill of %s, got: %#v", c.address, f)
+		}
+	}
+
+	// the fonts and the fills shared by the cells get stored only once
+	var fontCount, fillCount int
+	db.Model(&model.Font{}).Count(&fontCount)
+	db.Model(&model.Fill{}).Count(&fillCount)
+	if fontCount != 2 || fillCount != 1 {
+		t.Errorf("Expected 2 fonts and 1 fill, got: %d and %d", fontCount, fillCount)
+	}
+}
+
+func TestFormattingEvaluation(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment := model.Assignment{Title: "Test Formatting Evaluation...", State: "READY_FOR_GRADING"}
+	db.Create(&assignment)
+	q := model.Question{
+		QuestionType: model.QuestionType("FileUpload"),
+		QuestionText: "Test Formatting Evaluation...",
+		MaxScore:     999.99,
+		AuthorUserID: 123456789,
+		IsFormatting: true,
+	}
+	if err := db.Create(&q).Error; err != nil {
+		t.Error(err)
+	}
+	importAnswer(t, q, assignment.ID, 10000, "Formatting model answer.xlsx")
+	a := importAnswer(t, q, assignment.ID, 4951, "Formatting student answer.xlsx")
+	if _, err := model.EvaluateAnswer(a.ID, 10000); err != nil {
+		t.Fatal(err)
+	}
+	// re-evaluation doesn't duplicate the block comments
+	if _, err := model.EvaluateAnswer(a.ID, 10000); err != nil {
+		t.Fatal(err)
+	}
+	// the answer was imported without the transformation entries
+	db.Model(&model.Worksheet{}).Where("StudentAnswerID = ?", a.ID).UpdateColumn("is_plagiarised", false)
+	model.AutoCommentAnswerCells(0, 10000)
+
+	for _, c := range []struct {
+		address, result string
+	}{
+		{"A1", "border missing bottom, alignment should be centre, number format shows 0 decimals instead of 2, " +
+			"font should be Arial instead of Calibri, font size should be 12 instead of 11, font should be bold"},
+		{"A2", ""},
+		{"A3", "border missing bottom"},
+	} {
+		var cell model.Cell
+		if err := db.
+			Select("Cells.*").
+			Joins("JOIN WorkSheets AS ws ON ws.id = Cells.worksheet_id").
+			Where("ws.StudentAnswerID = ? AND Cells.cell_range = ?", a.ID, c.address).
+			Preload("AutoEvaluation").
+			First(&cell).Error; err != nil {
+			t.Fatalf("Failed to retrieve the cell %s: %v", c.address, err)
+		}
+		ae := cell.AutoEvaluation
+		if ae == nil || !ae.IsFormattingCorrect.Valid || ae.IsFormattingCorrect.Bool != (c.result == "") || ae.FormattingResult != c.result {
+			t.Errorf("Expected the formatting result of %s to be %q, got: %#v", c.address, c.result, ae)
+			continue
+		}
+		var comment model.Comment
+		db.First(&comment, "CommentID = ?", cell.CommentID)
+		if c.result != "" && !strings.Contains(comment.Text, "Your cell formatting is wrong: "+c.result) ||
+			c.result == "" && strings.Contains(comment.Text, "formatting") {
+			t.Errorf("Unexpected comment of %s: %q", c.address, comment.Text)
+		}
+	}
+
+	var mappings []model.BlockCommentMapping
+	db.Preload("Comment").
+		Joins("JOIN ExcelBlocks AS b ON b.ExcelBlockID = BlockCommentMapping.ExcelBlockID").
+		Joins("JOIN WorkSheets AS ws ON ws.id = b.worksheet_id").
+		Where("ws.StudentAnswerID = ?", a.ID).
+		Find(&mappings)
+	expected := "Formatting of A1:A3: border missing bottom (A1, A3); alignment should be centre (A1); " +
+		"number format shows 0 decimals instead of 2 (A1); font should be Arial instead of Calibri (A1); " +
+		"font size should be 12 instead of 11 (A1); font should be bold (A1)"
+	if len(mappings) != 1 || mappings[0].Comment.Text != expected {
+		t.Errorf("Expected the block comment %q, got: %#v", expected, mappings)
+	}
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// createQuestion creates the assignment and the file upload question with the text.
+func createQuestion(t *testing.T, text string) (model.Assignment, model.Question) {
+	assignment := model.Assignment{Title: text, State: "READY_FOR_GRADING"}
+	db.Create(&assignment)
+	q := model.Question{
+		QuestionType: model.QuestionType("FileUpload"),
+		QuestionText: text,
+		MaxScore:     999.99,
+		AuthorUserID: 123456789,
+	}
+	if err := db.Create(&q).Error; err != nil {
+		t.Fatal(err)
+	}
+	return assignment, q
+}
+
+// createAnswer creates the answer of the user to the question.
+func createAnswer(q model.Question, assignmentID, uid int) model.Answer {
+	sa := model.StudentAssignment{UserID: uid, AssignmentID: assignmentID}
+	db.Create(&sa)
+	a := model.Answer{
+		QuestionID:          model.NewNullInt64(q.ID),
+		SubmissionTime:      *parseTime("2018-09-30 12:42"),
+		StudentAssignmentID: sa.ID,
+	}
+	db.Create(&a)
+	return a
+}
+
+// importWorkbook imports the answer file of the user to the question.
+func importWorkbook(t *testing.T, q model.Question, assignmentID, uid int, fileName string) (model.Answer, model.Workbook) {
+	a := createAnswer(q, assignmentID, uid)
+	wb, err := model.ExtractBlocksFromFile(fileName, "FFFFFF00", true, true, true, a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, wb
+}
+
+// importAnswer imports the answer file of the user to the question.
+func importAnswer(t *testing.T, q model.Question, assignmentID, uid int, fileName string) model.Answer {
+	a, _ := importWorkbook(t, q, assignmentID, uid, fileName)
+	return a
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"extract-blocks/cmd"
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestPalette tests the block categories given with the block color palette.
+func TestPalette(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	fileName := "Palette.xlsx"
+
+	cmd.RootCmd.SetArgs([]string{
+		"run", "-U", url, "-t", "-f",
+		"--palette", "FFFFFF00=calculation,FF00FF00=input,FF0000FF=formatting",
+		fileName})
+	cmd.Execute()
+	cmd.RootCmd.PersistentFlags().Set("palette", "")
+
+	var blocks []model.Block
+	db.
+		Joins("JOIN WorkSheets AS ws ON ws.id = ExcelBlocks.worksheet_id").
+		Joins("JOIN WorkBooks AS wb ON wb.id = ws.workbook_id").
+		Where("wb.file_name = ? AND ExcelBlocks.BlockCellRange != ''", fileName).
+		Order("ExcelBlocks.BlockCellRange").
+		Find(&blocks)
+	expected := map[string]model.BlockCategory{
+		"A1:A1": model.FormattingBlock,
+		"B2:B3": model.InputBlock,
+		"C2:C3": model.CalculationBlock,
+	}
+	if len(blocks) != len(expected) {
+		t.Fatalf("Expected %d blocks, got: %#v", len(expected), blocks)
+	}
+	for _, b := range blocks {
+		if c, ok := expected[b.Range]; !ok || b.Category != c {
+			t.Errorf("Expected the block %q to be %q, got: %q", b.Range, c, b.Category)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestPivotTableCapture tests the import of the pivot table layout, filters,
+// "show values as" settings and the calculated fields and items.
+func TestPivotTableCapture(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Pivot Tables...")
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, "pivot_full.xlsx")
+
+	var ds model.DataSource
+	if db.
+		Joins("JOIN WorkSheets AS ws ON ws.id = DataSources.worksheet_id").
+		Where("ws.workbook_id = ? AND DataSources.name = ?", wb.ID, "PivotTable2").
+		First(&ds).RecordNotFound() {
+		t.Fatal("The pivot table data source is missing")
+	}
+
+	var options model.PivotOptions
+	db.Where("DataSourceId = ?", ds.ID).First(&options)
+	if expected := (model.PivotOptions{
+		ID:             options.ID,
+		DataSourceID:   ds.ID,
+		Location:       "A4:AH18",
+		Layout:         "tabular",
+		RowGrandTotals: true,
+		SourceSheet:    "Sheet1",
+		SourceRange:    "A1:J8",
+		RecordCount:    7,
+	}); options != expected {
+		t.Errorf("Expected the pivot table options %#v, got: %#v", expected, options)
+	}
+
+	var fields []model.PivotTable
+	db.Where("DataSourceId = ?", ds.ID).Order("id").Find(&fields)
+	if len(fields) != 13 {
+		t.Fatalf("Expected 13 pivot table entries, got: %#v", fields)
+	}
+	for i, expected := range []model.PivotTable{
+		{Type: "Filter", Label: "Month", SelectedItems: "2009-02-01"},
+		{Type: "Filter", Label: "Course", SelectedItems: "CAT,MAT"},
+		{Type: "Row", Label: "Salesman", HiddenItems: "Devasis"},
+		{Type: "Row", Label: "Category", Filter: "captionNotEqual,Prep"},
+		{Type: "Column", Label: "Continent"},
+		{Type: "Column", Label: "Country"},
+		{Type: "Column", Label: "Region"},
+		{Type: "Value", Label: "Net Sales", Function: "sum", DisplayName: "Summation Sales",
+			ShowDataAs: "difference", BaseField: "Salesman", BaseItem: "Bishnu"},
+		{Type: "Value", Label: "Profit", Function: "average", DisplayName: "Average of ALL Profit",
+			ShowDataAs: "percentOfTotal"},
+		{Type: "Value", Label: "No. Customers", Function: "count", DisplayName: "Count of Customers"},
+		{Type: "Value", Label: "Margin", Function: "sum", DisplayName: "Sum of Margin"},
+		{Type: "CalculatedField", Label: "Margin", Formula: "Profit/'Net Sales'"},
+		{Type: "CalculatedItem", Label: "Region", DisplayName: "North", Formula: "Kashmir+Punjab"},
+	} {
+		f := fields[i]
+		expected.ID, expected.DataSourceID = f.ID, ds.ID
+		if f != expected {
+			t.Errorf("Expected the pivot table entry %#v, got: %#v", expected, f)
+		}
+	}
+
+	for r, expected := range map[string]string{
+		"PivotLayout":     "tabular",
+		"GrandTotals":     "rows",
+		"HiddenItems":     "Salesman,Devasis",
+		"FieldFilter":     "Category,captionNotEqual,Prep",
+		"CalculatedField": "Margin=Profit/'Net Sales'",
+		"CalculatedItem":  "Region,North=Kashmir+Punjab",
+	} {
+		var cell model.Cell
+		db.Where("worksheet_id = ? AND cell_type = ? AND cell_range = ?", ds.WorksheetID, "Pivot", r).First(&cell)
+		if cell.Formula != expected {
+			t.Errorf("Expected the pivot auxiliary cell %q with %q, got: %q", r, expected, cell.Formula)
+		}
+	}
+	var count int
+	db.Model(&model.Cell{}).
+		Where("worksheet_id = ? AND cell_type = ? AND cell_range = ?", ds.WorksheetID, "Pivot", "ShowValuesAs").
+		Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 \"show values as\" auxiliary cells, got: %d", count)
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestSharedAndArrayFormulas tests the extraction of the shared and array formula blocks.
+func TestSharedAndArrayFormulas(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	const fileName = "shared_and_array_formulas.xlsx"
+	qf := model.Source{FileName: fileName, S3BucketName: "studentanswers"}
+	db.Create(&qf)
+	q := model.Question{
+		SourceID:     model.NewNullInt64(qf.ID),
+		QuestionType: model.QuestionType("FileUpload"),
+		QuestionText: "Test Shared and Array Formulas...",
+		MaxScore:     999.99,
+		AuthorUserID: 123456789,
+	}
+	if err := db.Create(&q).Error; err != nil {
+		t.Error(err)
+	}
+	if err := q.ImportFile(fileName, "FFFFFF00", true, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct{ cellRange, formula string }{
+		{"B3", "A3*2"},
+		{"D1", "A1:A5*3"},
+		{"D3", "A1:A5*3"}, // a spilled cell
+		{"F3", "LOG10(A3)"},
+	} {
+		var qed model.QuestionExcelData
+		db.First(&qed, "QuestionID = ? AND CellRange = ?", q.ID, r.cellRange)
+		if qed.Formula != r.formula {
+			t.Errorf("Expected formula %q of the cell %s, got %q", r.formula, r.cellRange, qed.Formula)
+		}
+	}
+
+	assignment := model.Assignment{Title: "Test Shared and Array Formulas...", State: "READY_FOR_GRADING"}
+	db.Create(&assignment)
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, fileName)
+
+	db.First(&q, q.ID)
+	for _, workbookID := range []int{int(q.ReferenceID.Int64), wb.ID} {
+		var blocks []model.Block
+		db.Joins("JOIN WorkSheets AS ws ON ws.id = ExcelBlocks.worksheet_id").
+			Where("ws.workbook_id = ?", workbookID).
+			Order("ExcelBlocks.BlockCellRange").
+			Find(&blocks)
+		if len(blocks) != 3 {
+			t.Errorf("Expected 3 blocks (workbook ID: %d), got: %v", workbookID, blocks)
+			continue
+		}
+		for i, expected := range []string{"B1:B5", "D1:D5", "F1:F5"} {
+			if b := blocks[i]; b.Range != expected || b.IsArray != (expected == "D1:D5") {
+				t.Errorf("Expected block %s (workbook ID: %d), got: %s (array: %v)", expected, workbookID, b, b.IsArray)
+			}
+		}
+	}
+
+	var cell model.Cell
+	db.Joins("JOIN WorkSheets AS ws ON ws.id = Cells.worksheet_id").
+		First(&cell, "ws.workbook_id = ? AND Cells.cell_range = ?", wb.ID, "D4")
+	if cell.Formula != "A1:A5*3" || cell.Value != "120" {
+		t.Errorf("Expected the spilled cell D4 with the array formula, got: %#v", cell)
+	}
+}
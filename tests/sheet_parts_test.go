@@ -0,0 +1,40 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestSheetParts tests the import of a workbook with the sheet parts that don't follow
+// the sheetN.xml naming and the order of the sheets in the workbook.
+func TestSheetParts(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Sheet Parts...")
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, "sheet_parts.xlsx")
+
+	for idx, name := range []string{"Data", "Sales"} {
+		var ws model.Worksheet
+		if db.Where("workbook_id = ? AND name = ?", wb.ID, name).First(&ws).RecordNotFound() {
+			t.Fatalf("The worksheet %q entry is missing", name)
+		}
+		if ws.Idx != idx+1 {
+			t.Errorf("Expected the worksheet %q at the position %d, got: %d", name, idx+1, ws.Idx)
+		}
+		var charts, filters int
+		db.Model(&model.Chart{}).Where("worksheet_id = ?", ws.ID).Count(&charts)
+		db.Model(&model.Cell{}).Where("worksheet_id = ? AND cell_type = ?", ws.ID, "Filter").Count(&filters)
+		switch name {
+		case "Data":
+			if charts != 0 || filters == 0 {
+				t.Errorf("Expected the filter and no charts on %q, got: %d charts, %d filter cells", name, charts, filters)
+			}
+		case "Sales":
+			if charts != 1 || filters != 0 {
+				t.Errorf("Expected 1 chart and no filters on %q, got: %d charts, %d filter cells", name, charts, filters)
+			}
+		}
+	}
+}
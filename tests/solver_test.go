@@ -0,0 +1,98 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// answerSolverModels returns the verified Solver models of the answer.
+func answerSolverModels(answerID int) (models []model.SolverVerification) {
+	db.
+		Select("SolverVerifications.*").
+		Joins("JOIN WorkSheets AS ws ON ws.id = SolverVerifications.worksheet_id").
+		Where("ws.StudentAnswerID = ?", answerID).
+		Order("ws.idx").
+		Find(&models)
+	return
+}
+
+func TestSolverVerification(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Solver...")
+
+	// the Solver models get re-solved as linear programs
+	for _, c := range []struct {
+		fileName string
+		status   []string
+		optimal  []bool
+		solution []string
+	}{
+		{"Solver Simple Question.xlsx", nil, nil, nil},
+		{"Stud1 Solver Simple.xlsx", []string{"optimal"}, []bool{true}, []string{"C6=3,C7=2"}},
+		{"stud2-solver-multi-sheet.xlsx", []string{"optimal", "optimal"}, []bool{true, true},
+			[]string{"B1=4,B2=5,B3=1", "B1=2,B2=2,B3=6,B4=4"}},
+		{"Solver max.xlsx", []string{"optimal"}, []bool{true}, []string{"C6=5,C7=4"}},
+		{"Solver max not optimal.xlsx", []string{"optimal"}, []bool{false}, []string{"C6=5,C7=4"}},
+		{"Solver not linear.xlsx", []string{"not linear"}, []bool{false}, []string{""}},
+	} {
+		a := importAnswer(t, q, assignment.ID, 4951, c.fileName)
+		models := answerSolverModels(a.ID)
+		if len(models) != len(c.status) {
+			t.Errorf("Expected %d Solver model(s) in %q, got: %d", len(c.status), c.fileName, len(models))
+			continue
+		}
+		for i, v := range models {
+			if v.Status != c.status[i] || v.IsOptimal.Bool != c.optimal[i] || v.Solution != c.solution[i] {
+				t.Errorf("Expected the Solver model %q of %q to be %s (optimal: %v, solution: %q), got: %s (optimal: %v, solution: %q)",
+					v.Structure, c.fileName, c.status[i], c.optimal[i], c.solution[i], v.Status, v.IsOptimal.Bool, v.Solution)
+			}
+			if c.status[i] == "optimal" && !v.IsFeasible.Bool {
+				t.Errorf("Expected the submitted values of %q to be feasible", c.fileName)
+			}
+		}
+	}
+
+	// the structure gets compared with the Solver set up of the model answer
+	ma := importAnswer(t, q, assignment.ID, 10000, "Solver max.xlsx")
+	for _, c := range []struct {
+		fileName string
+		isSame   bool
+	}{
+		{"Solver max.xlsx", true},
+		{"Solver max not optimal.xlsx", true},
+		{"Stud1 Solver Simple.xlsx", false},
+	} {
+		a := ma
+		if c.fileName != "Solver max.xlsx" {
+			a = importAnswer(t, q, assignment.ID, 4952, c.fileName)
+		}
+		if _, err := model.EvaluateSolverModels(a.ID, 10000); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range answerSolverModels(a.ID) {
+			if v.IsSameStructure.Bool != c.isSame {
+				t.Errorf("Expected the Solver model %q of %q to have the same structure: %v", v.Structure, c.fileName, c.isSame)
+			}
+		}
+	}
+
+	// the student answer misses the integer constraint
+	base := "data/missing-or-partial/Solver/"
+	q.ID = 0
+	if err := db.Create(&q).Error; err != nil {
+		t.Error(err)
+	}
+	importAnswer(t, q, assignment.ID, 10000, base+"Solver ModelAnswer.xlsx")
+	a := importAnswer(t, q, assignment.ID, 4953, base+"Solver StudentlAnswer.xlsx")
+	if n, err := model.EvaluateSolverModels(a.ID, 10000); err != nil || n != 1 {
+		t.Fatalf("Expected a single evaluated Solver model, got: %d, %v", n, err)
+	}
+	for _, v := range answerSolverModels(a.ID) {
+		if !v.IsOptimal.Bool || v.IsSameStructure.Bool {
+			t.Errorf("Expected the Solver model %q to be optimal, but with a different structure", v.Structure)
+		}
+	}
+}
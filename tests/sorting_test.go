@@ -0,0 +1,85 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// answerSortings returns the sort levels of the answer worksheet.
+func answerSortings(answerID int, sheetName string) (sortings []model.Sorting) {
+	db.
+		Select("Sortings.*").
+		Joins("JOIN DataSources AS ds ON ds.id = Sortings.DataSourceID").
+		Joins("JOIN WorkSheets AS ws ON ws.id = ds.worksheet_id").
+		Where("ws.StudentAnswerID = ? AND ws.name = ?", answerID, sheetName).
+		Order("Sortings.id").
+		Find(&sortings)
+	return
+}
+
+func TestSorting(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Sorting...")
+	a := importAnswer(t, q, assignment.ID, 10000, "Sorting ALL TYPES.xlsx")
+	levels := answerSortings(a.ID, "Q2")
+	if len(levels) != 10 {
+		t.Fatalf("Expected 10 sort levels, got: %d", len(levels))
+	}
+	for i, c := range []struct {
+		reference, sortType, sortBy, color, customList string
+	}{
+		{"D2:D98", "ascending", "cellColor", "FFB7DEE8", ""},
+		{"D2:D98", "descending", "cellColor", "FFFCD5B4", ""},
+		{"G2:G98", "ascending", "fontColor", "FFFF0000", ""},
+		{"G2:G98", "descending", "fontColor", "FFE46C0A", ""},
+		{"H2:H98", "ascending", "", "", "Sun,Mon,Tue,Wed,Thu,Fri,Sat"},
+		{"A2:A98", "ascending", "", "", ""},
+		{"B2:B98", "ascending", "", "", ""},
+		{"C2:C98", "descending", "", "", ""},
+		{"E2:E98", "ascending", "", "", ""},
+		{"F2:F98", "descending", "", "", ""},
+	} {
+		l := levels[i]
+		if l.Level != i+1 || l.Method != "Vertical" || l.Reference != c.reference || l.Type != c.sortType ||
+			l.SortBy != c.sortBy || l.Color != c.color || l.CustomList != c.customList {
+			t.Errorf("Unexpected sort level %d: %#v", i+1, l)
+		}
+		if !l.IsOrdered.Valid || !l.IsOrdered.Bool || l.IsInferred {
+			t.Errorf("Expected the data ordered by the level %d: %#v", i+1, l)
+		}
+	}
+
+	a = importAnswer(t, q, assignment.ID, 10000, "Sorting Horizontal.xlsx")
+	levels = answerSortings(a.ID, "Sheet2")
+	if len(levels) != 4 {
+		t.Fatalf("Expected 4 sort levels, got: %d", len(levels))
+	}
+	for _, l := range levels {
+		if l.Method != "Horizontal" || !l.IsOrdered.Bool || l.IsInferred {
+			t.Errorf("Expected the data ordered by the horizontal sort level: %#v", l)
+		}
+	}
+
+	// the answers without the sort state get verified against the model answer sorting
+	a = importAnswer(t, q, assignment.ID, 4951, "Sorting Horizontal inferred.xlsx")
+	inferred := answerSortings(a.ID, "Sheet2")
+	if len(inferred) != len(levels) {
+		t.Fatalf("Expected %d inferred sort levels, got: %d", len(levels), len(inferred))
+	}
+	for i, l := range inferred {
+		if !l.IsInferred || !l.IsOrdered.Bool || l.Reference != levels[i].Reference || l.Type != levels[i].Type {
+			t.Errorf("Expected the inferred sort level %#v, got: %#v", levels[i], l)
+		}
+	}
+	a = importAnswer(t, q, assignment.ID, 4952, "Sorting Horizontal unsorted.xlsx")
+	if inferred := answerSortings(a.ID, "Sheet2"); len(inferred) != 0 {
+		t.Errorf("Expected no sorting inferred of the unsorted data, got: %#v", inferred)
+	}
+	a = importAnswer(t, q, assignment.ID, 4953, "Sorting Horizontal empty.xlsx")
+	if inferred := answerSortings(a.ID, "Sheet2"); len(inferred) != 0 {
+		t.Errorf("Expected no sorting inferred of the empty worksheet, got: %#v", inferred)
+	}
+}
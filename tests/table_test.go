@@ -0,0 +1,81 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestTables tests the import of the Excel tables and the resolution of the structured references.
+func TestTables(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test Tables...")
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, "tables.xlsx")
+
+	var tables []model.Table
+	db.Preload("Columns").
+		Joins("JOIN WorkSheets AS ws ON ws.id = ExcelTables.worksheet_id").
+		Where("ws.workbook_id = ?", wb.ID).
+		Find(&tables)
+	if len(tables) != 1 {
+		t.Fatalf("Expected 1 table, got: %d", len(tables))
+	}
+	table := tables[0]
+	if table.Name != "Sales" || table.Range != "A1:D5" || table.HeaderRowCount != 1 || table.TotalsRowCount != 1 ||
+		!table.HasAutoFilter || table.Style != "TableStyleMedium2" || !table.ShowRowStripes || table.ShowColumnStripes {
+		t.Errorf("Unexpected table entry: %#v", table)
+	}
+	if len(table.Columns) != 4 {
+		t.Fatalf("Expected 4 table columns, got: %#v", table.Columns)
+	}
+	if c := table.Columns[3]; c.Name != "Total" || c.Idx != 3 || c.TotalsRowFunction != "sum" ||
+		c.CalculatedColumnFormula != "Sales[[#This Row],[Qty]]*Sales[[#This Row],[Price]]" {
+		t.Errorf("Unexpected table column entry: %#v", c)
+	}
+	if c := table.Columns[0]; c.TotalsRowLabel != "Total" {
+		t.Errorf("Unexpected table column entry: %#v", c)
+	}
+
+	for sheet, formulas := range map[string]map[string]string{
+		"Data": {
+			"D2": "B2*C2",
+			"D4": "B4*C4",
+			"B5": "SUBTOTAL(109,B2:B4)",
+			"D5": "SUBTOTAL(109,D2:D4)",
+		},
+		"Report": {"B1": "AVERAGE(Data!C2:C4)"},
+	} {
+		for r, expected := range formulas {
+			var cell model.Cell
+			db.Joins("JOIN WorkSheets AS ws ON ws.id = Cells.worksheet_id").
+				Where("ws.workbook_id = ? AND ws.name = ? AND Cells.cell_range = ?", wb.ID, sheet, r).
+				First(&cell)
+			if cell.Formula != expected {
+				t.Errorf("Expected the formula of %s!%s to be %q, got: %q", sheet, r, expected, cell.Formula)
+			}
+		}
+	}
+	for r, expected := range map[string]string{
+		"D2": "Sales[[#This Row],[Qty]]*Sales[[#This Row],[Price]]",
+		"B5": "SUBTOTAL(109,Sales[Qty])",
+	} {
+		var cell model.Cell
+		db.Joins("JOIN WorkSheets AS ws ON ws.id = Cells.worksheet_id").
+			Where("ws.workbook_id = ? AND ws.name = ? AND Cells.cell_range = ?", wb.ID, "Data", r).
+			First(&cell)
+		if cell.OriginalFormula != expected {
+			t.Errorf("Expected the original formula of Data!%s to be %q, got: %q", r, expected, cell.OriginalFormula)
+		}
+	}
+
+	var count int
+	db.Model(&model.Block{}).
+		Joins("JOIN WorkSheets AS ws ON ws.id = ExcelBlocks.worksheet_id").
+		Where("ws.workbook_id = ? AND ws.name = ? AND ExcelBlocks.BlockCellRange = ?", wb.ID, "Data", "D2:D4").
+		Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the calculated column to be extracted as a single block D2:D4, got: %d", count)
+	}
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	model "extract-blocks/model"
+	"testing"
+)
+
+// TestWhatIfAnalysis tests the import of the scenarios, the data tables and the detection of Goal Seek.
+func TestWhatIfAnalysis(t *testing.T) {
+
+	db = createTestDB()
+	defer closeTestDB()
+
+	assignment, q := createQuestion(t, "Test What-If...")
+	_, mwb := importWorkbook(t, q, assignment.ID, model.ModelAnswerUserID, "what_if.xlsx")
+	_, wb := importWorkbook(t, q, assignment.ID, 4951, "what_if.xlsx")
+	var ws model.Worksheet
+	db.Where("workbook_id = ? AND name = ?", wb.ID, "Loan").First(&ws)
+
+	var scenarios []model.Scenario
+	db.Preload("InputCells").Where("worksheet_id = ?", ws.ID).Order("id").Find(&scenarios)
+	if len(scenarios) != 2 {
+		t.Fatalf("Expected 2 scenarios, got: %#v", scenarios)
+	}
+	if s := scenarios[0]; s.Name != "Best" || !s.IsLocked || s.IsCurrent || s.User != "Tutor" ||
+		s.Comment != "Low rate" || s.ResultCells != "B4" || len(s.InputCells) != 2 ||
+		s.InputCells[0].String() != "B1=0.04" || s.InputCells[1].String() != "B2=5" {
+		t.Errorf("Unexpected scenario: %#v", s)
+	}
+	if s := scenarios[1]; s.Name != "Worst" || s.IsLocked || !s.IsCurrent || len(s.InputCells) != 2 {
+		t.Errorf("Unexpected scenario: %#v", s)
+	}
+
+	var dataTables []model.DataTable
+	db.Where("worksheet_id = ?", ws.ID).Order("id").Find(&dataTables)
+	if len(dataTables) != 2 {
+		t.Fatalf("Expected 2 data tables, got: %#v", dataTables)
+	}
+	if dt := dataTables[0]; dt.Range != "B11:B13" || dt.Formula != "TABLE(,B1)" || dt.Is2D ||
+		dt.RowInputCell != "" || dt.ColumnInputCell != "B1" {
+		t.Errorf("Unexpected one-variable data table: %#v", dt)
+	}
+	if dt := dataTables[1]; dt.Range != "F11:G12" || dt.Formula != "TABLE(B2,B1)" || !dt.Is2D ||
+		dt.RowInputCell != "B2" || dt.ColumnInputCell != "B1" {
+		t.Errorf("Unexpected two-variable data table: %#v", dt)
+	}
+	for r, expected := range map[string]string{
+		"B11:B13": "TABLE(,B1)",
+		"F11:G12": "TABLE(B2,B1)",
+	} {
+		var b model.Block
+		db.Where("worksheet_id = ? AND BlockCellRange = ?", ws.ID, r).First(&b)
+		if b.Formula != expected || !b.IsArray {
+			t.Errorf("Expected the data table block %s with the formula %q, got: %#v", r, expected, b)
+		}
+	}
+
+	var mws model.Worksheet
+	db.Where("workbook_id = ? AND name = ?", mwb.ID, "Loan").First(&mws)
+	for _, id := range []int{mws.ID, ws.ID} {
+		var goalSeeks []model.GoalSeek
+		db.Where("worksheet_id = ?", id).Find(&goalSeeks)
+		if len(goalSeeks) != 1 {
+			t.Fatalf("Expected 1 Goal Seek, got: %#v", goalSeeks)
+		}
+		if gs := goalSeeks[0]; gs.TargetCell != "D2" || gs.TargetValue != "100" || gs.ChangingCell != "D1" {
+			t.Errorf("Unexpected Goal Seek: %#v", gs)
+		}
+	}
+
+	var count int
+	db.Model(&model.Cell{}).Where("worksheet_id = ? AND cell_type = ?", ws.ID, "WhatIf").Count(&count)
+	if count != 6 {
+		t.Errorf("Expected 6 what-if auxiliary cells, got: %d", count)
+	}
+
+	// the target value differs from the model answer and the other "non-round" value
+	// isn't a Goal Seek result of the model answer
+	_, wb = importWorkbook(t, q, assignment.ID, 4952, "what_if student.xlsx")
+	var sws model.Worksheet
+	db.Where("workbook_id = ? AND name = ?", wb.ID, "Loan").First(&sws)
+	var goalSeeks []model.GoalSeek
+	db.Where("worksheet_id = ?", sws.ID).Find(&goalSeeks)
+	if sws.ID == 0 || len(goalSeeks) != 0 {
+		t.Errorf("Expected no Goal Seek, got: %#v", goalSeeks)
+	}
+}